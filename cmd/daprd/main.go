@@ -126,6 +126,13 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == runtime.DrainCommand {
+		if err := runtime.Drain(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	rt, err := runtime.FromFlags()
 	if err != nil {
 		log.Fatal(err)
@@ -429,9 +436,12 @@ func main() {
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
-	<-stop
-	gracefulShutdownDuration := 5 * time.Second
-	log.Info("dapr shutting down. Waiting 5 seconds to finish outstanding operations")
+	select {
+	case <-stop:
+	case <-rt.AppExited():
+	}
+	gracefulShutdownDuration := rt.GracefulShutdownDuration()
+	log.Infof("dapr shutting down. Waiting %s to finish outstanding operations", gracefulShutdownDuration)
 	rt.Stop()
 	<-time.After(gracefulShutdownDuration)
 }
@@ -22,19 +22,23 @@ var log = logger.NewLogger("dapr.operator")
 var config string
 var certChainPath string
 var disableLeaderElection bool
+var annotationPrefix string
 
 const (
 	defaultCredentialsPath = "/var/run/dapr/credentials"
 
 	// defaultDaprSystemConfigName is the default resource object name for Dapr System Config
 	defaultDaprSystemConfigName = "daprsystem"
+
+	// defaultAnnotationPrefix is the default domain of the Dapr annotations
+	defaultAnnotationPrefix = "dapr.io"
 )
 
 func main() {
 	log.Infof("starting Dapr Operator -- version %s -- commit %s", version.Version(), version.Commit())
 
 	ctx := signals.Context()
-	operator.NewOperator(config, certChainPath, !disableLeaderElection).Run(ctx)
+	operator.NewOperator(config, certChainPath, !disableLeaderElection, annotationPrefix).Run(ctx)
 
 	shutdownDuration := 5 * time.Second
 	log.Infof("allowing %s for graceful shutdown to complete", shutdownDuration)
@@ -57,6 +61,7 @@ func init() {
 	flag.StringVar(&certChainPath, "certchain", defaultCredentialsPath, "Path to the credentials directory holding the cert chain")
 
 	flag.BoolVar(&disableLeaderElection, "disable-leader-election", false, "Disable leader election for controller manager. ")
+	flag.StringVar(&annotationPrefix, "annotation-prefix", defaultAnnotationPrefix, "Domain of the Dapr annotations on deployments, matching the sidecar injector")
 
 	flag.Parse()
 
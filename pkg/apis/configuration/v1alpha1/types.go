@@ -36,6 +36,8 @@ type ConfigurationSpec struct {
 	Secrets SecretsSpec `json:"secrets,omitempty"`
 	// +optional
 	AccessControlSpec AccessControlSpec `json:"accessControl,omitempty"`
+	// +optional
+	LoggingSpec LoggingSpec `json:"logging,omitempty"`
 }
 
 // SecretsSpec is the spec for secrets configuration
@@ -75,6 +77,12 @@ type MTLSSpec struct {
 	AllowedClockSkew string `json:"allowedClockSkew"`
 }
 
+// LoggingSpec defines logging configuration
+type LoggingSpec struct {
+	// +optional
+	MinLevel string `json:"minLevel,omitempty"`
+}
+
 // SelectorSpec selects target services to which the handler is to be applied
 type SelectorSpec struct {
 	Fields []SelectorField `json:"fields"`
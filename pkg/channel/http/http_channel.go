@@ -42,9 +42,10 @@ type Channel struct {
 	appHeaderToken string
 }
 
-// CreateLocalChannel creates an HTTP AppChannel
+// CreateLocalChannel creates an HTTP AppChannel. When SSL is enabled, the given client certificates
+// are presented to the app.
 // nolint:gosec
-func CreateLocalChannel(port, maxConcurrency int, spec config.TracingSpec, sslEnabled bool) (channel.AppChannel, error) {
+func CreateLocalChannel(port, maxConcurrency int, spec config.TracingSpec, sslEnabled bool, clientCerts ...tls.Certificate) (channel.AppChannel, error) {
 	scheme := httpScheme
 	if sslEnabled {
 		scheme = httpsScheme
@@ -61,7 +62,7 @@ func CreateLocalChannel(port, maxConcurrency int, spec config.TracingSpec, sslEn
 	}
 
 	if sslEnabled {
-		c.client.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+		c.client.TLSConfig = &tls.Config{InsecureSkipVerify: true, Certificates: clientCerts}
 	}
 
 	if maxConcurrency > 0 {
@@ -7,6 +7,7 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -329,6 +330,15 @@ func TestCreateChannel(t *testing.T) {
 		assert.Equal(t, b, "https://127.0.0.1:3000")
 	})
 
+	t.Run("ssl with a client certificate", func(t *testing.T) {
+		cert := tls.Certificate{Certificate: [][]byte{[]byte("cert")}}
+		ch, err := CreateLocalChannel(3000, 0, config.TracingSpec{}, true, cert)
+		assert.NoError(t, err)
+
+		c := ch.(*Channel)
+		assert.Equal(t, []tls.Certificate{cert}, c.client.TLSConfig.Certificates)
+	})
+
 	t.Run("non-ssl scheme", func(t *testing.T) {
 		ch, err := CreateLocalChannel(3000, 0, config.TracingSpec{}, false)
 		assert.NoError(t, err)
@@ -7,6 +7,8 @@ package diagnostics
 
 import (
 	"context"
+	"io"
+	"sync"
 	"time"
 
 	diag_utils "github.com/dapr/dapr/pkg/diagnostics/utils"
@@ -219,3 +221,75 @@ func (g *grpcMetrics) UnaryClientInterceptor() func(ctx context.Context, method
 		return err
 	}
 }
+
+// StreamClientInterceptor is a gRPC client-side interceptor for Streaming RPCs.
+// A stream is recorded once it ends, with the bytes sent and received across all its messages.
+func (g *grpcMetrics) StreamClientInterceptor() func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			g.ClientRequestSent(ctx, method, 0)
+			g.ClientRequestRecieved(ctx, method, status.Code(err).String(), 0, start)
+			return nil, err
+		}
+		return &monitoredClientStream{ClientStream: stream, metrics: g, method: method, start: start}, nil
+	}
+}
+
+// monitoredClientStream counts the bytes of the messages of a client stream, and records them
+// when the stream ends.
+type monitoredClientStream struct {
+	grpc.ClientStream
+
+	metrics *grpcMetrics
+	method  string
+	start   time.Time
+
+	lock          sync.Mutex
+	sentBytes     int64
+	receivedBytes int64
+	done          bool
+}
+
+func (s *monitoredClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.lock.Lock()
+		s.sentBytes += int64(s.metrics.getPayloadSize(m))
+		s.lock.Unlock()
+	} else if err != io.EOF {
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *monitoredClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == nil:
+		s.lock.Lock()
+		s.receivedBytes += int64(s.metrics.getPayloadSize(m))
+		s.lock.Unlock()
+	case err == io.EOF:
+		s.finish(nil)
+	default:
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *monitoredClientStream) finish(err error) {
+	s.lock.Lock()
+	if s.done {
+		s.lock.Unlock()
+		return
+	}
+	s.done = true
+	sent, received := s.sentBytes, s.receivedBytes
+	s.lock.Unlock()
+
+	ctx := s.Context()
+	s.metrics.ClientRequestSent(ctx, s.method, sent)
+	s.metrics.ClientRequestRecieved(ctx, s.method, status.Code(err).String(), received, s.start)
+}
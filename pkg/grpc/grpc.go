@@ -52,9 +52,10 @@ func (g *Manager) SetAuthenticator(auth security.Authenticator) {
 	g.auth = auth
 }
 
-// CreateLocalChannel creates a new gRPC AppChannel
-func (g *Manager) CreateLocalChannel(port, maxConcurrency int, spec config.TracingSpec, sslEnabled bool) (channel.AppChannel, error) {
-	conn, err := g.GetGRPCConnection(fmt.Sprintf("127.0.0.1:%v", port), "", "", true, false, sslEnabled)
+// CreateLocalChannel creates a new gRPC AppChannel. When SSL is enabled, the given client
+// certificates are presented to the app.
+func (g *Manager) CreateLocalChannel(port, maxConcurrency int, spec config.TracingSpec, sslEnabled bool, clientCerts ...tls.Certificate) (channel.AppChannel, error) {
+	conn, err := g.getGRPCConnection(fmt.Sprintf("127.0.0.1:%v", port), "", "", true, false, sslEnabled, clientCerts)
 	if err != nil {
 		return nil, errors.Errorf("error establishing connection to app grpc on port %v: %s", port, err)
 	}
@@ -66,6 +67,10 @@ func (g *Manager) CreateLocalChannel(port, maxConcurrency int, spec config.Traci
 
 // GetGRPCConnection returns a new grpc connection for a given address and inits one if doesn't exist
 func (g *Manager) GetGRPCConnection(address, id string, namespace string, skipTLS, recreateIfExists, sslEnabled bool) (*grpc.ClientConn, error) {
+	return g.getGRPCConnection(address, id, namespace, skipTLS, recreateIfExists, sslEnabled, nil)
+}
+
+func (g *Manager) getGRPCConnection(address, id string, namespace string, skipTLS, recreateIfExists, sslEnabled bool, clientCerts []tls.Certificate) (*grpc.ClientConn, error) {
 	if val, ok := g.connectionPool[address]; ok && !recreateIfExists {
 		return val, nil
 	}
@@ -115,6 +120,7 @@ func (g *Manager) GetGRPCConnection(address, id string, namespace string, skipTL
 		// nolint:gosec
 		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
 			InsecureSkipVerify: true,
+			Certificates:       clientCerts,
 		})))
 	}
 
@@ -10,6 +10,8 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/dapr/components-contrib/bindings"
 	"github.com/dapr/components-contrib/pubsub"
@@ -41,6 +43,7 @@ import (
 type API interface {
 	APIEndpoints() []Endpoint
 	MarkStatusAsReady()
+	MarkComponentsAsReady()
 	SetAppChannel(appChannel channel.AppChannel)
 	SetDirectMessaging(directMessaging messaging.DirectMessaging)
 	SetActorRuntime(actor actors.Actors)
@@ -60,8 +63,11 @@ type api struct {
 	sendToOutputBindingFn func(name string, req *bindings.InvokeRequest) (*bindings.InvokeResponse, error)
 	id                    string
 	extendedMetadata      sync.Map
-	readyStatus           bool
+	readyStatus           int32
+	componentsReady       int32
+	draining              int32
 	tracingSpec           config.TracingSpec
+	maxDrainDuration      time.Duration
 }
 
 type registeredComponent struct {
@@ -79,6 +85,8 @@ type metadata struct {
 
 const (
 	apiVersionV1         = "v1.0"
+	healthzRoute         = "healthz"
+	drainRoute           = "drain"
 	idParam              = "id"
 	methodParam          = "method"
 	topicParam           = "topic"
@@ -92,6 +100,7 @@ const (
 	consistencyParam     = "consistency"
 	concurrencyParam     = "concurrency"
 	pubsubnameparam      = "pubsubname"
+	drainSecondsParam    = "seconds"
 	traceparentHeader    = "traceparent"
 	tracestateHeader     = "tracestate"
 )
@@ -108,7 +117,8 @@ func NewAPI(
 	pubsubAdapter runtime_pubsub.Adapter,
 	actor actors.Actors,
 	sendToOutputBindingFn func(name string, req *bindings.InvokeRequest) (*bindings.InvokeResponse, error),
-	tracingSpec config.TracingSpec) API {
+	tracingSpec config.TracingSpec,
+	maxDrainDuration time.Duration) API {
 	api := &api{
 		appChannel:            appChannel,
 		directMessaging:       directMessaging,
@@ -121,6 +131,7 @@ func NewAPI(
 		sendToOutputBindingFn: sendToOutputBindingFn,
 		id:                    appID,
 		tracingSpec:           tracingSpec,
+		maxDrainDuration:      maxDrainDuration,
 	}
 	api.components = components
 	api.endpoints = append(api.endpoints, api.constructStateEndpoints()...)
@@ -131,6 +142,7 @@ func NewAPI(
 	api.endpoints = append(api.endpoints, api.constructMetadataEndpoints()...)
 	api.endpoints = append(api.endpoints, api.constructBindingsEndpoints()...)
 	api.endpoints = append(api.endpoints, api.constructHealthzEndpoints()...)
+	api.endpoints = append(api.endpoints, api.constructDrainEndpoints()...)
 
 	return api
 }
@@ -142,7 +154,12 @@ func (a *api) APIEndpoints() []Endpoint {
 
 // MarkStatusAsReady marks the ready status of dapr
 func (a *api) MarkStatusAsReady() {
-	a.readyStatus = true
+	atomic.StoreInt32(&a.readyStatus, 1)
+}
+
+// MarkComponentsAsReady marks the components of dapr as loaded
+func (a *api) MarkComponentsAsReady() {
+	atomic.StoreInt32(&a.componentsReady, 1)
 }
 
 func (a *api) constructStateEndpoints() []Endpoint {
@@ -304,10 +321,33 @@ func (a *api) constructHealthzEndpoints() []Endpoint {
 	return []Endpoint{
 		{
 			Methods: []string{fasthttp.MethodGet},
-			Route:   "healthz",
+			Route:   healthzRoute,
 			Version: apiVersionV1,
 			Handler: a.onGetHealthz,
 		},
+		{
+			Methods: []string{fasthttp.MethodGet},
+			Route:   "healthz/liveness",
+			Version: apiVersionV1,
+			Handler: a.onGetHealthzLiveness,
+		},
+		{
+			Methods: []string{fasthttp.MethodGet},
+			Route:   "healthz/components",
+			Version: apiVersionV1,
+			Handler: a.onGetHealthzComponents,
+		},
+	}
+}
+
+func (a *api) constructDrainEndpoints() []Endpoint {
+	return []Endpoint{
+		{
+			Methods: []string{fasthttp.MethodPost},
+			Route:   drainRoute,
+			Version: apiVersionV1,
+			Handler: a.onPostDrain,
+		},
 	}
 }
 
@@ -1239,7 +1279,10 @@ func GetStatusCodeFromMetadata(metadata map[string]string) int {
 }
 
 func (a *api) onGetHealthz(reqCtx *fasthttp.RequestCtx) {
-	if !a.readyStatus {
+	if a.respondDraining(reqCtx) {
+		return
+	}
+	if atomic.LoadInt32(&a.readyStatus) == 0 {
 		msg := NewErrorResponse("ERR_HEALTH_NOT_READY", messages.ErrHealthNotReady)
 		respondWithError(reqCtx, fasthttp.StatusInternalServerError, msg)
 		log.Debug(msg)
@@ -1248,6 +1291,71 @@ func (a *api) onGetHealthz(reqCtx *fasthttp.RequestCtx) {
 	}
 }
 
+// onGetHealthzLiveness responds as long as dapr is running, regardless of its readiness. It is
+// meant for liveness probes that shouldn't restart dapr while a dependency such as the placement
+// service is unavailable.
+func (a *api) onGetHealthzLiveness(reqCtx *fasthttp.RequestCtx) {
+	respondEmpty(reqCtx)
+}
+
+// onGetHealthzComponents responds once the components of dapr have been loaded and dapr has
+// finished initializing, so that traffic is only routed once requests using the components can
+// be served. It is meant for readiness probes, so it stops responding once dapr is draining as well.
+func (a *api) onGetHealthzComponents(reqCtx *fasthttp.RequestCtx) {
+	if a.respondDraining(reqCtx) {
+		return
+	}
+	if atomic.LoadInt32(&a.componentsReady) == 0 {
+		msg := NewErrorResponse("ERR_HEALTH_COMPONENTS_NOT_READY", messages.ErrHealthComponentsNotReady)
+		respondWithError(reqCtx, fasthttp.StatusInternalServerError, msg)
+		log.Debug(msg)
+	} else {
+		respondEmpty(reqCtx)
+	}
+}
+
+// respondDraining responds with an error when dapr is draining. Draining is never undone, so
+// marking dapr as ready afterwards doesn't put it back into rotation.
+func (a *api) respondDraining(reqCtx *fasthttp.RequestCtx) bool {
+	if atomic.LoadInt32(&a.draining) == 0 {
+		return false
+	}
+	msg := NewErrorResponse("ERR_HEALTH_NOT_READY", messages.ErrHealthDraining)
+	respondWithError(reqCtx, fasthttp.StatusInternalServerError, msg)
+	log.Debug(msg)
+	return true
+}
+
+// onPostDrain marks dapr as not ready so it is taken out of rotation, then responds once the
+// number of seconds in the query, capped at the graceful shutdown duration, has passed. It is
+// meant for the preStop hook of the sidecar, which runs in the container of dapr, so only local
+// callers are accepted. Unlike the healthz routes, it requires the API token when one is set.
+func (a *api) onPostDrain(reqCtx *fasthttp.RequestCtx) {
+	if !reqCtx.RemoteIP().IsLoopback() {
+		msg := NewErrorResponse("ERR_DRAIN_FORBIDDEN", messages.ErrDrainForbidden)
+		respondWithError(reqCtx, fasthttp.StatusForbidden, msg)
+		log.Debug(msg)
+		return
+	}
+
+	secondsStr := string(reqCtx.QueryArgs().Peek(drainSecondsParam))
+	seconds, err := strconv.Atoi(secondsStr)
+	if err != nil || seconds < 0 {
+		msg := NewErrorResponse("ERR_MALFORMED_REQUEST", fmt.Sprintf(messages.ErrHealthDrainSeconds, secondsStr))
+		respondWithError(reqCtx, fasthttp.StatusBadRequest, msg)
+		log.Debug(msg)
+		return
+	}
+
+	atomic.StoreInt32(&a.draining, 1)
+	duration := time.Duration(seconds) * time.Second
+	if duration > a.maxDrainDuration {
+		duration = a.maxDrainDuration
+	}
+	time.Sleep(duration)
+	respondEmpty(reqCtx)
+}
+
 func getMetadataFromRequest(reqCtx *fasthttp.RequestCtx) map[string]string {
 	metadata := map[string]string{}
 	const metadataPrefix string = "metadata."
@@ -16,7 +16,9 @@ import (
 	gohttp "net/http"
 	"os"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/dapr/components-contrib/bindings"
 	"github.com/dapr/components-contrib/middleware"
@@ -2605,9 +2607,111 @@ func TestV1HealthzEndpoint(t *testing.T) {
 		assert.Equal(t, 204, resp.StatusCode)
 	})
 
+	t.Run("Healthz liveness - 204 No Content when not ready", func(t *testing.T) {
+		atomic.StoreInt32(&testAPI.readyStatus, 0)
+		resp := fakeServer.DoRequest("GET", "v1.0/healthz/liveness", nil, nil)
+
+		assert.Equal(t, 204, resp.StatusCode, "liveness should not depend on readiness")
+
+		resp = fakeServer.DoRequest("GET", "v1.0/healthz", nil, nil)
+		assert.Equal(t, 500, resp.StatusCode)
+	})
+
+	t.Run("Healthz components - 500 ERR_HEALTH_COMPONENTS_NOT_READY", func(t *testing.T) {
+		resp := fakeServer.DoRequest("GET", "v1.0/healthz/components", nil, nil)
+
+		assert.Equal(t, 500, resp.StatusCode, "components not loaded should return 500")
+		assert.Equal(t, "ERR_HEALTH_COMPONENTS_NOT_READY", resp.ErrorBody["errorCode"])
+	})
+
+	t.Run("Healthz components - 204 No Content when not ready", func(t *testing.T) {
+		atomic.StoreInt32(&testAPI.readyStatus, 0)
+		testAPI.MarkComponentsAsReady()
+		resp := fakeServer.DoRequest("GET", "v1.0/healthz/components", nil, nil)
+
+		assert.Equal(t, 204, resp.StatusCode, "components readiness should not depend on the readiness of dapr")
+	})
+
+	t.Run("Healthz - 500 while draining", func(t *testing.T) {
+		atomic.StoreInt32(&testAPI.draining, 1)
+		testAPI.MarkStatusAsReady()
+		testAPI.MarkComponentsAsReady()
+
+		resp := fakeServer.DoRequest("GET", "v1.0/healthz", nil, nil)
+		assert.Equal(t, 500, resp.StatusCode, "dapr should not be ready after draining")
+
+		resp = fakeServer.DoRequest("GET", "v1.0/healthz/components", nil, nil)
+		assert.Equal(t, 500, resp.StatusCode, "components readiness should fail after draining")
+	})
+
 	fakeServer.Shutdown()
 }
 
+func TestV1DrainEndpoint(t *testing.T) {
+	token := "1234"
+	os.Setenv("DAPR_API_TOKEN", token)
+	defer os.Clearenv()
+
+	testAPI := &api{
+		json:             jsoniter.ConfigFastest,
+		maxDrainDuration: 100 * time.Millisecond,
+	}
+	testAPI.MarkStatusAsReady()
+
+	t.Run("non-local callers are rejected", func(t *testing.T) {
+		fakeServer := newFakeHTTPServer()
+		fakeServer.StartServer(testAPI.constructDrainEndpoints())
+		defer fakeServer.Shutdown()
+
+		resp := fakeServer.DoRequest("POST", "v1.0/drain", nil, map[string]string{"seconds": "0"})
+		assert.Equal(t, 403, resp.StatusCode)
+		assert.Equal(t, "ERR_DRAIN_FORBIDDEN", resp.ErrorBody["errorCode"])
+		assert.Equal(t, int32(0), atomic.LoadInt32(&testAPI.draining))
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	router := newFakeHTTPServer().getRouter(testAPI.constructDrainEndpoints())
+	go fasthttp.Serve(ln, useAPIAuthentication(router.Handler))
+	defer ln.Close()
+	url := fmt.Sprintf("http://%s/v1.0/drain", ln.Addr())
+
+	drain := func(t *testing.T, method, seconds, token string) int {
+		r, err := gohttp.NewRequest(method, url+"?seconds="+seconds, nil)
+		assert.NoError(t, err)
+		if token != "" {
+			r.Header.Set("dapr-api-token", token)
+		}
+		client := gohttp.Client{Timeout: 5 * time.Second}
+		res, err := client.Do(r)
+		assert.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	t.Run("unauthenticated callers are rejected", func(t *testing.T) {
+		assert.Equal(t, 401, drain(t, "POST", "0", ""))
+		assert.Equal(t, int32(0), atomic.LoadInt32(&testAPI.draining))
+	})
+
+	t.Run("GET isn't allowed", func(t *testing.T) {
+		assert.Equal(t, 405, drain(t, "GET", "0", token))
+		assert.Equal(t, int32(0), atomic.LoadInt32(&testAPI.draining))
+	})
+
+	t.Run("invalid seconds", func(t *testing.T) {
+		assert.Equal(t, 400, drain(t, "POST", "-1", token))
+		assert.Equal(t, int32(0), atomic.LoadInt32(&testAPI.draining))
+	})
+
+	t.Run("drain capped at the graceful shutdown duration", func(t *testing.T) {
+		start := time.Now()
+		assert.Equal(t, 204, drain(t, "POST", "3600", token))
+		assert.Less(t, int64(time.Since(start)), int64(5*time.Second))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&testAPI.draining))
+	})
+}
+
 func TestV1TransactionEndpoints(t *testing.T) {
 	fakeServer := newFakeHTTPServer()
 	fakeStore := fakeStateStore{}
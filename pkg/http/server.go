@@ -173,15 +173,26 @@ func (s *server) getRouter(endpoints []Endpoint) *routing.Router {
 	router := routing.New()
 	parameterFinder, _ := regexp.Compile("/{.*}")
 	for _, e := range endpoints {
-		path := fmt.Sprintf("/%s/%s", e.Version, e.Route)
-		for _, m := range e.Methods {
-			pathIncludesParameters := parameterFinder.MatchString(path)
-			if pathIncludesParameters {
-				router.Handle(m, path, s.unescapeRequestParametersHandler(e.Handler))
-			} else {
-				router.Handle(m, path, e.Handler)
+		paths := []string{fmt.Sprintf("/%s/%s", e.Version, e.Route)}
+		// The sidecar probes can include the app ID in their path, so the health routes are
+		// also served under it.
+		if s.config.AppID != "" && isHealthzRoute(e.Route) {
+			paths = append(paths, fmt.Sprintf("/%s/%s/%s", s.config.AppID, e.Version, e.Route))
+		}
+		for _, path := range paths {
+			for _, m := range e.Methods {
+				pathIncludesParameters := parameterFinder.MatchString(path)
+				if pathIncludesParameters {
+					router.Handle(m, path, s.unescapeRequestParametersHandler(e.Handler))
+				} else {
+					router.Handle(m, path, e.Handler)
+				}
 			}
 		}
 	}
 	return router
 }
+
+func isHealthzRoute(route string) bool {
+	return route == healthzRoute || strings.HasPrefix(route, healthzRoute+"/")
+}
@@ -62,6 +62,66 @@ func TestCorsHandler(t *testing.T) {
 		assert.True(t, mh.hasCORS)
 	})
 }
+func TestGetRouterHealthzAppIDRoutes(t *testing.T) {
+	mh := func(reqCtx *fasthttp.RequestCtx) {
+		reqCtx.Response.SetBody([]byte("handled"))
+	}
+	endpoints := []Endpoint{
+		{
+			Methods: []string{fasthttp.MethodGet},
+			Route:   "healthz",
+			Version: apiVersionV1,
+			Handler: mh,
+		},
+		{
+			Methods: []string{fasthttp.MethodGet},
+			Route:   "healthz/liveness",
+			Version: apiVersionV1,
+			Handler: mh,
+		},
+		{
+			Methods: []string{fasthttp.MethodGet},
+			Route:   "healthz/components",
+			Version: apiVersionV1,
+			Handler: mh,
+		},
+		{
+			Methods: []string{fasthttp.MethodGet},
+			Route:   "metadata",
+			Version: apiVersionV1,
+			Handler: mh,
+		},
+	}
+
+	t.Run("health routes served under the app id", func(t *testing.T) {
+		srv := server{config: ServerConfig{AppID: "myapp"}}
+		router := srv.getRouter(endpoints)
+		for _, path := range []string{
+			"/v1.0/healthz",
+			"/myapp/v1.0/healthz",
+			"/myapp/v1.0/healthz/liveness",
+			"/myapp/v1.0/healthz/components",
+		} {
+			r := &fasthttp.RequestCtx{}
+			handler, _ := router.Lookup(fasthttp.MethodGet, path, r)
+			if assert.NotNil(t, handler, path) {
+				handler(r)
+				assert.Equal(t, "handled", string(r.Response.Body()))
+			}
+		}
+
+		handler, _ := router.Lookup(fasthttp.MethodGet, "/myapp/v1.0/metadata", &fasthttp.RequestCtx{})
+		assert.Nil(t, handler)
+	})
+
+	t.Run("no app id routes without an app id", func(t *testing.T) {
+		srv := newServer()
+		router := srv.getRouter(endpoints)
+		handler, _ := router.Lookup(fasthttp.MethodGet, "/v1.0/healthz", &fasthttp.RequestCtx{})
+		assert.NotNil(t, handler)
+	})
+}
+
 func TestUnescapeRequestParametersHandler(t *testing.T) {
 	mh := func(reqCtx *fasthttp.RequestCtx) {
 		pc, _, _, ok := runtime.Caller(1)
@@ -5,15 +5,106 @@
 
 package injector
 
-import "github.com/kelseyhightower/envconfig"
+import (
+	"strings"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+)
 
 // Config represents configuration options for the Dapr Sidecar Injector webhook server
 type Config struct {
-	TLSCertFile            string `envconfig:"TLS_CERT_FILE" required:"true"`
-	TLSKeyFile             string `envconfig:"TLS_KEY_FILE" required:"true"`
-	SidecarImage           string `envconfig:"SIDECAR_IMAGE" required:"true"`
-	SidecarImagePullPolicy string `envconfig:"SIDECAR_IMAGE_PULL_POLICY"`
-	Namespace              string `envconfig:"NAMESPACE" required:"true"`
+	TLSCertFile            string        `envconfig:"TLS_CERT_FILE" required:"true"`
+	TLSKeyFile             string        `envconfig:"TLS_KEY_FILE" required:"true"`
+	SidecarImage           string        `envconfig:"SIDECAR_IMAGE" required:"true"`
+	SidecarImagePullPolicy string        `envconfig:"SIDECAR_IMAGE_PULL_POLICY"`
+	Namespace              string        `envconfig:"NAMESPACE" required:"true"`
+	MTLSCacheResyncPeriod  time.Duration `envconfig:"MTLS_CACHE_RESYNC_PERIOD"`
+	MTLSCacheWorkers       int           `envconfig:"MTLS_CACHE_WORKERS"`
+	// SidecarImageNamespaceOverrides maps namespaces to the sidecar image used for their pods,
+	// set as a comma separated list of namespace=image pairs.
+	SidecarImageNamespaceOverrides NamespaceImages `envconfig:"SIDECAR_IMAGE_NAMESPACE_OVERRIDES"`
+	MetricsProxyImage              string          `envconfig:"METRICS_PROXY_IMAGE"`
+	// PortPoolStart and PortPoolEnd define the range the sidecar ports are assigned from
+	// for pods using the port pool. The pool is disabled when either is zero.
+	PortPoolStart int32 `envconfig:"PORT_POOL_START"`
+	PortPoolEnd   int32 `envconfig:"PORT_POOL_END"`
+	// AnnotationPrefix is the domain of the pod annotations read and written by the injector. The
+	// operator must be started with the same --annotation-prefix to create the Dapr Services.
+	AnnotationPrefix string `envconfig:"ANNOTATION_PREFIX"`
+	// ValidateLimitRanges enables checking the sidecar resources against the LimitRanges of the pod namespace.
+	ValidateLimitRanges bool `envconfig:"VALIDATE_LIMIT_RANGES"`
+	// AppHealthCheckPathDefaults maps namespaces to the app health check path used for pods
+	// that don't set one.
+	AppHealthCheckPathDefaults map[string]string `envconfig:"APP_HEALTH_CHECK_PATH_DEFAULTS"`
+	// LenientInjection drops invalid optional annotations with a warning instead of
+	// rejecting the pod.
+	LenientInjection bool `envconfig:"LENIENT_INJECTION"`
+	// DevMode defaults the sidecar image pull policy to Never, for local clusters where the
+	// sidecar image is loaded directly onto the nodes.
+	DevMode bool `envconfig:"DEV_MODE"`
+	// ValidateServiceAccounts enables warning about pods whose service account, used as the
+	// mTLS identity of the sidecar, doesn't exist.
+	ValidateServiceAccounts bool `envconfig:"VALIDATE_SERVICE_ACCOUNTS"`
+	// AnnotateResolvedPorts annotates pods with the resolved sidecar ports, for tooling such as
+	// NetworkPolicy generators.
+	AnnotateResolvedPorts bool `envconfig:"ANNOTATE_RESOLVED_PORTS"`
+	// GoMemLimitPercent is the percentage of the sidecar memory limit GOMEMLIMIT is set to
+	// for pods that opt in with the auto GOMEMLIMIT annotation.
+	GoMemLimitPercent int `envconfig:"GOMEMLIMIT_PERCENT"`
+	// StrictImagePullPolicy rejects pods with an unrecognized sidecar image pull policy
+	// annotation instead of defaulting to IfNotPresent.
+	StrictImagePullPolicy bool `envconfig:"STRICT_IMAGE_PULL_POLICY"`
+	// SidecarImageAllowlist lists the sidecar images pods can be injected with. Entries ending
+	// with * match any image with the given prefix. All images are allowed when empty.
+	SidecarImageAllowlist []string `envconfig:"SIDECAR_IMAGE_ALLOWLIST"`
+	// FailClosed rejects pods when the dapr configuration holding the mTLS setting can't be
+	// loaded, instead of injecting the sidecar without mTLS.
+	FailClosed bool `envconfig:"FAIL_CLOSED"`
+	// TrustAnchorsConfigMap is the name of a ConfigMap holding the trust anchors under the ca.crt
+	// key, expected in the namespace of every injected pod. When set, trust anchors larger than
+	// TrustAnchorsEnvMaxBytes are mounted from it instead of being passed as an env var, unless
+	// the ConfigMap is missing from the namespace of the pod.
+	TrustAnchorsConfigMap   string `envconfig:"TRUST_ANCHORS_CONFIGMAP"`
+	TrustAnchorsEnvMaxBytes int    `envconfig:"TRUST_ANCHORS_ENV_MAX_BYTES"`
+	// SidecarDefaultCPURequest and SidecarDefaultMemoryRequest are the requests of sidecars
+	// that don't get one for the resource from the pod. Defaults are disabled when empty.
+	SidecarDefaultCPURequest    string `envconfig:"SIDECAR_DEFAULT_CPU_REQUEST"`
+	SidecarDefaultMemoryRequest string `envconfig:"SIDECAR_DEFAULT_MEMORY_REQUEST"`
+	// PlacementPort is the port of the placement service passed to the sidecars, for pods that
+	// don't annotate one.
+	PlacementPort int32 `envconfig:"PLACEMENT_PORT"`
+	// CertSecretRetries is the number of times a failed read of the sentry cert secret is
+	// retried, starting CertSecretRetryBackoff apart and doubling the wait on each retry.
+	CertSecretRetries      int           `envconfig:"CERT_SECRET_RETRIES"`
+	CertSecretRetryBackoff time.Duration `envconfig:"CERT_SECRET_RETRY_BACKOFF"`
+	// ClusterDomain is the DNS domain of the cluster, used to build the addresses of the dapr
+	// control plane services.
+	ClusterDomain string `envconfig:"KUBE_CLUSTER_DOMAIN"`
+}
+
+// NamespaceImages maps namespaces to images. It is decoded from a comma separated list of
+// namespace=image pairs, since images contain colons in their tag or registry port, which
+// separate the keys and values of maps decoded by envconfig.
+type NamespaceImages map[string]string
+
+// Decode implements envconfig.Decoder.
+func (n *NamespaceImages) Decode(value string) error {
+	images := NamespaceImages{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return errors.Errorf("invalid namespace image %q, expected namespace=image", pair)
+		}
+		images[kv[0]] = kv[1]
+	}
+	*n = images
+	return nil
 }
 
 // NewConfigWithDefaults returns a Config object with default values already
@@ -21,7 +112,17 @@ type Config struct {
 // and/or override default values.
 func NewConfigWithDefaults() Config {
 	return Config{
-		SidecarImagePullPolicy: "Always",
+		SidecarImagePullPolicy:  "Always",
+		MTLSCacheResyncPeriod:   10 * time.Minute,
+		MTLSCacheWorkers:        1,
+		MetricsProxyImage:       "alpine/socat:1.7.4.4",
+		AnnotationPrefix:        defaultAnnotationPrefix,
+		GoMemLimitPercent:       defaultGoMemLimitPercent,
+		TrustAnchorsEnvMaxBytes: defaultTrustAnchorsEnvMaxBytes,
+		PlacementPort:           defaultPlacementPort,
+		CertSecretRetries:       defaultCertSecretRetries,
+		CertSecretRetryBackoff:  defaultCertSecretRetryBackoff,
+		ClusterDomain:           defaultClusterDomain,
 	}
 }
 
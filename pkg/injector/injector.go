@@ -19,6 +19,7 @@ import (
 	"github.com/pkg/errors"
 	v1 "k8s.io/api/admission/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
@@ -38,9 +39,12 @@ type injector struct {
 	config       Config
 	deserializer runtime.Decoder
 	server       *http.Server
-	kubeClient   *kubernetes.Clientset
+	kubeClient   kubernetes.Interface
 	daprClient   scheme.Interface
 	authUID      string
+	mtlsCache    *mtlsCache
+	// defaultRequests are the sidecar resource requests applied when the pod provides none.
+	defaultRequests corev1.ResourceList
 }
 
 // toAdmissionResponse is a helper function to create an AdmissionResponse
@@ -73,7 +77,7 @@ func getAppIDFromRequest(req *v1.AdmissionRequest) string {
 }
 
 // NewInjector returns a new Injector instance with the given config
-func NewInjector(authUID string, config Config, daprClient scheme.Interface, kubeClient *kubernetes.Clientset) Injector {
+func NewInjector(authUID string, config Config, daprClient scheme.Interface, kubeClient kubernetes.Interface) Injector {
 	mux := http.NewServeMux()
 
 	i := &injector{
@@ -85,15 +89,40 @@ func NewInjector(authUID string, config Config, daprClient scheme.Interface, kub
 			Addr:    fmt.Sprintf(":%d", port),
 			Handler: mux,
 		},
-		kubeClient: kubeClient,
-		daprClient: daprClient,
-		authUID:    authUID,
+		kubeClient:      kubeClient,
+		daprClient:      daprClient,
+		authUID:         authUID,
+		defaultRequests: getDefaultRequests(config),
+	}
+	if daprClient != nil {
+		i.mtlsCache = newMTLSCache(daprClient, config.MTLSCacheResyncPeriod, config.MTLSCacheWorkers)
 	}
 
 	mux.HandleFunc("/mutate", i.handleRequest)
 	return i
 }
 
+// getDefaultRequests parses the default sidecar resource requests of the config, skipping the
+// ones that are empty or invalid.
+func getDefaultRequests(config Config) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for name, value := range map[corev1.ResourceName]string{
+		corev1.ResourceCPU:    config.SidecarDefaultCPURequest,
+		corev1.ResourceMemory: config.SidecarDefaultMemoryRequest,
+	} {
+		if value == "" {
+			continue
+		}
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			log.Warnf("ignoring invalid default sidecar %s request %s: %s", name, value, err)
+			continue
+		}
+		requests[name] = q
+	}
+	return requests
+}
+
 func ReplicasetAccountUID(kubeClient *kubernetes.Clientset) (string, error) {
 	r, err := kubeClient.CoreV1().ServiceAccounts(metav1.NamespaceSystem).Get(context.TODO(), "replicaset-controller", metav1.GetOptions{})
 	if err != nil {
@@ -105,6 +134,10 @@ func ReplicasetAccountUID(kubeClient *kubernetes.Clientset) (string, error) {
 func (i *injector) Run(ctx context.Context) {
 	doneCh := make(chan struct{})
 
+	if i.mtlsCache != nil {
+		go i.mtlsCache.Run(ctx.Done())
+	}
+
 	go func() {
 		select {
 		case <-ctx.Done():
@@ -158,6 +191,7 @@ func (i *injector) handleRequest(w http.ResponseWriter, r *http.Request) {
 
 	var admissionResponse *v1.AdmissionResponse
 	var patchOps []PatchOperation
+	var warnings []string
 	var err error
 
 	ar := v1.AdmissionReview{}
@@ -172,7 +206,7 @@ func (i *injector) handleRequest(w http.ResponseWriter, r *http.Request) {
 			err = errors.Wrapf(err, "invalid kind for review: %s", ar.Kind)
 			log.Error(err)
 		} else {
-			patchOps, err = i.getPodPatchOperations(&ar, i.config.Namespace, i.config.SidecarImage, i.config.SidecarImagePullPolicy, i.kubeClient, i.daprClient)
+			patchOps, warnings, err = i.getPodPatchOperationsWithContext(r.Context(), &ar, i.config.Namespace, i.config.SidecarImage, i.config.SidecarImagePullPolicy, i.kubeClient, i.daprClient)
 		}
 	}
 
@@ -204,6 +238,7 @@ func (i *injector) handleRequest(w http.ResponseWriter, r *http.Request) {
 
 	admissionReview := v1.AdmissionReview{}
 	if admissionResponse != nil {
+		admissionResponse.Warnings = warnings
 		admissionReview.Response = admissionResponse
 		if ar.Request != nil {
 			admissionReview.Response.UID = ar.Request.UID
@@ -7,13 +7,20 @@ package injector
 
 import (
 	"encoding/json"
+	"os"
+	"strings"
 	"testing"
 
+	configurationapi "github.com/dapr/dapr/pkg/apis/configuration/v1alpha1"
+	"github.com/dapr/dapr/pkg/client/clientset/versioned/fake"
+	auth "github.com/dapr/dapr/pkg/runtime/security"
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/admission/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 const (
@@ -37,6 +44,38 @@ func TestConfigCorrectValues(t *testing.T) {
 	assert.Equal(t, "e", injector.config.Namespace)
 }
 
+func TestGetConfigFromEnvironment(t *testing.T) {
+	for key, value := range map[string]string{
+		"TLS_CERT_FILE": "a",
+		"TLS_KEY_FILE":  "b",
+		"SIDECAR_IMAGE": "c",
+		"NAMESPACE":     "e",
+	} {
+		os.Setenv(key, value)
+		defer os.Unsetenv(key)
+	}
+
+	t.Run("namespace image overrides with tags and registry ports", func(t *testing.T) {
+		os.Setenv("SIDECAR_IMAGE_NAMESPACE_OVERRIDES", "debug=daprio/daprd:1.0.0-debug, dev=localhost:5000/daprd:edge")
+		defer os.Unsetenv("SIDECAR_IMAGE_NAMESPACE_OVERRIDES")
+
+		config, err := GetConfigFromEnvironment()
+		assert.NoError(t, err)
+		assert.Equal(t, NamespaceImages{
+			"debug": "daprio/daprd:1.0.0-debug",
+			"dev":   "localhost:5000/daprd:edge",
+		}, config.SidecarImageNamespaceOverrides)
+	})
+
+	t.Run("invalid namespace image override", func(t *testing.T) {
+		os.Setenv("SIDECAR_IMAGE_NAMESPACE_OVERRIDES", "daprio/daprd:1.0.0")
+		defer os.Unsetenv("SIDECAR_IMAGE_NAMESPACE_OVERRIDES")
+
+		_, err := GetConfigFromEnvironment()
+		assert.Error(t, err)
+	})
+}
+
 func TestGetConfig(t *testing.T) {
 	m := map[string]string{daprConfigKey: "config1"}
 	c := getConfig(m)
@@ -102,6 +141,56 @@ func TestGetProtocol(t *testing.T) {
 	})
 }
 
+func TestGetAppProtocol(t *testing.T) {
+	t.Run("single protocol", func(t *testing.T) {
+		p, err := getAppProtocol(map[string]string{daprAppProtocolKey: "grpc"}, 5000)
+		assert.NoError(t, err)
+		assert.Equal(t, "grpc", p)
+	})
+
+	t.Run("protocol of the app port", func(t *testing.T) {
+		m := map[string]string{daprAppProtocolKey: "5000=grpc, 8080=HTTP"}
+		p, err := getAppProtocol(m, 5000)
+		assert.NoError(t, err)
+		assert.Equal(t, "grpc", p)
+
+		p, err = getAppProtocol(m, 8080)
+		assert.NoError(t, err)
+		assert.Equal(t, "http", p)
+	})
+
+	t.Run("app port missing from the map", func(t *testing.T) {
+		_, err := getAppProtocol(map[string]string{daprAppProtocolKey: "5000=grpc"}, 8080)
+		assert.Error(t, err)
+
+		_, err = getAppProtocol(map[string]string{daprAppProtocolKey: "5000=grpc"}, -1)
+		assert.Error(t, err)
+	})
+
+	t.Run("map parsing", func(t *testing.T) {
+		protocols, err := parseAppProtocolMap("5000=grpc,,8080=http")
+		assert.NoError(t, err)
+		assert.Equal(t, map[int32]string{5000: "grpc", 8080: "http"}, protocols)
+	})
+
+	t.Run("daprd args", func(t *testing.T) {
+		m := map[string]string{
+			daprAppPortKey:     "5000",
+			daprAppProtocolKey: "5000=grpc,8080=http",
+		}
+		c, err := getSidecarContainer(m, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Contains(t, strings.Join(c.Args, " "), "--app-protocol grpc")
+	})
+
+	t.Run("invalid map", func(t *testing.T) {
+		for _, value := range []string{"5000=grpc,8080", "abc=grpc", "0=grpc", "70000=http", "5000=tcp", "5000=grpc,5000=http"} {
+			_, err := parseAppProtocolMap(value)
+			assert.Error(t, err, value)
+		}
+	})
+}
+
 func TestGetAppID(t *testing.T) {
 	t.Run("get app id", func(t *testing.T) {
 		m := map[string]string{appIDKey: "app"}
@@ -133,6 +222,106 @@ func TestLogLevel(t *testing.T) {
 	})
 }
 
+func TestValidateLogLevel(t *testing.T) {
+	daprClient := getTestLogLevelDaprClient()
+
+	t.Run("invalid log level", func(t *testing.T) {
+		m := map[string]string{daprLogLevel: "verbose"}
+		err := validateLogLevel(m, "ns", daprClient)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("no config", func(t *testing.T) {
+		m := map[string]string{daprLogLevel: "debug"}
+		err := validateLogLevel(m, "ns", daprClient)
+		assert.Nil(t, err)
+	})
+
+	t.Run("more verbose than config minimum", func(t *testing.T) {
+		m := map[string]string{daprLogLevel: "info", daprConfigKey: "config1"}
+		err := validateLogLevel(m, "ns", daprClient)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("default log level is more verbose than config minimum", func(t *testing.T) {
+		m := map[string]string{daprConfigKey: "config1"}
+		err := validateLogLevel(m, "ns", daprClient)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("equal to config minimum", func(t *testing.T) {
+		m := map[string]string{daprLogLevel: "warn", daprConfigKey: "config1"}
+		err := validateLogLevel(m, "ns", daprClient)
+		assert.Nil(t, err)
+	})
+
+	t.Run("less verbose than config minimum", func(t *testing.T) {
+		m := map[string]string{daprLogLevel: "error", daprConfigKey: "config1"}
+		err := validateLogLevel(m, "ns", daprClient)
+		assert.Nil(t, err)
+	})
+
+	t.Run("config not found", func(t *testing.T) {
+		m := map[string]string{daprLogLevel: "debug", daprConfigKey: "missing"}
+		err := validateLogLevel(m, "ns", daprClient)
+		assert.Nil(t, err)
+	})
+
+	t.Run("no dapr client", func(t *testing.T) {
+		m := map[string]string{daprLogLevel: "debug", daprConfigKey: "config1"}
+		err := validateLogLevel(m, "ns", nil)
+		assert.Nil(t, err)
+	})
+
+	t.Run("extra args log level more verbose than config minimum", func(t *testing.T) {
+		for _, extraArgs := range []string{"--log-level debug", "-log-level=info", "--enable-api-logging --log-level debug"} {
+			m := map[string]string{daprLogLevel: "error", daprConfigKey: "config1", daprSidecarExtraArgsKey: extraArgs}
+			err := validateLogLevel(m, "ns", daprClient)
+			assert.Error(t, err, extraArgs)
+		}
+	})
+
+	t.Run("extra args log level overrides the annotation", func(t *testing.T) {
+		m := map[string]string{daprConfigKey: "config1", daprSidecarExtraArgsKey: "--log-level=error"}
+		err := validateLogLevel(m, "ns", daprClient)
+		assert.Nil(t, err)
+	})
+
+	t.Run("invalid extra args log level", func(t *testing.T) {
+		for _, extraArgs := range []string{"--log-level verbose", "--log-level"} {
+			m := map[string]string{daprSidecarExtraArgsKey: extraArgs}
+			err := validateLogLevel(m, "ns", daprClient)
+			assert.Error(t, err, extraArgs)
+		}
+	})
+}
+
+// getTestLogLevelDaprClient returns a Dapr client serving the config1 configuration, which
+// enforces a warn minimum log level. The fake clientset tracks configurations under another
+// group than the one it gets them from, so gets are served by a reactor.
+func getTestLogLevelDaprClient() *fake.Clientset {
+	config := &configurationapi.Configuration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "config1",
+			Namespace: "ns",
+		},
+		Spec: configurationapi.ConfigurationSpec{
+			LoggingSpec: configurationapi.LoggingSpec{
+				MinLevel: "warn",
+			},
+		},
+	}
+	daprClient := fake.NewSimpleClientset()
+	daprClient.PrependReactor("get", "configurations", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		get := action.(k8stesting.GetAction)
+		if get.GetNamespace() != config.Namespace || get.GetName() != config.Name {
+			return true, nil, apierrors.NewNotFound(configurationapi.Resource("configurations"), get.GetName())
+		}
+		return true, config, nil
+	})
+	return daprClient
+}
+
 func TestMaxConcurrency(t *testing.T) {
 	t.Run("empty max concurrency - should be -1", func(t *testing.T) {
 		m := map[string]string{}
@@ -155,9 +344,128 @@ func TestMaxConcurrency(t *testing.T) {
 	})
 }
 
+func TestMaxRequestBodySize(t *testing.T) {
+	t.Run("empty max request size - should be -1", func(t *testing.T) {
+		size, err := getMaxRequestBodySize(map[string]string{})
+		assert.Nil(t, err)
+		assert.Equal(t, int32(-1), size)
+	})
+
+	t.Run("bare integer is read as MB", func(t *testing.T) {
+		size, err := getMaxRequestBodySize(map[string]string{daprMaxRequestBodySize: "16"})
+		assert.Nil(t, err)
+		assert.Equal(t, int32(16), size)
+	})
+
+	t.Run("binary units are converted to MB", func(t *testing.T) {
+		size, err := getMaxRequestBodySize(map[string]string{daprMaxRequestBodySize: "4Mi"})
+		assert.Nil(t, err)
+		assert.Equal(t, int32(4), size)
+
+		size, err = getMaxRequestBodySize(map[string]string{daprMaxRequestBodySize: "1Gi"})
+		assert.Nil(t, err)
+		assert.Equal(t, int32(1024), size)
+	})
+
+	t.Run("partial MB is rounded up", func(t *testing.T) {
+		size, err := getMaxRequestBodySize(map[string]string{daprMaxRequestBodySize: "512Ki"})
+		assert.Nil(t, err)
+		assert.Equal(t, int32(1), size)
+
+		size, err = getMaxRequestBodySize(map[string]string{daprMaxRequestBodySize: "4M"})
+		assert.Nil(t, err)
+		assert.Equal(t, int32(4), size)
+	})
+
+	t.Run("invalid max request size", func(t *testing.T) {
+		_, err := getMaxRequestBodySize(map[string]string{daprMaxRequestBodySize: "invalid"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("max request size that doesn't fit int32", func(t *testing.T) {
+		_, err := getMaxRequestBodySize(map[string]string{daprMaxRequestBodySize: "3000000000"})
+		assert.Error(t, err)
+
+		_, err = getMaxRequestBodySize(map[string]string{daprMaxRequestBodySize: "4Pi"})
+		assert.Error(t, err)
+	})
+
+	t.Run("negative max request size", func(t *testing.T) {
+		_, err := getMaxRequestBodySize(map[string]string{daprMaxRequestBodySize: "-1Mi"})
+		assert.Error(t, err)
+	})
+}
+
 func TestKubernetesDNS(t *testing.T) {
-	dns := getKubernetesDNS("a", "b")
+	dns := getKubernetesDNS("a", "b", "")
 	assert.Equal(t, "a.b.svc.cluster.local", dns)
+
+	t.Run("custom cluster domain", func(t *testing.T) {
+		dns := getKubernetesDNS("a", "b", "cluster.internal")
+		assert.Equal(t, "a.b.svc.cluster.internal", dns)
+	})
+}
+
+func TestGetPlacementAddress(t *testing.T) {
+	t.Run("default address", func(t *testing.T) {
+		address, err := getPlacementAddress(map[string]string{}, "dapr-system", "", defaultPlacementPort)
+		assert.Nil(t, err)
+		assert.Equal(t, "dapr-placement-server.dapr-system.svc.cluster.local:50005", address)
+	})
+
+	t.Run("custom cluster domain", func(t *testing.T) {
+		address, err := getPlacementAddress(map[string]string{}, "dapr-system", "cluster.internal", defaultPlacementPort)
+		assert.Nil(t, err)
+		assert.Equal(t, "dapr-placement-server.dapr-system.svc.cluster.internal:50005", address)
+	})
+
+	t.Run("configured port", func(t *testing.T) {
+		address, err := getPlacementAddress(map[string]string{}, "dapr-system", "", 6050)
+		assert.Nil(t, err)
+		assert.Equal(t, "dapr-placement-server.dapr-system.svc.cluster.local:6050", address)
+	})
+
+	t.Run("unset configured port", func(t *testing.T) {
+		address, err := getPlacementAddress(map[string]string{}, "dapr-system", "", 0)
+		assert.Nil(t, err)
+		assert.Equal(t, "dapr-placement-server.dapr-system.svc.cluster.local:50005", address)
+	})
+
+	t.Run("annotated port overrides the configured port", func(t *testing.T) {
+		m := map[string]string{daprPlacementHostPortKey: "7050"}
+		address, err := getPlacementAddress(m, "dapr-system", "", 6050)
+		assert.Nil(t, err)
+		assert.Equal(t, "dapr-placement-server.dapr-system.svc.cluster.local:7050", address)
+	})
+
+	t.Run("address override", func(t *testing.T) {
+		m := map[string]string{daprPlacementHostAddressKey: "placement.example.com:50005"}
+		address, err := getPlacementAddress(m, "dapr-system", "", defaultPlacementPort)
+		assert.Nil(t, err)
+		assert.Equal(t, "placement.example.com:50005", address)
+	})
+
+	t.Run("address override with a list of placement servers", func(t *testing.T) {
+		m := map[string]string{daprPlacementHostAddressKey: "10.0.0.1:50005,10.0.0.2:50005,[fd00::3]:50005"}
+		address, err := getPlacementAddress(m, "dapr-system", "", defaultPlacementPort)
+		assert.Nil(t, err)
+		assert.Equal(t, "10.0.0.1:50005,10.0.0.2:50005,[fd00::3]:50005", address)
+	})
+
+	t.Run("invalid address override", func(t *testing.T) {
+		for _, value := range []string{"placement", "placement:abc", ":50005", "placement:50005,", "placement:70000"} {
+			_, err := getPlacementAddress(map[string]string{daprPlacementHostAddressKey: value}, "dapr-system", "", defaultPlacementPort)
+			assert.NotNil(t, err, value)
+		}
+	})
+
+	t.Run("invalid placement port", func(t *testing.T) {
+		_, err := getPlacementAddress(map[string]string{daprPlacementHostPortKey: "abc"}, "dapr-system", "", defaultPlacementPort)
+		assert.NotNil(t, err)
+
+		_, err = getPlacementAddress(map[string]string{daprPlacementHostPortKey: "0"}, "dapr-system", "", defaultPlacementPort)
+		assert.NotNil(t, err)
+	})
 }
 
 func TestGetMetricsPort(t *testing.T) {
@@ -315,6 +623,47 @@ func TestGetResourceRequirements(t *testing.T) {
 		assert.NotNil(t, err)
 		assert.Nil(t, r)
 	})
+
+	t.Run("valid ephemeral storage limit and request", func(t *testing.T) {
+		a := map[string]string{daprEphemeralStorageLimitKey: "2Gi", daprEphemeralStorageRequestKey: "512Mi"}
+		r, err := getResourceRequirements(a)
+		assert.Nil(t, err)
+		assert.Equal(t, "2Gi", r.Limits.StorageEphemeral().String())
+		assert.Equal(t, "512Mi", r.Requests.StorageEphemeral().String())
+	})
+
+	t.Run("ephemeral storage composes with cpu and memory", func(t *testing.T) {
+		a := map[string]string{
+			daprCPULimitKey:                "100m",
+			daprMemoryLimitKey:             "1Gi",
+			daprEphemeralStorageLimitKey:   "2Gi",
+			daprMemoryRequestKey:           "256Mi",
+			daprEphemeralStorageRequestKey: "512Mi",
+		}
+		r, err := getResourceRequirements(a)
+		assert.Nil(t, err)
+		assert.Len(t, r.Limits, 3)
+		assert.Len(t, r.Requests, 2)
+		assert.Equal(t, "100m", r.Limits.Cpu().String())
+		assert.Equal(t, "1Gi", r.Limits.Memory().String())
+		assert.Equal(t, "2Gi", r.Limits.StorageEphemeral().String())
+		assert.Equal(t, "256Mi", r.Requests.Memory().String())
+		assert.Equal(t, "512Mi", r.Requests.StorageEphemeral().String())
+	})
+
+	t.Run("invalid ephemeral storage limit", func(t *testing.T) {
+		a := map[string]string{daprEphemeralStorageLimitKey: "storage"}
+		r, err := getResourceRequirements(a)
+		assert.NotNil(t, err)
+		assert.Nil(t, r)
+	})
+
+	t.Run("invalid ephemeral storage request", func(t *testing.T) {
+		a := map[string]string{daprEphemeralStorageRequestKey: "storage"}
+		r, err := getResourceRequirements(a)
+		assert.NotNil(t, err)
+		assert.Nil(t, r)
+	})
 }
 
 func TestAPITokenSecret(t *testing.T) {
@@ -335,6 +684,83 @@ func TestAPITokenSecret(t *testing.T) {
 	})
 }
 
+func TestAppTokenSecret(t *testing.T) {
+	t.Run("default env var", func(t *testing.T) {
+		annotations := map[string]string{daprAppTokenSecret: "appsecret"}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Nil(t, err)
+		env := c.Env[len(c.Env)-1]
+		assert.Equal(t, "APP_API_TOKEN", env.Name)
+		assert.Equal(t, "appsecret", env.ValueFrom.SecretKeyRef.Name)
+		assert.Equal(t, "token", env.ValueFrom.SecretKeyRef.Key)
+	})
+
+	t.Run("renamed env var", func(t *testing.T) {
+		annotations := map[string]string{
+			daprAppTokenSecret:     "appsecret",
+			daprAppTokenEnvNameKey: "MY_APP_TOKEN",
+		}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Nil(t, err)
+		env := c.Env[len(c.Env)-1]
+		assert.Equal(t, "APP_API_TOKEN", env.Name)
+		assert.Equal(t, "appsecret", env.ValueFrom.SecretKeyRef.Name)
+
+		appEnv := getAppContainerAppTokenEnv(annotations)
+		assert.Len(t, appEnv, 1)
+		assert.Equal(t, "MY_APP_TOKEN", appEnv[0].Name)
+		assert.Equal(t, "appsecret", appEnv[0].ValueFrom.SecretKeyRef.Name)
+		assert.Equal(t, "token", appEnv[0].ValueFrom.SecretKeyRef.Key)
+	})
+
+	t.Run("daprd reads the renamed token", func(t *testing.T) {
+		annotations := map[string]string{
+			daprAppTokenSecret:     "appsecret",
+			daprAppTokenEnvNameKey: "MY_APP_TOKEN",
+		}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Nil(t, err)
+
+		// Resolve the secret references the way the kubelet would for the sidecar.
+		for _, e := range c.Env {
+			if e.ValueFrom != nil && e.ValueFrom.SecretKeyRef != nil && e.ValueFrom.SecretKeyRef.Name == "appsecret" {
+				os.Setenv(e.Name, "app-token")
+				defer os.Unsetenv(e.Name)
+			}
+		}
+		assert.Equal(t, "app-token", auth.GetAppToken())
+	})
+
+	t.Run("app containers don't get the default token env var", func(t *testing.T) {
+		annotations := map[string]string{daprAppTokenSecret: "appsecret"}
+		assert.Len(t, getAppContainerAppTokenEnv(annotations), 0)
+	})
+
+	t.Run("file mount", func(t *testing.T) {
+		annotations := map[string]string{
+			daprAppTokenSecret:   "appsecret",
+			daprAppTokenMountKey: "true",
+		}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Nil(t, err)
+		env := c.Env[len(c.Env)-1]
+		assert.Equal(t, "APP_API_TOKEN_FILE", env.Name)
+		assert.Equal(t, "/var/run/secrets/dapr.io/app-token/token", env.Value)
+		assert.Equal(t, appTokenVolumeName, c.VolumeMounts[0].Name)
+		assert.Equal(t, appTokenMountPath, c.VolumeMounts[0].MountPath)
+
+		volumes := getSidecarVolumes(annotations)
+		assert.Len(t, volumes, 1)
+		assert.Equal(t, appTokenVolumeName, volumes[0].Name)
+		assert.Equal(t, "appsecret", volumes[0].Secret.SecretName)
+	})
+
+	t.Run("no volume without file mount", func(t *testing.T) {
+		annotations := map[string]string{daprAppTokenSecret: "appsecret"}
+		assert.Len(t, getSidecarVolumes(annotations), 0)
+	})
+}
+
 func TestAppSSL(t *testing.T) {
 	t.Run("ssl enabled", func(t *testing.T) {
 		annotations := map[string]string{
@@ -394,4 +820,95 @@ func TestAppSSL(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("probes use http when enabled", func(t *testing.T) {
+		annotations := map[string]string{
+			daprAppSSLKey: "true",
+		}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Empty(t, c.LivenessProbe.HTTPGet.Scheme)
+		assert.Empty(t, c.ReadinessProbe.HTTPGet.Scheme)
+	})
+
+	t.Run("probes use http when disabled", func(t *testing.T) {
+		c, err := getSidecarContainer(map[string]string{}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Empty(t, c.LivenessProbe.HTTPGet.Scheme)
+		assert.Empty(t, c.ReadinessProbe.HTTPGet.Scheme)
+	})
+
+	t.Run("scheme annotation sets https with app ssl", func(t *testing.T) {
+		annotations := map[string]string{
+			daprAppSSLKey:               "true",
+			daprReadinessProbeSchemeKey: "https",
+		}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Empty(t, c.LivenessProbe.HTTPGet.Scheme)
+		assert.Equal(t, corev1.URISchemeHTTPS, c.ReadinessProbe.HTTPGet.Scheme)
+	})
+}
+
+func TestOtelEnvVars(t *testing.T) {
+	t.Run("endpoint and protocol set", func(t *testing.T) {
+		annotations := map[string]string{
+			daprOtelEndpointKey: "http://otel-collector.observability:4317",
+			daprOtelProtocolKey: "grpc",
+		}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Nil(t, err)
+
+		env := map[string]string{}
+		for _, e := range c.Env {
+			env[e.Name] = e.Value
+		}
+		assert.Equal(t, "http://otel-collector.observability:4317", env[otelExporterEndpointEnvVar])
+		assert.Equal(t, "grpc", env[otelExporterProtocolEnvVar])
+	})
+
+	t.Run("not set", func(t *testing.T) {
+		c, err := getSidecarContainer(map[string]string{}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Nil(t, err)
+		for _, e := range c.Env {
+			assert.NotEqual(t, otelExporterEndpointEnvVar, e.Name)
+			assert.NotEqual(t, otelExporterProtocolEnvVar, e.Name)
+		}
+	})
+
+	t.Run("invalid endpoint", func(t *testing.T) {
+		annotations := map[string]string{daprOtelEndpointKey: "otel-collector:4317"}
+		_, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("invalid protocol", func(t *testing.T) {
+		annotations := map[string]string{
+			daprOtelEndpointKey: "http://otel-collector:4317",
+			daprOtelProtocolKey: "thrift",
+		}
+		_, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NotNil(t, err)
+	})
+}
+
+func TestTerminationMessagePolicy(t *testing.T) {
+	t.Run("default policy", func(t *testing.T) {
+		c, err := getSidecarContainer(map[string]string{}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Nil(t, err)
+		assert.Equal(t, corev1.TerminationMessageFallbackToLogsOnError, c.TerminationMessagePolicy)
+	})
+
+	t.Run("policy override", func(t *testing.T) {
+		annotations := map[string]string{daprTerminationMessagePolicyKey: "File"}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Nil(t, err)
+		assert.Equal(t, corev1.TerminationMessageReadFile, c.TerminationMessagePolicy)
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+		annotations := map[string]string{daprTerminationMessagePolicyKey: "Logs"}
+		_, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NotNil(t, err)
+	})
 }
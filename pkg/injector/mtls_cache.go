@@ -0,0 +1,142 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation and Dapr Contributors.
+// Licensed under the MIT License.
+// ------------------------------------------------------------
+
+package injector
+
+import (
+	"sync"
+	"time"
+
+	configurationapi "github.com/dapr/dapr/pkg/apis/configuration/v1alpha1"
+	scheme "github.com/dapr/dapr/pkg/client/clientset/versioned"
+	"github.com/dapr/dapr/pkg/client/informers/externalversions"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// mtlsCache keeps the mTLS setting of the Dapr system configuration up to date
+// using an informer, so admission requests don't need to list configurations.
+type mtlsCache struct {
+	informer cache.SharedIndexInformer
+	queue    workqueue.RateLimitingInterface
+	workers  int
+
+	lock    sync.RWMutex
+	enabled bool
+	synced  bool
+}
+
+func newMTLSCache(daprClient scheme.Interface, resyncPeriod time.Duration, workers int) *mtlsCache {
+	if workers < 1 {
+		workers = 1
+	}
+
+	factory := externalversions.NewSharedInformerFactory(daprClient, resyncPeriod)
+	c := &mtlsCache{
+		informer: factory.Configuration().V1alpha1().Configurations().Informer(),
+		queue:    workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		workers:  workers,
+		enabled:  defaultMtlsEnabled,
+	}
+
+	c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueue,
+		UpdateFunc: func(_, newObj interface{}) {
+			c.enqueue(newObj)
+		},
+		DeleteFunc: c.enqueue,
+	})
+	return c
+}
+
+func (c *mtlsCache) enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		log.Warnf("failed to get key for dapr configuration: %s", err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// Run starts the informer and the workers and blocks until stopCh is closed.
+func (c *mtlsCache) Run(stopCh <-chan struct{}) {
+	defer c.queue.ShutDown()
+
+	go c.informer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, c.informer.HasSynced) {
+		log.Warn("failed to sync dapr configuration cache")
+		return
+	}
+
+	// The workers haven't handled the initial adds yet, so the setting is read from the synced
+	// cache to never report the default once synced.
+	c.lock.Lock()
+	c.enabled = c.getCachedMTLSEnabled()
+	c.synced = true
+	c.lock.Unlock()
+
+	for i := 0; i < c.workers; i++ {
+		go wait.Until(c.runWorker, time.Second, stopCh)
+	}
+	<-stopCh
+}
+
+func (c *mtlsCache) runWorker() {
+	for c.processNextItem() {
+	}
+}
+
+func (c *mtlsCache) processNextItem() bool {
+	key, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	_, name, err := cache.SplitMetaNamespaceKey(key.(string))
+	if err != nil || name != defaultConfig {
+		c.queue.Forget(key)
+		return true
+	}
+
+	obj, exists, err := c.informer.GetIndexer().GetByKey(key.(string))
+	if err != nil {
+		log.Warnf("failed to get dapr configuration %s from cache: %s", key, err)
+		c.queue.AddRateLimited(key)
+		return true
+	}
+
+	enabled := defaultMtlsEnabled
+	if exists {
+		if config, ok := obj.(*configurationapi.Configuration); ok {
+			enabled = config.Spec.MTLSSpec.Enabled
+		}
+	}
+
+	c.lock.Lock()
+	c.enabled = enabled
+	c.lock.Unlock()
+	c.queue.Forget(key)
+	return true
+}
+
+// getCachedMTLSEnabled returns the mTLS setting of the Dapr system configuration in the informer
+// cache, or the default when there is none.
+func (c *mtlsCache) getCachedMTLSEnabled() bool {
+	for _, obj := range c.informer.GetIndexer().List() {
+		if config, ok := obj.(*configurationapi.Configuration); ok && config.Name == defaultConfig {
+			return config.Spec.MTLSSpec.Enabled
+		}
+	}
+	return defaultMtlsEnabled
+}
+
+// MTLSEnabled returns the cached mTLS setting and whether the cache has synced.
+func (c *mtlsCache) MTLSEnabled() (bool, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.enabled, c.synced
+}
@@ -0,0 +1,145 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation and Dapr Contributors.
+// Licensed under the MIT License.
+// ------------------------------------------------------------
+
+package injector
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	configurationapi "github.com/dapr/dapr/pkg/apis/configuration/v1alpha1"
+	"github.com/dapr/dapr/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// waitForCacheSync waits for the given informer to sync, giving up after five seconds instead of
+// hanging the test.
+func waitForCacheSync(synced cache.InformerSynced) bool {
+	timeoutCh := make(chan struct{})
+	timer := time.AfterFunc(5*time.Second, func() { close(timeoutCh) })
+	defer timer.Stop()
+	return cache.WaitForCacheSync(timeoutCh, synced)
+}
+
+// countUpdates registers a handler counting the update events of the informer of the given cache,
+// which are resyncs as long as the configurations aren't changed.
+func countUpdates(c *mtlsCache) *int64 {
+	var updates int64
+	c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(_, _ interface{}) {
+			atomic.AddInt64(&updates, 1)
+		},
+	})
+	return &updates
+}
+
+func getTestConfiguration(mtlsEnabled bool) *configurationapi.Configuration {
+	return &configurationapi.Configuration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaultConfig,
+			Namespace: "dapr-system",
+		},
+		Spec: configurationapi.ConfigurationSpec{
+			MTLSSpec: configurationapi.MTLSSpec{
+				Enabled: mtlsEnabled,
+			},
+		},
+	}
+}
+
+func TestMTLSCache(t *testing.T) {
+	daprClient := fake.NewSimpleClientset(getTestConfiguration(false))
+
+	t.Run("reflects the system configuration", func(t *testing.T) {
+		c := newMTLSCache(daprClient, time.Minute, 2)
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		go c.Run(stopCh)
+
+		// The setting must already be correct when the cache first reports being synced.
+		var enabled, synced bool
+		assert.Eventually(t, func() bool {
+			enabled, synced = c.MTLSEnabled()
+			return synced
+		}, 5*time.Second, time.Millisecond)
+		assert.False(t, enabled)
+	})
+
+	t.Run("follows changes of the system configuration", func(t *testing.T) {
+		daprClient := fake.NewSimpleClientset(getTestConfiguration(false))
+		c := newMTLSCache(daprClient, time.Hour, 2)
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		go c.Run(stopCh)
+
+		assert.Eventually(t, func() bool {
+			_, synced := c.MTLSEnabled()
+			return synced
+		}, 5*time.Second, time.Millisecond)
+
+		for _, expected := range []bool{true, false} {
+			_, err := daprClient.ConfigurationV1alpha1().Configurations("dapr-system").Update(getTestConfiguration(expected))
+			assert.NoError(t, err)
+			assert.Eventually(t, func() bool {
+				enabled, _ := c.MTLSEnabled()
+				return enabled == expected
+			}, 5*time.Second, 10*time.Millisecond)
+		}
+
+		err := daprClient.ConfigurationV1alpha1().Configurations("dapr-system").Delete(defaultConfig, &metav1.DeleteOptions{})
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			enabled, _ := c.MTLSEnabled()
+			return enabled == defaultMtlsEnabled
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("synced setting doesn't depend on the workers", func(t *testing.T) {
+		c := newMTLSCache(daprClient, time.Minute, 1)
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		go c.informer.Run(stopCh)
+		assert.True(t, waitForCacheSync(c.informer.HasSynced))
+
+		assert.False(t, c.getCachedMTLSEnabled())
+	})
+
+	t.Run("default without the system configuration", func(t *testing.T) {
+		c := newMTLSCache(fake.NewSimpleClientset(), time.Minute, 1)
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		go c.informer.Run(stopCh)
+		assert.True(t, waitForCacheSync(c.informer.HasSynced))
+
+		assert.Equal(t, defaultMtlsEnabled, c.getCachedMTLSEnabled())
+	})
+
+	t.Run("resync period is respected", func(t *testing.T) {
+		// client-go doesn't resync more often than every second
+		short := newMTLSCache(daprClient, time.Second, 1)
+		shortUpdates := countUpdates(short)
+		long := newMTLSCache(daprClient, time.Hour, 1)
+		longUpdates := countUpdates(long)
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		go long.Run(stopCh)
+		go short.Run(stopCh)
+
+		// the long period cache runs for as long as it takes the short period cache to resync
+		// a few times, without resyncing itself
+		assert.Eventually(t, func() bool {
+			return atomic.LoadInt64(shortUpdates) >= 2
+		}, 10*time.Second, 10*time.Millisecond)
+		assert.Equal(t, int64(0), atomic.LoadInt64(longUpdates))
+	})
+
+	t.Run("worker count defaults to one", func(t *testing.T) {
+		c := newMTLSCache(daprClient, time.Minute, 0)
+		assert.Equal(t, 1, c.workers)
+	})
+}
@@ -9,12 +9,19 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
+	"net"
+	"net/url"
 	"path"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	scheme "github.com/dapr/dapr/pkg/client/clientset/versioned"
 	"github.com/dapr/dapr/pkg/credentials"
+	"github.com/dapr/dapr/pkg/logger"
 	auth "github.com/dapr/dapr/pkg/runtime/security"
 	"github.com/dapr/dapr/pkg/sentry/certs"
 	"github.com/dapr/dapr/pkg/validation"
@@ -25,11 +32,13 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 )
 
 const (
 	sidecarContainerName              = "daprd"
+	defaultAnnotationPrefix           = "dapr.io"
 	daprEnabledKey                    = "dapr.io/enabled"
 	daprAppPortKey                    = "dapr.io/app-port"
 	daprConfigKey                     = "dapr.io/config"
@@ -46,6 +55,8 @@ const (
 	daprMemoryLimitKey                = "dapr.io/sidecar-memory-limit"
 	daprCPURequestKey                 = "dapr.io/sidecar-cpu-request"
 	daprMemoryRequestKey              = "dapr.io/sidecar-memory-request"
+	daprEphemeralStorageLimitKey      = "dapr.io/sidecar-ephemeral-storage-limit"
+	daprEphemeralStorageRequestKey    = "dapr.io/sidecar-ephemeral-storage-request"
 	daprLivenessProbeDelayKey         = "dapr.io/sidecar-liveness-probe-delay-seconds"
 	daprLivenessProbeTimeoutKey       = "dapr.io/sidecar-liveness-probe-timeout-seconds"
 	daprLivenessProbePeriodKey        = "dapr.io/sidecar-liveness-probe-period-seconds"
@@ -54,14 +65,98 @@ const (
 	daprReadinessProbeTimeoutKey      = "dapr.io/sidecar-readiness-probe-timeout-seconds"
 	daprReadinessProbePeriodKey       = "dapr.io/sidecar-readiness-probe-period-seconds"
 	daprReadinessProbeThresholdKey    = "dapr.io/sidecar-readiness-probe-threshold"
+	daprStartupProbeDelayKey          = "dapr.io/sidecar-startup-probe-delay-seconds"
+	daprStartupProbeTimeoutKey        = "dapr.io/sidecar-startup-probe-timeout-seconds"
+	daprStartupProbePeriodKey         = "dapr.io/sidecar-startup-probe-period-seconds"
+	daprStartupProbeThresholdKey      = "dapr.io/sidecar-startup-probe-threshold"
 	daprMaxRequestBodySize            = "dapr.io/http-max-request-size"
 	daprAppSSLKey                     = "dapr.io/app-ssl"
-	sidecarAPIGRPCPortKey             = "com.infoblox.dapr.sidecar-grpc-port"
-	sidecarHTTPPortKey                = "com.infoblox.dapr.sidecar-http-port"
-	sidecarInternalGRPCPortKey        = "com.infoblox.dapr.sidecar-internal-grpc-port"
+	daprOtelEndpointKey               = "dapr.io/otel-endpoint"
+	daprOtelProtocolKey               = "dapr.io/otel-protocol"
+	daprSidecarImageKey               = "dapr.io/sidecar-image"
+	daprInjectMetricsProxyKey         = "dapr.io/inject-metrics-proxy"
+	daprMetricsProxyPortKey           = "dapr.io/metrics-proxy-port"
+	daprHealthzIncludeAppIDKey        = "dapr.io/sidecar-healthz-include-app-id"
+	daprAllowPrivilegeEscalationKey   = "dapr.io/sidecar-allow-privilege-escalation"
+	daprLivenessProbeSchemeKey        = "dapr.io/sidecar-liveness-scheme"
+	daprReadinessProbeSchemeKey       = "dapr.io/sidecar-readiness-scheme"
+	daprSidecarBaseContainerKey       = "dapr.io/sidecar-base-container"
+	daprPlacementHostPortKey          = "dapr.io/placement-host-port"
+	daprPlacementHostAddressKey       = "dapr.io/placement-host-address"
+	daprAppTokenEnvNameKey            = "dapr.io/app-token-env-name"
+	daprAppTokenMountKey              = "dapr.io/app-token-mount"
+	daprUsePortPoolKey                = "dapr.io/use-port-pool"
+	daprSidecarReadinessGateKey       = "dapr.io/sidecar-readiness-gate"
+	daprTerminationMessagePolicyKey   = "dapr.io/sidecar-termination-message-policy"
+	daprEnvPrependKey                 = "dapr.io/env-prepend"
+	daprGracefulShutdownSecondsKey    = "dapr.io/sidecar-graceful-shutdown-seconds"
+	daprMemoryLimitPercentKey         = "dapr.io/sidecar-memory-limit-percent"
+	daprCABundleConfigMapKey          = "dapr.io/ca-bundle-configmap"
+	daprCABundleMountPathKey          = "dapr.io/ca-bundle-mount-path"
+	daprCABundleKeyKey                = "dapr.io/ca-bundle-key"
+	daprAppHealthCheckPathKey         = "dapr.io/app-health-check-path"
+	daprLivenessStartupSecondsKey     = "dapr.io/sidecar-liveness-startup-seconds"
+	daprSidecarImagePullPolicyKey     = "dapr.io/sidecar-image-pull-policy"
+	daprSidecarExtraArgsKey           = "dapr.io/sidecar-extra-args"
+	daprDebugEffectiveConfigKey       = "dapr.io/debug-effective-config"
+	daprEffectiveConfigKey            = "dapr.io/effective-config"
+	daprSidecarVersionKey             = "dapr.io/sidecar-version"
+	daprHealthzPathPrefixKey          = "dapr.io/sidecar-healthz-path-prefix"
+	daprProbePortKey                  = "dapr.io/sidecar-probe-port"
+	daprSidecarNoLimitsKey            = "dapr.io/sidecar-no-limits"
+	daprAppPreStopSleepSecondsKey     = "dapr.io/app-prestop-sleep-seconds"
+	daprSidecarAutoGoMemLimitKey      = "dapr.io/sidecar-auto-gomemlimit"
+	daprComponentCacheKey             = "dapr.io/sidecar-component-cache"
+	daprComponentCachePathKey         = "dapr.io/sidecar-component-cache-path"
+	daprPlacementHostAliasKey         = "dapr.io/placement-host-alias"
+	daprInheritImagePullPolicyKey     = "dapr.io/sidecar-inherit-image-pull-policy"
+	daprMetricsListenAddressKey       = "dapr.io/metrics-listen-address"
+	daprProbeTypeKey                  = "dapr.io/sidecar-probe-type"
+	daprHealthzPathKey                = "dapr.io/sidecar-healthz-path"
+	daprLivenessOnlyHealthzKey        = "dapr.io/sidecar-liveness-only-healthz"
+	daprReadinessComponentsKey        = "dapr.io/sidecar-readiness-components"
+	daprAppTLSClientCertSecretKey     = "dapr.io/app-tls-client-cert-secret"
+	daprDisableLivenessProbeKey       = "dapr.io/sidecar-disable-liveness-probe"
+	daprSidecarNativeKey              = "dapr.io/sidecar-native"
+	daprEnvFromAnnotationsKey         = "dapr.io/env-from-annotations"
+	daprReadOnlyRootFilesystemKey     = "dapr.io/sidecar-read-only-root-filesystem"
+	daprRunAsNonRootKey               = "dapr.io/sidecar-run-as-non-root"
+	daprRunAsUserKey                  = "dapr.io/sidecar-run-as-user"
+	daprDropCapabilitiesKey           = "dapr.io/sidecar-drop-capabilities"
+	daprAddCapabilitiesKey            = "dapr.io/sidecar-add-capabilities"
+	daprSeccompProfileTypeKey         = "dapr.io/sidecar-seccomp-profile-type"
+	daprSeccompLocalhostProfileKey    = "dapr.io/sidecar-seccomp-profile-localhost-path"
+	daprAlignTerminationGraceKey      = "dapr.io/sidecar-align-termination-grace-period"
+	daprEnableJobInjectionKey         = "dapr.io/enable-job-injection"
+	daprShutdownOnAppExitKey          = "dapr.io/sidecar-shutdown-on-app-exit"
+	daprAppExitIgnoredProcessesKey    = "dapr.io/sidecar-app-exit-ignored-processes"
+	daprDNSNdotsKey                   = "dapr.io/sidecar-dns-ndots"
+	daprAppIDNamespacingKey           = "dapr.io/app-id-namespacing"
+	sidecarAPIGRPCPortKey             = "dapr.io/sidecar-grpc-port"
+	sidecarHTTPPortKey                = "dapr.io/sidecar-http-port"
+	sidecarInternalGRPCPortKey        = "dapr.io/sidecar-internal-grpc-port"
+	deprecatedSidecarAPIGRPCPortKey   = "com.infoblox.dapr.sidecar-grpc-port"
+	deprecatedSidecarHTTPPortKey      = "com.infoblox.dapr.sidecar-http-port"
+	deprecatedSidecarInternalGRPCKey  = "com.infoblox.dapr.sidecar-internal-grpc-port"
 	containersPath                    = "/spec/containers"
+	initContainersPath                = "/spec/initContainers"
+	volumesPath                       = "/spec/volumes"
+	automountServiceAccountTokenPath  = "/spec/automountServiceAccountToken"
+	readinessGatesPath                = "/spec/readinessGates"
+	hostAliasesPath                   = "/spec/hostAliases"
+	shareProcessNamespacePath         = "/spec/shareProcessNamespace"
+	dnsConfigPath                     = "/spec/dnsConfig"
+	annotationsPath                   = "/metadata/annotations"
+	redactedValue                     = "<redacted>"
+	sidecarReadyConditionType         = "dapr.io/sidecar-ready"
 	userContainerDaprHTTPPortName     = "DAPR_HTTP_PORT"
 	userContainerDaprGRPCPortName     = "DAPR_GRPC_PORT"
+	userContainerDaprGracefulShutdown = "DAPR_GRACEFUL_SHUTDOWN_SECONDS"
+	userContainerDaprMTLSEnabled      = "DAPR_MTLS_ENABLED"
+	goMemLimitEnvVar                  = "GOMEMLIMIT"
+	daprHostNameEnvVar                = "DAPR_HOST_NAME"
+	otelExporterEndpointEnvVar        = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	otelExporterProtocolEnvVar        = "OTEL_EXPORTER_OTLP_PROTOCOL"
 	apiAddress                        = "dapr-api"
 	placementService                  = "dapr-placement-server"
 	sentryService                     = "dapr-sentry"
@@ -69,32 +164,100 @@ const (
 	sidecarGRPCPortName               = "dapr-grpc"
 	sidecarInternalGRPCPortName       = "dapr-internal"
 	sidecarMetricsPortName            = "dapr-metrics"
+	metricsProxyContainerName         = "dapr-metrics-proxy"
+	metricsProxyPortName              = "dapr-metrics-px"
+	defaultMetricsProxyPort           = 9091
+	metricsProxyUser                  = 65532
+	metricsProxyProcessName           = "socat"
 	defaultLogLevel                   = "info"
 	defaultLogAsJSON                  = false
 	defaultAppSSL                     = false
 	kubernetesMountPath               = "/var/run/secrets/kubernetes.io/serviceaccount"
-	defaultConfig                     = "daprsystem"
-	defaultMetricsPort                = 9090
-	defaultSidecarHTTPPort            = 3500
-	defaultSidecarAPIGRPCPort         = 50001
-	defaultSidecarInternalGRPCPortKey = 50002
-	sidecarHealthzPath                = "healthz"
-	defaultHealthzProbeDelaySeconds   = 3
-	defaultHealthzProbeTimeoutSeconds = 3
-	defaultHealthzProbePeriodSeconds  = 6
-	defaultHealthzProbeThreshold      = 3
-	apiVersionV1                      = "v1.0"
-	defaultMtlsEnabled                = true
-	trueString                        = "true"
+	tokenSecretKey                    = "token"
+	appTokenVolumeName                = "dapr-app-token"
+	appTokenMountPath                 = "/var/run/secrets/dapr.io/app-token"
+	caBundleVolumeName                = "dapr-ca-bundle"
+	defaultCABundleMountPath          = "/etc/ssl/certs"
+	defaultCABundleKey                = "ca.crt"
+	sslCertFileEnvVar                 = "SSL_CERT_FILE"
+	sslCertDirEnvVar                  = "SSL_CERT_DIR"
+	componentCacheVolumeName          = "dapr-component-cache"
+	defaultComponentCachePath         = "/var/run/dapr/component-cache"
+	componentCacheDirEnvVar           = "DAPR_COMPONENT_CACHE_DIR"
+	tmpVolumeName                     = "dapr-tmp"
+	tmpMountPath                      = "/tmp"
+	trustAnchorsVolumeName            = "dapr-trust-anchors"
+	trustAnchorsMountPath             = "/var/run/secrets/dapr.io/trust-anchors"
+	appTLSClientCertVolumeName        = "dapr-app-tls-client-cert"
+	appTLSClientCertMountPath         = "/var/run/secrets/dapr.io/app-tls-client-cert"
+	// A single env var can't be larger than 128KiB on Linux.
+	defaultTrustAnchorsEnvMaxBytes = 64 * 1024
+	defaultConfig                  = "daprsystem"
+	defaultClusterDomain           = "cluster.local"
+	// defaultGracefulShutdownSeconds is the shutdown window of daprd when it isn't annotated.
+	defaultGracefulShutdownSeconds       = 5
+	defaultTerminationGracePeriodSeconds = 30
+	bytesPerMB                           = 1 << 20
+	defaultCertSecretRetries             = 3
+	defaultCertSecretRetryBackoff        = 100 * time.Millisecond
+	maxCertSecretRetryWait               = 3 * time.Second
+	defaultMetricsPort                   = 9090
+	defaultPlacementPort                 = 50005
+	defaultSidecarHTTPPort               = 3500
+	defaultSidecarAPIGRPCPort            = 50001
+	defaultSidecarInternalGRPCPortKey    = 50002
+	sidecarHealthzPath                   = "healthz"
+	sidecarDrainCommand                  = "drain"
+	sidecarLivenessRoute                 = "liveness"
+	sidecarComponentsRoute               = "components"
+	probeTypeHTTP                        = "http"
+	probeTypeTCP                         = "tcp"
+	probeTypeGRPC                        = "grpc"
+	defaultHealthzProbeDelaySeconds      = 3
+	defaultHealthzProbeTimeoutSeconds    = 3
+	defaultHealthzProbePeriodSeconds     = 6
+	defaultHealthzProbeThreshold         = 3
+	defaultNativeStartupProbePeriod      = 1
+	defaultNativeStartupProbeThreshold   = 60
+	apiVersionV1                         = "v1.0"
+	defaultMtlsEnabled                   = true
+	defaultGoMemLimitPercent             = 90
+	trueString                           = "true"
+	containerRestartPolicyAlways         = "Always"
 )
 
 func (i *injector) getPodPatchOperations(ar *v1.AdmissionReview,
-	namespace, image, imagePullPolicy string, kubeClient *kubernetes.Clientset, daprClient scheme.Interface) ([]PatchOperation, error) {
+	namespace, image, imagePullPolicy string, kubeClient kubernetes.Interface, daprClient scheme.Interface) ([]PatchOperation, []string, error) {
+	return i.getPodPatchOperationsWithContext(context.Background(), ar, namespace, image, imagePullPolicy, kubeClient, daprClient)
+}
+
+// getPodPatchOperationsWithContext returns the patch operations injecting the sidecar, along with
+// the admission warnings. The waits between the retried reads of the sentry cert secret end with
+// the given context, the context of the admission request. The annotations named in the warnings
+// and errors use the configured prefix, as written on the pod.
+func (i *injector) getPodPatchOperationsWithContext(ctx context.Context, ar *v1.AdmissionReview,
+	namespace, image, imagePullPolicy string, kubeClient kubernetes.Interface, daprClient scheme.Interface) ([]PatchOperation, []string, error) {
+	patchOps, warnings, err := i.getPrefixedPodPatchOperations(ctx, ar, namespace, image, imagePullPolicy, kubeClient, daprClient)
+	for idx := range warnings {
+		warnings[idx] = renderAnnotationPrefix(warnings[idx], i.config.AnnotationPrefix)
+	}
+	if err != nil {
+		if msg := renderAnnotationPrefix(err.Error(), i.config.AnnotationPrefix); msg != err.Error() {
+			err = errors.New(msg)
+		}
+	}
+	return patchOps, warnings, err
+}
+
+// getPrefixedPodPatchOperations returns the patch operations injecting the sidecar. The pod
+// annotations are read with the default dapr.io prefix, which the warnings and errors name.
+func (i *injector) getPrefixedPodPatchOperations(ctx context.Context, ar *v1.AdmissionReview,
+	namespace, image, imagePullPolicy string, kubeClient kubernetes.Interface, daprClient scheme.Interface) ([]PatchOperation, []string, error) {
 	req := ar.Request
 	var pod corev1.Pod
 	if err := json.Unmarshal(req.Object.Raw, &pod); err != nil {
 		errors.Wrap(err, "could not unmarshal raw object")
-		return nil, err
+		return nil, nil, err
 	}
 
 	log.Infof(
@@ -109,36 +272,196 @@ func (i *injector) getPodPatchOperations(ar *v1.AdmissionReview,
 		req.UserInfo,
 	)
 
+	pod.Annotations = normalizeAnnotationPrefix(pod.Annotations, i.config.AnnotationPrefix)
+
 	if !isResourceDaprEnabled(pod.Annotations) || podContainsSidecarContainer(&pod) {
-		return nil, nil
+		return nil, nil, nil
+	}
+
+	// The sidecar never exits by itself, which keeps Jobs from completing.
+	if isJobPod(&pod) && !getBoolAnnotationOrDefault(pod.Annotations, daprEnableJobInjectionKey, false) {
+		log.Infof("skipping sidecar injection for pod %s owned by a Job, set %s to inject it", pod.Name, daprEnableJobInjectionKey)
+		return nil, nil, nil
 	}
 
-	id := getAppID(pod)
-	err := validation.ValidateKubernetesAppID(id)
+	// The operator derives the Service of the app from the same ID.
+	id, err := validation.GetKubernetesAppID(getAppID(pod), getStringAnnotation(pod.Annotations, daprAppIDNamespacingKey), getPrefixedAnnotationKey(daprAppIDNamespacingKey, i.config.AnnotationPrefix), req.Namespace)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	// Pods with a log level rejected by their configuration are admitted with a warning in
+	// lenient mode.
+	var logLevelWarnings []string
+	err = validateLogLevel(pod.Annotations, req.Namespace, daprClient)
+	if err != nil {
+		if !i.config.LenientInjection {
+			return nil, nil, err
+		}
+		logLevelWarnings = append(logLevelWarnings, err.Error())
+	}
+
+	err = validateMutuallyExclusiveAnnotations(pod.Annotations)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if i.config.StrictImagePullPolicy {
+		err = validateSidecarImagePullPolicy(pod.Annotations)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var lenientWarnings []string
+	if i.config.LenientInjection {
+		pod.Annotations, lenientWarnings = dropInvalidOptionalAnnotations(pod.Annotations)
+	}
+
+	// The ports of hostNetwork pods are checked as annotated, the pool isn't unique across pods.
+	err = validateHostNetworkPorts(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if usePortPool(pod.Annotations) {
+		pod.Annotations, err = assignPortsFromPool(pod, i.config.PortPoolStart, i.config.PortPoolEnd)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
+	warnings := getDeprecatedAnnotationWarnings(pod.Annotations)
+	warnings = append(warnings, lenientWarnings...)
+	warnings = append(warnings, logLevelWarnings...)
+	warnings = append(warnings, getNoLimitsWarnings(pod.Annotations)...)
+	warnings = append(warnings, getMemoryUnitWarnings(pod.Annotations)...)
+	warnings = append(warnings, getUnknownAnnotationWarnings(pod.Annotations)...)
+	warnings = append(warnings, getMissingSecretWarnings(pod.Annotations, req.Namespace, kubeClient)...)
+
 	// Keep DNS resolution outside of getSidecarContainer for unit testing.
-	placementAddress := fmt.Sprintf("%s:50005", getKubernetesDNS(placementService, namespace))
-	sentryAddress := fmt.Sprintf("%s:80", getKubernetesDNS(sentryService, namespace))
-	apiSrvAddress := fmt.Sprintf("%s:80", getKubernetesDNS(apiAddress, namespace))
+	placementAddress, err := getPlacementAddress(pod.Annotations, namespace, i.config.ClusterDomain, i.config.PlacementPort)
+	if err != nil {
+		return nil, nil, err
+	}
+	var hostAliasPatchOps []PatchOperation
+	if getBoolAnnotationOrDefault(pod.Annotations, daprPlacementHostAliasKey, false) {
+		var hostAliasWarnings []string
+		hostAliasPatchOps, hostAliasWarnings = getPlacementHostAliasPatchOperations(pod.Spec.HostAliases, namespace, i.config.ClusterDomain, kubeClient)
+		warnings = append(warnings, hostAliasWarnings...)
+	}
+	sentryAddress := fmt.Sprintf("%s:80", getKubernetesDNS(sentryService, namespace, i.config.ClusterDomain))
+	apiSrvAddress := fmt.Sprintf("%s:80", getKubernetesDNS(apiAddress, namespace, i.config.ClusterDomain))
 
 	var trustAnchors string
 	var certChain string
 	var certKey string
 	var identity string
 
-	mtlsEnabled := mTLSEnabled(daprClient)
+	mtlsEnabled, err := i.mTLSEnabled(daprClient)
+	if err != nil {
+		if i.config.FailClosed {
+			return nil, nil, errors.Wrap(err, "failed to load the dapr configuration to determine the mTLS setting")
+		}
+		// Fail open injects the sidecar without mTLS rather than reading the sentry credentials
+		// for a setting that couldn't be confirmed.
+		mtlsEnabled = false
+		warnings = append(warnings, fmt.Sprintf("injecting the sidecar without mTLS, the dapr configuration couldn't be loaded: %s", err))
+	}
 	if mtlsEnabled {
-		trustAnchors, certChain, certKey = getTrustAnchorsAndCertChain(kubeClient, namespace)
+		trustAnchors, certChain, certKey = getTrustAnchorsAndCertChain(ctx, kubeClient, namespace, i.config.CertSecretRetries, i.config.CertSecretRetryBackoff)
 		identity = fmt.Sprintf("%s:%s", req.Namespace, pod.Spec.ServiceAccountName)
+		if i.config.ValidateServiceAccounts {
+			warnings = append(warnings, getMissingServiceAccountWarnings(pod.Spec.ServiceAccountName, req.Namespace, kubeClient)...)
+		}
 	}
 
+	image = getSidecarImage(pod.Annotations, req.Namespace, image, i.config.SidecarImageNamespaceOverrides)
+	imagePullPolicy = getSidecarImagePullPolicy(pod.Annotations, pod.Spec.Containers, imagePullPolicy, i.config.DevMode)
+	pod.Annotations = applyDefaultAppHealthCheckPath(pod.Annotations, req.Namespace, i.config.AppHealthCheckPathDefaults)
+
 	tokenMount := getTokenVolumeMount(pod)
 	sidecarContainer, err := getSidecarContainer(pod.Annotations, id, image, imagePullPolicy, req.Namespace, apiSrvAddress, placementAddress, tokenMount, trustAnchors, certChain, certKey, sentryAddress, mtlsEnabled, identity)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	err = validateSidecarImage(sidecarContainer.Image, i.config.SidecarImageAllowlist)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sidecarVolumes := getSidecarVolumes(pod.Annotations)
+	if mountTrustAnchorsEnabled(trustAnchors, i.config.TrustAnchorsConfigMap, i.config.TrustAnchorsEnvMaxBytes) {
+		// The volume is only mounted from a ConfigMap in the namespace of the pod, since the pod
+		// would otherwise never start. The trust anchors are passed as an env var instead.
+		if err := validateTrustAnchorsConfigMap(kubeClient, req.Namespace, i.config.TrustAnchorsConfigMap); err != nil {
+			warnings = append(warnings, fmt.Sprintf("passing the trust anchors as an env var: %s", err))
+		} else {
+			mountTrustAnchors(sidecarContainer)
+			sidecarVolumes = append(sidecarVolumes, getTrustAnchorsVolume(i.config.TrustAnchorsConfigMap))
+		}
+	}
+
+	if _, ok := pod.Annotations[daprMemoryLimitPercentKey]; ok && !sidecarNoLimitsEnabled(pod.Annotations) {
+		memoryLimit, err := getMemoryLimitFromPercent(pod.Annotations, pod.Spec.Containers)
+		if err != nil {
+			return nil, nil, err
+		}
+		if sidecarContainer.Resources.Limits == nil {
+			sidecarContainer.Resources.Limits = corev1.ResourceList{}
+		}
+		sidecarContainer.Resources.Limits[corev1.ResourceMemory] = memoryLimit
+	}
+
+	applyDefaultRequests(&sidecarContainer.Resources, i.defaultRequests)
+
+	sidecarContainer.Env = append(sidecarContainer.Env, getHostNameEnvVar(pod.Spec.Hostname))
+
+	if getBoolAnnotationOrDefault(pod.Annotations, daprAlignTerminationGraceKey, false) {
+		// The annotation has already been validated when building the sidecar container.
+		drainSeconds, _ := getGracefulShutdownSeconds(pod.Annotations)
+		if drainSeconds < 0 {
+			drainSeconds = defaultGracefulShutdownSeconds
+		}
+		preStopSeconds := getAlignedPreStopSeconds(pod.Spec.TerminationGracePeriodSeconds, drainSeconds)
+		sidecarContainer.Lifecycle, err = getAlignedSidecarLifecycle(pod.Annotations, sidecarContainer.Lifecycle, preStopSeconds)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Job pods are only injected when enabled. A native sidecar is stopped by Kubernetes once the
+	// app containers of the Job complete. Otherwise daprd can watch the app processes through a
+	// process namespace shared with the app and shut down once they exit. This is opt-in, since
+	// the app can then read the environment of daprd, including its certificate key and tokens.
+	shutdownOnAppExit := false
+	if isJobPod(&pod) && !sidecarNativeEnabled(pod.Annotations) {
+		if getBoolAnnotationOrDefault(pod.Annotations, daprShutdownOnAppExitKey, false) {
+			shutdownOnAppExit = true
+			sidecarContainer.Args = append(sidecarContainer.Args, "--shutdown-on-app-exit")
+			if ignored := getAppExitIgnoredProcesses(pod.Annotations); len(ignored) > 0 {
+				sidecarContainer.Args = append(sidecarContainer.Args, "--app-exit-ignored-processes", strings.Join(ignored, ","))
+			}
+		} else {
+			warnings = append(warnings, fmt.Sprintf("the sidecar won't exit once the app of the Job completes, set %s or %s", daprSidecarNativeKey, daprShutdownOnAppExitKey))
+		}
+	}
+
+	if getBoolAnnotationOrDefault(pod.Annotations, daprSidecarAutoGoMemLimitKey, false) {
+		if goMemLimit, ok := getGoMemLimit(sidecarContainer.Resources, i.config.GoMemLimitPercent); ok {
+			sidecarContainer.Env = append(sidecarContainer.Env, corev1.EnvVar{
+				Name:  goMemLimitEnvVar,
+				Value: goMemLimit,
+			})
+		}
+	}
+
+	if i.config.ValidateLimitRanges {
+		err = validateLimitRanges(sidecarContainer.Resources, req.Namespace, kubeClient)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
 	patchOps := []PatchOperation{}
@@ -154,36 +477,270 @@ func (i *injector) getPodPatchOperations(ar *v1.AdmissionReview,
 			Name:  userContainerDaprGRPCPortName,
 			Value: fmt.Sprint(getSideCarAPIGRPCPort(pod.Annotations)),
 		},
+		{
+			Name:  userContainerDaprMTLSEnabled,
+			Value: strconv.FormatBool(mtlsEnabled),
+		},
+	}
+	// The annotation has already been validated when building the sidecar container.
+	if gracefulShutdownSeconds, _ := getGracefulShutdownSeconds(pod.Annotations); gracefulShutdownSeconds >= 0 {
+		portEnv = append(portEnv, corev1.EnvVar{
+			Name:  userContainerDaprGracefulShutdown,
+			Value: fmt.Sprint(gracefulShutdownSeconds),
+		})
+	}
+	portEnv = append(portEnv, getAppContainerAppTokenEnv(pod.Annotations)...)
+	injectedContainers := []corev1.Container{*sidecarContainer}
+	if metricsProxyEnabled(pod.Annotations) {
+		metricsProxyPort, err := getMetricsProxyPort(pod.Annotations)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := validateMetricsProxyPort(metricsProxyPort, append([]corev1.Container{*sidecarContainer}, pod.Spec.Containers...)); err != nil {
+			return nil, nil, err
+		}
+		injectedContainers = append(injectedContainers, getMetricsProxyContainer(pod.Annotations, i.config.MetricsProxyImage, metricsProxyPort))
 	}
-	if len(pod.Spec.Containers) == 0 {
-		path = containersPath
-		value = []corev1.Container{*sidecarContainer}
+
+	if sidecarNativeEnabled(pod.Annotations) {
+		nativeSidecar, err := getNativeSidecarContainer(sidecarContainer)
+		if err != nil {
+			return nil, nil, err
+		}
+		patchOps = append(patchOps, getInitContainerPatchOperation(pod.Spec.InitContainers, nativeSidecar))
+		if len(pod.Spec.Containers) > 0 {
+			envPatchOps = addDaprEnvVarsToContainers(pod.Spec.Containers, portEnv, envPrependEnabled(pod.Annotations))
+			for _, c := range injectedContainers[1:] {
+				patchOps = append(patchOps, PatchOperation{
+					Op:    "add",
+					Path:  "/spec/containers/-",
+					Value: c,
+				})
+			}
+		} else if len(injectedContainers) > 1 {
+			// Appending to a missing containers array fails, so the array is added as a whole.
+			patchOps = append(patchOps, PatchOperation{
+				Op:    "add",
+				Path:  containersPath,
+				Value: injectedContainers[1:],
+			})
+		}
 	} else {
-		envPatchOps = addDaprEnvVarsToContainers(pod.Spec.Containers, portEnv)
-		path = "/spec/containers/-"
-		value = sidecarContainer
+		if len(pod.Spec.Containers) == 0 {
+			path = containersPath
+			value = injectedContainers
+		} else {
+			envPatchOps = addDaprEnvVarsToContainers(pod.Spec.Containers, portEnv, envPrependEnabled(pod.Annotations))
+			path = "/spec/containers/-"
+			value = sidecarContainer
+		}
+
+		patchOps = append(
+			patchOps,
+			PatchOperation{
+				Op:    "add",
+				Path:  path,
+				Value: value,
+			},
+		)
+		if len(pod.Spec.Containers) > 0 {
+			for _, c := range injectedContainers[1:] {
+				patchOps = append(patchOps, PatchOperation{
+					Op:    "add",
+					Path:  "/spec/containers/-",
+					Value: c,
+				})
+			}
+		}
+	}
+	patchOps = append(patchOps, envPatchOps...)
+	appPreStopSleepSeconds, err := getAppPreStopSleepSeconds(pod.Annotations)
+	if err != nil {
+		return nil, nil, err
+	}
+	if appPreStopSleepSeconds > 0 {
+		patchOps = append(patchOps, getAppPreStopPatchOperations(pod.Spec.Containers, appPreStopSleepSeconds)...)
+	}
+	dnsNdots, err := getDNSNdots(pod.Annotations)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dnsNdots != "" {
+		patchOps = append(patchOps, getDNSNdotsPatchOperations(pod.Spec.DNSConfig, dnsNdots)...)
+	}
+	if mtlsEnabled && tokenMount == nil {
+		// The sidecar needs the service account token to authenticate with sentry.
+		patchOps = append(patchOps, PatchOperation{
+			Op:    "add",
+			Path:  automountServiceAccountTokenPath,
+			Value: true,
+		})
+	}
+	if shutdownOnAppExit {
+		patchOps = append(patchOps, PatchOperation{
+			Op:    "add",
+			Path:  shareProcessNamespacePath,
+			Value: true,
+		})
+	}
+	if sidecarReadinessGateEnabled(pod.Annotations) {
+		// The condition type is named with the configured prefix, like the operator that reports it.
+		conditionType := corev1.PodConditionType(getPrefixedAnnotationKey(sidecarReadyConditionType, i.config.AnnotationPrefix))
+		patchOps = append(patchOps, getReadinessGatePatchOperations(pod.Spec.ReadinessGates, conditionType)...)
+	}
+	patchOps = append(patchOps, hostAliasPatchOps...)
+	patchOps = append(patchOps, getVolumePatchOperations(pod.Spec.Volumes, sidecarVolumes, volumesPath)...)
+	if version := getSidecarVersion(sidecarContainer.Image); version != "" {
+		patchOps = append(patchOps, PatchOperation{
+			Op:    "add",
+			Path:  getAnnotationPatchPath(daprSidecarVersionKey, i.config.AnnotationPrefix),
+			Value: version,
+		})
+	}
+	if i.config.AnnotateResolvedPorts {
+		patchOps = append(patchOps, getResolvedPortsPatchOperations(pod.Annotations, i.config.AnnotationPrefix)...)
+	}
+	if getBoolAnnotationOrDefault(pod.Annotations, daprDebugEffectiveConfigKey, false) {
+		patchOp, err := getEffectiveConfigPatchOperation(pod.Annotations, sidecarContainer, i.config.AnnotationPrefix)
+		if err != nil {
+			return nil, nil, err
+		}
+		patchOps = append(patchOps, patchOp)
 	}
 
-	patchOps = append(
-		patchOps,
-		PatchOperation{
+	return patchOps, warnings, nil
+}
+
+// getResolvedPortsPatchOperations annotates the pod with the sidecar ports as resolved from
+// the annotations and defaults, using the given annotation prefix.
+func getResolvedPortsPatchOperations(annotations map[string]string, prefix string) []PatchOperation {
+	ports := []struct {
+		key  string
+		port int32
+	}{
+		{sidecarHTTPPortKey, getSideCarHTTPPort(annotations)},
+		{sidecarAPIGRPCPortKey, getSideCarAPIGRPCPort(annotations)},
+		{sidecarInternalGRPCPortKey, getSideCarInternalGRPCPort(annotations)},
+		{daprMetricsPortKey, int32(getMetricsPort(annotations))},
+	}
+
+	patchOps := make([]PatchOperation, 0, len(ports))
+	for _, p := range ports {
+		patchOps = append(patchOps, PatchOperation{
 			Op:    "add",
-			Path:  path,
-			Value: value,
-		},
-	)
-	patchOps = append(patchOps, envPatchOps...)
+			Path:  getAnnotationPatchPath(p.key, prefix),
+			Value: strconv.Itoa(int(p.port)),
+		})
+	}
+	return patchOps
+}
+
+// getSidecarVersion returns the tag of the sidecar image, recorded on the pod for inventory and
+// upgrade tracking. Images without a tag resolve to latest, while images pinned by digest only
+// have no version.
+func getSidecarVersion(image string) string {
+	name := image
+	digest := ""
+	if idx := strings.Index(name, "@"); idx != -1 {
+		name, digest = name[:idx], name[idx+1:]
+	}
+	// A colon before the last slash separates the port of the registry host, not the tag.
+	if idx := strings.LastIndex(name, ":"); idx != -1 && idx > strings.LastIndex(name, "/") {
+		return name[idx+1:]
+	}
+	if digest != "" {
+		return ""
+	}
+	return "latest"
+}
+
+// getEffectiveConfigPatchOperation adds an annotation holding the resolved sidecar options
+// as JSON, with the secret references redacted, using the given annotation prefix. The image,
+// pull policy and resources are taken from the injected sidecar, since they are resolved after
+// the annotations, e.g. from the memory limit percent or the injector default requests.
+func getEffectiveConfigPatchOperation(annotations map[string]string, sidecar *corev1.Container, prefix string) (PatchOperation, error) {
+	opts, err := ParseSidecarOptions(annotations)
+	if err != nil {
+		return PatchOperation{}, err
+	}
+	opts.Image = sidecar.Image
+	opts.ImagePullPolicy = sidecar.ImagePullPolicy
+	opts.Resources = sidecar.Resources.DeepCopy()
+	opts = redactSidecarOptions(opts)
+
+	effectiveConfig, err := json.Marshal(opts)
+	if err != nil {
+		return PatchOperation{}, errors.Wrap(err, "failed to marshal the effective sidecar config")
+	}
+	return PatchOperation{
+		Op:    "add",
+		Path:  getAnnotationPatchPath(daprEffectiveConfigKey, prefix),
+		Value: string(effectiveConfig),
+	}, nil
+}
+
+// redactSidecarOptions returns a copy of the options with the secrets and secret references replaced.
+func redactSidecarOptions(opts SidecarOptions) SidecarOptions {
+	if opts.APITokenSecret != "" {
+		opts.APITokenSecret = redactedValue
+	}
+	if opts.AppTokenSecret != "" {
+		opts.AppTokenSecret = redactedValue
+	}
+	if opts.BaseContainer != nil {
+		base := opts.BaseContainer.DeepCopy()
+		for i := range base.Env {
+			if base.Env[i].Value != "" {
+				base.Env[i].Value = redactedValue
+			}
+			base.Env[i].ValueFrom = nil
+		}
+		opts.BaseContainer = base
+	}
+	return opts
+}
+
+// getPrefixedAnnotationKey returns the given annotation key, declared with the default dapr.io
+// prefix, with the given prefix instead.
+func getPrefixedAnnotationKey(key, prefix string) string {
+	if prefix != "" && prefix != defaultAnnotationPrefix {
+		return prefix + strings.TrimPrefix(key, defaultAnnotationPrefix)
+	}
+	return key
+}
+
+// defaultPrefixedAnnotationKeyRegexp matches the dapr.io prefix of the annotation keys in a message,
+// which the prefix is the last part of, e.g. not the dapr.io of example.dapr.io/app-id.
+var defaultPrefixedAnnotationKeyRegexp = regexp.MustCompile(`(^|[^A-Za-z0-9.-])` + regexp.QuoteMeta(defaultAnnotationPrefix+"/"))
+
+// renderAnnotationPrefix returns the given message with the annotation keys, declared with the
+// default dapr.io prefix, named with the given prefix instead.
+func renderAnnotationPrefix(msg, prefix string) string {
+	if prefix == "" || prefix == defaultAnnotationPrefix {
+		return msg
+	}
+	return defaultPrefixedAnnotationKeyRegexp.ReplaceAllString(msg, "${1}"+strings.ReplaceAll(prefix, "$", "$$")+"/")
+}
 
-	return patchOps, nil
+// getAnnotationPatchPath returns the patch path of the given annotation, declared with the default
+// dapr.io prefix, written with the given prefix instead.
+func getAnnotationPatchPath(key, prefix string) string {
+	return annotationsPath + "/" + escapeJSONPointer(getPrefixedAnnotationKey(key, prefix))
+}
+
+// escapeJSONPointer escapes a key to be used as a JSON pointer path segment.
+func escapeJSONPointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
 }
 
 // This function add Dapr environment variables to all the containers in any Dapr enabled pod.
 // The containers can be injected or user defined.
-func addDaprEnvVarsToContainers(containers []corev1.Container, daprEnv []corev1.EnvVar) []PatchOperation {
+// When prepend is set, the Dapr environment variables are added before the existing ones.
+func addDaprEnvVarsToContainers(containers []corev1.Container, daprEnv []corev1.EnvVar, prepend bool) []PatchOperation {
 	envPatchOps := []PatchOperation{}
 	for i, container := range containers {
 		path := fmt.Sprintf("%s/%d/env", containersPath, i)
-		patchOps := getEnvPatchOperations(container.Env, daprEnv, path)
+		patchOps := getEnvPatchOperations(container.Env, daprEnv, path, prepend)
 		envPatchOps = append(envPatchOps, patchOps...)
 	}
 	return envPatchOps
@@ -191,7 +748,7 @@ func addDaprEnvVarsToContainers(containers []corev1.Container, daprEnv []corev1.
 
 // This function only add new environment variables if they do not exist.
 // It does not override existing values for those variables if they have been defined already.
-func getEnvPatchOperations(envs []corev1.EnvVar, addEnv []corev1.EnvVar, path string) []PatchOperation {
+func getEnvPatchOperations(envs []corev1.EnvVar, addEnv []corev1.EnvVar, path string, prepend bool) []PatchOperation {
 	if len(envs) == 0 {
 		// If there are no environment variables defined in the container, we initialize a slice of environment vars.
 		return []PatchOperation{
@@ -203,7 +760,11 @@ func getEnvPatchOperations(envs []corev1.EnvVar, addEnv []corev1.EnvVar, path st
 		}
 	}
 	// If there are existing env vars, then we are adding to an existing slice of env vars.
-	path += "/-"
+	if prepend {
+		path += "/0"
+	} else {
+		path += "/-"
+	}
 
 	var patchOps []PatchOperation
 LoopEnv:
@@ -220,118 +781,1650 @@ LoopEnv:
 			Value: env,
 		})
 	}
-	return patchOps
-}
 
-func getTrustAnchorsAndCertChain(kubeClient *kubernetes.Clientset, namespace string) (string, string, string) {
-	secret, err := kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), certs.KubeScrtName, meta_v1.GetOptions{})
-	if err != nil {
-		return "", "", ""
+	if prepend {
+		// Every op inserts at the head of the list, so apply them in reverse to keep the order.
+		for i, j := 0, len(patchOps)-1; i < j; i, j = i+1, j-1 {
+			patchOps[i], patchOps[j] = patchOps[j], patchOps[i]
+		}
 	}
-	rootCert := secret.Data[credentials.RootCertFilename]
-	certChain := secret.Data[credentials.IssuerCertFilename]
-	certKey := secret.Data[credentials.IssuerKeyFilename]
-	return string(rootCert), string(certChain), string(certKey)
+	return patchOps
 }
 
-func mTLSEnabled(daprClient scheme.Interface) bool {
-	resp, err := daprClient.ConfigurationV1alpha1().Configurations(meta_v1.NamespaceAll).List(meta_v1.ListOptions{})
-	if err != nil {
-		log.Errorf("Failed to load dapr configuration from k8s, use default value %t for mTLSEnabled: %s", defaultMtlsEnabled, err)
-		return defaultMtlsEnabled
+// getVolumePatchOperations adds the volumes needed by the sidecar, skipping volumes
+// whose names are already defined in the pod.
+func getVolumePatchOperations(volumes []corev1.Volume, addVolumes []corev1.Volume, path string) []PatchOperation {
+	if len(addVolumes) == 0 {
+		return nil
 	}
-
-	for _, c := range resp.Items {
-		if c.GetName() == defaultConfig {
-			return c.Spec.MTLSSpec.Enabled
+	if len(volumes) == 0 {
+		return []PatchOperation{
+			{
+				Op:    "add",
+				Path:  path,
+				Value: addVolumes,
+			},
 		}
 	}
-	log.Infof("Dapr system configuration (%s) is not found, use default value %t for mTLSEnabled", defaultConfig, defaultMtlsEnabled)
-	return defaultMtlsEnabled
-}
+	path += "/-"
 
-func getTokenVolumeMount(pod corev1.Pod) *corev1.VolumeMount {
-	for _, c := range pod.Spec.Containers {
-		for _, v := range c.VolumeMounts {
-			if v.MountPath == kubernetesMountPath {
-				return &v
+	var patchOps []PatchOperation
+LoopVolumes:
+	for _, volume := range addVolumes {
+		for _, actual := range volumes {
+			if actual.Name == volume.Name {
+				continue LoopVolumes
 			}
 		}
+		patchOps = append(patchOps, PatchOperation{
+			Op:    "add",
+			Path:  path,
+			Value: volume,
+		})
 	}
-	return nil
+	return patchOps
 }
 
-func podContainsSidecarContainer(pod *corev1.Pod) bool {
-	for _, c := range pod.Spec.Containers {
-		if c.Name == sidecarContainerName {
-			return true
-		}
-	}
-	return false
+// sidecarReadinessGateEnabled returns whether the pod gets the sidecar ready readiness gate, whose
+// condition the operator sets from the readiness of the sidecar container.
+func sidecarReadinessGateEnabled(annotations map[string]string) bool {
+	return getBoolAnnotationOrDefault(annotations, daprSidecarReadinessGateKey, false)
 }
 
-func getMaxConcurrency(annotations map[string]string) (int32, error) {
-	return getInt32Annotation(annotations, daprAppMaxConcurrencyKey)
+// getAppPreStopSleepSeconds returns the annotated preStop sleep of the app containers, or 0 when it isn't set.
+func getAppPreStopSleepSeconds(annotations map[string]string) (int32, error) {
+	seconds, err := getInt32Annotation(annotations, daprAppPreStopSleepSecondsKey)
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := annotations[daprAppPreStopSleepSecondsKey]; !ok {
+		return 0, nil
+	}
+	if seconds < 0 {
+		return 0, errors.Errorf("invalid value for %s: %d", daprAppPreStopSleepSecondsKey, seconds)
+	}
+	return seconds, nil
 }
 
-func getAppPort(annotations map[string]string) (int32, error) {
-	return getInt32Annotation(annotations, daprAppPortKey)
+// getDNSNdots returns the annotated ndots option of the pod DNS config, or an empty string when
+// the annotation isn't set. The resolver caps ndots at 15.
+func getDNSNdots(annotations map[string]string) (string, error) {
+	s, ok := annotations[daprDNSNdotsKey]
+	if !ok {
+		return "", nil
+	}
+	ndots, err := strconv.Atoi(s)
+	if err != nil || ndots < 0 || ndots > 15 {
+		return "", errors.Errorf("invalid value for %s: %s, must be an integer between 0 and 15", daprDNSNdotsKey, s)
+	}
+	return strconv.Itoa(ndots), nil
 }
 
-func getConfig(annotations map[string]string) string {
-	return getStringAnnotation(annotations, daprConfigKey)
+// getDNSNdotsPatchOperations sets the ndots option of the pod DNS config, replacing the ndots
+// option of the pod if any. A lower ndots spares the lookups of the placement and sentry
+// addresses through every search domain.
+func getDNSNdotsPatchOperations(dnsConfig *corev1.PodDNSConfig, ndots string) []PatchOperation {
+	option := corev1.PodDNSConfigOption{Name: "ndots", Value: &ndots}
+	if dnsConfig == nil {
+		return []PatchOperation{
+			{
+				Op:    "add",
+				Path:  dnsConfigPath,
+				Value: corev1.PodDNSConfig{Options: []corev1.PodDNSConfigOption{option}},
+			},
+		}
+	}
+	if len(dnsConfig.Options) == 0 {
+		return []PatchOperation{
+			{
+				Op:    "add",
+				Path:  dnsConfigPath + "/options",
+				Value: []corev1.PodDNSConfigOption{option},
+			},
+		}
+	}
+	for i, o := range dnsConfig.Options {
+		if o.Name == "ndots" {
+			return []PatchOperation{
+				{
+					Op:    "replace",
+					Path:  fmt.Sprintf("%s/options/%d", dnsConfigPath, i),
+					Value: option,
+				},
+			}
+		}
+	}
+	return []PatchOperation{
+		{
+			Op:    "add",
+			Path:  dnsConfigPath + "/options/-",
+			Value: option,
+		},
+	}
 }
 
-func getProtocol(annotations map[string]string) string {
-	return getStringAnnotationOrDefault(annotations, daprAppProtocolKey, "http")
-}
+// getAppPreStopPatchOperations adds a preStop hook sleeping for the given duration to the app
+// containers that don't define one, giving endpoints time to deregister before the app stops.
+// The hook runs sleep through sh, which must be available in the app image.
+func getAppPreStopPatchOperations(containers []corev1.Container, seconds int32) []PatchOperation {
+	preStop := &corev1.Handler{
+		Exec: &corev1.ExecAction{
+			Command: []string{"sh", "-c", fmt.Sprintf("sleep %d", seconds)},
+		},
+	}
 
-func getMetricsPort(annotations map[string]string) int {
-	return int(getInt32AnnotationOrDefault(annotations, daprMetricsPortKey, defaultMetricsPort))
+	patchOps := []PatchOperation{}
+	for i, c := range containers {
+		if c.Lifecycle == nil {
+			patchOps = append(patchOps, PatchOperation{
+				Op:    "add",
+				Path:  fmt.Sprintf("%s/%d/lifecycle", containersPath, i),
+				Value: &corev1.Lifecycle{PreStop: preStop},
+			})
+		} else if c.Lifecycle.PreStop == nil {
+			patchOps = append(patchOps, PatchOperation{
+				Op:    "add",
+				Path:  fmt.Sprintf("%s/%d/lifecycle/preStop", containersPath, i),
+				Value: preStop,
+			})
+		}
+	}
+	return patchOps
 }
 
-func getAppID(pod corev1.Pod) string {
+// getReadinessGatePatchOperations adds a readiness gate for the given condition type unless the pod already has it.
+func getReadinessGatePatchOperations(gates []corev1.PodReadinessGate, conditionType corev1.PodConditionType) []PatchOperation {
+	gate := corev1.PodReadinessGate{ConditionType: conditionType}
+	if len(gates) == 0 {
+		return []PatchOperation{
+			{
+				Op:    "add",
+				Path:  readinessGatesPath,
+				Value: []corev1.PodReadinessGate{gate},
+			},
+		}
+	}
+	for _, g := range gates {
+		if g.ConditionType == conditionType {
+			return nil
+		}
+	}
+	return []PatchOperation{
+		{
+			Op:    "add",
+			Path:  readinessGatesPath + "/-",
+			Value: gate,
+		},
+	}
+}
+
+// getSidecarVolumes returns the pod volumes mounted by the sidecar container.
+func getSidecarVolumes(annotations map[string]string) []corev1.Volume {
+	volumes := []corev1.Volume{}
+	if appSecret := GetAppTokenSecret(annotations); appSecret != "" && appTokenMountEnabled(annotations) {
+		volumes = append(volumes, corev1.Volume{
+			Name: appTokenVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: appSecret,
+					Items: []corev1.KeyToPath{
+						{
+							Key:  tokenSecretKey,
+							Path: tokenSecretKey,
+						},
+					},
+				},
+			},
+		})
+	}
+	if configMap := getCABundleConfigMap(annotations); configMap != "" {
+		volumes = append(volumes, corev1.Volume{
+			Name: caBundleVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: configMap,
+					},
+				},
+			},
+		})
+	}
+	if secret := getStringAnnotation(annotations, daprAppTLSClientCertSecretKey); secret != "" {
+		volumes = append(volumes, corev1.Volume{
+			Name: appTLSClientCertVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: secret,
+					Items: []corev1.KeyToPath{
+						{Key: corev1.TLSCertKey, Path: corev1.TLSCertKey},
+						{Key: corev1.TLSPrivateKeyKey, Path: corev1.TLSPrivateKeyKey},
+					},
+				},
+			},
+		})
+	}
+	if componentCacheEnabled(annotations) {
+		volumes = append(volumes, corev1.Volume{
+			Name: componentCacheVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+	}
+	if readOnlyRootFilesystemEnabled(annotations) {
+		// daprd still needs a writable /tmp, e.g. for the temporary files of the Go runtime.
+		volumes = append(volumes, corev1.Volume{
+			Name: tmpVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+	}
+	return volumes
+}
+
+// mountTrustAnchorsEnabled returns whether the trust anchors are too large to be passed to the
+// sidecar as an env var and a ConfigMap to mount them from is configured.
+func mountTrustAnchorsEnabled(trustAnchors, configMap string, envMaxBytes int) bool {
+	return configMap != "" && trustAnchors != "" && len(trustAnchors) > envMaxBytes
+}
+
+// validateTrustAnchorsConfigMap checks that the trust anchors ConfigMap exists in the given namespace
+// and holds the trust anchors.
+func validateTrustAnchorsConfigMap(kubeClient kubernetes.Interface, namespace, configMap string) error {
+	if kubeClient == nil {
+		return errors.Errorf("trust anchors ConfigMap %s/%s could not be checked", namespace, configMap)
+	}
+	cm, err := kubeClient.CoreV1().ConfigMaps(namespace).Get(context.TODO(), configMap, meta_v1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "trust anchors ConfigMap %s/%s could not be found", namespace, configMap)
+	}
+	if _, ok := cm.Data[credentials.RootCertFilename]; !ok {
+		return errors.Errorf("trust anchors ConfigMap %s/%s has no %s key", namespace, configMap, credentials.RootCertFilename)
+	}
+	return nil
+}
+
+func getTrustAnchorsVolume(configMap string) corev1.Volume {
+	return corev1.Volume{
+		Name: trustAnchorsVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: configMap,
+				},
+				Items: []corev1.KeyToPath{
+					{
+						Key:  credentials.RootCertFilename,
+						Path: credentials.RootCertFilename,
+					},
+				},
+			},
+		},
+	}
+}
+
+// mountTrustAnchors points the sidecar at the trust anchors mounted from the trust anchors volume
+// in place of the trust anchors env var.
+func mountTrustAnchors(c *corev1.Container) {
+	env := make([]corev1.EnvVar, 0, len(c.Env))
+	for _, e := range c.Env {
+		if e.Name != certs.TrustAnchorsEnvVar {
+			env = append(env, e)
+		}
+	}
+	c.Env = env
+	c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{
+		Name:      trustAnchorsVolumeName,
+		MountPath: trustAnchorsMountPath,
+		ReadOnly:  true,
+	})
+	c.Args = append(c.Args, "--trust-anchors-file", path.Join(trustAnchorsMountPath, credentials.RootCertFilename))
+}
+
+// getTrustAnchorsAndCertChain reads the certificates from the sentry secret. Failed reads are
+// retried up to retries times, doubling the backoff between attempts, as the secret can be
+// briefly unavailable right after sentry writes it. The reads and waits end with the given
+// context and after maxCertSecretRetryWait at most, well under the webhook timeout.
+func getTrustAnchorsAndCertChain(ctx context.Context, kubeClient kubernetes.Interface, namespace string, retries int, backoff time.Duration) (string, string, string) {
+	ctx, cancel := context.WithTimeout(ctx, maxCertSecretRetryWait)
+	defer cancel()
+
+	if retries < 0 {
+		retries = 0
+	}
+	var secret *corev1.Secret
+	var err error
+	attempt := 0
+	waitErr := wait.ExponentialBackoffWithContext(ctx, wait.Backoff{Duration: backoff, Factor: 2, Steps: retries + 1}, func() (bool, error) {
+		secret, err = kubeClient.CoreV1().Secrets(namespace).Get(ctx, certs.KubeScrtName, meta_v1.GetOptions{})
+		if err != nil && attempt < retries {
+			log.Warnf("failed to get the cert secret, retrying: %s", err)
+		}
+		attempt++
+		return err == nil, nil
+	})
+	if err == nil && waitErr != nil {
+		err = waitErr
+	}
+	if err != nil {
+		log.Errorf("failed to get the cert secret: %s", err)
+		return "", "", ""
+	}
+	rootCert := secret.Data[credentials.RootCertFilename]
+	certChain := secret.Data[credentials.IssuerCertFilename]
+	certKey := secret.Data[credentials.IssuerKeyFilename]
+	return string(rootCert), string(certChain), string(certKey)
+}
+
+// mTLSEnabled returns the mTLS setting from the configuration cache once it has synced,
+// falling back to listing the configurations from the API server.
+func (i *injector) mTLSEnabled(daprClient scheme.Interface) (bool, error) {
+	if i.mtlsCache != nil {
+		if enabled, synced := i.mtlsCache.MTLSEnabled(); synced {
+			return enabled, nil
+		}
+	}
+	return mTLSEnabled(daprClient)
+}
+
+// mTLSEnabled returns the mTLS setting of the dapr system configuration. When the configuration
+// can't be loaded, mTLS is reported disabled along with the lookup error.
+func mTLSEnabled(daprClient scheme.Interface) (bool, error) {
+	resp, err := daprClient.ConfigurationV1alpha1().Configurations(meta_v1.NamespaceAll).List(meta_v1.ListOptions{})
+	if err != nil {
+		log.Errorf("Failed to load dapr configuration from k8s to determine mTLSEnabled: %s", err)
+		return false, err
+	}
+
+	for _, c := range resp.Items {
+		if c.GetName() == defaultConfig {
+			return c.Spec.MTLSSpec.Enabled, nil
+		}
+	}
+	log.Infof("Dapr system configuration (%s) is not found, use default value %t for mTLSEnabled", defaultConfig, defaultMtlsEnabled)
+	return defaultMtlsEnabled, nil
+}
+
+// logLevels lists the daprd log levels ordered from most to least verbose.
+var logLevels = []logger.LogLevel{
+	logger.DebugLevel,
+	logger.InfoLevel,
+	logger.WarnLevel,
+	logger.ErrorLevel,
+	logger.FatalLevel,
+}
+
+func getLogLevelIndex(level string) int {
+	for i, l := range logLevels {
+		if string(l) == strings.ToLower(level) {
+			return i
+		}
+	}
+	return -1
+}
+
+// validateLogLevel checks that the log level of the sidecar, from the log level annotation or the
+// --log-level flag of the extra args overriding it, is a known level and, when the pod references
+// a Dapr configuration with a minimum log level, that it is not more verbose than that minimum.
+// The minimum isn't checked without a Dapr client.
+func validateLogLevel(annotations map[string]string, namespace string, daprClient scheme.Interface) error {
+	key, level := daprLogLevel, getLogLevel(annotations)
+	if extraArgsLevel, ok := getExtraArgsLogLevel(annotations); ok {
+		key, level = daprSidecarExtraArgsKey, extraArgsLevel
+	}
+	levelIndex := getLogLevelIndex(level)
+	if levelIndex == -1 {
+		return errors.Errorf("invalid value for %s: %s", key, level)
+	}
+
+	configName := getConfig(annotations)
+	if configName == "" || daprClient == nil {
+		return nil
+	}
+
+	config, err := daprClient.ConfigurationV1alpha1().Configurations(namespace).Get(configName, meta_v1.GetOptions{})
+	if err != nil {
+		log.Warnf("Failed to load dapr configuration %s to validate log level: %s", configName, err)
+		return nil
+	}
+
+	minLevel := config.Spec.LoggingSpec.MinLevel
+	if minLevel == "" {
+		return nil
+	}
+	minLevelIndex := getLogLevelIndex(minLevel)
+	if minLevelIndex == -1 {
+		log.Warnf("Dapr configuration %s has an invalid minimum log level %s, skipping validation", configName, minLevel)
+		return nil
+	}
+	if levelIndex < minLevelIndex {
+		return errors.Errorf("log level %s is more verbose than the minimum level %s allowed by configuration %s", level, minLevel, configName)
+	}
+	return nil
+}
+
+// deprecatedAnnotations maps deprecated annotation keys to the warning returned when they are used.
+var deprecatedAnnotations = map[string]string{
+	deprecatedSidecarAPIGRPCPortKey:  fmt.Sprintf("annotation %s is deprecated, use %s instead", deprecatedSidecarAPIGRPCPortKey, sidecarAPIGRPCPortKey),
+	deprecatedSidecarHTTPPortKey:     fmt.Sprintf("annotation %s is deprecated, use %s instead", deprecatedSidecarHTTPPortKey, sidecarHTTPPortKey),
+	deprecatedSidecarInternalGRPCKey: fmt.Sprintf("annotation %s is deprecated, use %s instead", deprecatedSidecarInternalGRPCKey, sidecarInternalGRPCPortKey),
+}
+
+func getDeprecatedAnnotationWarnings(annotations map[string]string) []string {
+	warnings := []string{}
+	for key := range annotations {
+		if warning, ok := deprecatedAnnotations[key]; ok {
+			warnings = append(warnings, warning)
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+// knownAnnotations is the registry of the dapr.io annotation keys read by the injector.
+var knownAnnotations = map[string]bool{
+	daprEnabledKey:                  true,
+	daprAppPortKey:                  true,
+	daprConfigKey:                   true,
+	daprAppProtocolKey:              true,
+	appIDKey:                        true,
+	daprEnableProfilingKey:          true,
+	daprLogLevel:                    true,
+	daprAPITokenSecret:              true,
+	daprAppTokenSecret:              true,
+	daprLogAsJSON:                   true,
+	daprAppMaxConcurrencyKey:        true,
+	daprMetricsPortKey:              true,
+	daprCPULimitKey:                 true,
+	daprMemoryLimitKey:              true,
+	daprCPURequestKey:               true,
+	daprMemoryRequestKey:            true,
+	daprEphemeralStorageLimitKey:    true,
+	daprEphemeralStorageRequestKey:  true,
+	daprLivenessProbeDelayKey:       true,
+	daprLivenessProbeTimeoutKey:     true,
+	daprLivenessProbePeriodKey:      true,
+	daprLivenessProbeThresholdKey:   true,
+	daprReadinessProbeDelayKey:      true,
+	daprReadinessProbeTimeoutKey:    true,
+	daprReadinessProbePeriodKey:     true,
+	daprReadinessProbeThresholdKey:  true,
+	daprStartupProbeDelayKey:        true,
+	daprStartupProbeTimeoutKey:      true,
+	daprStartupProbePeriodKey:       true,
+	daprStartupProbeThresholdKey:    true,
+	daprMaxRequestBodySize:          true,
+	daprAppSSLKey:                   true,
+	daprOtelEndpointKey:             true,
+	daprOtelProtocolKey:             true,
+	daprSidecarImageKey:             true,
+	daprInjectMetricsProxyKey:       true,
+	daprMetricsProxyPortKey:         true,
+	daprHealthzIncludeAppIDKey:      true,
+	daprAllowPrivilegeEscalationKey: true,
+	daprLivenessProbeSchemeKey:      true,
+	daprReadinessProbeSchemeKey:     true,
+	daprSidecarBaseContainerKey:     true,
+	daprPlacementHostPortKey:        true,
+	daprPlacementHostAddressKey:     true,
+	daprAppTokenEnvNameKey:          true,
+	daprAppTokenMountKey:            true,
+	daprUsePortPoolKey:              true,
+	daprSidecarReadinessGateKey:     true,
+	daprTerminationMessagePolicyKey: true,
+	daprEnvPrependKey:               true,
+	daprGracefulShutdownSecondsKey:  true,
+	daprMemoryLimitPercentKey:       true,
+	daprCABundleConfigMapKey:        true,
+	daprCABundleMountPathKey:        true,
+	daprCABundleKeyKey:              true,
+	daprAppHealthCheckPathKey:       true,
+	daprLivenessStartupSecondsKey:   true,
+	daprSidecarImagePullPolicyKey:   true,
+	daprSidecarExtraArgsKey:         true,
+	daprDebugEffectiveConfigKey:     true,
+	daprEffectiveConfigKey:          true,
+	daprSidecarVersionKey:           true,
+	daprHealthzPathPrefixKey:        true,
+	daprProbePortKey:                true,
+	daprSidecarNoLimitsKey:          true,
+	daprAppPreStopSleepSecondsKey:   true,
+	daprSidecarAutoGoMemLimitKey:    true,
+	daprComponentCacheKey:           true,
+	daprComponentCachePathKey:       true,
+	daprPlacementHostAliasKey:       true,
+	daprInheritImagePullPolicyKey:   true,
+	daprMetricsListenAddressKey:     true,
+	daprProbeTypeKey:                true,
+	daprHealthzPathKey:              true,
+	daprLivenessOnlyHealthzKey:      true,
+	daprReadinessComponentsKey:      true,
+	daprAppTLSClientCertSecretKey:   true,
+	daprDisableLivenessProbeKey:     true,
+	daprSidecarNativeKey:            true,
+	daprEnvFromAnnotationsKey:       true,
+	daprReadOnlyRootFilesystemKey:   true,
+	daprRunAsNonRootKey:             true,
+	daprRunAsUserKey:                true,
+	daprDropCapabilitiesKey:         true,
+	daprAddCapabilitiesKey:          true,
+	daprSeccompProfileTypeKey:       true,
+	daprSeccompLocalhostProfileKey:  true,
+	daprAlignTerminationGraceKey:    true,
+	daprEnableJobInjectionKey:       true,
+	daprShutdownOnAppExitKey:        true,
+	daprAppExitIgnoredProcessesKey:  true,
+	daprDNSNdotsKey:                 true,
+	daprAppIDNamespacingKey:         true,
+	sidecarAPIGRPCPortKey:           true,
+	sidecarHTTPPortKey:              true,
+	sidecarInternalGRPCPortKey:      true,
+}
+
+// getUnknownAnnotationWarnings returns a warning for every dapr.io annotation that isn't
+// in the registry of known keys, e.g. a typo such as dapr.io/app-prot.
+func getUnknownAnnotationWarnings(annotations map[string]string) []string {
+	warnings := []string{}
+	for key := range annotations {
+		if strings.HasPrefix(key, defaultAnnotationPrefix+"/") && !knownAnnotations[key] {
+			warnings = append(warnings, fmt.Sprintf("unknown annotation %s", key))
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+// mutuallyExclusiveAnnotations lists annotation pairs that can't be set on the same pod.
+var mutuallyExclusiveAnnotations = [][2]string{
+	{sidecarAPIGRPCPortKey, deprecatedSidecarAPIGRPCPortKey},
+	{sidecarHTTPPortKey, deprecatedSidecarHTTPPortKey},
+	{sidecarInternalGRPCPortKey, deprecatedSidecarInternalGRPCKey},
+	{daprUsePortPoolKey, sidecarHTTPPortKey},
+	{daprUsePortPoolKey, sidecarAPIGRPCPortKey},
+	{daprUsePortPoolKey, sidecarInternalGRPCPortKey},
+	{daprUsePortPoolKey, deprecatedSidecarHTTPPortKey},
+	{daprUsePortPoolKey, deprecatedSidecarAPIGRPCPortKey},
+	{daprUsePortPoolKey, deprecatedSidecarInternalGRPCKey},
+	{daprMemoryLimitPercentKey, daprMemoryLimitKey},
+	{daprLivenessOnlyHealthzKey, daprHealthzPathKey},
+	{daprReadinessComponentsKey, daprHealthzPathKey},
+	{daprPlacementHostAddressKey, daprPlacementHostPortKey},
+	{daprDisableLivenessProbeKey, daprLivenessProbeDelayKey},
+	{daprDisableLivenessProbeKey, daprLivenessProbeTimeoutKey},
+	{daprDisableLivenessProbeKey, daprLivenessProbePeriodKey},
+	{daprDisableLivenessProbeKey, daprLivenessProbeThresholdKey},
+	{daprDisableLivenessProbeKey, daprLivenessProbeSchemeKey},
+	{daprDisableLivenessProbeKey, daprLivenessStartupSecondsKey},
+	{daprDisableLivenessProbeKey, daprLivenessOnlyHealthzKey},
+}
+
+func validateMutuallyExclusiveAnnotations(annotations map[string]string) error {
+	for _, pair := range mutuallyExclusiveAnnotations {
+		_, first := annotations[pair[0]]
+		_, second := annotations[pair[1]]
+		if first && second {
+			return errors.Errorf("annotations %s and %s are mutually exclusive", pair[0], pair[1])
+		}
+	}
+	return nil
+}
+
+// optionalAnnotationValidators holds the validation of the annotations that are dropped
+// instead of rejecting the pod when lenient injection is enabled.
+var optionalAnnotationValidators = map[string]func(map[string]string) error{
+	daprOtelEndpointKey: func(annotations map[string]string) error {
+		_, err := getOtelEndpoint(annotations)
+		return err
+	},
+	daprOtelProtocolKey: func(annotations map[string]string) error {
+		_, err := getOtelProtocol(annotations)
+		return err
+	},
+	daprTerminationMessagePolicyKey: func(annotations map[string]string) error {
+		_, err := getTerminationMessagePolicy(annotations)
+		return err
+	},
+	daprLivenessProbeSchemeKey: func(annotations map[string]string) error {
+		_, err := getProbeScheme(annotations, daprLivenessProbeSchemeKey)
+		return err
+	},
+	daprReadinessProbeSchemeKey: func(annotations map[string]string) error {
+		_, err := getProbeScheme(annotations, daprReadinessProbeSchemeKey)
+		return err
+	},
+	daprSidecarBaseContainerKey: func(annotations map[string]string) error {
+		_, err := getSidecarBaseContainer(annotations)
+		return err
+	},
+	daprMaxRequestBodySize: func(annotations map[string]string) error {
+		_, err := getMaxRequestBodySize(annotations)
+		return err
+	},
+	daprAppMaxConcurrencyKey: func(annotations map[string]string) error {
+		_, err := getMaxConcurrency(annotations)
+		return err
+	},
+	daprGracefulShutdownSecondsKey: func(annotations map[string]string) error {
+		_, err := getGracefulShutdownSeconds(annotations)
+		return err
+	},
+	daprAppTLSClientCertSecretKey: func(annotations map[string]string) error {
+		_, err := getAppTLSClientCertSecret(annotations)
+		return err
+	},
+	daprCABundleMountPathKey: func(annotations map[string]string) error {
+		_, err := getCABundleMountPath(annotations)
+		return err
+	},
+	daprLivenessStartupSecondsKey: func(annotations map[string]string) error {
+		_, err := getLivenessFailureThreshold(annotations, ProbeOptions{PeriodSeconds: 1})
+		return err
+	},
+	daprAppPreStopSleepSecondsKey: func(annotations map[string]string) error {
+		_, err := getAppPreStopSleepSeconds(annotations)
+		return err
+	},
+	daprDNSNdotsKey: func(annotations map[string]string) error {
+		_, err := getDNSNdots(annotations)
+		return err
+	},
+	daprHealthzPathKey: func(annotations map[string]string) error {
+		_, err := getHealthzPath(annotations)
+		return err
+	},
+	daprProbeTypeKey: func(annotations map[string]string) error {
+		_, err := getProbeType(annotations)
+		return err
+	},
+	daprMetricsListenAddressKey: func(annotations map[string]string) error {
+		_, err := getMetricsListenAddress(annotations)
+		return err
+	},
+	daprComponentCachePathKey: func(annotations map[string]string) error {
+		_, err := getComponentCachePath(annotations)
+		return err
+	},
+	daprMetricsProxyPortKey: func(annotations map[string]string) error {
+		_, err := getMetricsProxyPort(annotations)
+		return err
+	},
+	daprProbePortKey: func(annotations map[string]string) error {
+		_, err := getProbePort(annotations, 0)
+		return err
+	},
+	daprPlacementHostAddressKey: func(annotations map[string]string) error {
+		_, err := getPlacementHostAddress(annotations)
+		return err
+	},
+	daprPlacementHostPortKey: func(annotations map[string]string) error {
+		_, err := getPlacementPort(annotations, defaultPlacementPort)
+		return err
+	},
+	daprEnvFromAnnotationsKey: func(annotations map[string]string) error {
+		_, err := getEnvFromAnnotations(annotations)
+		return err
+	},
+	daprRunAsUserKey: func(annotations map[string]string) error {
+		_, err := getRunAsUser(annotations)
+		return err
+	},
+	daprDropCapabilitiesKey: func(annotations map[string]string) error {
+		_, err := getCapabilities(annotations, daprDropCapabilitiesKey)
+		return err
+	},
+	daprAddCapabilitiesKey: func(annotations map[string]string) error {
+		_, err := getCapabilities(annotations, daprAddCapabilitiesKey)
+		return err
+	},
+	daprLivenessProbeDelayKey:      getProbeTimingValidator(daprLivenessProbeDelayKey),
+	daprLivenessProbeTimeoutKey:    getProbeTimingValidator(daprLivenessProbeTimeoutKey),
+	daprLivenessProbePeriodKey:     getProbeTimingValidator(daprLivenessProbePeriodKey),
+	daprLivenessProbeThresholdKey:  getProbeTimingValidator(daprLivenessProbeThresholdKey),
+	daprReadinessProbeDelayKey:     getProbeTimingValidator(daprReadinessProbeDelayKey),
+	daprReadinessProbeTimeoutKey:   getProbeTimingValidator(daprReadinessProbeTimeoutKey),
+	daprReadinessProbePeriodKey:    getProbeTimingValidator(daprReadinessProbePeriodKey),
+	daprReadinessProbeThresholdKey: getProbeTimingValidator(daprReadinessProbeThresholdKey),
+	daprStartupProbeDelayKey:       getProbeTimingValidator(daprStartupProbeDelayKey),
+	daprStartupProbeTimeoutKey:     getProbeTimingValidator(daprStartupProbeTimeoutKey),
+	daprStartupProbePeriodKey:      getProbeTimingValidator(daprStartupProbePeriodKey),
+	daprStartupProbeThresholdKey:   getProbeTimingValidator(daprStartupProbeThresholdKey),
+	daprCPULimitKey:                getResourceQuantityValidator(daprCPULimitKey),
+	daprMemoryLimitKey:             getResourceQuantityValidator(daprMemoryLimitKey),
+	daprCPURequestKey:              getResourceQuantityValidator(daprCPURequestKey),
+	daprMemoryRequestKey:           getResourceQuantityValidator(daprMemoryRequestKey),
+	daprEphemeralStorageLimitKey:   getResourceQuantityValidator(daprEphemeralStorageLimitKey),
+	daprEphemeralStorageRequestKey: getResourceQuantityValidator(daprEphemeralStorageRequestKey),
+	daprSeccompProfileTypeKey: func(annotations map[string]string) error {
+		_, err := getSeccompProfile(annotations)
+		return err
+	},
+	daprSeccompLocalhostProfileKey: func(annotations map[string]string) error {
+		_, err := getSeccompProfile(annotations)
+		return err
+	},
+}
+
+// probeTimingAnnotations lists the annotations setting the delays, periods and thresholds of the
+// sidecar probes.
+var probeTimingAnnotations = []string{
+	daprLivenessProbeDelayKey,
+	daprLivenessProbeTimeoutKey,
+	daprLivenessProbePeriodKey,
+	daprLivenessProbeThresholdKey,
+	daprReadinessProbeDelayKey,
+	daprReadinessProbeTimeoutKey,
+	daprReadinessProbePeriodKey,
+	daprReadinessProbeThresholdKey,
+	daprStartupProbeDelayKey,
+	daprStartupProbeTimeoutKey,
+	daprStartupProbePeriodKey,
+	daprStartupProbeThresholdKey,
+}
+
+// validateProbeTiming rejects a negative probe timing annotation, which Kubernetes would reject
+// with an error that doesn't mention the annotation.
+func validateProbeTiming(annotations map[string]string, key string) error {
+	s, ok := annotations[key]
+	if !ok {
+		return nil
+	}
+	value, err := strconv.ParseInt(s, 10, 32)
+	if err == nil && value < 0 {
+		return errors.Errorf("invalid value for %s: %s, must not be negative", key, s)
+	}
+	return nil
+}
+
+func getProbeTimingValidator(key string) func(map[string]string) error {
+	return func(annotations map[string]string) error {
+		return validateProbeTiming(annotations, key)
+	}
+}
+
+func getResourceQuantityValidator(key string) func(map[string]string) error {
+	return func(annotations map[string]string) error {
+		if _, err := resource.ParseQuantity(annotations[key]); err != nil {
+			return errors.Wrapf(err, "invalid value for %s: %s", key, annotations[key])
+		}
+		return nil
+	}
+}
+
+// dropInvalidOptionalAnnotations returns the annotations without the optional annotations that
+// fail validation, along with a warning for every dropped annotation.
+func dropInvalidOptionalAnnotations(annotations map[string]string) (map[string]string, []string) {
+	keys := make([]string, 0, len(optionalAnnotationValidators))
+	for key := range optionalAnnotationValidators {
+		if _, ok := annotations[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	warnings := []string{}
+	var valid map[string]string
+	for _, key := range keys {
+		err := optionalAnnotationValidators[key](annotations)
+		if err == nil {
+			continue
+		}
+		if valid == nil {
+			valid = make(map[string]string, len(annotations))
+			for k, v := range annotations {
+				valid[k] = v
+			}
+		}
+		delete(valid, key)
+		warnings = append(warnings, fmt.Sprintf("ignoring annotation %s: %s", key, err))
+	}
+
+	if valid == nil {
+		return annotations, warnings
+	}
+	return valid, warnings
+}
+
+// hostNetworkPortAnnotations lists the sidecar port annotations, including their deprecated
+// equivalents, that must be set on pods using the host network.
+var hostNetworkPortAnnotations = [][2]string{
+	{sidecarHTTPPortKey, deprecatedSidecarHTTPPortKey},
+	{sidecarAPIGRPCPortKey, deprecatedSidecarAPIGRPCPortKey},
+	{sidecarInternalGRPCPortKey, deprecatedSidecarInternalGRPCKey},
+	{daprMetricsPortKey, daprMetricsPortKey},
+}
+
+// validateHostNetworkPorts rejects pods using the host network unless every sidecar port is set
+// explicitly, either annotated or assigned from the port pool, since the default ports would
+// collide between the pods running on the same node.
+func validateHostNetworkPorts(pod corev1.Pod) error {
+	if !pod.Spec.HostNetwork {
+		return nil
+	}
+	// The pool hands out the same ports to every pod, which collide on the node.
+	if usePortPool(pod.Annotations) {
+		return errors.Errorf("%s can't be used by pods with hostNetwork enabled, set the sidecar ports explicitly", daprUsePortPoolKey)
+	}
+
+	missing := []string{}
+	for _, keys := range hostNetworkPortAnnotations {
+		_, ok := pod.Annotations[keys[0]]
+		_, deprecatedOK := pod.Annotations[keys[1]]
+		if !ok && !deprecatedOK {
+			missing = append(missing, keys[0])
+		}
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("pods with hostNetwork enabled must set the sidecar ports explicitly to avoid collisions on the node, missing annotations: %s",
+			strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// validateLimitRanges checks the sidecar resource requirements against the container limits
+// of the LimitRanges in the pod namespace, which would otherwise cause the pod to be rejected.
+func validateLimitRanges(resources corev1.ResourceRequirements, namespace string, kubeClient kubernetes.Interface) error {
+	if kubeClient == nil {
+		return nil
+	}
+
+	limitRanges, err := kubeClient.CoreV1().LimitRanges(namespace).List(context.TODO(), meta_v1.ListOptions{})
+	if err != nil {
+		log.Warnf("failed to list limit ranges in namespace %s, skipping validation: %s", namespace, err)
+		return nil
+	}
+
+	for _, lr := range limitRanges.Items {
+		for _, item := range lr.Spec.Limits {
+			if item.Type != corev1.LimitTypeContainer {
+				continue
+			}
+			for _, values := range []struct {
+				kind string
+				list corev1.ResourceList
+			}{
+				{"request", resources.Requests},
+				{"limit", resources.Limits},
+			} {
+				names := make([]string, 0, len(values.list))
+				for name := range values.list {
+					names = append(names, string(name))
+				}
+				sort.Strings(names)
+
+				for _, n := range names {
+					name := corev1.ResourceName(n)
+					quantity := values.list[name]
+					if max, ok := item.Max[name]; ok && quantity.Cmp(max) > 0 {
+						return errors.Errorf("sidecar %s %s %s exceeds the maximum %s allowed by LimitRange %s",
+							name, values.kind, quantity.String(), max.String(), lr.Name)
+					}
+					if min, ok := item.Min[name]; ok && quantity.Cmp(min) < 0 {
+						return errors.Errorf("sidecar %s %s %s is below the minimum %s allowed by LimitRange %s",
+							name, values.kind, quantity.String(), min.String(), lr.Name)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// getMissingSecretWarnings returns a warning for every token secret referenced by the annotations
+// that can't be found in the pod namespace.
+func getMissingSecretWarnings(annotations map[string]string, namespace string, kubeClient kubernetes.Interface) []string {
+	warnings := []string{}
+	if kubeClient == nil {
+		return warnings
+	}
+	for _, key := range []string{daprAPITokenSecret, daprAppTokenSecret} {
+		name := getStringAnnotation(annotations, key)
+		if name == "" {
+			continue
+		}
+		_, err := kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), name, meta_v1.GetOptions{})
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("secret %s referenced by annotation %s could not be found: %s", name, key, err))
+		}
+	}
+	return warnings
+}
+
+// getMissingServiceAccountWarnings returns a warning when the service account used as the mTLS
+// identity of the sidecar can't be found, since sentry would reject the sidecar.
+func getMissingServiceAccountWarnings(serviceAccountName, namespace string, kubeClient kubernetes.Interface) []string {
+	warnings := []string{}
+	if kubeClient == nil {
+		return warnings
+	}
+	if serviceAccountName == "" {
+		serviceAccountName = "default"
+	}
+	_, err := kubeClient.CoreV1().ServiceAccounts(namespace).Get(context.TODO(), serviceAccountName, meta_v1.GetOptions{})
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("service account %s used as the mTLS identity could not be found: %s", serviceAccountName, err))
+	}
+	return warnings
+}
+
+func usePortPool(annotations map[string]string) bool {
+	return getBoolAnnotationOrDefault(annotations, daprUsePortPoolKey, false)
+}
+
+// assignPortsFromPool picks the first HTTP, gRPC and internal gRPC ports in the pool that aren't used
+// by the pod's containers or the metrics port, and returns a copy of the pod annotations with the
+// sidecar port annotations set to them.
+func assignPortsFromPool(pod corev1.Pod, start, end int32) (map[string]string, error) {
+	if start <= 0 || end <= 0 {
+		return nil, errors.Errorf("%s is set but the injector port pool is not configured", daprUsePortPoolKey)
+	}
+
+	used := map[int32]bool{
+		int32(getMetricsPort(pod.Annotations)): true,
+	}
+	for _, c := range pod.Spec.Containers {
+		for _, p := range c.Ports {
+			used[p.ContainerPort] = true
+		}
+	}
+
+	ports := []int32{}
+	for port := start; port <= end && len(ports) < 3; port++ {
+		if !used[port] {
+			ports = append(ports, port)
+		}
+	}
+	if len(ports) < 3 {
+		return nil, errors.Errorf("not enough free ports in the injector port pool %d-%d", start, end)
+	}
+
+	annotations := make(map[string]string, len(pod.Annotations)+3)
+	for k, v := range pod.Annotations {
+		annotations[k] = v
+	}
+	annotations[sidecarHTTPPortKey] = strconv.Itoa(int(ports[0]))
+	annotations[sidecarAPIGRPCPortKey] = strconv.Itoa(int(ports[1]))
+	annotations[sidecarInternalGRPCPortKey] = strconv.Itoa(int(ports[2]))
+	return annotations, nil
+}
+
+func getTokenVolumeMount(pod corev1.Pod) *corev1.VolumeMount {
+	for _, c := range pod.Spec.Containers {
+		for _, v := range c.VolumeMounts {
+			if v.MountPath == kubernetesMountPath {
+				return &v
+			}
+		}
+	}
+	return nil
+}
+
+func isJobPod(pod *corev1.Pod) bool {
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "Job" && strings.HasPrefix(owner.APIVersion, "batch/") {
+			return true
+		}
+	}
+	return false
+}
+
+// getAppExitIgnoredProcesses returns the names of the processes daprd doesn't wait for when
+// shutting down on app exit, the annotated ones and those of the injected metrics proxy.
+func getAppExitIgnoredProcesses(annotations map[string]string) []string {
+	var ignored []string
+	for _, name := range strings.Split(getStringAnnotation(annotations, daprAppExitIgnoredProcessesKey), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			ignored = append(ignored, name)
+		}
+	}
+	if metricsProxyEnabled(annotations) {
+		ignored = append(ignored, metricsProxyProcessName)
+	}
+	return ignored
+}
+
+func podContainsSidecarContainer(pod *corev1.Pod) bool {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == sidecarContainerName {
+			return true
+		}
+	}
+	for _, c := range pod.Spec.InitContainers {
+		if c.Name == sidecarContainerName {
+			return true
+		}
+	}
+	return false
+}
+
+func sidecarNativeEnabled(annotations map[string]string) bool {
+	return getBoolAnnotationOrDefault(annotations, daprSidecarNativeKey, false)
+}
+
+// getNativeSidecarContainer returns the sidecar as a native sidecar, an init container with
+// restartPolicy Always that Kubernetes 1.28+ starts before and stops after the app containers.
+// The vendored Kubernetes API predates the container restartPolicy field, so the container is
+// converted to its JSON representation to set it.
+func getNativeSidecarContainer(sidecar *corev1.Container) (map[string]interface{}, error) {
+	b, err := json.Marshal(sidecar)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not marshal the sidecar container")
+	}
+	var native map[string]interface{}
+	if err := json.Unmarshal(b, &native); err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal the sidecar container")
+	}
+	native["restartPolicy"] = containerRestartPolicyAlways
+	return native, nil
+}
+
+// getInitContainerPatchOperation appends the given container to the pod init containers.
+func getInitContainerPatchOperation(initContainers []corev1.Container, container interface{}) PatchOperation {
+	if len(initContainers) == 0 {
+		return PatchOperation{
+			Op:    "add",
+			Path:  initContainersPath,
+			Value: []interface{}{container},
+		}
+	}
+	return PatchOperation{
+		Op:    "add",
+		Path:  initContainersPath + "/-",
+		Value: container,
+	}
+}
+
+func getMaxConcurrency(annotations map[string]string) (int32, error) {
+	return getInt32Annotation(annotations, daprAppMaxConcurrencyKey)
+}
+
+// getGracefulShutdownSeconds returns the annotated shutdown window of daprd, or -1 when it isn't set.
+func getGracefulShutdownSeconds(annotations map[string]string) (int32, error) {
+	seconds, err := getInt32Annotation(annotations, daprGracefulShutdownSecondsKey)
+	if err != nil {
+		return -1, err
+	}
+	if _, ok := annotations[daprGracefulShutdownSecondsKey]; ok && seconds < 0 {
+		return -1, errors.Errorf("invalid value for %s: %d", daprGracefulShutdownSecondsKey, seconds)
+	}
+	return seconds, nil
+}
+
+// getSidecarLifecycle returns a preStop hook asking daprd to stop reporting ready and to wait
+// for the graceful shutdown window before the sidecar is sent SIGTERM, or nil when no window is set.
+// The wait counts towards the termination grace period of the pod. The hook runs daprd in the
+// sidecar container, since daprd only accepts drain requests from local callers.
+func getSidecarLifecycle(httpPort, gracefulShutdownSeconds int32) *corev1.Lifecycle {
+	if gracefulShutdownSeconds <= 0 {
+		return nil
+	}
+	return &corev1.Lifecycle{
+		PreStop: &corev1.Handler{
+			Exec: &corev1.ExecAction{
+				Command: []string{
+					"/daprd", sidecarDrainCommand,
+					"--dapr-http-port", fmt.Sprintf("%v", httpPort),
+					"--seconds", fmt.Sprintf("%v", gracefulShutdownSeconds),
+				},
+			},
+		},
+	}
+}
+
+// getAlignedSidecarLifecycle replaces the preStop hook of the given sidecar lifecycle with the
+// aligned one, keeping the other hooks of the base container. The aligned hook can't be combined
+// with a preStop hook of the base container, which would otherwise be silently dropped.
+func getAlignedSidecarLifecycle(annotations map[string]string, lifecycle *corev1.Lifecycle, preStopSeconds int32) (*corev1.Lifecycle, error) {
+	// The annotation has already been validated when building the sidecar container.
+	if base, _ := getSidecarBaseContainer(annotations); base != nil && hasPreStop(base.Lifecycle) {
+		return nil, errors.Errorf("%s can't be combined with a preStop hook in %s", daprAlignTerminationGraceKey, daprSidecarBaseContainerKey)
+	}
+
+	aligned := getSidecarLifecycle(getSideCarHTTPPort(annotations), preStopSeconds)
+	if lifecycle == nil || lifecycle.PostStart == nil {
+		return aligned, nil
+	}
+	merged := &corev1.Lifecycle{PostStart: lifecycle.PostStart}
+	if aligned != nil {
+		merged.PreStop = aligned.PreStop
+	}
+	return merged, nil
+}
+
+// getAlignedPreStopSeconds returns how long the sidecar preStop hook waits so that daprd is sent
+// SIGTERM once only its drain window is left of the termination grace period of the pod, which
+// keeps the sidecar up for as long as the app containers may run.
+func getAlignedPreStopSeconds(terminationGracePeriodSeconds *int64, drainSeconds int32) int32 {
+	gracePeriod := int64(defaultTerminationGracePeriodSeconds)
+	if terminationGracePeriodSeconds != nil {
+		gracePeriod = *terminationGracePeriodSeconds
+	}
+	seconds := gracePeriod - int64(drainSeconds)
+	if seconds <= 0 {
+		return 0
+	}
+	if seconds > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return int32(seconds)
+}
+
+func getAppPort(annotations map[string]string) (int32, error) {
+	return getInt32Annotation(annotations, daprAppPortKey)
+}
+
+func getConfig(annotations map[string]string) string {
+	return getStringAnnotation(annotations, daprConfigKey)
+}
+
+func getProtocol(annotations map[string]string) string {
+	return getStringAnnotationOrDefault(annotations, daprAppProtocolKey, "http")
+}
+
+// getAppProtocol returns the protocol daprd uses to reach the app. The app protocol annotation
+// either holds a single protocol or maps ports to protocols, such as 5000=grpc,8080=http. Since
+// daprd only talks to the app port, the protocol mapped to it is used and the other entries
+// are only validated.
+func getAppProtocol(annotations map[string]string, appPort int32) (string, error) {
+	protocol := getProtocol(annotations)
+	if !strings.Contains(protocol, "=") {
+		return protocol, nil
+	}
+
+	protocols, err := parseAppProtocolMap(protocol)
+	if err != nil {
+		return "", err
+	}
+	protocol, ok := protocols[appPort]
+	if !ok {
+		return "", errors.Errorf("invalid value for %s: no protocol for app port %d", daprAppProtocolKey, appPort)
+	}
+	return protocol, nil
+}
+
+func parseAppProtocolMap(value string) (map[int32]string, error) {
+	protocols := map[int32]string{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.Errorf("invalid value for %s: %s", daprAppProtocolKey, entry)
+		}
+		port, err := strconv.ParseInt(strings.TrimSpace(kv[0]), 10, 32)
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, errors.Errorf("invalid value for %s: invalid port in %s", daprAppProtocolKey, entry)
+		}
+		protocol := strings.ToLower(strings.TrimSpace(kv[1]))
+		if protocol != "http" && protocol != "grpc" {
+			return nil, errors.Errorf("invalid value for %s: invalid protocol in %s", daprAppProtocolKey, entry)
+		}
+		if _, ok := protocols[int32(port)]; ok {
+			return nil, errors.Errorf("invalid value for %s: duplicate port %d", daprAppProtocolKey, port)
+		}
+		protocols[int32(port)] = protocol
+	}
+	return protocols, nil
+}
+
+func getMetricsPort(annotations map[string]string) int {
+	return int(getInt32AnnotationOrDefault(annotations, daprMetricsPortKey, defaultMetricsPort))
+}
+
+// getMetricsListenAddress returns the address the sidecar metrics server binds to, which must
+// be an IP address or localhost. An empty address binds to all interfaces.
+func getMetricsListenAddress(annotations map[string]string) (string, error) {
+	address := getStringAnnotation(annotations, daprMetricsListenAddressKey)
+	if address == "" || address == "localhost" || net.ParseIP(address) != nil {
+		return address, nil
+	}
+	return "", errors.Errorf("invalid value for %s: %s", daprMetricsListenAddressKey, address)
+}
+
+// injectedSidecarEnvVars are the env vars set on the sidecar by the injector. Env vars from annotations
+// come after them and would win, so they can't override the identity, the credentials or the settings
+// of the sidecar.
+var injectedSidecarEnvVars = map[string]bool{
+	utils.HostIPEnvVar:                true,
+	"NAMESPACE":                       true,
+	"SENTRY_LOCAL_IDENTITY":           true,
+	certs.TrustAnchorsEnvVar:          true,
+	certs.CertChainEnvVar:             true,
+	certs.CertKeyEnvVar:               true,
+	auth.APITokenEnvVar:               true,
+	auth.AppAPITokenEnvVar:            true,
+	auth.AppAPITokenFileEnvVar:        true,
+	goMemLimitEnvVar:                  true,
+	daprHostNameEnvVar:                true,
+	userContainerDaprMTLSEnabled:      true,
+	otelExporterEndpointEnvVar:        true,
+	otelExporterProtocolEnvVar:        true,
+	sslCertFileEnvVar:                 true,
+	sslCertDirEnvVar:                  true,
+	componentCacheDirEnvVar:           true,
+	userContainerDaprHTTPPortName:     true,
+	userContainerDaprGRPCPortName:     true,
+	userContainerDaprGracefulShutdown: true,
+}
+
+// getEnvFromAnnotations returns an env var for every pod annotation listed in the comma separated
+// value of dapr.io/env-from-annotations. The name of the env var is the annotation key uppercased,
+// with any character not allowed in an env var name replaced by an underscore, so that
+// example.com/team-name becomes EXAMPLE_COM_TEAM_NAME. Listed annotations missing from the pod are
+// skipped, and annotations mapped to an env var set by the injector are rejected.
+func getEnvFromAnnotations(annotations map[string]string) ([]corev1.EnvVar, error) {
+	envs := []corev1.EnvVar{}
+	for _, key := range strings.Split(getStringAnnotation(annotations, daprEnvFromAnnotationsKey), ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		name := getEnvNameFromAnnotationKey(key)
+		if name[0] >= '0' && name[0] <= '9' {
+			return nil, errors.Errorf("invalid value for %s: %s can't be used as an env var name", daprEnvFromAnnotationsKey, key)
+		}
+		if injectedSidecarEnvVars[name] {
+			return nil, errors.Errorf("invalid value for %s: %s can't override the %s env var set by the injector", daprEnvFromAnnotationsKey, key, name)
+		}
+		value, ok := annotations[key]
+		if !ok {
+			continue
+		}
+		envs = append(envs, corev1.EnvVar{
+			Name:  name,
+			Value: value,
+		})
+	}
+	return envs, nil
+}
+
+func hasEnvVar(envs []corev1.EnvVar, name string) bool {
+	for _, env := range envs {
+		if env.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func getEnvNameFromAnnotationKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(key))
+}
+
+func getAppID(pod corev1.Pod) string {
 	return getStringAnnotationOrDefault(pod.Annotations, appIDKey, pod.GetName())
 }
 
-func getLogLevel(annotations map[string]string) string {
-	return getStringAnnotationOrDefault(annotations, daprLogLevel, defaultLogLevel)
+func getLogLevel(annotations map[string]string) string {
+	return getStringAnnotationOrDefault(annotations, daprLogLevel, defaultLogLevel)
+}
+
+func logAsJSONEnabled(annotations map[string]string) bool {
+	return getBoolAnnotationOrDefault(annotations, daprLogAsJSON, defaultLogAsJSON)
+}
+
+func profilingEnabled(annotations map[string]string) bool {
+	return getBoolAnnotationOrDefault(annotations, daprEnableProfilingKey, false)
+}
+
+func appSSLEnabled(annotations map[string]string) bool {
+	return getBoolAnnotationOrDefault(annotations, daprAppSSLKey, defaultAppSSL)
+}
+
+// getAppTLSClientCertSecret returns the name of the kubernetes.io/tls secret holding the client
+// certificate daprd presents to the app. It requires the app to be reached over TLS.
+func getAppTLSClientCertSecret(annotations map[string]string) (string, error) {
+	secret := getStringAnnotation(annotations, daprAppTLSClientCertSecretKey)
+	if secret != "" && !appSSLEnabled(annotations) {
+		return "", errors.Errorf("invalid value for %s: %s requires %s to be enabled", daprAppTLSClientCertSecretKey, secret, daprAppSSLKey)
+	}
+	return secret, nil
+}
+
+// The sidecar port getters read the dapr.io annotations, or the deprecated vendor-specific ones,
+// which are mutually exclusive with them.
+func getSideCarAPIGRPCPort(annotations map[string]string) int32 {
+	return getInt32AnnotationOrDefault(annotations, getPortAnnotationKey(annotations, sidecarAPIGRPCPortKey, deprecatedSidecarAPIGRPCPortKey), defaultSidecarAPIGRPCPort)
+}
+
+func getSideCarHTTPPort(annotations map[string]string) int32 {
+	return getInt32AnnotationOrDefault(annotations, getPortAnnotationKey(annotations, sidecarHTTPPortKey, deprecatedSidecarHTTPPortKey), defaultSidecarHTTPPort)
+}
+
+func getSideCarInternalGRPCPort(annotations map[string]string) int32 {
+	return getInt32AnnotationOrDefault(annotations, getPortAnnotationKey(annotations, sidecarInternalGRPCPortKey, deprecatedSidecarInternalGRPCKey), defaultSidecarInternalGRPCPortKey)
+}
+
+func getPortAnnotationKey(annotations map[string]string, key, deprecatedKey string) string {
+	if _, ok := annotations[deprecatedKey]; ok {
+		return deprecatedKey
+	}
+	return key
+}
+
+func envPrependEnabled(annotations map[string]string) bool {
+	return getBoolAnnotationOrDefault(annotations, daprEnvPrependKey, false)
+}
+
+func getAPITokenSecret(annotations map[string]string) string {
+	return getStringAnnotationOrDefault(annotations, daprAPITokenSecret, "")
+}
+
+func GetAppTokenSecret(annotations map[string]string) string {
+	return getStringAnnotationOrDefault(annotations, daprAppTokenSecret, "")
+}
+
+func getAppTokenEnvName(annotations map[string]string) string {
+	return getStringAnnotationOrDefault(annotations, daprAppTokenEnvNameKey, auth.AppAPITokenEnvVar)
+}
+
+// getAppTokenEnv returns an env var holding the app token of the given secret.
+func getAppTokenEnv(name, secret string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				Key: tokenSecretKey,
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: secret,
+				},
+			},
+		},
+	}
+}
+
+// getAppContainerAppTokenEnv returns the env vars holding the app token for the app containers,
+// which are only set when the app token env var is renamed so the app can verify the token sent
+// by daprd.
+func getAppContainerAppTokenEnv(annotations map[string]string) []corev1.EnvVar {
+	secret := GetAppTokenSecret(annotations)
+	name := getAppTokenEnvName(annotations)
+	if secret == "" || name == auth.AppAPITokenEnvVar {
+		return nil
+	}
+	return []corev1.EnvVar{getAppTokenEnv(name, secret)}
+}
+
+func appTokenMountEnabled(annotations map[string]string) bool {
+	return getBoolAnnotationOrDefault(annotations, daprAppTokenMountKey, false)
+}
+
+func getCABundleConfigMap(annotations map[string]string) string {
+	return getStringAnnotation(annotations, daprCABundleConfigMapKey)
+}
+
+func getCABundleMountPath(annotations map[string]string) (string, error) {
+	mountPath := getStringAnnotationOrDefault(annotations, daprCABundleMountPathKey, defaultCABundleMountPath)
+	if !path.IsAbs(mountPath) {
+		return "", errors.Errorf("invalid value for %s: %s", daprCABundleMountPathKey, mountPath)
+	}
+	return mountPath, nil
+}
+
+func getCABundleKey(annotations map[string]string) string {
+	return getStringAnnotationOrDefault(annotations, daprCABundleKeyKey, defaultCABundleKey)
+}
+
+func componentCacheEnabled(annotations map[string]string) bool {
+	return getBoolAnnotationOrDefault(annotations, daprComponentCacheKey, false)
+}
+
+func readOnlyRootFilesystemEnabled(annotations map[string]string) bool {
+	return getBoolAnnotationOrDefault(annotations, daprReadOnlyRootFilesystemKey, false)
+}
+
+func runAsNonRootEnabled(annotations map[string]string) bool {
+	return getBoolAnnotationOrDefault(annotations, daprRunAsNonRootKey, false)
+}
+
+// getRunAsUser returns the UID the sidecar runs as, or nil when it isn't set. UID 0 is rejected
+// when the sidecar is also required to run as non-root, since the container would never start.
+func getRunAsUser(annotations map[string]string) (*int64, error) {
+	s, ok := annotations[daprRunAsUserKey]
+	if !ok {
+		return nil, nil
+	}
+	uid, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || uid < 0 {
+		return nil, errors.Errorf("invalid value for %s: %s", daprRunAsUserKey, s)
+	}
+	if uid == 0 && runAsNonRootEnabled(annotations) {
+		return nil, errors.Errorf("invalid value for %s: %s can't be used with %s", daprRunAsUserKey, s, daprRunAsNonRootKey)
+	}
+	return &uid, nil
+}
+
+// getCapabilities returns the Linux capabilities listed in the comma separated value of the given
+// annotation, uppercased, such as NET_BIND_SERVICE or ALL. Adding ALL is rejected since it is as
+// good as running the sidecar privileged.
+func getCapabilities(annotations map[string]string, key string) ([]corev1.Capability, error) {
+	var capabilities []corev1.Capability
+	for _, c := range strings.Split(getStringAnnotation(annotations, key), ",") {
+		c = strings.ToUpper(strings.TrimSpace(c))
+		if c == "" {
+			continue
+		}
+		if !isValidCapability(c) || (key == daprAddCapabilitiesKey && c == "ALL") {
+			return nil, errors.Errorf("invalid value for %s: %s", key, c)
+		}
+		capabilities = append(capabilities, corev1.Capability(c))
+	}
+	return capabilities, nil
+}
+
+// getSeccompProfile returns the seccomp profile of the sidecar, or nil when the profile type isn't
+// set. Localhost profiles need a path relative to the seccomp profile directory of the kubelet.
+func getSeccompProfile(annotations map[string]string) (*corev1.SeccompProfile, error) {
+	profileType := getStringAnnotation(annotations, daprSeccompProfileTypeKey)
+	localhostProfile := getStringAnnotation(annotations, daprSeccompLocalhostProfileKey)
+	if profileType == "" {
+		if localhostProfile != "" {
+			return nil, errors.Errorf("%s is set without %s", daprSeccompLocalhostProfileKey, daprSeccompProfileTypeKey)
+		}
+		return nil, nil
+	}
+
+	switch corev1.SeccompProfileType(profileType) {
+	case corev1.SeccompProfileTypeRuntimeDefault, corev1.SeccompProfileTypeUnconfined:
+		if localhostProfile != "" {
+			return nil, errors.Errorf("%s can only be set with the %s profile type", daprSeccompLocalhostProfileKey, corev1.SeccompProfileTypeLocalhost)
+		}
+		return &corev1.SeccompProfile{Type: corev1.SeccompProfileType(profileType)}, nil
+	case corev1.SeccompProfileTypeLocalhost:
+		if localhostProfile == "" || path.IsAbs(localhostProfile) || strings.Contains(localhostProfile, "..") {
+			return nil, errors.Errorf("invalid value for %s: %q", daprSeccompLocalhostProfileKey, localhostProfile)
+		}
+		return &corev1.SeccompProfile{
+			Type:             corev1.SeccompProfileTypeLocalhost,
+			LocalhostProfile: &localhostProfile,
+		}, nil
+	default:
+		return nil, errors.Errorf("invalid value for %s: %s", daprSeccompProfileTypeKey, profileType)
+	}
+}
+
+func isValidCapability(c string) bool {
+	for i, r := range c {
+		if (r < 'A' || r > 'Z') && (i == 0 || ((r < '0' || r > '9') && r != '_')) {
+			return false
+		}
+	}
+	return true
 }
 
-func logAsJSONEnabled(annotations map[string]string) bool {
-	return getBoolAnnotationOrDefault(annotations, daprLogAsJSON, defaultLogAsJSON)
+func getComponentCachePath(annotations map[string]string) (string, error) {
+	cachePath := getStringAnnotationOrDefault(annotations, daprComponentCachePathKey, defaultComponentCachePath)
+	if !path.IsAbs(cachePath) {
+		return "", errors.Errorf("invalid value for %s: %s", daprComponentCachePathKey, cachePath)
+	}
+	return cachePath, nil
 }
 
-func profilingEnabled(annotations map[string]string) bool {
-	return getBoolAnnotationOrDefault(annotations, daprEnableProfilingKey, false)
+// getMaxRequestBodySize returns the max request body size of daprd in MB. Bare integers are
+// read as MB, quantities such as 4Mi or 512Ki are converted and rounded up to the next MB.
+func getMaxRequestBodySize(annotations map[string]string) (int32, error) {
+	s, ok := annotations[daprMaxRequestBodySize]
+	if !ok {
+		return -1, nil
+	}
+	var size int64
+	if value, err := strconv.ParseInt(s, 10, 64); err == nil {
+		size = value
+	} else {
+		quantity, err := resource.ParseQuantity(s)
+		if err != nil {
+			return -1, errors.Wrapf(err, "invalid value for %s: %s", daprMaxRequestBodySize, s)
+		}
+		bytes := quantity.Value()
+		size = bytes / bytesPerMB
+		if bytes%bytesPerMB != 0 {
+			size++
+		}
+	}
+	if size < 0 || size > math.MaxInt32 {
+		return -1, errors.Errorf("invalid value for %s: %s, the size must be between 0 and %dMB", daprMaxRequestBodySize, s, math.MaxInt32)
+	}
+	return int32(size), nil
 }
 
-func appSSLEnabled(annotations map[string]string) bool {
-	return getBoolAnnotationOrDefault(annotations, daprAppSSLKey, defaultAppSSL)
+func getOtelEndpoint(annotations map[string]string) (string, error) {
+	endpoint := getStringAnnotation(annotations, daprOtelEndpointKey)
+	if endpoint == "" {
+		return "", nil
+	}
+	u, err := url.ParseRequestURI(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", errors.Errorf("invalid value for %s: %s is not a valid URL", daprOtelEndpointKey, endpoint)
+	}
+	return endpoint, nil
 }
 
-func getSideCarAPIGRPCPort(annotations map[string]string) int32 {
-	return getInt32AnnotationOrDefault(annotations, sidecarAPIGRPCPortKey, defaultSidecarAPIGRPCPort)
+func getOtelProtocol(annotations map[string]string) (string, error) {
+	protocol := getStringAnnotation(annotations, daprOtelProtocolKey)
+	switch protocol {
+	case "", "grpc", "http/protobuf", "http/json":
+		return protocol, nil
+	default:
+		return "", errors.Errorf("invalid value for %s: %s", daprOtelProtocolKey, protocol)
+	}
 }
 
-func getSideCarHTTPPort(annotations map[string]string) int32 {
-	return getInt32AnnotationOrDefault(annotations, sidecarHTTPPortKey, defaultSidecarHTTPPort)
+func getTerminationMessagePolicy(annotations map[string]string) (corev1.TerminationMessagePolicy, error) {
+	policy := getStringAnnotationOrDefault(annotations, daprTerminationMessagePolicyKey, string(corev1.TerminationMessageFallbackToLogsOnError))
+	switch corev1.TerminationMessagePolicy(policy) {
+	case corev1.TerminationMessageReadFile, corev1.TerminationMessageFallbackToLogsOnError:
+		return corev1.TerminationMessagePolicy(policy), nil
+	default:
+		return "", errors.Errorf("invalid value for %s: %s", daprTerminationMessagePolicyKey, policy)
+	}
 }
 
-func getSideCarInternalGRPCPort(annotations map[string]string) int32 {
-	return getInt32AnnotationOrDefault(annotations, sidecarInternalGRPCPortKey, defaultSidecarInternalGRPCPortKey)
+func metricsProxyEnabled(annotations map[string]string) bool {
+	return getBoolAnnotationOrDefault(annotations, daprInjectMetricsProxyKey, false)
 }
 
-func getAPITokenSecret(annotations map[string]string) string {
-	return getStringAnnotationOrDefault(annotations, daprAPITokenSecret, "")
+// getMetricsProxyPort returns the port the metrics proxy listens on, 9091 by default.
+func getMetricsProxyPort(annotations map[string]string) (int32, error) {
+	if _, ok := annotations[daprMetricsProxyPortKey]; !ok {
+		return defaultMetricsProxyPort, nil
+	}
+	port, err := getInt32Annotation(annotations, daprMetricsProxyPortKey)
+	if err != nil {
+		return 0, err
+	}
+	if port <= 0 || port > 65535 {
+		return 0, errors.Errorf("invalid value for %s: %d", daprMetricsProxyPortKey, port)
+	}
+	return port, nil
 }
 
-func GetAppTokenSecret(annotations map[string]string) string {
-	return getStringAnnotationOrDefault(annotations, daprAppTokenSecret, "")
+// validateMetricsProxyPort rejects a metrics proxy port that is already used by one of the
+// containers of the pod, since the containers share the network namespace of the pod.
+func validateMetricsProxyPort(port int32, containers []corev1.Container) error {
+	for _, c := range containers {
+		for _, p := range c.Ports {
+			if p.ContainerPort == port {
+				return errors.Errorf("metrics proxy port %d is already used by container %s, set %s to a free port", port, c.Name, daprMetricsProxyPortKey)
+			}
+		}
+	}
+	return nil
 }
 
-func getMaxRequestBodySize(annotations map[string]string) (int32, error) {
-	return getInt32Annotation(annotations, daprMaxRequestBodySize)
+// getMetricsProxyContainer returns a container that exposes the daprd metrics endpoint on the given port.
+// The proxy only forwards traffic, so it runs with a restricted security context.
+func getMetricsProxyContainer(annotations map[string]string, image string, port int32) corev1.Container {
+	metricsPort := getMetricsPort(annotations)
+	allowPrivilegeEscalation := false
+	readOnlyRootFilesystem := true
+	runAsNonRoot := true
+	runAsUser := int64(metricsProxyUser)
+	return corev1.Container{
+		Name:  metricsProxyContainerName,
+		Image: image,
+		Ports: []corev1.ContainerPort{
+			{
+				ContainerPort: port,
+				Name:          metricsProxyPortName,
+			},
+		},
+		Args: []string{
+			fmt.Sprintf("TCP-LISTEN:%d,fork,reuseaddr", port),
+			fmt.Sprintf("TCP:127.0.0.1:%d", metricsPort),
+		},
+		SecurityContext: &corev1.SecurityContext{
+			AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+			ReadOnlyRootFilesystem:   &readOnlyRootFilesystem,
+			RunAsNonRoot:             &runAsNonRoot,
+			RunAsUser:                &runAsUser,
+			Capabilities: &corev1.Capabilities{
+				Drop: []corev1.Capability{"ALL"},
+			},
+			SeccompProfile: &corev1.SeccompProfile{
+				Type: corev1.SeccompProfileTypeRuntimeDefault,
+			},
+		},
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("50m"),
+				corev1.ResourceMemory: resource.MustParse("32Mi"),
+			},
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("10m"),
+				corev1.ResourceMemory: resource.MustParse("16Mi"),
+			},
+		},
+	}
+}
+
+// normalizeAnnotationPrefix returns a copy of the annotations where the keys using the given
+// prefix are rewritten to the default dapr.io prefix the annotation keys are declared with.
+// When a custom prefix is set, annotations using the default prefix are ignored.
+func normalizeAnnotationPrefix(annotations map[string]string, prefix string) map[string]string {
+	if prefix == "" || prefix == defaultAnnotationPrefix {
+		return annotations
+	}
+
+	customPrefix := prefix + "/"
+	normalized := make(map[string]string, len(annotations))
+	for k, v := range annotations {
+		switch {
+		case strings.HasPrefix(k, customPrefix):
+			normalized[defaultAnnotationPrefix+"/"+strings.TrimPrefix(k, customPrefix)] = v
+		case strings.HasPrefix(k, defaultAnnotationPrefix+"/"):
+			continue
+		default:
+			normalized[k] = v
+		}
+	}
+	return normalized
 }
 
 func getBoolAnnotationOrDefault(annotations map[string]string, key string, defaultValue bool) bool {
@@ -374,87 +2467,498 @@ func getInt32Annotation(annotations map[string]string, key string) (int32, error
 	}
 	value, err := strconv.ParseInt(s, 10, 32)
 	if err != nil {
-		return -1, errors.Wrapf(err, "error parsing %s int value %s ", key, s)
+		return -1, errors.Wrapf(err, "error parsing %s int value %s ", key, s)
+	}
+	return int32(value), nil
+}
+
+func getProbeHTTPHandler(port int32, scheme corev1.URIScheme, pathElements ...string) corev1.Handler {
+	return corev1.Handler{
+		HTTPGet: &corev1.HTTPGetAction{
+			Path:   formatProbePath(pathElements...),
+			Port:   intstr.IntOrString{IntVal: port},
+			Scheme: scheme,
+		},
+	}
+}
+
+// getProbeType returns the type of the sidecar probes, http by default.
+func getProbeType(annotations map[string]string) (string, error) {
+	probeType := strings.ToLower(getStringAnnotationOrDefault(annotations, daprProbeTypeKey, probeTypeHTTP))
+	switch probeType {
+	case probeTypeHTTP, probeTypeTCP:
+		return probeType, nil
+	case probeTypeGRPC:
+		// The gRPC probe handler was added in Kubernetes 1.23 and isn't part of the vendored API.
+		return "", errors.Errorf("invalid value for %s: %s probes aren't supported yet", daprProbeTypeKey, probeType)
+	default:
+		return "", errors.Errorf("invalid value for %s: %s", daprProbeTypeKey, probeType)
+	}
+}
+
+// getProbeHandler returns the sidecar probe handler for the probe type in the given options.
+// TCP probes check the probe port is open, HTTP probes query the healthz endpoint.
+func getProbeHandler(opts SidecarOptions, scheme corev1.URIScheme, pathElements ...string) corev1.Handler {
+	if opts.ProbeType == probeTypeTCP {
+		return corev1.Handler{
+			TCPSocket: &corev1.TCPSocketAction{
+				Port: intstr.IntOrString{IntVal: opts.ProbePort},
+			},
+		}
+	}
+	return getProbeHTTPHandler(opts.ProbePort, scheme, pathElements...)
+}
+
+// getHealthzPathElements returns the sidecar healthz path elements, optionally prefixed with the app ID.
+// The path prefix is prepended for sidecars served behind a path based proxy. A non empty healthz
+// path replaces the default /v1.0/healthz route.
+func getHealthzPathElements(pathPrefix string, includeAppID bool, appID, healthzPath string) []string {
+	elements := []string{}
+	if pathPrefix != "" {
+		elements = append(elements, pathPrefix)
+	}
+	if includeAppID {
+		elements = append(elements, appID)
+	}
+	if healthzPath != "" {
+		return append(elements, healthzPath)
+	}
+	return append(elements, apiVersionV1, sidecarHealthzPath)
+}
+
+func getHealthzPathPrefix(annotations map[string]string) string {
+	return getStringAnnotation(annotations, daprHealthzPathPrefixKey)
+}
+
+// getHealthzPath returns the custom healthz route of the sidecar probes, or an empty string for
+// the default route.
+func getHealthzPath(annotations map[string]string) (string, error) {
+	healthzPath := getStringAnnotation(annotations, daprHealthzPathKey)
+	if healthzPath == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(healthzPath, "/") {
+		return "", errors.Errorf("invalid value for %s: %s", daprHealthzPathKey, healthzPath)
+	}
+	return formatProbePath(healthzPath), nil
+}
+
+// getProbePort returns the port targeted by the sidecar probes, which defaults to the sidecar
+// HTTP port unless the probes go through a proxy.
+func getProbePort(annotations map[string]string, httpPort int32) (int32, error) {
+	port, err := getInt32Annotation(annotations, daprProbePortKey)
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := annotations[daprProbePortKey]; !ok {
+		return httpPort, nil
+	}
+	if port <= 0 || port > 65535 {
+		return 0, errors.Errorf("invalid value for %s: %d", daprProbePortKey, port)
+	}
+	return port, nil
+}
+
+// getStartupProbeOptions returns the startup probe settings, or nil if none of the startup
+// probe annotations are set, in which case the sidecar gets no startup probe.
+func getStartupProbeOptions(annotations map[string]string) *ProbeOptions {
+	annotated := false
+	for _, key := range []string{daprStartupProbeDelayKey, daprStartupProbeTimeoutKey, daprStartupProbePeriodKey, daprStartupProbeThresholdKey} {
+		if _, ok := annotations[key]; ok {
+			annotated = true
+			break
+		}
+	}
+	if !annotated {
+		return nil
+	}
+
+	return &ProbeOptions{
+		InitialDelaySeconds: getInt32AnnotationOrDefault(annotations, daprStartupProbeDelayKey, defaultHealthzProbeDelaySeconds),
+		TimeoutSeconds:      getInt32AnnotationOrDefault(annotations, daprStartupProbeTimeoutKey, defaultHealthzProbeTimeoutSeconds),
+		PeriodSeconds:       getInt32AnnotationOrDefault(annotations, daprStartupProbePeriodKey, defaultHealthzProbePeriodSeconds),
+		FailureThreshold:    getInt32AnnotationOrDefault(annotations, daprStartupProbeThresholdKey, defaultHealthzProbeThreshold),
+	}
+}
+
+// getNativeStartupProbeOptions returns the startup probe settings of a native sidecar, which always
+// gets a startup probe since the app containers wait for it to succeed. The annotations override the
+// defaults, which probe every second so the app containers start as soon as daprd is up.
+func getNativeStartupProbeOptions(annotations map[string]string) *ProbeOptions {
+	return &ProbeOptions{
+		InitialDelaySeconds: getInt32AnnotationOrDefault(annotations, daprStartupProbeDelayKey, 0),
+		TimeoutSeconds:      getInt32AnnotationOrDefault(annotations, daprStartupProbeTimeoutKey, defaultHealthzProbeTimeoutSeconds),
+		PeriodSeconds:       getInt32AnnotationOrDefault(annotations, daprStartupProbePeriodKey, defaultNativeStartupProbePeriod),
+		FailureThreshold:    getInt32AnnotationOrDefault(annotations, daprStartupProbeThresholdKey, defaultNativeStartupProbeThreshold),
+	}
+}
+
+// getLivenessFailureThreshold returns the liveness failure threshold, increased by the number of
+// probe periods needed to cover the annotated startup time so slow sidecars aren't killed while booting.
+func getLivenessFailureThreshold(annotations map[string]string, probe ProbeOptions) (int32, error) {
+	startupSeconds, err := getInt32Annotation(annotations, daprLivenessStartupSecondsKey)
+	if err != nil {
+		return probe.FailureThreshold, err
+	}
+	if _, ok := annotations[daprLivenessStartupSecondsKey]; !ok {
+		return probe.FailureThreshold, nil
+	}
+	if startupSeconds < 0 {
+		return probe.FailureThreshold, errors.Errorf("invalid value for %s: %d", daprLivenessStartupSecondsKey, startupSeconds)
+	}
+
+	remaining := startupSeconds - probe.InitialDelaySeconds
+	if remaining <= 0 || probe.PeriodSeconds <= 0 {
+		return probe.FailureThreshold, nil
+	}
+	extra := (remaining + probe.PeriodSeconds - 1) / probe.PeriodSeconds
+	return probe.FailureThreshold + extra, nil
+}
+
+// getProbeScheme returns the probe scheme set by the given annotation. Without the annotation,
+// an empty scheme leaves Kubernetes to default to HTTP. App SSL doesn't change the default, since
+// it only applies to the calls of daprd to the app and the healthz endpoint is served over HTTP.
+func getProbeScheme(annotations map[string]string, key string) (corev1.URIScheme, error) {
+	scheme := getStringAnnotation(annotations, key)
+	switch strings.ToUpper(scheme) {
+	case "":
+		return "", nil
+	case string(corev1.URISchemeHTTP):
+		return corev1.URISchemeHTTP, nil
+	case string(corev1.URISchemeHTTPS):
+		return corev1.URISchemeHTTPS, nil
+	default:
+		return "", errors.Errorf("invalid value for %s: %s", key, scheme)
+	}
+}
+
+func formatProbePath(elements ...string) string {
+	pathStr := path.Join(elements...)
+	if !strings.HasPrefix(pathStr, "/") {
+		pathStr = fmt.Sprintf("/%s", pathStr)
+	}
+	return pathStr
+}
+
+func appendQuantityToResourceList(quantity string, resourceName corev1.ResourceName, resourceList corev1.ResourceList) (*corev1.ResourceList, error) {
+	q, err := resource.ParseQuantity(quantity)
+	if err != nil {
+		return nil, err
+	}
+	resourceList[resourceName] = q
+	return &resourceList, nil
+}
+
+// applyDefaultRequests sets the default requests for the resources that have neither a request
+// nor a limit, as the request of a resource with only a limit defaults to the limit.
+func applyDefaultRequests(r *corev1.ResourceRequirements, defaults corev1.ResourceList) {
+	for name, quantity := range defaults {
+		if _, ok := r.Requests[name]; ok {
+			continue
+		}
+		if _, ok := r.Limits[name]; ok {
+			continue
+		}
+		if r.Requests == nil {
+			r.Requests = corev1.ResourceList{}
+		}
+		r.Requests[name] = quantity.DeepCopy()
+	}
+}
+
+func getResourceRequirements(annotations map[string]string) (*corev1.ResourceRequirements, error) {
+	r := corev1.ResourceRequirements{
+		Limits:   corev1.ResourceList{},
+		Requests: corev1.ResourceList{},
+	}
+	cpuLimit, ok := annotations[daprCPULimitKey]
+	if ok {
+		list, err := appendQuantityToResourceList(cpuLimit, corev1.ResourceCPU, r.Limits)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value for %s: %s", daprCPULimitKey, cpuLimit)
+		}
+		r.Limits = *list
+	}
+	memLimit, ok := annotations[daprMemoryLimitKey]
+	if ok {
+		list, err := appendQuantityToResourceList(memLimit, corev1.ResourceMemory, r.Limits)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value for %s: %s", daprMemoryLimitKey, memLimit)
+		}
+		r.Limits = *list
+	}
+	cpuRequest, ok := annotations[daprCPURequestKey]
+	if ok {
+		list, err := appendQuantityToResourceList(cpuRequest, corev1.ResourceCPU, r.Requests)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value for %s: %s", daprCPURequestKey, cpuRequest)
+		}
+		r.Requests = *list
+	}
+	memRequest, ok := annotations[daprMemoryRequestKey]
+	if ok {
+		list, err := appendQuantityToResourceList(memRequest, corev1.ResourceMemory, r.Requests)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value for %s: %s", daprMemoryRequestKey, memRequest)
+		}
+		r.Requests = *list
+	}
+	ephemeralStorageLimit, ok := annotations[daprEphemeralStorageLimitKey]
+	if ok {
+		list, err := appendQuantityToResourceList(ephemeralStorageLimit, corev1.ResourceEphemeralStorage, r.Limits)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value for %s: %s", daprEphemeralStorageLimitKey, ephemeralStorageLimit)
+		}
+		r.Limits = *list
+	}
+	ephemeralStorageRequest, ok := annotations[daprEphemeralStorageRequestKey]
+	if ok {
+		list, err := appendQuantityToResourceList(ephemeralStorageRequest, corev1.ResourceEphemeralStorage, r.Requests)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value for %s: %s", daprEphemeralStorageRequestKey, ephemeralStorageRequest)
+		}
+		r.Requests = *list
+	}
+
+	for _, warning := range getMemoryUnitWarnings(annotations) {
+		log.Warn(warning)
+	}
+
+	if sidecarNoLimitsEnabled(annotations) {
+		if len(r.Limits) > 0 {
+			log.Warnf("%s is set, dropping the sidecar resource limits", daprSidecarNoLimitsKey)
+		}
+		r.Limits = nil
+	}
+
+	if len(r.Limits) > 0 || len(r.Requests) > 0 {
+		return &r, nil
+	}
+	return nil, nil
+}
+
+func sidecarNoLimitsEnabled(annotations map[string]string) bool {
+	return getBoolAnnotationOrDefault(annotations, daprSidecarNoLimitsKey, false)
+}
+
+// getNoLimitsWarnings returns a warning for every limit annotation ignored because of the no-limits annotation.
+func getNoLimitsWarnings(annotations map[string]string) []string {
+	warnings := []string{}
+	if !sidecarNoLimitsEnabled(annotations) {
+		return warnings
+	}
+	for _, key := range []string{daprCPULimitKey, daprMemoryLimitKey, daprMemoryLimitPercentKey, daprEphemeralStorageLimitKey} {
+		if _, ok := annotations[key]; ok {
+			warnings = append(warnings, fmt.Sprintf("annotation %s is ignored because %s is set", key, daprSidecarNoLimitsKey))
+		}
+	}
+	return warnings
+}
+
+// getMemoryUnitWarnings returns a warning for every memory annotation using a decimal unit such as
+// 500M, which is often meant as the binary unit 500Mi, along with the value in binary units.
+func getMemoryUnitWarnings(annotations map[string]string) []string {
+	warnings := []string{}
+	for _, key := range []string{daprMemoryLimitKey, daprMemoryRequestKey} {
+		value, ok := annotations[key]
+		if !ok {
+			continue
+		}
+		q, err := resource.ParseQuantity(value)
+		if err != nil || !isDecimalMemoryUnit(value) {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("annotation %s uses the decimal unit %s, which is %d bytes or %.2fMi, use binary units such as Mi or Gi to avoid confusion",
+			key, value, q.Value(), float64(q.Value())/(1024*1024)))
+	}
+	return warnings
+}
+
+func isDecimalMemoryUnit(value string) bool {
+	suffix := strings.TrimLeft(value, "+-.0123456789")
+	switch suffix {
+	case "k", "M", "G", "T", "P", "E":
+		return true
+	default:
+		return false
+	}
+}
+
+func isResourceDaprEnabled(annotations map[string]string) bool {
+	return getBoolAnnotationOrDefault(annotations, daprEnabledKey, false)
+}
+
+// getKubernetesDNS returns the DNS name of a service, defaulting to the cluster.local domain.
+func getKubernetesDNS(name, namespace, clusterDomain string) string {
+	if clusterDomain == "" {
+		clusterDomain = defaultClusterDomain
+	}
+	return fmt.Sprintf("%s.%s.svc.%s", name, namespace, clusterDomain)
+}
+
+// getSidecarImage returns the sidecar image for a pod. The pod annotation takes precedence
+// over the namespace override, which takes precedence over the injector's default image.
+func getSidecarImage(annotations map[string]string, namespace, defaultImage string, namespaceImages map[string]string) string {
+	if image, ok := namespaceImages[namespace]; ok && image != "" {
+		defaultImage = image
+	}
+	return getStringAnnotationOrDefault(annotations, daprSidecarImageKey, defaultImage)
+}
+
+// getSidecarImagePullPolicy returns the sidecar image pull policy for a pod. The pod annotation
+// takes precedence over the policy inherited from the first app container when the pod opts in,
+// which takes precedence over dev mode, which takes precedence over the injector's default policy.
+func getSidecarImagePullPolicy(annotations map[string]string, containers []corev1.Container, defaultPolicy string, devMode bool) string {
+	if devMode {
+		defaultPolicy = string(corev1.PullNever)
+	}
+	if getBoolAnnotationOrDefault(annotations, daprInheritImagePullPolicyKey, false) && len(containers) > 0 && containers[0].ImagePullPolicy != "" {
+		defaultPolicy = string(containers[0].ImagePullPolicy)
+	}
+	return getStringAnnotationOrDefault(annotations, daprSidecarImagePullPolicyKey, defaultPolicy)
+}
+
+// validateSidecarImage returns an error if the image isn't in the allowlist. Allowlist entries
+// ending with * match by prefix, others must match exactly. An empty allowlist allows any image.
+func validateSidecarImage(image string, allowlist []string) error {
+	if len(allowlist) == 0 {
+		return nil
+	}
+	for _, allowed := range allowlist {
+		if strings.HasSuffix(allowed, "*") {
+			if strings.HasPrefix(image, strings.TrimSuffix(allowed, "*")) {
+				return nil
+			}
+		} else if image == allowed {
+			return nil
+		}
+	}
+	return errors.Errorf("sidecar image %s is not allowed", image)
+}
+
+// validateSidecarImagePullPolicy returns an error if the sidecar image pull policy annotation
+// is set to a value other than Always, Never or IfNotPresent.
+func validateSidecarImagePullPolicy(annotations map[string]string) error {
+	policy, ok := annotations[daprSidecarImagePullPolicyKey]
+	if !ok {
+		return nil
+	}
+	switch corev1.PullPolicy(policy) {
+	case corev1.PullAlways, corev1.PullNever, corev1.PullIfNotPresent:
+		return nil
+	default:
+		return errors.Errorf("invalid value for %s: %s", daprSidecarImagePullPolicyKey, policy)
+	}
+}
+
+// applyDefaultAppHealthCheckPath returns the annotations with the namespace default app health
+// check path added when the pod doesn't set one.
+func applyDefaultAppHealthCheckPath(annotations map[string]string, namespace string, defaults map[string]string) map[string]string {
+	if _, ok := annotations[daprAppHealthCheckPathKey]; ok {
+		return annotations
+	}
+	defaultPath, ok := defaults[namespace]
+	if !ok || defaultPath == "" {
+		return annotations
+	}
+
+	withDefault := make(map[string]string, len(annotations)+1)
+	for k, v := range annotations {
+		withDefault[k] = v
+	}
+	withDefault[daprAppHealthCheckPathKey] = defaultPath
+	return withDefault
+}
+
+func getAppHealthCheckPath(annotations map[string]string) string {
+	return getStringAnnotation(annotations, daprAppHealthCheckPathKey)
+}
+
+// getPlacementHostAliasPatchOperations adds a host alias resolving the placement service name
+// to its ClusterIP, sparing the sidecar the DNS lookup. A warning is returned instead when the
+// ClusterIP can't be determined, in which case the sidecar falls back to DNS.
+func getPlacementHostAliasPatchOperations(hostAliases []corev1.HostAlias, namespace, clusterDomain string, kubeClient kubernetes.Interface) ([]PatchOperation, []string) {
+	svc, err := kubeClient.CoreV1().Services(namespace).Get(context.TODO(), placementService, meta_v1.GetOptions{})
+	if err != nil {
+		return nil, []string{fmt.Sprintf("could not add a host alias for the placement service: %s", err)}
+	}
+	if svc.Spec.ClusterIP == "" || svc.Spec.ClusterIP == corev1.ClusterIPNone {
+		return nil, []string{fmt.Sprintf("could not add a host alias for the placement service: service %s/%s has no ClusterIP", namespace, placementService)}
 	}
-	return int32(value), nil
-}
 
-func getProbeHTTPHandler(port int32, pathElements ...string) corev1.Handler {
-	return corev1.Handler{
-		HTTPGet: &corev1.HTTPGetAction{
-			Path: formatProbePath(pathElements...),
-			Port: intstr.IntOrString{IntVal: port},
-		},
+	hostAlias := corev1.HostAlias{
+		IP:        svc.Spec.ClusterIP,
+		Hostnames: []string{getKubernetesDNS(placementService, namespace, clusterDomain)},
 	}
+	if len(hostAliases) == 0 {
+		return []PatchOperation{
+			{
+				Op:    "add",
+				Path:  hostAliasesPath,
+				Value: []corev1.HostAlias{hostAlias},
+			},
+		}, nil
+	}
+	return []PatchOperation{
+		{
+			Op:    "add",
+			Path:  hostAliasesPath + "/-",
+			Value: hostAlias,
+		},
+	}, nil
 }
 
-func formatProbePath(elements ...string) string {
-	pathStr := path.Join(elements...)
-	if !strings.HasPrefix(pathStr, "/") {
-		pathStr = fmt.Sprintf("/%s", pathStr)
+// getPlacementAddress returns the placement address passed to daprd.
+func getPlacementAddress(annotations map[string]string, namespace, clusterDomain string, defaultPort int32) (string, error) {
+	override, err := getPlacementHostAddress(annotations)
+	if err != nil || override != "" {
+		return override, err
 	}
-	return pathStr
-}
 
-func appendQuantityToResourceList(quantity string, resourceName corev1.ResourceName, resourceList corev1.ResourceList) (*corev1.ResourceList, error) {
-	q, err := resource.ParseQuantity(quantity)
+	host := getKubernetesDNS(placementService, namespace, clusterDomain)
+	port, err := getPlacementPort(annotations, defaultPort)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	resourceList[resourceName] = q
-	return &resourceList, nil
+	return fmt.Sprintf("%s:%d", host, port), nil
 }
 
-func getResourceRequirements(annotations map[string]string) (*corev1.ResourceRequirements, error) {
-	r := corev1.ResourceRequirements{
-		Limits:   corev1.ResourceList{},
-		Requests: corev1.ResourceList{},
+// getPlacementHostAddress returns the annotated placement address, passed to daprd as is in place
+// of the in-cluster placement service. It can hold a comma-separated list of host:port entries.
+func getPlacementHostAddress(annotations map[string]string) (string, error) {
+	address := getStringAnnotation(annotations, daprPlacementHostAddressKey)
+	if address == "" {
+		return "", nil
 	}
-	cpuLimit, ok := annotations[daprCPULimitKey]
-	if ok {
-		list, err := appendQuantityToResourceList(cpuLimit, corev1.ResourceCPU, r.Limits)
+	for _, entry := range strings.Split(address, ",") {
+		host, port, err := net.SplitHostPort(strings.TrimSpace(entry))
 		if err != nil {
-			return nil, errors.Wrap(err, "error parsing sidecar cpu limit")
+			return "", errors.Wrapf(err, "invalid value for %s: %s", daprPlacementHostAddressKey, address)
 		}
-		r.Limits = *list
-	}
-	memLimit, ok := annotations[daprMemoryLimitKey]
-	if ok {
-		list, err := appendQuantityToResourceList(memLimit, corev1.ResourceMemory, r.Limits)
-		if err != nil {
-			return nil, errors.Wrap(err, "error parsing sidecar memory limit")
+		if p, err := strconv.Atoi(port); host == "" || err != nil || p < 1 || p > 65535 {
+			return "", errors.Errorf("invalid value for %s: %s is not a valid host:port address", daprPlacementHostAddressKey, entry)
 		}
-		r.Limits = *list
 	}
-	cpuRequest, ok := annotations[daprCPURequestKey]
-	if ok {
-		list, err := appendQuantityToResourceList(cpuRequest, corev1.ResourceCPU, r.Requests)
-		if err != nil {
-			return nil, errors.Wrap(err, "error parsing sidecar cpu request")
-		}
-		r.Requests = *list
+	return address, nil
+}
+
+// getPlacementPort returns the annotated placement service port, or the given default. The
+// default falls back to the standard placement port when unset.
+func getPlacementPort(annotations map[string]string, defaultPort int32) (int32, error) {
+	port, err := getInt32Annotation(annotations, daprPlacementHostPortKey)
+	if err != nil {
+		return -1, err
 	}
-	memRequest, ok := annotations[daprMemoryRequestKey]
-	if ok {
-		list, err := appendQuantityToResourceList(memRequest, corev1.ResourceMemory, r.Requests)
-		if err != nil {
-			return nil, errors.Wrap(err, "error parsing sidecar memory request")
+	if port == -1 {
+		if defaultPort <= 0 {
+			return defaultPlacementPort, nil
 		}
-		r.Requests = *list
+		return defaultPort, nil
 	}
-
-	if len(r.Limits) > 0 || len(r.Requests) > 0 {
-		return &r, nil
+	if port < 1 || port > 65535 {
+		return -1, errors.Errorf("invalid value for %s: %d is not a valid port", daprPlacementHostPortKey, port)
 	}
-	return nil, nil
-}
-
-func isResourceDaprEnabled(annotations map[string]string) bool {
-	return getBoolAnnotationOrDefault(annotations, daprEnabledKey, false)
-}
-
-func getKubernetesDNS(name, namespace string) string {
-	return fmt.Sprintf("%s.%s.svc.cluster.local", name, namespace)
+	return port, nil
 }
 
 func getPullPolicy(pullPolicy string) corev1.PullPolicy {
@@ -471,60 +2975,59 @@ func getPullPolicy(pullPolicy string) corev1.PullPolicy {
 }
 
 func getSidecarContainer(annotations map[string]string, id, daprSidecarImage, imagePullPolicy, namespace, controlPlaneAddress, placementServiceAddress string, tokenVolumeMount *corev1.VolumeMount, trustAnchors, certChain, certKey, sentryAddress string, mtlsEnabled bool, identity string) (*corev1.Container, error) {
-	appPort, err := getAppPort(annotations)
+	opts, err := ParseSidecarOptions(annotations)
 	if err != nil {
 		return nil, err
 	}
-	appPortStr := ""
-	if appPort > 0 {
-		appPortStr = fmt.Sprintf("%v", appPort)
-	}
 
-	metricsPort := getMetricsPort(annotations)
-	maxConcurrency, err := getMaxConcurrency(annotations)
-	if err != nil {
-		log.Warn(err)
+	appPortStr := ""
+	if opts.AppPort > 0 {
+		appPortStr = fmt.Sprintf("%v", opts.AppPort)
 	}
 
-	sslEnabled := appSSLEnabled(annotations)
-
 	pullPolicy := getPullPolicy(imagePullPolicy)
 
-	sidecarHTTPPort := getSideCarHTTPPort(annotations)
-
-	httpHandler := getProbeHTTPHandler(sidecarHTTPPort, apiVersionV1, sidecarHealthzPath)
-
-	allowPrivilegeEscalation := false
-
-	requestBodySize, err := getMaxRequestBodySize(annotations)
-	if err != nil {
-		log.Warn(err)
+	healthzPathElements := getHealthzPathElements(opts.HealthzPathPrefix, opts.HealthzIncludeAppID, id, opts.HealthzPath)
+	livenessPathElements := healthzPathElements
+	if opts.LivenessOnlyHealthz {
+		// The liveness route ignores the readiness of daprd, such as its placement connectivity,
+		// which is still checked by the readiness probe.
+		livenessPathElements = append(healthzPathElements[:len(healthzPathElements):len(healthzPathElements)], sidecarLivenessRoute)
 	}
+	readinessPathElements := healthzPathElements
+	if opts.ReadinessComponents {
+		// The components route is only ready once daprd has loaded the components and finished
+		// initializing, including its channel to the app.
+		readinessPathElements = append(healthzPathElements[:len(healthzPathElements):len(healthzPathElements)], sidecarComponentsRoute)
+	}
+	livenessHandler := getProbeHandler(opts, opts.LivenessProbe.Scheme, livenessPathElements...)
+	readinessHandler := getProbeHandler(opts, opts.ReadinessProbe.Scheme, readinessPathElements...)
+
+	allowPrivilegeEscalation := opts.AllowPrivilegeEscalation
 
-	sidecarAPIGRPCPort := getSideCarAPIGRPCPort(annotations)
-	sidecarInternalGRPCPort := getSideCarInternalGRPCPort(annotations)
 	c := &corev1.Container{
-		Name:            sidecarContainerName,
-		Image:           daprSidecarImage,
-		ImagePullPolicy: pullPolicy,
+		Name:                     sidecarContainerName,
+		Image:                    daprSidecarImage,
+		ImagePullPolicy:          pullPolicy,
+		TerminationMessagePolicy: opts.TerminationMessagePolicy,
 		SecurityContext: &corev1.SecurityContext{
 			AllowPrivilegeEscalation: &allowPrivilegeEscalation,
 		},
 		Ports: []corev1.ContainerPort{
 			{
-				ContainerPort: int32(sidecarHTTPPort),
+				ContainerPort: opts.HTTPPort,
 				Name:          sidecarHTTPPortName,
 			},
 			{
-				ContainerPort: int32(sidecarAPIGRPCPort),
+				ContainerPort: opts.APIGRPCPort,
 				Name:          sidecarGRPCPortName,
 			},
 			{
-				ContainerPort: int32(sidecarInternalGRPCPort),
+				ContainerPort: opts.InternalGRPCPort,
 				Name:          sidecarInternalGRPCPortName,
 			},
 			{
-				ContainerPort: int32(metricsPort),
+				ContainerPort: opts.MetricsPort,
 				Name:          sidecarMetricsPortName,
 			},
 		},
@@ -545,48 +3048,93 @@ func getSidecarContainer(annotations map[string]string, id, daprSidecarImage, im
 		},
 		Args: []string{
 			"--mode", "kubernetes",
-			"--dapr-http-port", fmt.Sprintf("%v", sidecarHTTPPort),
-			"--dapr-grpc-port", fmt.Sprintf("%v", sidecarAPIGRPCPort),
-			"--dapr-internal-grpc-port", fmt.Sprintf("%v", sidecarInternalGRPCPort),
+			"--dapr-http-port", fmt.Sprintf("%v", opts.HTTPPort),
+			"--dapr-grpc-port", fmt.Sprintf("%v", opts.APIGRPCPort),
+			"--dapr-internal-grpc-port", fmt.Sprintf("%v", opts.InternalGRPCPort),
 			"--app-port", appPortStr,
 			"--app-id", id,
 			"--control-plane-address", controlPlaneAddress,
-			"--app-protocol", getProtocol(annotations),
+			"--app-protocol", opts.AppProtocol,
 			"--placement-host-address", placementServiceAddress,
-			"--config", getConfig(annotations),
-			"--log-level", getLogLevel(annotations),
-			"--app-max-concurrency", fmt.Sprintf("%v", maxConcurrency),
+			"--config", opts.Config,
+			"--log-level", opts.LogLevel,
+			"--app-max-concurrency", fmt.Sprintf("%v", opts.AppMaxConcurrency),
 			"--sentry-address", sentryAddress,
-			"--metrics-port", fmt.Sprintf("%v", metricsPort),
-			"--dapr-http-max-request-size", fmt.Sprintf("%v", requestBodySize),
+			"--metrics-port", fmt.Sprintf("%v", opts.MetricsPort),
+			"--dapr-http-max-request-size", fmt.Sprintf("%v", opts.MaxRequestBodySize),
 		},
 		ReadinessProbe: &corev1.Probe{
-			Handler:             httpHandler,
-			InitialDelaySeconds: getInt32AnnotationOrDefault(annotations, daprReadinessProbeDelayKey, defaultHealthzProbeDelaySeconds),
-			TimeoutSeconds:      getInt32AnnotationOrDefault(annotations, daprReadinessProbeTimeoutKey, defaultHealthzProbeTimeoutSeconds),
-			PeriodSeconds:       getInt32AnnotationOrDefault(annotations, daprReadinessProbePeriodKey, defaultHealthzProbePeriodSeconds),
-			FailureThreshold:    getInt32AnnotationOrDefault(annotations, daprReadinessProbeThresholdKey, defaultHealthzProbeThreshold),
+			Handler:             readinessHandler,
+			InitialDelaySeconds: opts.ReadinessProbe.InitialDelaySeconds,
+			TimeoutSeconds:      opts.ReadinessProbe.TimeoutSeconds,
+			PeriodSeconds:       opts.ReadinessProbe.PeriodSeconds,
+			FailureThreshold:    opts.ReadinessProbe.FailureThreshold,
 		},
 		LivenessProbe: &corev1.Probe{
-			Handler:             httpHandler,
-			InitialDelaySeconds: getInt32AnnotationOrDefault(annotations, daprLivenessProbeDelayKey, defaultHealthzProbeDelaySeconds),
-			TimeoutSeconds:      getInt32AnnotationOrDefault(annotations, daprLivenessProbeTimeoutKey, defaultHealthzProbeTimeoutSeconds),
-			PeriodSeconds:       getInt32AnnotationOrDefault(annotations, daprLivenessProbePeriodKey, defaultHealthzProbePeriodSeconds),
-			FailureThreshold:    getInt32AnnotationOrDefault(annotations, daprLivenessProbeThresholdKey, defaultHealthzProbeThreshold),
+			Handler:             livenessHandler,
+			InitialDelaySeconds: opts.LivenessProbe.InitialDelaySeconds,
+			TimeoutSeconds:      opts.LivenessProbe.TimeoutSeconds,
+			PeriodSeconds:       opts.LivenessProbe.PeriodSeconds,
+			FailureThreshold:    opts.LivenessProbe.FailureThreshold,
 		},
 	}
 
+	if opts.DisableLivenessProbe {
+		c.LivenessProbe = nil
+	}
+
+	if opts.ReadOnlyRootFilesystem {
+		readOnlyRootFilesystem := true
+		c.SecurityContext.ReadOnlyRootFilesystem = &readOnlyRootFilesystem
+	}
+
+	if opts.RunAsNonRoot {
+		runAsNonRoot := true
+		c.SecurityContext.RunAsNonRoot = &runAsNonRoot
+	}
+
+	c.SecurityContext.RunAsUser = opts.RunAsUser
+
+	c.SecurityContext.SeccompProfile = opts.SeccompProfile
+
+	if len(opts.DropCapabilities) > 0 || len(opts.AddCapabilities) > 0 {
+		c.SecurityContext.Capabilities = &corev1.Capabilities{
+			Drop: opts.DropCapabilities,
+			Add:  opts.AddCapabilities,
+		}
+	}
+
+	if opts.StartupProbe != nil {
+		startupPathElements := healthzPathElements
+		if opts.Native && opts.HealthzPath == "" {
+			// The app containers of a native sidecar only start once its startup probe succeeds, while
+			// the healthz and components routes wait for the app, so the probe uses the liveness route
+			// instead. Startup probes don't gate traffic, which still waits for the readiness probe.
+			startupPathElements = append(healthzPathElements[:len(healthzPathElements):len(healthzPathElements)], sidecarLivenessRoute)
+		}
+		// The liveness probe only starts once the startup probe succeeds, so the startup probe uses the
+		// liveness scheme: a startup probe passing over another scheme than the liveness probe would let
+		// the kubelet restart a sidecar that never got healthy over the liveness scheme.
+		c.StartupProbe = &corev1.Probe{
+			Handler:             getProbeHandler(opts, opts.LivenessProbe.Scheme, startupPathElements...),
+			InitialDelaySeconds: opts.StartupProbe.InitialDelaySeconds,
+			TimeoutSeconds:      opts.StartupProbe.TimeoutSeconds,
+			PeriodSeconds:       opts.StartupProbe.PeriodSeconds,
+			FailureThreshold:    opts.StartupProbe.FailureThreshold,
+		}
+	}
+
 	if tokenVolumeMount != nil {
 		c.VolumeMounts = []corev1.VolumeMount{
 			*tokenVolumeMount,
 		}
 	}
 
-	if logAsJSONEnabled(annotations) {
+	if opts.LogAsJSON {
 		c.Args = append(c.Args, "--log-as-json")
 	}
 
-	if profilingEnabled(annotations) {
+	if opts.ProfilingEnabled {
 		c.Args = append(c.Args, "--enable-profiling")
 	}
 
@@ -610,46 +3158,508 @@ func getSidecarContainer(annotations map[string]string, id, daprSidecarImage, im
 			})
 	}
 
-	if sslEnabled {
+	if opts.AppSSL {
 		c.Args = append(c.Args, "--app-ssl")
 	}
 
-	secret := getAPITokenSecret(annotations)
-	if secret != "" {
+	if opts.AppTLSClientCertSecret != "" {
+		c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{
+			Name:      appTLSClientCertVolumeName,
+			MountPath: appTLSClientCertMountPath,
+			ReadOnly:  true,
+		})
+		c.Args = append(c.Args,
+			"--app-tls-client-cert-file", path.Join(appTLSClientCertMountPath, corev1.TLSCertKey),
+			"--app-tls-client-key-file", path.Join(appTLSClientCertMountPath, corev1.TLSPrivateKeyKey))
+	}
+
+	if opts.MetricsListenAddress != "" {
+		c.Args = append(c.Args, "--metrics-listen-address", opts.MetricsListenAddress)
+	}
+
+	if opts.AppHealthCheckPath != "" {
+		c.Args = append(c.Args, "--app-health-check-path", opts.AppHealthCheckPath)
+	}
+
+	if opts.GracefulShutdownSeconds >= 0 {
+		c.Args = append(c.Args, "--dapr-graceful-shutdown-seconds", fmt.Sprintf("%v", opts.GracefulShutdownSeconds))
+		c.Lifecycle = getSidecarLifecycle(opts.HTTPPort, opts.GracefulShutdownSeconds)
+	}
+
+	if opts.APITokenSecret != "" {
 		c.Env = append(c.Env, corev1.EnvVar{
 			Name: auth.APITokenEnvVar,
 			ValueFrom: &corev1.EnvVarSource{
 				SecretKeyRef: &corev1.SecretKeySelector{
-					Key: "token",
+					Key: tokenSecretKey,
 					LocalObjectReference: corev1.LocalObjectReference{
-						Name: secret,
+						Name: opts.APITokenSecret,
 					},
 				},
 			},
 		})
 	}
 
-	appSecret := GetAppTokenSecret(annotations)
-	if appSecret != "" {
+	if opts.AppTokenSecret != "" && opts.AppTokenMount {
+		c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{
+			Name:      appTokenVolumeName,
+			MountPath: appTokenMountPath,
+			ReadOnly:  true,
+		})
 		c.Env = append(c.Env, corev1.EnvVar{
-			Name: auth.AppAPITokenEnvVar,
-			ValueFrom: &corev1.EnvVarSource{
-				SecretKeyRef: &corev1.SecretKeySelector{
-					Key: "token",
-					LocalObjectReference: corev1.LocalObjectReference{
-						Name: appSecret,
-					},
-				},
-			},
+			Name:  auth.AppAPITokenFileEnvVar,
+			Value: path.Join(appTokenMountPath, tokenSecretKey),
 		})
+	} else if opts.AppTokenSecret != "" {
+		// daprd only reads the app token from APP_API_TOKEN, the annotated env var name is set
+		// on the app containers.
+		c.Env = append(c.Env, getAppTokenEnv(auth.AppAPITokenEnvVar, opts.AppTokenSecret))
 	}
 
-	resources, err := getResourceRequirements(annotations)
-	if err != nil {
-		log.Warnf("couldn't set container resource requirements: %s. using defaults", err)
+	if opts.CABundleConfigMap != "" {
+		c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{
+			Name:      caBundleVolumeName,
+			MountPath: opts.CABundleMountPath,
+			ReadOnly:  true,
+		})
+		// Point Go's TLS stack at the mounted bundle.
+		c.Env = append(c.Env, corev1.EnvVar{
+			Name:  sslCertFileEnvVar,
+			Value: path.Join(opts.CABundleMountPath, opts.CABundleKey),
+		},
+			corev1.EnvVar{
+				Name:  sslCertDirEnvVar,
+				Value: opts.CABundleMountPath,
+			})
+	}
+
+	if opts.ReadOnlyRootFilesystem {
+		c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{
+			Name:      tmpVolumeName,
+			MountPath: tmpMountPath,
+		})
+	}
+
+	if opts.ComponentCache {
+		c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{
+			Name:      componentCacheVolumeName,
+			MountPath: opts.ComponentCachePath,
+		})
+		c.Env = append(c.Env, corev1.EnvVar{
+			Name:  componentCacheDirEnvVar,
+			Value: opts.ComponentCachePath,
+		})
+	}
+
+	if opts.OtelEndpoint != "" {
+		c.Env = append(c.Env, corev1.EnvVar{
+			Name:  otelExporterEndpointEnvVar,
+			Value: opts.OtelEndpoint,
+		})
+	}
+
+	if opts.OtelProtocol != "" {
+		c.Env = append(c.Env, corev1.EnvVar{
+			Name:  otelExporterProtocolEnvVar,
+			Value: opts.OtelProtocol,
+		})
+	}
+
+	for _, env := range opts.EnvFromAnnotations {
+		if hasEnvVar(c.Env, env.Name) {
+			return nil, errors.Errorf("invalid value for %s: can't override the %s env var set by the injector", daprEnvFromAnnotationsKey, env.Name)
+		}
+		c.Env = append(c.Env, env)
+	}
+
+	if len(opts.ExtraArgs) > 0 {
+		c.Args = mergeArgs(c.Args, opts.ExtraArgs)
 	}
-	if resources != nil {
-		c.Resources = *resources
+
+	if opts.Resources != nil {
+		c.Resources = *opts.Resources
+	}
+
+	if opts.BaseContainer != nil {
+		// The drain hook would otherwise be replaced by the base container and the sidecar
+		// would no longer shut down gracefully.
+		if hasPreStop(opts.BaseContainer.Lifecycle) && hasPreStop(c.Lifecycle) {
+			return nil, errors.Errorf("%s can't be combined with a preStop hook in %s", daprGracefulShutdownSecondsKey, daprSidecarBaseContainerKey)
+		}
+		c = overlaySidecarContainer(opts.BaseContainer, c)
 	}
 	return c, nil
 }
+
+// getMemoryLimitFromPercent computes the sidecar memory limit as the annotated percentage
+// of the summed memory limits of the app containers.
+func getMemoryLimitFromPercent(annotations map[string]string, containers []corev1.Container) (resource.Quantity, error) {
+	percent, err := getInt32Annotation(annotations, daprMemoryLimitPercentKey)
+	if err != nil {
+		return resource.Quantity{}, err
+	}
+	if percent <= 0 || percent > 100 {
+		return resource.Quantity{}, errors.Errorf("invalid value for %s: %d", daprMemoryLimitPercentKey, percent)
+	}
+
+	var total int64
+	for _, c := range containers {
+		limit, ok := c.Resources.Limits[corev1.ResourceMemory]
+		if !ok {
+			return resource.Quantity{}, errors.Errorf("%s is set but container %s has no memory limit", daprMemoryLimitPercentKey, c.Name)
+		}
+		total += limit.Value()
+	}
+	if total == 0 {
+		return resource.Quantity{}, errors.Errorf("%s is set but the pod has no app container memory limits", daprMemoryLimitPercentKey)
+	}
+	return *resource.NewQuantity(total*int64(percent)/100, resource.BinarySI), nil
+}
+
+// getHostNameEnvVar returns the env var exposing the pod hostname to the sidecar, e.g. the stable
+// hostname of a StatefulSet pod. The downward API can't reference spec.hostname, so an explicit
+// hostname is set as is, otherwise the pod name, which Kubernetes uses as the default hostname.
+func getHostNameEnvVar(hostname string) corev1.EnvVar {
+	if hostname != "" {
+		return corev1.EnvVar{
+			Name:  daprHostNameEnvVar,
+			Value: hostname,
+		}
+	}
+	return corev1.EnvVar{
+		Name: daprHostNameEnvVar,
+		ValueFrom: &corev1.EnvVarSource{
+			FieldRef: &corev1.ObjectFieldSelector{
+				FieldPath: "metadata.name",
+			},
+		},
+	}
+}
+
+// getGoMemLimit returns the GOMEMLIMIT value, in bytes, for the given percentage of the
+// sidecar memory limit. ok is false if the sidecar has no memory limit.
+func getGoMemLimit(resources corev1.ResourceRequirements, percent int) (string, bool) {
+	limit, ok := resources.Limits[corev1.ResourceMemory]
+	if !ok || limit.IsZero() {
+		return "", false
+	}
+	if percent <= 0 || percent > 100 {
+		percent = defaultGoMemLimitPercent
+	}
+	return strconv.FormatInt(limit.Value()*int64(percent)/100, 10), true
+}
+
+// protectedSidecarArgs are the daprd flags that set the identity of the sidecar, its security, its
+// control plane or its ports. They are only set by the injector, so that the extra args can't get
+// around the app ID validation, mTLS or the control plane addresses, and so that the ports stay in
+// line with the container ports, the probes, the preStop hook and the env vars of the app containers.
+var protectedSidecarArgs = map[string]bool{
+	"mode":                    true,
+	"app-id":                  true,
+	"control-plane-address":   true,
+	"placement-host-address":  true,
+	"sentry-address":          true,
+	"enable-mtls":             true,
+	"trust-anchors-file":      true,
+	"dapr-http-port":          true,
+	"dapr-grpc-port":          true,
+	"dapr-internal-grpc-port": true,
+	"metrics-port":            true,
+	"app-port":                true,
+}
+
+func getSidecarExtraArgs(annotations map[string]string) ([]string, error) {
+	extraArgs := strings.Fields(getStringAnnotation(annotations, daprSidecarExtraArgsKey))
+	for _, arg := range parseArgs(extraArgs) {
+		if protectedSidecarArgs[arg.name] {
+			return nil, errors.Errorf("flag --%s can't be set with %s", arg.name, daprSidecarExtraArgsKey)
+		}
+	}
+	return extraArgs, nil
+}
+
+// getExtraArgsLogLevel returns the value of the --log-level flag of the extra args, which overrides
+// the log level annotation.
+func getExtraArgsLogLevel(annotations map[string]string) (string, bool) {
+	level, found := "", false
+	for _, arg := range parseArgs(strings.Fields(getStringAnnotation(annotations, daprSidecarExtraArgsKey))) {
+		if arg.name != "log-level" {
+			continue
+		}
+		found = true
+		level = ""
+		if idx := strings.Index(arg.tokens[0], "="); idx != -1 {
+			level = arg.tokens[0][idx+1:]
+		} else if len(arg.tokens) > 1 {
+			level = arg.tokens[1]
+		}
+	}
+	return level, found
+}
+
+// cmdArg is a command line flag along with the tokens making up its value.
+type cmdArg struct {
+	name   string
+	tokens []string
+}
+
+// isFlag returns true for tokens such as --log-level or -log-level=debug, but not for negative numbers.
+func isFlag(token string) bool {
+	if len(token) < 2 || !strings.HasPrefix(token, "-") {
+		return false
+	}
+	_, err := strconv.ParseFloat(token, 64)
+	return err != nil
+}
+
+// parseArgs groups the given tokens by flag. A flag is followed by its value unless the value
+// is set with = or the next token is another flag, as for boolean flags.
+func parseArgs(tokens []string) []cmdArg {
+	args := []cmdArg{}
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if !isFlag(token) {
+			// stray value without a flag, kept in place
+			args = append(args, cmdArg{tokens: []string{token}})
+			continue
+		}
+
+		name := strings.TrimLeft(token, "-")
+		if idx := strings.Index(name, "="); idx != -1 {
+			args = append(args, cmdArg{name: name[:idx], tokens: []string{token}})
+			continue
+		}
+
+		arg := cmdArg{name: name, tokens: []string{token}}
+		if i+1 < len(tokens) && !isFlag(tokens[i+1]) {
+			arg.tokens = append(arg.tokens, tokens[i+1])
+			i++
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+// mergeArgs adds the extra args to the sidecar args. A flag that is already set by the injector
+// is overridden in place by the extra args rather than being passed twice. The protected flags
+// are rejected before, when parsing the extra args.
+func mergeArgs(args, extraArgs []string) []string {
+	overrides := map[string]cmdArg{}
+	parsedExtra := parseArgs(extraArgs)
+	for _, arg := range parsedExtra {
+		if arg.name != "" {
+			overrides[arg.name] = arg
+		}
+	}
+
+	merged := []string{}
+	used := map[string]bool{}
+	for _, arg := range parseArgs(args) {
+		if override, ok := overrides[arg.name]; ok && arg.name != "" {
+			if !used[arg.name] {
+				merged = append(merged, override.tokens...)
+				used[arg.name] = true
+			}
+			continue
+		}
+		merged = append(merged, arg.tokens...)
+	}
+	for _, arg := range parsedExtra {
+		if arg.name != "" && used[arg.name] {
+			continue
+		}
+		merged = append(merged, arg.tokens...)
+	}
+	return merged
+}
+
+func getSidecarBaseContainer(annotations map[string]string) (*corev1.Container, error) {
+	raw := getStringAnnotation(annotations, daprSidecarBaseContainerKey)
+	if raw == "" {
+		return nil, nil
+	}
+	var base corev1.Container
+	if err := json.Unmarshal([]byte(raw), &base); err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", daprSidecarBaseContainerKey)
+	}
+	if err := validateSidecarBaseSecurityContext(base.SecurityContext); err != nil {
+		return nil, err
+	}
+	return &base, nil
+}
+
+// validateSidecarBaseSecurityContext rejects a base container that would escalate the privileges
+// of the sidecar. Host namespaces are set on the pod rather than on a container, so they can't be
+// requested through the base container. Privilege escalation, the user and added capabilities have
+// their own annotations, which keep them visible on the pod. An unmasked /proc and SELinux options,
+// which can give the sidecar an unconfined label such as spc_t, are rejected as well.
+func validateSidecarBaseSecurityContext(sc *corev1.SecurityContext) error {
+	if sc == nil {
+		return nil
+	}
+	if sc.Privileged != nil && *sc.Privileged {
+		return errors.Errorf("invalid value for %s: the sidecar can't be privileged", daprSidecarBaseContainerKey)
+	}
+	if sc.AllowPrivilegeEscalation != nil && *sc.AllowPrivilegeEscalation {
+		return errors.Errorf("invalid value for %s: use %s to allow privilege escalation", daprSidecarBaseContainerKey, daprAllowPrivilegeEscalationKey)
+	}
+	if sc.RunAsUser != nil && *sc.RunAsUser == 0 {
+		return errors.Errorf("invalid value for %s: the sidecar can't run as root", daprSidecarBaseContainerKey)
+	}
+	if sc.RunAsNonRoot != nil && !*sc.RunAsNonRoot {
+		return errors.Errorf("invalid value for %s: use %s to set runAsNonRoot", daprSidecarBaseContainerKey, daprRunAsNonRootKey)
+	}
+	if sc.Capabilities != nil && len(sc.Capabilities.Add) > 0 {
+		return errors.Errorf("invalid value for %s: use %s to add capabilities", daprSidecarBaseContainerKey, daprAddCapabilitiesKey)
+	}
+	if sc.ProcMount != nil && *sc.ProcMount != corev1.DefaultProcMount {
+		return errors.Errorf("invalid value for %s: the sidecar can't use the %s proc mount", daprSidecarBaseContainerKey, *sc.ProcMount)
+	}
+	if sc.SELinuxOptions != nil {
+		return errors.Errorf("invalid value for %s: the sidecar can't set SELinux options", daprSidecarBaseContainerKey)
+	}
+	return nil
+}
+
+// overlaySidecarContainer uses the user supplied base container as the starting point for the sidecar.
+// Fields required by the injector always come from the injected container, env vars, volume mounts,
+// resources and the security context are merged with the injected values taking precedence, the
+// lifecycle hooks are merged with the base container taking precedence, and the remaining fields
+// are only filled in when the base container leaves them empty.
+func overlaySidecarContainer(base, injected *corev1.Container) *corev1.Container {
+	c := base.DeepCopy()
+
+	c.Name = injected.Name
+	c.Image = injected.Image
+	c.Command = injected.Command
+	c.Args = injected.Args
+	c.Ports = injected.Ports
+	c.ReadinessProbe = injected.ReadinessProbe
+	c.LivenessProbe = injected.LivenessProbe
+	if injected.StartupProbe != nil {
+		c.StartupProbe = injected.StartupProbe
+	}
+
+	env := append([]corev1.EnvVar{}, injected.Env...)
+LoopEnv:
+	for _, e := range base.Env {
+		for _, i := range injected.Env {
+			if e.Name == i.Name {
+				continue LoopEnv
+			}
+		}
+		env = append(env, e)
+	}
+	c.Env = env
+
+	volumeMounts := append([]corev1.VolumeMount{}, injected.VolumeMounts...)
+LoopVolumeMounts:
+	for _, v := range base.VolumeMounts {
+		for _, i := range injected.VolumeMounts {
+			if v.MountPath == i.MountPath {
+				continue LoopVolumeMounts
+			}
+		}
+		volumeMounts = append(volumeMounts, v)
+	}
+	if len(volumeMounts) > 0 {
+		c.VolumeMounts = volumeMounts
+	}
+
+	if c.ImagePullPolicy == "" {
+		c.ImagePullPolicy = injected.ImagePullPolicy
+	}
+	if c.TerminationMessagePolicy == "" {
+		c.TerminationMessagePolicy = injected.TerminationMessagePolicy
+	}
+	c.SecurityContext = mergeSecurityContext(c.SecurityContext, injected.SecurityContext)
+	c.Lifecycle = mergeLifecycle(c.Lifecycle, injected.Lifecycle)
+	c.Resources.Limits = mergeResourceList(c.Resources.Limits, injected.Resources.Limits)
+	c.Resources.Requests = mergeResourceList(c.Resources.Requests, injected.Resources.Requests)
+	return c
+}
+
+func hasPreStop(lifecycle *corev1.Lifecycle) bool {
+	return lifecycle != nil && lifecycle.PreStop != nil
+}
+
+// mergeLifecycle keeps the hooks of the base lifecycle and adds the injected hooks it doesn't set,
+// such as the drain preStop hook next to a postStart hook of the base container. A preStop hook in
+// both is rejected when the sidecar container is built.
+func mergeLifecycle(base, injected *corev1.Lifecycle) *corev1.Lifecycle {
+	if base == nil {
+		return injected
+	}
+	if injected == nil {
+		return base
+	}
+	merged := base.DeepCopy()
+	if merged.PreStop == nil {
+		merged.PreStop = injected.PreStop
+	}
+	if merged.PostStart == nil {
+		merged.PostStart = injected.PostStart
+	}
+	return merged
+}
+
+// mergeSecurityContext sets the fields of the injected security context, which come from the
+// annotations and the defaults of the injector, over the base security context.
+func mergeSecurityContext(base, injected *corev1.SecurityContext) *corev1.SecurityContext {
+	if base == nil {
+		return injected
+	}
+	if injected == nil {
+		return base
+	}
+	sc := base.DeepCopy()
+	if injected.Capabilities != nil {
+		sc.Capabilities = injected.Capabilities
+	}
+	if injected.Privileged != nil {
+		sc.Privileged = injected.Privileged
+	}
+	if injected.SELinuxOptions != nil {
+		sc.SELinuxOptions = injected.SELinuxOptions
+	}
+	if injected.WindowsOptions != nil {
+		sc.WindowsOptions = injected.WindowsOptions
+	}
+	if injected.RunAsUser != nil {
+		sc.RunAsUser = injected.RunAsUser
+	}
+	if injected.RunAsGroup != nil {
+		sc.RunAsGroup = injected.RunAsGroup
+	}
+	if injected.RunAsNonRoot != nil {
+		sc.RunAsNonRoot = injected.RunAsNonRoot
+	}
+	if injected.ReadOnlyRootFilesystem != nil {
+		sc.ReadOnlyRootFilesystem = injected.ReadOnlyRootFilesystem
+	}
+	if injected.AllowPrivilegeEscalation != nil {
+		sc.AllowPrivilegeEscalation = injected.AllowPrivilegeEscalation
+	}
+	if injected.ProcMount != nil {
+		sc.ProcMount = injected.ProcMount
+	}
+	if injected.SeccompProfile != nil {
+		sc.SeccompProfile = injected.SeccompProfile
+	}
+	return sc
+}
+
+// mergeResourceList sets the injected quantities over the base quantities of the same resources.
+func mergeResourceList(base, injected corev1.ResourceList) corev1.ResourceList {
+	if len(injected) == 0 {
+		return base
+	}
+	merged := corev1.ResourceList{}
+	for name, quantity := range base {
+		merged[name] = quantity
+	}
+	for name, quantity := range injected {
+		merged[name] = quantity
+	}
+	return merged
+}
@@ -6,16 +6,37 @@
 package injector
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 
+	configurationapi "github.com/dapr/dapr/pkg/apis/configuration/v1alpha1"
+	daprfake "github.com/dapr/dapr/pkg/client/clientset/versioned/fake"
+	"github.com/dapr/dapr/pkg/credentials"
+	"github.com/dapr/dapr/pkg/operator/handlers"
+	"github.com/dapr/dapr/pkg/sentry/certs"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 
+	v1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLogAsJSONEnabled(t *testing.T) {
@@ -84,7 +105,10 @@ func TestGetProbeHttpHandler(t *testing.T) {
 		},
 	}
 
-	assert.EqualValues(t, expectedHandler, getProbeHTTPHandler(defaultSidecarHTTPPort, pathElements...))
+	assert.EqualValues(t, expectedHandler, getProbeHTTPHandler(defaultSidecarHTTPPort, "", pathElements...))
+
+	expectedHandler.HTTPGet.Scheme = corev1.URISchemeHTTPS
+	assert.EqualValues(t, expectedHandler, getProbeHTTPHandler(defaultSidecarHTTPPort, corev1.URISchemeHTTPS, pathElements...))
 }
 
 func TestGetSideCarContainer(t *testing.T) {
@@ -317,10 +341,4057 @@ func TestAddDaprEnvVarsToContainers(t *testing.T) {
 	for _, tc := range testCases {
 		tc := tc
 		t.Run(tc.testName, func(t *testing.T) {
-			patchEnv := addDaprEnvVarsToContainers([]corev1.Container{tc.mockContainer}, tc.mockEnvs)
+			patchEnv := addDaprEnvVarsToContainers([]corev1.Container{tc.mockContainer}, tc.mockEnvs, false)
 			fmt.Println(tc.testName)
 			assert.Equal(t, tc.expOpsLen, len(patchEnv))
 			assert.Equal(t, tc.expOps, patchEnv)
 		})
 	}
 }
+
+func getTestAdmissionReview(t *testing.T, pod corev1.Pod) *v1.AdmissionReview {
+	raw, err := json.Marshal(pod)
+	assert.NoError(t, err)
+	return &v1.AdmissionReview{
+		Request: &v1.AdmissionRequest{
+			Namespace: "ns",
+			Object: runtime.RawExtension{
+				Raw: raw,
+			},
+		},
+	}
+}
+
+func getTestDaprClient(mtlsEnabled bool) *daprfake.Clientset {
+	return daprfake.NewSimpleClientset(&configurationapi.Configuration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaultConfig,
+			Namespace: "dapr-system",
+		},
+		Spec: configurationapi.ConfigurationSpec{
+			MTLSSpec: configurationapi.MTLSSpec{
+				Enabled: mtlsEnabled,
+			},
+		},
+	})
+}
+
+// getTestEnvPatchValues returns the env vars added to the app containers by the given patch.
+func getTestEnvPatchValues(patchOps []PatchOperation) []corev1.EnvVar {
+	env := []corev1.EnvVar{}
+	for _, p := range patchOps {
+		switch v := p.Value.(type) {
+		case []corev1.EnvVar:
+			env = append(env, v...)
+		case corev1.EnvVar:
+			env = append(env, v)
+		}
+	}
+	return env
+}
+
+func TestMTLSEnabled(t *testing.T) {
+	t.Run("system configuration", func(t *testing.T) {
+		for _, expected := range []bool{true, false} {
+			enabled, err := mTLSEnabled(getTestDaprClient(expected))
+			assert.NoError(t, err)
+			assert.Equal(t, expected, enabled)
+		}
+	})
+
+	t.Run("no system configuration", func(t *testing.T) {
+		enabled, err := mTLSEnabled(daprfake.NewSimpleClientset())
+		assert.NoError(t, err)
+		assert.Equal(t, defaultMtlsEnabled, enabled)
+	})
+
+	t.Run("lookup error", func(t *testing.T) {
+		daprClient := daprfake.NewSimpleClientset()
+		daprClient.PrependReactor("list", "configurations", func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("api server unreachable")
+		})
+		enabled, err := mTLSEnabled(daprClient)
+		assert.Error(t, err)
+		assert.False(t, enabled)
+	})
+}
+
+func TestGetPodPatchOperationsWarnings(t *testing.T) {
+	i := &injector{}
+
+	t.Run("deprecated annotation", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					daprEnabledKey:               "true",
+					appIDKey:                     "app",
+					deprecatedSidecarHTTPPortKey: "3600",
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+		}
+
+		patchOps, warnings, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.NotEmpty(t, patchOps)
+		assert.Equal(t, []string{fmt.Sprintf("annotation %s is deprecated, use %s instead", deprecatedSidecarHTTPPortKey, sidecarHTTPPortKey)}, warnings)
+	})
+
+	t.Run("new port annotation", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					daprEnabledKey:     "true",
+					appIDKey:           "app",
+					sidecarHTTPPortKey: "3600",
+				},
+			},
+		}
+
+		_, warnings, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.Empty(t, warnings)
+	})
+
+	t.Run("missing secret", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					daprEnabledKey:     "true",
+					appIDKey:           "app",
+					daprAPITokenSecret: "missing",
+				},
+			},
+		}
+
+		_, warnings, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.Len(t, warnings, 1)
+		assert.Contains(t, warnings[0], "missing")
+	})
+
+	t.Run("no warnings", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					daprEnabledKey: "true",
+					appIDKey:       "app",
+				},
+			},
+		}
+
+		_, warnings, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.Empty(t, warnings)
+	})
+}
+
+func TestGetSideCarPorts(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		annotations := map[string]string{}
+		assert.Equal(t, int32(defaultSidecarHTTPPort), getSideCarHTTPPort(annotations))
+		assert.Equal(t, int32(defaultSidecarAPIGRPCPort), getSideCarAPIGRPCPort(annotations))
+		assert.Equal(t, int32(defaultSidecarInternalGRPCPortKey), getSideCarInternalGRPCPort(annotations))
+	})
+
+	t.Run("dapr.io annotations", func(t *testing.T) {
+		annotations := map[string]string{
+			sidecarHTTPPortKey:         "3600",
+			sidecarAPIGRPCPortKey:      "50011",
+			sidecarInternalGRPCPortKey: "50012",
+		}
+		assert.Equal(t, int32(3600), getSideCarHTTPPort(annotations))
+		assert.Equal(t, int32(50011), getSideCarAPIGRPCPort(annotations))
+		assert.Equal(t, int32(50012), getSideCarInternalGRPCPort(annotations))
+	})
+
+	t.Run("deprecated annotations", func(t *testing.T) {
+		annotations := map[string]string{
+			deprecatedSidecarHTTPPortKey:     "3700",
+			deprecatedSidecarAPIGRPCPortKey:  "50021",
+			deprecatedSidecarInternalGRPCKey: "50022",
+		}
+		assert.Equal(t, int32(3700), getSideCarHTTPPort(annotations))
+		assert.Equal(t, int32(50021), getSideCarAPIGRPCPort(annotations))
+		assert.Equal(t, int32(50022), getSideCarInternalGRPCPort(annotations))
+		assert.Len(t, getDeprecatedAnnotationWarnings(annotations), 3)
+	})
+}
+
+func TestValidateMutuallyExclusiveAnnotations(t *testing.T) {
+	t.Run("no conflict", func(t *testing.T) {
+		annotations := map[string]string{
+			sidecarHTTPPortKey:              "3600",
+			deprecatedSidecarAPIGRPCPortKey: "50011",
+		}
+		assert.NoError(t, validateMutuallyExclusiveAnnotations(annotations))
+	})
+
+	t.Run("conflicting http port annotations", func(t *testing.T) {
+		annotations := map[string]string{
+			sidecarHTTPPortKey:           "3600",
+			deprecatedSidecarHTTPPortKey: "3700",
+		}
+		assert.Error(t, validateMutuallyExclusiveAnnotations(annotations))
+	})
+
+	t.Run("conflicting grpc port annotations", func(t *testing.T) {
+		annotations := map[string]string{
+			sidecarAPIGRPCPortKey:           "50011",
+			deprecatedSidecarAPIGRPCPortKey: "50011",
+		}
+		assert.Error(t, validateMutuallyExclusiveAnnotations(annotations))
+	})
+
+	t.Run("placement address override with a placement port", func(t *testing.T) {
+		annotations := map[string]string{
+			daprPlacementHostAddressKey: "placement:50005",
+			daprPlacementHostPortKey:    "50006",
+		}
+		assert.Error(t, validateMutuallyExclusiveAnnotations(annotations))
+	})
+
+	t.Run("disabled liveness probe with liveness annotations", func(t *testing.T) {
+		for _, key := range []string{
+			daprLivenessProbeDelayKey,
+			daprLivenessProbeTimeoutKey,
+			daprLivenessProbePeriodKey,
+			daprLivenessProbeThresholdKey,
+			daprLivenessProbeSchemeKey,
+			daprLivenessStartupSecondsKey,
+			daprLivenessOnlyHealthzKey,
+		} {
+			annotations := map[string]string{
+				daprDisableLivenessProbeKey: "true",
+				key:                         "1",
+			}
+			assert.Error(t, validateMutuallyExclusiveAnnotations(annotations), key)
+		}
+	})
+
+	t.Run("disabled liveness probe with readiness annotations", func(t *testing.T) {
+		annotations := map[string]string{
+			daprDisableLivenessProbeKey: "true",
+			daprReadinessProbeDelayKey:  "10",
+		}
+		assert.NoError(t, validateMutuallyExclusiveAnnotations(annotations))
+	})
+
+	t.Run("admission error", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					daprEnabledKey:                   "true",
+					sidecarInternalGRPCPortKey:       "50012",
+					deprecatedSidecarInternalGRPCKey: "50022",
+				},
+			},
+		}
+
+		i := &injector{}
+		_, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.Error(t, err)
+	})
+}
+
+func TestGetSidecarImage(t *testing.T) {
+	namespaceImages := map[string]string{"debug": "daprio/daprd:debug"}
+
+	t.Run("default image", func(t *testing.T) {
+		assert.Equal(t, "daprio/daprd", getSidecarImage(map[string]string{}, "ns", "daprio/daprd", namespaceImages))
+	})
+
+	t.Run("namespace override", func(t *testing.T) {
+		assert.Equal(t, "daprio/daprd:debug", getSidecarImage(map[string]string{}, "debug", "daprio/daprd", namespaceImages))
+	})
+
+	t.Run("annotation override", func(t *testing.T) {
+		annotations := map[string]string{daprSidecarImageKey: "daprio/daprd:custom"}
+		assert.Equal(t, "daprio/daprd:custom", getSidecarImage(annotations, "debug", "daprio/daprd", namespaceImages))
+	})
+
+	t.Run("namespace override applied to the patch", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					daprEnabledKey: "true",
+				},
+			},
+		}
+		i := &injector{
+			config: Config{
+				SidecarImageNamespaceOverrides: map[string]string{"ns": "daprio/daprd:debug"},
+			},
+		}
+
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprio/daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		containers := patchOps[0].Value.([]corev1.Container)
+		assert.Equal(t, "daprio/daprd:debug", containers[0].Image)
+	})
+}
+
+func TestAppTokenAppContainerEnv(t *testing.T) {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "pod",
+			Annotations: map[string]string{
+				daprEnabledKey:         "true",
+				daprAppTokenSecret:     "appsecret",
+				daprAppTokenEnvNameKey: "MY_APP_TOKEN",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}},
+		},
+	}
+	i := &injector{config: NewConfigWithDefaults()}
+	patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+	assert.Nil(t, err)
+
+	found := false
+	for _, op := range patchOps {
+		if op.Path != "/spec/containers/0/env" {
+			continue
+		}
+		for _, e := range op.Value.([]corev1.EnvVar) {
+			if e.Name == "MY_APP_TOKEN" {
+				found = true
+				assert.Equal(t, "appsecret", e.ValueFrom.SecretKeyRef.Name)
+			}
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestMetricsProxyContainer(t *testing.T) {
+	t.Run("container args", func(t *testing.T) {
+		annotations := map[string]string{daprMetricsPortKey: "9095"}
+		c := getMetricsProxyContainer(annotations, "alpine/socat", defaultMetricsProxyPort)
+		assert.Equal(t, metricsProxyContainerName, c.Name)
+		assert.Equal(t, "alpine/socat", c.Image)
+		assert.Equal(t, []string{"TCP-LISTEN:9091,fork,reuseaddr", "TCP:127.0.0.1:9095"}, c.Args)
+		assert.Equal(t, int32(defaultMetricsProxyPort), c.Ports[0].ContainerPort)
+	})
+
+	t.Run("restricted security context", func(t *testing.T) {
+		c := getMetricsProxyContainer(map[string]string{}, "alpine/socat", defaultMetricsProxyPort)
+		assert.False(t, *c.SecurityContext.AllowPrivilegeEscalation)
+		assert.True(t, *c.SecurityContext.ReadOnlyRootFilesystem)
+		assert.True(t, *c.SecurityContext.RunAsNonRoot)
+		assert.Equal(t, int64(metricsProxyUser), *c.SecurityContext.RunAsUser)
+		assert.Equal(t, []corev1.Capability{"ALL"}, c.SecurityContext.Capabilities.Drop)
+		assert.Equal(t, corev1.SeccompProfileTypeRuntimeDefault, c.SecurityContext.SeccompProfile.Type)
+	})
+
+	t.Run("proxy port", func(t *testing.T) {
+		port, err := getMetricsProxyPort(map[string]string{})
+		assert.NoError(t, err)
+		assert.Equal(t, int32(defaultMetricsProxyPort), port)
+
+		port, err = getMetricsProxyPort(map[string]string{daprMetricsProxyPortKey: "9191"})
+		assert.NoError(t, err)
+		assert.Equal(t, int32(9191), port)
+
+		c := getMetricsProxyContainer(map[string]string{}, "alpine/socat", port)
+		assert.Equal(t, []string{"TCP-LISTEN:9191,fork,reuseaddr", "TCP:127.0.0.1:9090"}, c.Args)
+		assert.Equal(t, int32(9191), c.Ports[0].ContainerPort)
+
+		for _, value := range []string{"0", "65536", "-1", "port"} {
+			_, err = getMetricsProxyPort(map[string]string{daprMetricsProxyPortKey: value})
+			assert.Error(t, err, value)
+		}
+	})
+
+	t.Run("proxy port used by the app", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					daprEnabledKey:            "true",
+					daprInjectMetricsProxyKey: "true",
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{
+					Name:  "app",
+					Ports: []corev1.ContainerPort{{ContainerPort: defaultMetricsProxyPort}},
+				}},
+			},
+		}
+		i := &injector{config: NewConfigWithDefaults()}
+
+		_, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.Error(t, err)
+
+		pod.Annotations[daprMetricsProxyPortKey] = "9191"
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		proxy := patchOps[1].Value.(corev1.Container)
+		assert.Equal(t, int32(9191), proxy.Ports[0].ContainerPort)
+	})
+
+	t.Run("proxy port used by the sidecar", func(t *testing.T) {
+		err := validateMetricsProxyPort(defaultMetricsProxyPort, []corev1.Container{{
+			Name:  sidecarContainerName,
+			Ports: []corev1.ContainerPort{{ContainerPort: defaultMetricsProxyPort}},
+		}})
+		assert.Error(t, err)
+	})
+
+	t.Run("proxy added to the patch", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					daprEnabledKey:            "true",
+					daprInjectMetricsProxyKey: "true",
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+		}
+		i := &injector{config: NewConfigWithDefaults()}
+
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.Equal(t, "/spec/containers/-", patchOps[1].Path)
+		proxy := patchOps[1].Value.(corev1.Container)
+		assert.Equal(t, metricsProxyContainerName, proxy.Name)
+		assert.Equal(t, []string{"TCP-LISTEN:9091,fork,reuseaddr", "TCP:127.0.0.1:9090"}, proxy.Args)
+	})
+
+	t.Run("proxy not added by default", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					daprEnabledKey: "true",
+				},
+			},
+		}
+		i := &injector{config: NewConfigWithDefaults()}
+
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.Len(t, patchOps[0].Value.([]corev1.Container), 1)
+	})
+}
+
+func TestHealthzPathIncludeAppID(t *testing.T) {
+	t.Run("default path", func(t *testing.T) {
+		c, err := getSidecarContainer(map[string]string{}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, "/v1.0/healthz", c.LivenessProbe.HTTPGet.Path)
+		assert.Equal(t, "/v1.0/healthz", c.ReadinessProbe.HTTPGet.Path)
+	})
+
+	t.Run("app id prefixed path", func(t *testing.T) {
+		annotations := map[string]string{daprHealthzIncludeAppIDKey: "true"}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, "/app/v1.0/healthz", c.LivenessProbe.HTTPGet.Path)
+		assert.Equal(t, "/app/v1.0/healthz", c.ReadinessProbe.HTTPGet.Path)
+	})
+
+	t.Run("liveness only healthz path", func(t *testing.T) {
+		annotations := map[string]string{daprLivenessOnlyHealthzKey: "true"}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, "/v1.0/healthz/liveness", c.LivenessProbe.HTTPGet.Path)
+		assert.Equal(t, "/v1.0/healthz", c.ReadinessProbe.HTTPGet.Path)
+	})
+
+	t.Run("liveness only healthz path with an app id prefix", func(t *testing.T) {
+		annotations := map[string]string{daprLivenessOnlyHealthzKey: "true", daprHealthzIncludeAppIDKey: "true"}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, "/app/v1.0/healthz/liveness", c.LivenessProbe.HTTPGet.Path)
+		assert.Equal(t, "/app/v1.0/healthz", c.ReadinessProbe.HTTPGet.Path)
+	})
+
+	t.Run("components readiness path", func(t *testing.T) {
+		annotations := map[string]string{daprReadinessComponentsKey: "true"}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, "/v1.0/healthz", c.LivenessProbe.HTTPGet.Path)
+		assert.Equal(t, "/v1.0/healthz/components", c.ReadinessProbe.HTTPGet.Path)
+	})
+
+	t.Run("components readiness path with liveness only healthz and an app id prefix", func(t *testing.T) {
+		annotations := map[string]string{daprReadinessComponentsKey: "true", daprLivenessOnlyHealthzKey: "true", daprHealthzIncludeAppIDKey: "true"}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, "/app/v1.0/healthz/liveness", c.LivenessProbe.HTTPGet.Path)
+		assert.Equal(t, "/app/v1.0/healthz/components", c.ReadinessProbe.HTTPGet.Path)
+	})
+
+	t.Run("path elements", func(t *testing.T) {
+		assert.Equal(t, "/my-app/v1.0/healthz", formatProbePath(getHealthzPathElements("", true, "my-app", "")...))
+		assert.Equal(t, "/v1.0/healthz", formatProbePath(getHealthzPathElements("", false, "my-app", "")...))
+		assert.Equal(t, "/my-app/health", formatProbePath(getHealthzPathElements("", true, "my-app", "/health")...))
+	})
+
+	t.Run("custom healthz path", func(t *testing.T) {
+		annotations := map[string]string{daprHealthzPathKey: "/custom/health/"}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, "/custom/health", c.LivenessProbe.HTTPGet.Path)
+		assert.Equal(t, "/custom/health", c.ReadinessProbe.HTTPGet.Path)
+	})
+
+	t.Run("empty healthz path falls back to the default", func(t *testing.T) {
+		annotations := map[string]string{daprHealthzPathKey: ""}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, "/v1.0/healthz", c.LivenessProbe.HTTPGet.Path)
+	})
+
+	t.Run("relative healthz path", func(t *testing.T) {
+		annotations := map[string]string{daprHealthzPathKey: "health"}
+		_, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Error(t, err)
+	})
+}
+
+func TestAllowPrivilegeEscalation(t *testing.T) {
+	t.Run("default false", func(t *testing.T) {
+		c, err := getSidecarContainer(map[string]string{}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.False(t, *c.SecurityContext.AllowPrivilegeEscalation)
+	})
+
+	t.Run("annotation true", func(t *testing.T) {
+		annotations := map[string]string{daprAllowPrivilegeEscalationKey: "true"}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.True(t, *c.SecurityContext.AllowPrivilegeEscalation)
+	})
+
+	t.Run("annotation false", func(t *testing.T) {
+		annotations := map[string]string{daprAllowPrivilegeEscalationKey: "false"}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.False(t, *c.SecurityContext.AllowPrivilegeEscalation)
+	})
+}
+
+func TestProbeScheme(t *testing.T) {
+	t.Run("default scheme", func(t *testing.T) {
+		c, err := getSidecarContainer(map[string]string{}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, corev1.URIScheme(""), c.LivenessProbe.HTTPGet.Scheme)
+		assert.Equal(t, corev1.URIScheme(""), c.ReadinessProbe.HTTPGet.Scheme)
+	})
+
+	t.Run("mixed schemes", func(t *testing.T) {
+		annotations := map[string]string{
+			daprLivenessProbeSchemeKey:  "http",
+			daprReadinessProbeSchemeKey: "https",
+		}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, corev1.URISchemeHTTP, c.LivenessProbe.HTTPGet.Scheme)
+		assert.Equal(t, corev1.URISchemeHTTPS, c.ReadinessProbe.HTTPGet.Scheme)
+	})
+
+	t.Run("startup probe follows the liveness scheme", func(t *testing.T) {
+		annotations := map[string]string{
+			daprReadinessProbeSchemeKey:  "https",
+			daprStartupProbeThresholdKey: "30",
+		}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, corev1.URIScheme(""), c.StartupProbe.HTTPGet.Scheme)
+
+		annotations[daprLivenessProbeSchemeKey] = "https"
+		c, err = getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, corev1.URISchemeHTTPS, c.StartupProbe.HTTPGet.Scheme)
+	})
+
+	t.Run("invalid scheme", func(t *testing.T) {
+		annotations := map[string]string{daprLivenessProbeSchemeKey: "tcp"}
+		_, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Error(t, err)
+	})
+}
+
+func TestSidecarBaseContainer(t *testing.T) {
+	t.Run("overlay", func(t *testing.T) {
+		annotations := map[string]string{
+			daprSidecarBaseContainerKey: `{
+				"name": "custom",
+				"image": "custom/image",
+				"command": ["/bin/sh"],
+				"args": ["-c", "sleep"],
+				"workingDir": "/work",
+				"imagePullPolicy": "Never",
+				"env": [{"name": "NAMESPACE", "value": "other"}, {"name": "CUSTOM", "value": "value"}],
+				"resources": {"limits": {"cpu": "200m"}}
+			}`,
+			daprCPULimitKey: "100m",
+		}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+
+		// protected fields
+		assert.Equal(t, sidecarContainerName, c.Name)
+		assert.Equal(t, "image", c.Image)
+		assert.Equal(t, []string{"/daprd"}, c.Command)
+		assert.Contains(t, c.Args, "--app-id")
+		assert.NotNil(t, c.LivenessProbe)
+		assert.NotNil(t, c.ReadinessProbe)
+		assert.Len(t, c.Ports, 4)
+
+		// base container fields
+		assert.Equal(t, "/work", c.WorkingDir)
+		assert.Equal(t, corev1.PullNever, c.ImagePullPolicy)
+		assert.Equal(t, "100m", c.Resources.Limits.Cpu().String())
+
+		// merged env
+		env := map[string]string{}
+		for _, e := range c.Env {
+			env[e.Name] = e.Value
+		}
+		assert.Equal(t, "ns", env["NAMESPACE"])
+		assert.Equal(t, "value", env["CUSTOM"])
+	})
+
+	t.Run("empty base fields are filled in", func(t *testing.T) {
+		annotations := map[string]string{
+			daprSidecarBaseContainerKey: `{"workingDir": "/work"}`,
+		}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, corev1.PullAlways, c.ImagePullPolicy)
+		assert.NotNil(t, c.SecurityContext)
+		assert.Equal(t, corev1.TerminationMessageFallbackToLogsOnError, c.TerminationMessagePolicy)
+	})
+
+	t.Run("invalid base container", func(t *testing.T) {
+		annotations := map[string]string{
+			daprSidecarBaseContainerKey: `{"name": `,
+		}
+		_, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("privileged base container", func(t *testing.T) {
+		annotations := map[string]string{
+			daprSidecarBaseContainerKey: `{"securityContext": {"privileged": true}}`,
+		}
+		_, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("base container allowing privilege escalation", func(t *testing.T) {
+		annotations := map[string]string{
+			daprSidecarBaseContainerKey: `{"securityContext": {"allowPrivilegeEscalation": true}}`,
+		}
+		_, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("base container running as root", func(t *testing.T) {
+		annotations := map[string]string{
+			daprSidecarBaseContainerKey: `{"securityContext": {"runAsUser": 0}}`,
+		}
+		_, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("base container adding capabilities", func(t *testing.T) {
+		annotations := map[string]string{
+			daprSidecarBaseContainerKey: `{"securityContext": {"capabilities": {"add": ["NET_ADMIN"]}}}`,
+		}
+		_, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("base container allowing root", func(t *testing.T) {
+		annotations := map[string]string{
+			daprSidecarBaseContainerKey: `{"securityContext": {"runAsNonRoot": false}}`,
+		}
+		_, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("base container with an unmasked proc mount", func(t *testing.T) {
+		annotations := map[string]string{
+			daprSidecarBaseContainerKey: `{"securityContext": {"procMount": "Unmasked"}}`,
+		}
+		_, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("base container with the default proc mount", func(t *testing.T) {
+		annotations := map[string]string{
+			daprSidecarBaseContainerKey: `{"securityContext": {"procMount": "Default"}}`,
+		}
+		_, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+	})
+
+	t.Run("base container setting SELinux options", func(t *testing.T) {
+		annotations := map[string]string{
+			daprSidecarBaseContainerKey: `{"securityContext": {"seLinuxOptions": {"type": "spc_t"}}}`,
+		}
+		_, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("annotated security context wins over the base security context", func(t *testing.T) {
+		annotations := map[string]string{
+			daprSidecarBaseContainerKey:     `{"securityContext": {"runAsUser": 1000, "readOnlyRootFilesystem": false, "runAsGroup": 3000, "capabilities": {"drop": ["NET_RAW"]}}}`,
+			daprRunAsUserKey:                "2000",
+			daprReadOnlyRootFilesystemKey:   "true",
+			daprDropCapabilitiesKey:         "ALL",
+			daprAllowPrivilegeEscalationKey: "false",
+		}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2000), *c.SecurityContext.RunAsUser)
+		assert.True(t, *c.SecurityContext.ReadOnlyRootFilesystem)
+		assert.Equal(t, []corev1.Capability{"ALL"}, c.SecurityContext.Capabilities.Drop)
+		assert.False(t, *c.SecurityContext.AllowPrivilegeEscalation)
+		// fields the annotations leave unset come from the base security context
+		assert.Equal(t, int64(3000), *c.SecurityContext.RunAsGroup)
+	})
+
+	t.Run("annotated resources win over the base resources", func(t *testing.T) {
+		annotations := map[string]string{
+			daprSidecarBaseContainerKey: `{"resources": {"limits": {"cpu": "200m", "memory": "1Gi"}, "requests": {"cpu": "50m"}}}`,
+			daprCPULimitKey:             "100m",
+			daprMemoryRequestKey:        "64Mi",
+		}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, "100m", c.Resources.Limits.Cpu().String())
+		assert.Equal(t, "1Gi", c.Resources.Limits.Memory().String())
+		assert.Equal(t, "50m", c.Resources.Requests.Cpu().String())
+		assert.Equal(t, "64Mi", c.Resources.Requests.Memory().String())
+	})
+
+	t.Run("base lifecycle is merged with the drain hook", func(t *testing.T) {
+		annotations := map[string]string{
+			daprSidecarBaseContainerKey:    `{"lifecycle": {"postStart": {"exec": {"command": ["/bin/true"]}}}}`,
+			daprGracefulShutdownSecondsKey: "10",
+		}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"/bin/true"}, c.Lifecycle.PostStart.Exec.Command)
+		assert.Equal(t, getSidecarLifecycle(defaultSidecarHTTPPort, 10).PreStop, c.Lifecycle.PreStop)
+	})
+
+	t.Run("base preStop hook conflicts with the drain hook", func(t *testing.T) {
+		annotations := map[string]string{
+			daprSidecarBaseContainerKey:    `{"lifecycle": {"preStop": {"exec": {"command": ["/bin/sleep", "5"]}}}}`,
+			daprGracefulShutdownSecondsKey: "10",
+		}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), daprGracefulShutdownSecondsKey)
+		assert.Nil(t, c)
+	})
+
+	t.Run("base preStop hook kept without a drain window", func(t *testing.T) {
+		annotations := map[string]string{
+			daprSidecarBaseContainerKey: `{"lifecycle": {"preStop": {"exec": {"command": ["/bin/sleep", "5"]}}}}`,
+		}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"/bin/sleep", "5"}, c.Lifecycle.PreStop.Exec.Command)
+		assert.Nil(t, c.Lifecycle.PostStart)
+	})
+
+	t.Run("unprivileged base security context", func(t *testing.T) {
+		annotations := map[string]string{
+			daprSidecarBaseContainerKey: `{"securityContext": {"privileged": false, "allowPrivilegeEscalation": false, "runAsNonRoot": true}}`,
+		}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.True(t, *c.SecurityContext.RunAsNonRoot)
+	})
+}
+
+func TestGetVolumePatchOperations(t *testing.T) {
+	volume := corev1.Volume{Name: "dapr-volume"}
+
+	t.Run("no volumes to add", func(t *testing.T) {
+		assert.Len(t, getVolumePatchOperations(nil, nil, volumesPath), 0)
+	})
+
+	t.Run("pod without volumes", func(t *testing.T) {
+		patchOps := getVolumePatchOperations(nil, []corev1.Volume{volume}, volumesPath)
+		assert.Equal(t, []PatchOperation{{Op: "add", Path: "/spec/volumes", Value: []corev1.Volume{volume}}}, patchOps)
+	})
+
+	t.Run("pod with volumes", func(t *testing.T) {
+		patchOps := getVolumePatchOperations([]corev1.Volume{{Name: "app-volume"}}, []corev1.Volume{volume}, volumesPath)
+		assert.Equal(t, []PatchOperation{{Op: "add", Path: "/spec/volumes/-", Value: volume}}, patchOps)
+	})
+
+	t.Run("conflicting volume", func(t *testing.T) {
+		patchOps := getVolumePatchOperations([]corev1.Volume{volume}, []corev1.Volume{volume}, volumesPath)
+		assert.Len(t, patchOps, 0)
+	})
+}
+
+func TestAutomountServiceAccountTokenPatch(t *testing.T) {
+	automountPatch := PatchOperation{
+		Op:    "add",
+		Path:  automountServiceAccountTokenPath,
+		Value: true,
+	}
+	i := &injector{}
+
+	t.Run("mtls enabled without token volume", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pod",
+				Annotations: map[string]string{daprEnabledKey: "true"},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+		}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(true))
+		assert.NoError(t, err)
+		assert.Contains(t, patchOps, automountPatch)
+	})
+
+	t.Run("mtls enabled with token volume", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pod",
+				Annotations: map[string]string{daprEnabledKey: "true"},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name: "app",
+						VolumeMounts: []corev1.VolumeMount{
+							{Name: "token", MountPath: kubernetesMountPath},
+						},
+					},
+				},
+			},
+		}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(true))
+		assert.NoError(t, err)
+		assert.NotContains(t, patchOps, automountPatch)
+	})
+
+	t.Run("mtls disabled", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pod",
+				Annotations: map[string]string{daprEnabledKey: "true"},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+		}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.NotEmpty(t, patchOps)
+		assert.NotContains(t, patchOps, automountPatch)
+	})
+}
+
+func TestPortPool(t *testing.T) {
+	t.Run("assign ports skipping used ones", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{daprUsePortPoolKey: "true"},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Name: "app", Ports: []corev1.ContainerPort{{ContainerPort: 4001}}},
+				},
+			},
+		}
+		annotations, err := assignPortsFromPool(pod, 4000, 4010)
+		assert.NoError(t, err)
+		assert.Equal(t, "4000", annotations[sidecarHTTPPortKey])
+		assert.Equal(t, "4002", annotations[sidecarAPIGRPCPortKey])
+		assert.Equal(t, "4003", annotations[sidecarInternalGRPCPortKey])
+		assert.NotContains(t, pod.Annotations, sidecarHTTPPortKey)
+	})
+
+	t.Run("pool exhausted", func(t *testing.T) {
+		pod := corev1.Pod{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Name: "app", Ports: []corev1.ContainerPort{{ContainerPort: 4001}}},
+				},
+			},
+		}
+		_, err := assignPortsFromPool(pod, 4000, 4002)
+		assert.Error(t, err)
+	})
+
+	t.Run("pool not configured", func(t *testing.T) {
+		_, err := assignPortsFromPool(corev1.Pod{}, 0, 0)
+		assert.Error(t, err)
+	})
+
+	t.Run("ports wired consistently", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					daprEnabledKey:     "true",
+					daprUsePortPoolKey: "true",
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Name: "app", Ports: []corev1.ContainerPort{{ContainerPort: 5000}}},
+				},
+			},
+		}
+		i := &injector{config: Config{PortPoolStart: 5000, PortPoolEnd: 5100}}
+
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+
+		sidecar := patchOps[0].Value.(*corev1.Container)
+		assert.Equal(t, int32(5001), sidecar.Ports[0].ContainerPort)
+		assert.Equal(t, int32(5002), sidecar.Ports[1].ContainerPort)
+		assert.Equal(t, int32(5003), sidecar.Ports[2].ContainerPort)
+		assert.Contains(t, sidecar.Args, "5001")
+		assert.Contains(t, sidecar.Args, "5002")
+		assert.Contains(t, sidecar.Args, "5003")
+
+		env := patchOps[1].Value.([]corev1.EnvVar)
+		assert.Equal(t, corev1.EnvVar{Name: userContainerDaprHTTPPortName, Value: "5001"}, env[0])
+		assert.Equal(t, corev1.EnvVar{Name: userContainerDaprGRPCPortName, Value: "5002"}, env[1])
+	})
+
+	t.Run("explicit port conflicts with the pool", func(t *testing.T) {
+		annotations := map[string]string{
+			daprUsePortPoolKey: "true",
+			sidecarHTTPPortKey: "3600",
+		}
+		assert.Error(t, validateMutuallyExclusiveAnnotations(annotations))
+	})
+}
+
+func TestReadinessGate(t *testing.T) {
+	gate := corev1.PodReadinessGate{ConditionType: sidecarReadyConditionType}
+
+	t.Run("pod without readiness gates", func(t *testing.T) {
+		patchOps := getReadinessGatePatchOperations(nil, sidecarReadyConditionType)
+		assert.Equal(t, []PatchOperation{{Op: "add", Path: "/spec/readinessGates", Value: []corev1.PodReadinessGate{gate}}}, patchOps)
+	})
+
+	t.Run("pod with readiness gates", func(t *testing.T) {
+		patchOps := getReadinessGatePatchOperations([]corev1.PodReadinessGate{{ConditionType: "other"}}, sidecarReadyConditionType)
+		assert.Equal(t, []PatchOperation{{Op: "add", Path: "/spec/readinessGates/-", Value: gate}}, patchOps)
+	})
+
+	t.Run("pod already has the readiness gate", func(t *testing.T) {
+		patchOps := getReadinessGatePatchOperations([]corev1.PodReadinessGate{gate}, sidecarReadyConditionType)
+		assert.Len(t, patchOps, 0)
+	})
+
+	t.Run("readiness gate added when annotated", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					daprEnabledKey:              "true",
+					daprSidecarReadinessGateKey: "true",
+				},
+			},
+		}
+		i := &injector{}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.Contains(t, patchOps, PatchOperation{Op: "add", Path: "/spec/readinessGates", Value: []corev1.PodReadinessGate{gate}})
+	})
+}
+
+func TestAnnotationPrefix(t *testing.T) {
+	t.Run("default prefix leaves annotations untouched", func(t *testing.T) {
+		annotations := map[string]string{daprAppPortKey: "5000"}
+		assert.Equal(t, annotations, normalizeAnnotationPrefix(annotations, defaultAnnotationPrefix))
+		assert.Equal(t, annotations, normalizeAnnotationPrefix(annotations, ""))
+	})
+
+	t.Run("custom prefix is rewritten", func(t *testing.T) {
+		annotations := normalizeAnnotationPrefix(map[string]string{
+			"dapr.example.com/app-port":  "5000",
+			"dapr.example.com/log-level": "debug",
+			"dapr.io/app-port":           "6000",
+			"other":                      "value",
+		}, "dapr.example.com")
+
+		assert.Equal(t, map[string]string{
+			daprAppPortKey: "5000",
+			daprLogLevel:   "debug",
+			"other":        "value",
+		}, annotations)
+		assert.Equal(t, int32(5000), getInt32AnnotationOrDefault(annotations, daprAppPortKey, -1))
+		assert.Equal(t, "debug", getStringAnnotationOrDefault(annotations, daprLogLevel, defaultLogLevel))
+	})
+
+	t.Run("pod annotated with a custom prefix is injected", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					"dapr.example.com/enabled":  "true",
+					"dapr.example.com/app-id":   "app",
+					"dapr.example.com/app-port": "5000",
+				},
+			},
+		}
+		i := &injector{config: Config{AnnotationPrefix: "dapr.example.com"}}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.NotEmpty(t, patchOps)
+
+		sidecar := patchOps[0].Value.([]corev1.Container)[0]
+		assert.Contains(t, sidecar.Args, "--app-port")
+		assert.Contains(t, sidecar.Args, "5000")
+		assert.Contains(t, sidecar.Args, "app")
+	})
+
+	t.Run("errors name the custom prefix", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					"dapr.example.com/enabled":            "true",
+					"dapr.example.com/app-id":             "app",
+					"dapr.example.com/app-id-namespacing": "infix",
+				},
+			},
+		}
+		i := &injector{config: Config{AnnotationPrefix: "dapr.example.com"}}
+		_, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "dapr.example.com/app-id-namespacing")
+		}
+	})
+
+	t.Run("warnings and validation errors name the custom prefix", func(t *testing.T) {
+		getPod := func(annotations map[string]string) corev1.Pod {
+			pod := corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "pod",
+					Annotations: map[string]string{
+						"dapr.example.com/enabled": "true",
+						"dapr.example.com/app-id":  "app",
+					},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app"}},
+				},
+			}
+			for k, v := range annotations {
+				pod.Annotations[k] = v
+			}
+			return pod
+		}
+		i := &injector{config: Config{AnnotationPrefix: "dapr.example.com"}}
+
+		_, warnings, err := i.getPodPatchOperations(getTestAdmissionReview(t, getPod(map[string]string{"dapr.example.com/app-prot": "5000"})), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.Contains(t, warnings, "unknown annotation dapr.example.com/app-prot")
+
+		_, _, err = i.getPodPatchOperations(getTestAdmissionReview(t, getPod(map[string]string{
+			"dapr.example.com/sidecar-http-port": "3600",
+			"dapr.example.com/use-port-pool":     "true",
+		})), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "dapr.example.com/use-port-pool")
+			assert.NotContains(t, err.Error(), "dapr.io/")
+		}
+
+		_, _, err = i.getPodPatchOperations(getTestAdmissionReview(t, getPod(map[string]string{"dapr.example.com/sidecar-graceful-shutdown-seconds": "-1"})), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "invalid value for dapr.example.com/sidecar-graceful-shutdown-seconds")
+		}
+	})
+
+	t.Run("messages are rendered with the custom prefix", func(t *testing.T) {
+		assert.Equal(t, "unknown annotation dapr.io/app-prot", renderAnnotationPrefix("unknown annotation dapr.io/app-prot", defaultAnnotationPrefix))
+		assert.Equal(t, "dapr.example.com/a and dapr.example.com/b", renderAnnotationPrefix("dapr.io/a and dapr.io/b", "dapr.example.com"))
+		assert.Equal(t, "set example.dapr.io/app-id", renderAnnotationPrefix("set example.dapr.io/app-id", "example.dapr.io"))
+	})
+
+	t.Run("injector annotations are written with a custom prefix", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					"dapr.example.com/enabled":                "true",
+					"dapr.example.com/app-id":                 "app",
+					"dapr.example.com/debug-effective-config": "true",
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+		}
+		i := &injector{config: Config{AnnotationPrefix: "dapr.example.com", AnnotateResolvedPorts: true}}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd:1.0.0", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+
+		paths := []string{}
+		for _, p := range patchOps {
+			if strings.HasPrefix(p.Path, annotationsPath+"/") {
+				paths = append(paths, p.Path)
+			}
+		}
+		assert.Contains(t, paths, "/metadata/annotations/dapr.example.com~1sidecar-version")
+		assert.Contains(t, paths, "/metadata/annotations/dapr.example.com~1sidecar-http-port")
+		assert.Contains(t, paths, "/metadata/annotations/dapr.example.com~1effective-config")
+		for _, path := range paths {
+			assert.NotContains(t, path, "dapr.io")
+		}
+	})
+
+	t.Run("readiness gate is named with a custom prefix", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					"dapr.example.com/enabled":                "true",
+					"dapr.example.com/app-id":                 "app",
+					"dapr.example.com/sidecar-readiness-gate": "true",
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+		}
+		i := &injector{config: Config{AnnotationPrefix: "dapr.example.com"}}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+
+		var gates []corev1.PodReadinessGate
+		for _, p := range patchOps {
+			if p.Path == readinessGatesPath {
+				gates = p.Value.([]corev1.PodReadinessGate)
+			}
+		}
+		assert.Equal(t, []corev1.PodReadinessGate{{ConditionType: "dapr.example.com/sidecar-ready"}}, gates)
+	})
+
+	t.Run("dapr.io annotations are ignored with a custom prefix", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pod",
+				Annotations: map[string]string{daprEnabledKey: "true"},
+			},
+		}
+		i := &injector{config: Config{AnnotationPrefix: "dapr.example.com"}}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.Empty(t, patchOps)
+	})
+}
+
+func TestUnknownAnnotationWarnings(t *testing.T) {
+	t.Run("known annotations", func(t *testing.T) {
+		warnings := getUnknownAnnotationWarnings(map[string]string{
+			daprEnabledKey:     "true",
+			daprAppProtocolKey: "http",
+			"other.io/key":     "value",
+		})
+		assert.Empty(t, warnings)
+	})
+
+	t.Run("typo'd annotation", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					daprEnabledKey:      "true",
+					appIDKey:            "app",
+					"dapr.io/app-prot":  "grpc",
+					"dapr.io/log-leveL": "debug",
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+		}
+
+		i := &injector{}
+		_, warnings, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"unknown annotation dapr.io/app-prot", "unknown annotation dapr.io/log-leveL"}, warnings)
+	})
+}
+
+func TestHostNetworkPods(t *testing.T) {
+	getPod := func(annotations map[string]string) corev1.Pod {
+		annotations[daprEnabledKey] = "true"
+		annotations[appIDKey] = "app"
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pod",
+				Annotations: annotations,
+			},
+			Spec: corev1.PodSpec{
+				HostNetwork: true,
+				Containers:  []corev1.Container{{Name: "app"}},
+			},
+		}
+	}
+
+	t.Run("rejected without explicit ports", func(t *testing.T) {
+		i := &injector{}
+		_, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, getPod(map[string]string{})), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), sidecarHTTPPortKey)
+		assert.Contains(t, err.Error(), daprMetricsPortKey)
+	})
+
+	t.Run("rejected with some ports missing", func(t *testing.T) {
+		err := validateHostNetworkPorts(getPod(map[string]string{
+			sidecarHTTPPortKey:              "3600",
+			deprecatedSidecarAPIGRPCPortKey: "50011",
+			daprMetricsPortKey:              "9095",
+		}))
+		assert.EqualError(t, err, fmt.Sprintf("pods with hostNetwork enabled must set the sidecar ports explicitly to avoid collisions on the node, missing annotations: %s", sidecarInternalGRPCPortKey))
+	})
+
+	t.Run("injected with explicit ports", func(t *testing.T) {
+		i := &injector{}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, getPod(map[string]string{
+			sidecarHTTPPortKey:         "3600",
+			sidecarAPIGRPCPortKey:      "50011",
+			sidecarInternalGRPCPortKey: "50012",
+			daprMetricsPortKey:         "9095",
+		})), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.NotEmpty(t, patchOps)
+	})
+
+	t.Run("rejected with ports from the pool", func(t *testing.T) {
+		i := &injector{config: Config{PortPoolStart: 40000, PortPoolEnd: 40010}}
+		_, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, getPod(map[string]string{
+			daprUsePortPoolKey: "true",
+			daprMetricsPortKey: "9095",
+		})), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), daprUsePortPoolKey)
+	})
+
+	t.Run("rejected with explicit ports and the pool", func(t *testing.T) {
+		i := &injector{config: Config{PortPoolStart: 40000, PortPoolEnd: 40010}}
+		_, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, getPod(map[string]string{
+			daprUsePortPoolKey:         "true",
+			sidecarHTTPPortKey:         "3600",
+			sidecarAPIGRPCPortKey:      "50011",
+			sidecarInternalGRPCPortKey: "50012",
+			daprMetricsPortKey:         "9095",
+		})), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.Error(t, err)
+	})
+
+	t.Run("pod without host network", func(t *testing.T) {
+		pod := getPod(map[string]string{})
+		pod.Spec.HostNetwork = false
+		assert.NoError(t, validateHostNetworkPorts(pod))
+	})
+}
+
+func TestAddDaprEnvVarsToContainersOrder(t *testing.T) {
+	daprEnv := []corev1.EnvVar{
+		{Name: userContainerDaprHTTPPortName, Value: "3500"},
+		{Name: userContainerDaprGRPCPortName, Value: "50001"},
+	}
+	container := corev1.Container{
+		Name: "app",
+		Env: []corev1.EnvVar{
+			{Name: "APP_ENV", Value: "value"},
+			{Name: userContainerDaprGRPCPortName, Value: "50011"},
+		},
+	}
+
+	t.Run("append", func(t *testing.T) {
+		patchOps := addDaprEnvVarsToContainers([]corev1.Container{container}, daprEnv, false)
+		assert.Equal(t, []PatchOperation{
+			{Op: "add", Path: "/spec/containers/0/env/-", Value: daprEnv[0]},
+		}, patchOps)
+	})
+
+	t.Run("prepend", func(t *testing.T) {
+		patchOps := addDaprEnvVarsToContainers([]corev1.Container{container}, daprEnv, true)
+		assert.Equal(t, []PatchOperation{
+			{Op: "add", Path: "/spec/containers/0/env/0", Value: daprEnv[0]},
+		}, patchOps)
+	})
+
+	t.Run("prepend keeps the dapr env order", func(t *testing.T) {
+		c := corev1.Container{Name: "app", Env: []corev1.EnvVar{{Name: "APP_ENV", Value: "value"}}}
+		patchOps := addDaprEnvVarsToContainers([]corev1.Container{c}, daprEnv, true)
+		// applied in order, the ops result in DAPR_HTTP_PORT, DAPR_GRPC_PORT, APP_ENV
+		assert.Equal(t, []PatchOperation{
+			{Op: "add", Path: "/spec/containers/0/env/0", Value: daprEnv[1]},
+			{Op: "add", Path: "/spec/containers/0/env/0", Value: daprEnv[0]},
+		}, patchOps)
+	})
+
+	t.Run("prepend without existing env", func(t *testing.T) {
+		patchOps := addDaprEnvVarsToContainers([]corev1.Container{{Name: "app"}}, daprEnv, true)
+		assert.Equal(t, []PatchOperation{
+			{Op: "add", Path: "/spec/containers/0/env", Value: daprEnv},
+		}, patchOps)
+	})
+}
+
+func TestGracefulShutdownSecondsEnv(t *testing.T) {
+	getPod := func(annotations map[string]string) corev1.Pod {
+		annotations[daprEnabledKey] = "true"
+		annotations[appIDKey] = "app"
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pod",
+				Annotations: annotations,
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+		}
+	}
+	i := &injector{}
+
+	t.Run("env var set from the annotation", func(t *testing.T) {
+		pod := getPod(map[string]string{daprGracefulShutdownSecondsKey: "30"})
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+
+		envOp := patchOps[1]
+		assert.Equal(t, "/spec/containers/0/env", envOp.Path)
+		assert.Contains(t, envOp.Value, corev1.EnvVar{Name: "DAPR_GRACEFUL_SHUTDOWN_SECONDS", Value: "30"})
+
+		sidecar := patchOps[0].Value.(*corev1.Container)
+		assert.Contains(t, strings.Join(sidecar.Args, " "), "--dapr-graceful-shutdown-seconds 30")
+	})
+
+	t.Run("no env var without the annotation", func(t *testing.T) {
+		pod := getPod(map[string]string{})
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+
+		for _, env := range patchOps[1].Value.([]corev1.EnvVar) {
+			assert.NotEqual(t, "DAPR_GRACEFUL_SHUTDOWN_SECONDS", env.Name)
+		}
+		sidecar := patchOps[0].Value.(*corev1.Container)
+		assert.NotContains(t, sidecar.Args, "--dapr-graceful-shutdown-seconds")
+	})
+
+	t.Run("invalid annotation", func(t *testing.T) {
+		pod := getPod(map[string]string{daprGracefulShutdownSecondsKey: "-5"})
+		_, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.Error(t, err)
+	})
+}
+
+func TestValidateLimitRanges(t *testing.T) {
+	limitRange := &corev1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "limits",
+			Namespace: "ns",
+		},
+		Spec: corev1.LimitRangeSpec{
+			Limits: []corev1.LimitRangeItem{
+				{
+					Type: corev1.LimitTypePod,
+					Max:  corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10m")},
+				},
+				{
+					Type: corev1.LimitTypeContainer,
+					Max: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("500m"),
+						corev1.ResourceMemory: resource.MustParse("512Mi"),
+					},
+					Min: corev1.ResourceList{
+						corev1.ResourceMemory: resource.MustParse("32Mi"),
+					},
+				},
+			},
+		},
+	}
+	kubeClient := fake.NewSimpleClientset(limitRange)
+
+	t.Run("resources within the limit range", func(t *testing.T) {
+		err := validateLimitRanges(corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+			Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("300m")},
+		}, "ns", kubeClient)
+		assert.NoError(t, err)
+	})
+
+	t.Run("limit above the maximum", func(t *testing.T) {
+		err := validateLimitRanges(corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+		}, "ns", kubeClient)
+		assert.EqualError(t, err, "sidecar cpu limit 1 exceeds the maximum 500m allowed by LimitRange limits")
+	})
+
+	t.Run("request below the minimum", func(t *testing.T) {
+		err := validateLimitRanges(corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("16Mi")},
+		}, "ns", kubeClient)
+		assert.EqualError(t, err, "sidecar memory request 16Mi is below the minimum 32Mi allowed by LimitRange limits")
+	})
+
+	t.Run("namespace without limit ranges", func(t *testing.T) {
+		err := validateLimitRanges(corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4")},
+		}, "other", kubeClient)
+		assert.NoError(t, err)
+	})
+
+	t.Run("admission error when enabled", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					daprEnabledKey:  "true",
+					appIDKey:        "app",
+					daprCPULimitKey: "1",
+				},
+			},
+		}
+
+		i := &injector{config: Config{ValidateLimitRanges: true}}
+		_, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", kubeClient, getTestDaprClient(false))
+		assert.Error(t, err)
+
+		i = &injector{}
+		_, _, err = i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", kubeClient, getTestDaprClient(false))
+		assert.NoError(t, err)
+	})
+}
+
+func TestMemoryLimitFromPercent(t *testing.T) {
+	containers := []corev1.Container{
+		{
+			Name: "app",
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("768Mi")},
+			},
+		},
+		{
+			Name: "helper",
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+			},
+		},
+	}
+
+	t.Run("percentage of the summed limits", func(t *testing.T) {
+		limit, err := getMemoryLimitFromPercent(map[string]string{daprMemoryLimitPercentKey: "10"}, containers)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1024*1024*1024/10), limit.Value())
+	})
+
+	t.Run("container without a memory limit", func(t *testing.T) {
+		_, err := getMemoryLimitFromPercent(map[string]string{daprMemoryLimitPercentKey: "10"}, append(containers, corev1.Container{Name: "nolimit"}))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "nolimit")
+	})
+
+	t.Run("invalid percentage", func(t *testing.T) {
+		for _, val := range []string{"0", "101", "-1", "ten"} {
+			_, err := getMemoryLimitFromPercent(map[string]string{daprMemoryLimitPercentKey: val}, containers)
+			assert.Error(t, err, val)
+		}
+	})
+
+	t.Run("sidecar limit set from the annotation", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					daprEnabledKey:            "true",
+					appIDKey:                  "app",
+					daprMemoryLimitPercentKey: "25",
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: containers,
+			},
+		}
+
+		i := &injector{}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		sidecar := patchOps[0].Value.(*corev1.Container)
+		assert.Equal(t, "256Mi", sidecar.Resources.Limits.Memory().String())
+	})
+}
+
+func TestCABundleConfigMap(t *testing.T) {
+	t.Run("volume and mount", func(t *testing.T) {
+		annotations := map[string]string{daprCABundleConfigMapKey: "private-ca"}
+
+		volumes := getSidecarVolumes(annotations)
+		assert.Equal(t, []corev1.Volume{
+			{
+				Name: caBundleVolumeName,
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "private-ca"},
+					},
+				},
+			},
+		}, volumes)
+
+		container, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, []corev1.VolumeMount{
+			{Name: caBundleVolumeName, MountPath: "/etc/ssl/certs", ReadOnly: true},
+		}, container.VolumeMounts)
+	})
+
+	t.Run("custom mount path", func(t *testing.T) {
+		annotations := map[string]string{
+			daprCABundleConfigMapKey: "private-ca",
+			daprCABundleMountPathKey: "/etc/dapr/ca",
+		}
+
+		container, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, []corev1.VolumeMount{
+			{Name: caBundleVolumeName, MountPath: "/etc/dapr/ca", ReadOnly: true},
+		}, container.VolumeMounts)
+	})
+
+	t.Run("ssl env vars match the mount path", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{daprCABundleConfigMapKey: "private-ca"}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Contains(t, container.Env, corev1.EnvVar{Name: "SSL_CERT_FILE", Value: "/etc/ssl/certs/ca.crt"})
+		assert.Contains(t, container.Env, corev1.EnvVar{Name: "SSL_CERT_DIR", Value: "/etc/ssl/certs"})
+
+		container, err = getSidecarContainer(map[string]string{
+			daprCABundleConfigMapKey: "private-ca",
+			daprCABundleMountPathKey: "/etc/dapr/ca",
+			daprCABundleKeyKey:       "bundle.pem",
+		}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Contains(t, container.Env, corev1.EnvVar{Name: "SSL_CERT_FILE", Value: "/etc/dapr/ca/bundle.pem"})
+		assert.Contains(t, container.Env, corev1.EnvVar{Name: "SSL_CERT_DIR", Value: "/etc/dapr/ca"})
+	})
+
+	t.Run("relative mount path", func(t *testing.T) {
+		annotations := map[string]string{
+			daprCABundleConfigMapKey: "private-ca",
+			daprCABundleMountPathKey: "certs",
+		}
+
+		_, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("no volume without the annotation", func(t *testing.T) {
+		assert.Empty(t, getSidecarVolumes(map[string]string{}))
+
+		container, err := getSidecarContainer(map[string]string{}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Empty(t, container.VolumeMounts)
+		for _, env := range container.Env {
+			assert.NotEqual(t, "SSL_CERT_FILE", env.Name)
+			assert.NotEqual(t, "SSL_CERT_DIR", env.Name)
+		}
+	})
+}
+
+func TestAppHealthCheckPathDefaults(t *testing.T) {
+	getPod := func(annotations map[string]string) corev1.Pod {
+		annotations[daprEnabledKey] = "true"
+		annotations[appIDKey] = "app"
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pod",
+				Annotations: annotations,
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+		}
+	}
+	getArgs := func(t *testing.T, i *injector, pod corev1.Pod) string {
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		return strings.Join(patchOps[0].Value.(*corev1.Container).Args, " ")
+	}
+	i := &injector{config: Config{AppHealthCheckPathDefaults: map[string]string{"ns": "/healthz"}}}
+
+	t.Run("namespace default applied", func(t *testing.T) {
+		assert.Contains(t, getArgs(t, i, getPod(map[string]string{})), "--app-health-check-path /healthz")
+	})
+
+	t.Run("pod override", func(t *testing.T) {
+		args := getArgs(t, i, getPod(map[string]string{daprAppHealthCheckPathKey: "/ready"}))
+		assert.Contains(t, args, "--app-health-check-path /ready")
+		assert.NotContains(t, args, "/healthz")
+	})
+
+	t.Run("no default for the namespace", func(t *testing.T) {
+		i := &injector{config: Config{AppHealthCheckPathDefaults: map[string]string{"other": "/healthz"}}}
+		assert.NotContains(t, getArgs(t, i, getPod(map[string]string{})), "--app-health-check-path")
+	})
+}
+
+func TestLenientInjection(t *testing.T) {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "pod",
+			Annotations: map[string]string{
+				daprEnabledKey:      "true",
+				appIDKey:            "app",
+				daprOtelEndpointKey: "http://otel:4317",
+				daprOtelProtocolKey: "smoke-signals",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}},
+		},
+	}
+
+	t.Run("strict mode rejects the pod", func(t *testing.T) {
+		i := &injector{}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.Error(t, err)
+		assert.Empty(t, patchOps)
+	})
+
+	t.Run("lenient mode drops the bad annotation", func(t *testing.T) {
+		i := &injector{config: Config{LenientInjection: true}}
+		patchOps, warnings, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.NotEmpty(t, patchOps)
+		assert.Len(t, warnings, 1)
+		assert.Contains(t, warnings[0], daprOtelProtocolKey)
+
+		sidecar := patchOps[0].Value.(*corev1.Container)
+		assert.Contains(t, sidecar.Env, corev1.EnvVar{Name: otelExporterEndpointEnvVar, Value: "http://otel:4317"})
+		for _, env := range sidecar.Env {
+			assert.NotEqual(t, otelExporterProtocolEnvVar, env.Name)
+		}
+	})
+
+	t.Run("valid annotations are kept", func(t *testing.T) {
+		annotations := map[string]string{daprOtelProtocolKey: "grpc"}
+		valid, warnings := dropInvalidOptionalAnnotations(annotations)
+		assert.Equal(t, annotations, valid)
+		assert.Empty(t, warnings)
+	})
+}
+
+func TestMaxRequestBodySizeInjection(t *testing.T) {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "pod",
+			Annotations: map[string]string{
+				daprEnabledKey:         "true",
+				appIDKey:               "app",
+				daprMaxRequestBodySize: "4Pi",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}},
+		},
+	}
+
+	t.Run("oversized value rejects the pod", func(t *testing.T) {
+		i := &injector{}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.Error(t, err)
+		assert.Empty(t, patchOps)
+	})
+
+	t.Run("lenient mode drops the oversized value", func(t *testing.T) {
+		i := &injector{config: Config{LenientInjection: true}}
+		patchOps, warnings, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		args := strings.Join(patchOps[0].Value.(*corev1.Container).Args, " ")
+		assert.Contains(t, args, "--dapr-http-max-request-size -1")
+		assert.Contains(t, strings.Join(warnings, "\n"), daprMaxRequestBodySize)
+	})
+}
+
+func TestLogLevelMinimumInjection(t *testing.T) {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "pod",
+			Annotations: map[string]string{
+				daprEnabledKey: "true",
+				appIDKey:       "app",
+				daprConfigKey:  "config1",
+				daprLogLevel:   "debug",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}},
+		},
+	}
+
+	t.Run("strict mode rejects the pod", func(t *testing.T) {
+		i := &injector{}
+		_, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestLogLevelDaprClient())
+		assert.Error(t, err)
+	})
+
+	t.Run("lenient mode admits the pod with a warning", func(t *testing.T) {
+		i := &injector{config: Config{LenientInjection: true}}
+		patchOps, warnings, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestLogLevelDaprClient())
+		assert.NoError(t, err)
+		assert.NotEmpty(t, patchOps)
+		assert.Contains(t, strings.Join(warnings, "\n"), "log level debug is more verbose")
+	})
+}
+
+func TestLivenessFailureThresholdScaling(t *testing.T) {
+	probe := ProbeOptions{
+		InitialDelaySeconds: 3,
+		PeriodSeconds:       6,
+		FailureThreshold:    3,
+	}
+
+	testCases := []struct {
+		name      string
+		startup   string
+		threshold int32
+	}{
+		{"startup covered by the initial delay", "3", 3},
+		{"startup spanning one period", "9", 4},
+		{"startup spanning partial periods", "40", 10},
+		{"startup spanning whole periods", "63", 13},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			threshold, err := getLivenessFailureThreshold(map[string]string{daprLivenessStartupSecondsKey: tc.startup}, probe)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.threshold, threshold)
+		})
+	}
+
+	t.Run("no scaling without the annotation", func(t *testing.T) {
+		threshold, err := getLivenessFailureThreshold(map[string]string{}, probe)
+		assert.NoError(t, err)
+		assert.Equal(t, int32(3), threshold)
+	})
+
+	t.Run("invalid annotation", func(t *testing.T) {
+		_, err := getLivenessFailureThreshold(map[string]string{daprLivenessStartupSecondsKey: "-1"}, probe)
+		assert.Error(t, err)
+	})
+
+	t.Run("sidecar liveness probe", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{
+			daprLivenessStartupSecondsKey: "60",
+			daprLivenessProbePeriodKey:    "10",
+		}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		// (60 - 3) / 10 rounded up is 6 extra periods on top of the default threshold of 3
+		assert.Equal(t, int32(9), container.LivenessProbe.FailureThreshold)
+		assert.Equal(t, int32(defaultHealthzProbeThreshold), container.ReadinessProbe.FailureThreshold)
+	})
+}
+
+func TestNegativeProbeTiming(t *testing.T) {
+	t.Run("negative delay is rejected", func(t *testing.T) {
+		_, err := getSidecarContainer(map[string]string{
+			daprLivenessProbeDelayKey: "-5",
+		}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.EqualError(t, err, "invalid value for dapr.io/sidecar-liveness-probe-delay-seconds: -5, must not be negative")
+	})
+
+	t.Run("negative startup threshold is rejected", func(t *testing.T) {
+		_, err := getSidecarContainer(map[string]string{
+			daprStartupProbeThresholdKey: "-1",
+		}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("zero delay is accepted", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{
+			daprReadinessProbeDelayKey: "0",
+		}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, int32(0), container.ReadinessProbe.InitialDelaySeconds)
+	})
+
+	t.Run("negative delay is dropped with lenient injection", func(t *testing.T) {
+		annotations := map[string]string{daprReadinessProbeDelayKey: "-1"}
+		valid, warnings := dropInvalidOptionalAnnotations(annotations)
+		assert.Empty(t, valid)
+		assert.Len(t, warnings, 1)
+	})
+}
+
+func TestSidecarImagePullPolicy(t *testing.T) {
+	getPolicyWithAppPolicy := func(t *testing.T, i *injector, annotations map[string]string, appPolicy corev1.PullPolicy) corev1.PullPolicy {
+		annotations[daprEnabledKey] = "true"
+		annotations[appIDKey] = "app"
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pod",
+				Annotations: annotations,
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app", ImagePullPolicy: appPolicy}},
+			},
+		}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		return patchOps[0].Value.(*corev1.Container).ImagePullPolicy
+	}
+	getPolicy := func(t *testing.T, i *injector, annotations map[string]string) corev1.PullPolicy {
+		return getPolicyWithAppPolicy(t, i, annotations, "")
+	}
+
+	t.Run("injector default", func(t *testing.T) {
+		assert.Equal(t, corev1.PullAlways, getPolicy(t, &injector{}, map[string]string{}))
+	})
+
+	t.Run("dev mode defaults to never", func(t *testing.T) {
+		assert.Equal(t, corev1.PullNever, getPolicy(t, &injector{config: Config{DevMode: true}}, map[string]string{}))
+	})
+
+	t.Run("annotation overrides dev mode", func(t *testing.T) {
+		i := &injector{config: Config{DevMode: true}}
+		assert.Equal(t, corev1.PullIfNotPresent, getPolicy(t, i, map[string]string{daprSidecarImagePullPolicyKey: "IfNotPresent"}))
+	})
+
+	t.Run("annotation overrides the injector default", func(t *testing.T) {
+		assert.Equal(t, corev1.PullNever, getPolicy(t, &injector{}, map[string]string{daprSidecarImagePullPolicyKey: "Never"}))
+	})
+
+	t.Run("unrecognized value defaults to if not present", func(t *testing.T) {
+		assert.Equal(t, corev1.PullIfNotPresent, getPolicy(t, &injector{}, map[string]string{daprSidecarImagePullPolicyKey: "Sometimes"}))
+	})
+
+	t.Run("unrecognized value rejected in strict mode", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					daprEnabledKey:                "true",
+					appIDKey:                      "app",
+					daprSidecarImagePullPolicyKey: "Sometimes",
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+		}
+		i := &injector{config: Config{StrictImagePullPolicy: true}}
+		_, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.EqualError(t, err, fmt.Sprintf("invalid value for %s: Sometimes", daprSidecarImagePullPolicyKey))
+	})
+
+	t.Run("recognized value accepted in strict mode", func(t *testing.T) {
+		i := &injector{config: Config{StrictImagePullPolicy: true}}
+		assert.Equal(t, corev1.PullNever, getPolicy(t, i, map[string]string{daprSidecarImagePullPolicyKey: "Never"}))
+	})
+
+	t.Run("inherited from the app container", func(t *testing.T) {
+		annotations := map[string]string{daprInheritImagePullPolicyKey: "true"}
+		assert.Equal(t, corev1.PullIfNotPresent, getPolicyWithAppPolicy(t, &injector{}, annotations, corev1.PullIfNotPresent))
+	})
+
+	t.Run("inheritance overrides dev mode", func(t *testing.T) {
+		annotations := map[string]string{daprInheritImagePullPolicyKey: "true"}
+		assert.Equal(t, corev1.PullAlways, getPolicyWithAppPolicy(t, &injector{config: Config{DevMode: true}}, annotations, corev1.PullAlways))
+	})
+
+	t.Run("annotation overrides inheritance", func(t *testing.T) {
+		annotations := map[string]string{
+			daprInheritImagePullPolicyKey: "true",
+			daprSidecarImagePullPolicyKey: "Never",
+		}
+		assert.Equal(t, corev1.PullNever, getPolicyWithAppPolicy(t, &injector{}, annotations, corev1.PullIfNotPresent))
+	})
+
+	t.Run("not inherited without the annotation", func(t *testing.T) {
+		assert.Equal(t, corev1.PullAlways, getPolicyWithAppPolicy(t, &injector{}, map[string]string{}, corev1.PullIfNotPresent))
+	})
+
+	t.Run("injector default when the app container has no policy", func(t *testing.T) {
+		annotations := map[string]string{daprInheritImagePullPolicyKey: "true"}
+		assert.Equal(t, corev1.PullAlways, getPolicy(t, &injector{}, annotations))
+	})
+}
+
+func TestSidecarExtraArgs(t *testing.T) {
+	t.Run("override an injector flag", func(t *testing.T) {
+		merged := mergeArgs(
+			[]string{"--mode", "kubernetes", "--log-level", "info", "--app-max-concurrency", "-1", "--log-as-json"},
+			[]string{"--log-level", "debug"},
+		)
+		assert.Equal(t, []string{"--mode", "kubernetes", "--log-level", "debug", "--app-max-concurrency", "-1", "--log-as-json"}, merged)
+	})
+
+	t.Run("override with the = form", func(t *testing.T) {
+		merged := mergeArgs(
+			[]string{"--mode", "kubernetes", "--log-level", "info"},
+			[]string{"--log-level=warn"},
+		)
+		assert.Equal(t, []string{"--mode", "kubernetes", "--log-level=warn"}, merged)
+	})
+
+	t.Run("new flags are appended", func(t *testing.T) {
+		merged := mergeArgs(
+			[]string{"--mode", "kubernetes", "--app-port", ""},
+			[]string{"--enable-api-logging", "--allowed-origins", "https://example.com"},
+		)
+		assert.Equal(t, []string{"--mode", "kubernetes", "--app-port", "", "--enable-api-logging", "--allowed-origins", "https://example.com"}, merged)
+	})
+
+	t.Run("boolean flag overridden with a value", func(t *testing.T) {
+		merged := mergeArgs(
+			[]string{"--log-as-json", "--mode", "kubernetes"},
+			[]string{"--log-as-json=false"},
+		)
+		assert.Equal(t, []string{"--log-as-json=false", "--mode", "kubernetes"}, merged)
+	})
+
+	t.Run("sidecar container", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{
+			daprAppMaxConcurrencyKey: "5",
+			daprSidecarExtraArgsKey:  "--app-max-concurrency 10  --enable-api-logging",
+		}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+
+		args := strings.Join(container.Args, " ")
+		assert.Contains(t, args, "--app-max-concurrency 10")
+		assert.NotContains(t, args, "--app-max-concurrency 5")
+		assert.Equal(t, 1, strings.Count(args, "--app-max-concurrency"))
+		assert.Equal(t, "--enable-api-logging", container.Args[len(container.Args)-1])
+	})
+
+	t.Run("log level override", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{
+			daprLogLevel:            "info",
+			daprSidecarExtraArgsKey: "--log-level debug",
+		}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Contains(t, strings.Join(container.Args, " "), "--log-level debug")
+		assert.Equal(t, 1, strings.Count(strings.Join(container.Args, " "), "--log-level"))
+	})
+
+	t.Run("protected flags can't be overridden", func(t *testing.T) {
+		for _, extraArgs := range []string{
+			"--app-id other",
+			"--sentry-address sentry.other:443",
+			"--control-plane-address operator.other:443",
+			"--placement-host-address placement.other:50005",
+			"--mode standalone",
+			"--enable-mtls",
+			"--enable-api-logging --trust-anchors-file /tmp/ca.crt",
+			"--dapr-http-port 3600",
+			"--dapr-grpc-port=50010",
+			"--dapr-internal-grpc-port 50011",
+			"--metrics-port 9091",
+			"--app-port 8080",
+		} {
+			_, err := getSidecarContainer(map[string]string{
+				daprLogLevel:            "info",
+				daprSidecarExtraArgsKey: extraArgs,
+			}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+			assert.Error(t, err, extraArgs)
+		}
+	})
+}
+
+func TestEffectiveConfigAnnotation(t *testing.T) {
+	getPod := func(annotations map[string]string) corev1.Pod {
+		annotations[daprEnabledKey] = "true"
+		annotations[appIDKey] = "app"
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pod",
+				Annotations: annotations,
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+		}
+	}
+	i := &injector{}
+
+	t.Run("annotation content and redaction", func(t *testing.T) {
+		pod := getPod(map[string]string{
+			daprDebugEffectiveConfigKey: "true",
+			daprAppPortKey:              "5000",
+			daprAPITokenSecret:          "api-token",
+			daprAppTokenSecret:          "app-token",
+			daprSidecarBaseContainerKey: `{"env": [{"name": "PASSWORD", "value": "hunter2"}]}`,
+		})
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+
+		var effectiveConfig string
+		for _, op := range patchOps {
+			if op.Path == "/metadata/annotations/dapr.io~1effective-config" {
+				effectiveConfig = op.Value.(string)
+			}
+		}
+		assert.NotEmpty(t, effectiveConfig)
+		assert.NotContains(t, effectiveConfig, "api-token")
+		assert.NotContains(t, effectiveConfig, "app-token")
+		assert.NotContains(t, effectiveConfig, "hunter2")
+
+		var opts SidecarOptions
+		assert.NoError(t, json.Unmarshal([]byte(effectiveConfig), &opts))
+		assert.Equal(t, int32(5000), opts.AppPort)
+		assert.Equal(t, "<redacted>", opts.APITokenSecret)
+		assert.Equal(t, "<redacted>", opts.AppTokenSecret)
+		assert.Equal(t, "<redacted>", opts.BaseContainer.Env[0].Value)
+	})
+
+	t.Run("values resolved by the injector", func(t *testing.T) {
+		pod := getPod(map[string]string{
+			daprDebugEffectiveConfigKey: "true",
+			daprMemoryLimitPercentKey:   "50",
+		})
+		pod.Spec.Containers[0].Resources.Limits = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")}
+		i := &injector{defaultRequests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")}}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd:1.0.0", "IfNotPresent", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+
+		var opts SidecarOptions
+		var sidecar *corev1.Container
+		for _, op := range patchOps {
+			if op.Path == "/metadata/annotations/dapr.io~1effective-config" {
+				assert.NoError(t, json.Unmarshal([]byte(op.Value.(string)), &opts))
+			}
+			if c, ok := op.Value.(*corev1.Container); ok && c.Name == sidecarContainerName {
+				sidecar = c
+			}
+		}
+		assert.NotNil(t, sidecar)
+		assert.Equal(t, sidecar.Image, opts.Image)
+		assert.Equal(t, sidecar.ImagePullPolicy, opts.ImagePullPolicy)
+		assert.Equal(t, sidecar.Resources.Limits.Memory().Value(), opts.Resources.Limits.Memory().Value())
+		assert.Equal(t, int64(512*1024*1024), opts.Resources.Limits.Memory().Value())
+		assert.Equal(t, "100m", opts.Resources.Requests.Cpu().String())
+	})
+
+	t.Run("no annotation without the debug annotation", func(t *testing.T) {
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, getPod(map[string]string{})), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		for _, op := range patchOps {
+			assert.NotContains(t, op.Path, "effective-config")
+		}
+	})
+}
+
+func TestProxiedProbes(t *testing.T) {
+	t.Run("probes target the proxy", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{
+			daprHealthzPathPrefixKey: "/dapr",
+			daprProbePortKey:         "8080",
+		}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+
+		for _, probe := range []*corev1.Probe{container.LivenessProbe, container.ReadinessProbe} {
+			assert.Equal(t, "/dapr/v1.0/healthz", probe.HTTPGet.Path)
+			assert.Equal(t, intstr.FromInt(8080), probe.HTTPGet.Port)
+		}
+	})
+
+	t.Run("prefix combined with the app id", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{
+			daprHealthzPathPrefixKey:   "dapr/",
+			daprHealthzIncludeAppIDKey: "true",
+		}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, "/dapr/app/v1.0/healthz", container.LivenessProbe.HTTPGet.Path)
+		assert.Equal(t, intstr.FromInt(defaultSidecarHTTPPort), container.LivenessProbe.HTTPGet.Port)
+	})
+
+	t.Run("defaults to the sidecar http port", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{
+			sidecarHTTPPortKey: "3600",
+		}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, "/v1.0/healthz", container.ReadinessProbe.HTTPGet.Path)
+		assert.Equal(t, intstr.FromInt(3600), container.ReadinessProbe.HTTPGet.Port)
+	})
+
+	t.Run("invalid probe port", func(t *testing.T) {
+		_, err := getSidecarContainer(map[string]string{
+			daprProbePortKey: "70000",
+		}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Error(t, err)
+	})
+}
+
+func TestSidecarNoLimits(t *testing.T) {
+	t.Run("limits are omitted", func(t *testing.T) {
+		r, err := getResourceRequirements(map[string]string{
+			daprSidecarNoLimitsKey: "true",
+			daprCPULimitKey:        "1",
+			daprMemoryLimitKey:     "256Mi",
+			daprCPURequestKey:      "100m",
+			daprMemoryRequestKey:   "64Mi",
+		})
+		assert.NoError(t, err)
+		assert.Nil(t, r.Limits)
+		assert.Equal(t, "100m", r.Requests.Cpu().String())
+		assert.Equal(t, "64Mi", r.Requests.Memory().String())
+	})
+
+	t.Run("no requirements with limits only", func(t *testing.T) {
+		r, err := getResourceRequirements(map[string]string{
+			daprSidecarNoLimitsKey: "true",
+			daprCPULimitKey:        "1",
+		})
+		assert.NoError(t, err)
+		assert.Nil(t, r)
+	})
+
+	t.Run("limits kept without the annotation", func(t *testing.T) {
+		r, err := getResourceRequirements(map[string]string{daprCPULimitKey: "1"})
+		assert.NoError(t, err)
+		assert.Equal(t, "1", r.Limits.Cpu().String())
+	})
+
+	t.Run("admission warnings and percent limit skipped", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					daprEnabledKey:            "true",
+					appIDKey:                  "app",
+					daprSidecarNoLimitsKey:    "true",
+					daprCPULimitKey:           "1",
+					daprMemoryLimitPercentKey: "10",
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+		}
+
+		i := &injector{}
+		patchOps, warnings, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			fmt.Sprintf("annotation %s is ignored because %s is set", daprCPULimitKey, daprSidecarNoLimitsKey),
+			fmt.Sprintf("annotation %s is ignored because %s is set", daprMemoryLimitPercentKey, daprSidecarNoLimitsKey),
+		}, warnings)
+		assert.Nil(t, patchOps[0].Value.(*corev1.Container).Resources.Limits)
+	})
+}
+
+func TestMalformedResourceAnnotations(t *testing.T) {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "pod",
+			Annotations: map[string]string{
+				daprEnabledKey:       "true",
+				appIDKey:             "app",
+				daprCPULimitKey:      "100mm",
+				daprMemoryRequestKey: "64Mi",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}},
+		},
+	}
+
+	t.Run("pod is rejected", func(t *testing.T) {
+		i := &injector{}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid value for dapr.io/sidecar-cpu-limit: 100mm")
+		assert.Empty(t, patchOps)
+	})
+
+	t.Run("sidecar container isn't built", func(t *testing.T) {
+		_, err := getSidecarContainer(pod.Annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("lenient mode drops the bad annotation", func(t *testing.T) {
+		i := &injector{config: Config{LenientInjection: true}}
+		patchOps, warnings, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.Len(t, warnings, 1)
+		assert.Contains(t, warnings[0], daprCPULimitKey)
+
+		sidecar := patchOps[0].Value.(*corev1.Container)
+		assert.Empty(t, sidecar.Resources.Limits)
+		assert.Equal(t, "64Mi", sidecar.Resources.Requests.Memory().String())
+	})
+}
+
+func TestServiceAccountValidation(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(&corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-sa",
+			Namespace: "ns",
+		},
+	})
+
+	t.Run("service account exists", func(t *testing.T) {
+		assert.Empty(t, getMissingServiceAccountWarnings("app-sa", "ns", kubeClient))
+	})
+
+	t.Run("service account missing", func(t *testing.T) {
+		warnings := getMissingServiceAccountWarnings("missing-sa", "ns", kubeClient)
+		assert.Len(t, warnings, 1)
+		assert.Contains(t, warnings[0], "service account missing-sa")
+	})
+
+	t.Run("default service account", func(t *testing.T) {
+		warnings := getMissingServiceAccountWarnings("", "ns", kubeClient)
+		assert.Len(t, warnings, 1)
+		assert.Contains(t, warnings[0], "service account default")
+	})
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "pod",
+			Annotations: map[string]string{
+				daprEnabledKey: "true",
+				appIDKey:       "app",
+			},
+		},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: "missing-sa",
+			Containers:         []corev1.Container{{Name: "app"}},
+		},
+	}
+
+	t.Run("admission warning with mTLS enabled", func(t *testing.T) {
+		i := &injector{config: Config{ValidateServiceAccounts: true}}
+		_, warnings, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", kubeClient, getTestDaprClient(true))
+		assert.NoError(t, err)
+		assert.Len(t, warnings, 1)
+		assert.Contains(t, warnings[0], "service account missing-sa")
+	})
+
+	t.Run("no admission warning with mTLS disabled", func(t *testing.T) {
+		i := &injector{config: Config{ValidateServiceAccounts: true}}
+		_, warnings, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", kubeClient, getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.Empty(t, warnings)
+	})
+
+	t.Run("no admission warning without validation", func(t *testing.T) {
+		i := &injector{}
+		_, warnings, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", kubeClient, getTestDaprClient(true))
+		assert.NoError(t, err)
+		assert.Empty(t, warnings)
+	})
+}
+
+func TestResolvedPortAnnotations(t *testing.T) {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "pod",
+			Annotations: map[string]string{
+				daprEnabledKey:                  "true",
+				appIDKey:                        "app",
+				sidecarHTTPPortKey:              "3600",
+				deprecatedSidecarAPIGRPCPortKey: "50011",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}},
+		},
+	}
+
+	t.Run("resolved ports are annotated", func(t *testing.T) {
+		i := &injector{config: Config{AnnotateResolvedPorts: true}}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+
+		assert.Contains(t, patchOps, PatchOperation{Op: "add", Path: "/metadata/annotations/dapr.io~1sidecar-http-port", Value: "3600"})
+		assert.Contains(t, patchOps, PatchOperation{Op: "add", Path: "/metadata/annotations/dapr.io~1sidecar-grpc-port", Value: "50011"})
+		assert.Contains(t, patchOps, PatchOperation{Op: "add", Path: "/metadata/annotations/dapr.io~1sidecar-internal-grpc-port", Value: "50002"})
+		assert.Contains(t, patchOps, PatchOperation{Op: "add", Path: "/metadata/annotations/dapr.io~1metrics-port", Value: "9090"})
+	})
+
+	t.Run("no annotations when disabled", func(t *testing.T) {
+		i := &injector{}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		for _, op := range patchOps {
+			if strings.HasPrefix(op.Path, "/metadata/annotations") {
+				assert.NotContains(t, op.Path, "port")
+			}
+		}
+	})
+}
+
+func TestAppPreStopSleep(t *testing.T) {
+	preStop := &corev1.Handler{
+		Exec: &corev1.ExecAction{
+			Command: []string{"sh", "-c", "sleep 5"},
+		},
+	}
+
+	t.Run("hook added to the app containers", func(t *testing.T) {
+		containers := []corev1.Container{
+			{Name: "app"},
+			{Name: "lifecycle", Lifecycle: &corev1.Lifecycle{PostStart: &corev1.Handler{}}},
+			{Name: "prestop", Lifecycle: &corev1.Lifecycle{PreStop: &corev1.Handler{}}},
+		}
+		patchOps := getAppPreStopPatchOperations(containers, 5)
+		assert.Equal(t, []PatchOperation{
+			{Op: "add", Path: "/spec/containers/0/lifecycle", Value: &corev1.Lifecycle{PreStop: preStop}},
+			{Op: "add", Path: "/spec/containers/1/lifecycle/preStop", Value: preStop},
+		}, patchOps)
+	})
+
+	t.Run("pod annotated with a preStop sleep", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					daprEnabledKey:                "true",
+					appIDKey:                      "app",
+					daprAppPreStopSleepSecondsKey: "5",
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+		}
+
+		i := &injector{}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.Contains(t, patchOps, PatchOperation{Op: "add", Path: "/spec/containers/0/lifecycle", Value: &corev1.Lifecycle{PreStop: preStop}})
+
+		// the sidecar is untouched
+		assert.Nil(t, patchOps[0].Value.(*corev1.Container).Lifecycle)
+	})
+
+	t.Run("invalid annotation", func(t *testing.T) {
+		_, err := getAppPreStopSleepSeconds(map[string]string{daprAppPreStopSleepSecondsKey: "-1"})
+		assert.Error(t, err)
+	})
+}
+
+func TestAutoGoMemLimit(t *testing.T) {
+	t.Run("computed from the memory limit", func(t *testing.T) {
+		value, ok := getGoMemLimit(corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("100Mi")},
+		}, 80)
+		assert.True(t, ok)
+		assert.Equal(t, "83886080", value)
+	})
+
+	t.Run("default percentage", func(t *testing.T) {
+		value, ok := getGoMemLimit(corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("100Mi")},
+		}, 0)
+		assert.True(t, ok)
+		assert.Equal(t, "94371840", value)
+	})
+
+	t.Run("no memory limit", func(t *testing.T) {
+		_, ok := getGoMemLimit(corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+		}, 80)
+		assert.False(t, ok)
+	})
+
+	getGoMemLimitEnv := func(t *testing.T, annotations map[string]string, containers []corev1.Container) (string, bool) {
+		annotations[daprEnabledKey] = "true"
+		annotations[appIDKey] = "app"
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", Annotations: annotations},
+			Spec:       corev1.PodSpec{Containers: containers},
+		}
+
+		i := &injector{config: NewConfigWithDefaults()}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		for _, env := range patchOps[0].Value.(*corev1.Container).Env {
+			if env.Name == goMemLimitEnvVar {
+				return env.Value, true
+			}
+		}
+		return "", false
+	}
+
+	t.Run("env set from the memory limit annotation", func(t *testing.T) {
+		value, ok := getGoMemLimitEnv(t, map[string]string{
+			daprSidecarAutoGoMemLimitKey: "true",
+			daprMemoryLimitKey:           "100Mi",
+		}, []corev1.Container{{Name: "app"}})
+		assert.True(t, ok)
+		assert.Equal(t, "94371840", value)
+	})
+
+	t.Run("env set from the memory limit percent annotation", func(t *testing.T) {
+		value, ok := getGoMemLimitEnv(t, map[string]string{
+			daprSidecarAutoGoMemLimitKey: "true",
+			daprMemoryLimitPercentKey:    "50",
+		}, []corev1.Container{{
+			Name: "app",
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("200Mi")},
+			},
+		}})
+		assert.True(t, ok)
+		assert.Equal(t, "94371840", value)
+	})
+
+	t.Run("env not set without a memory limit", func(t *testing.T) {
+		_, ok := getGoMemLimitEnv(t, map[string]string{
+			daprSidecarAutoGoMemLimitKey: "true",
+		}, []corev1.Container{{Name: "app"}})
+		assert.False(t, ok)
+	})
+
+	t.Run("env not set without the annotation", func(t *testing.T) {
+		_, ok := getGoMemLimitEnv(t, map[string]string{
+			daprMemoryLimitKey: "100Mi",
+		}, []corev1.Container{{Name: "app"}})
+		assert.False(t, ok)
+	})
+}
+
+func TestComponentCache(t *testing.T) {
+	t.Run("volume, mount and env var", func(t *testing.T) {
+		annotations := map[string]string{daprComponentCacheKey: "true"}
+
+		assert.Equal(t, []corev1.Volume{
+			{
+				Name: componentCacheVolumeName,
+				VolumeSource: corev1.VolumeSource{
+					EmptyDir: &corev1.EmptyDirVolumeSource{},
+				},
+			},
+		}, getSidecarVolumes(annotations))
+
+		container, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, []corev1.VolumeMount{
+			{Name: componentCacheVolumeName, MountPath: "/var/run/dapr/component-cache"},
+		}, container.VolumeMounts)
+		assert.Contains(t, container.Env, corev1.EnvVar{Name: "DAPR_COMPONENT_CACHE_DIR", Value: "/var/run/dapr/component-cache"})
+	})
+
+	t.Run("custom path", func(t *testing.T) {
+		annotations := map[string]string{
+			daprComponentCacheKey:     "true",
+			daprComponentCachePathKey: "/cache",
+		}
+
+		container, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, []corev1.VolumeMount{
+			{Name: componentCacheVolumeName, MountPath: "/cache"},
+		}, container.VolumeMounts)
+		assert.Contains(t, container.Env, corev1.EnvVar{Name: "DAPR_COMPONENT_CACHE_DIR", Value: "/cache"})
+	})
+
+	t.Run("relative path", func(t *testing.T) {
+		_, err := getSidecarContainer(map[string]string{
+			daprComponentCacheKey:     "true",
+			daprComponentCachePathKey: "cache",
+		}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		assert.Empty(t, getSidecarVolumes(map[string]string{}))
+
+		container, err := getSidecarContainer(map[string]string{}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Empty(t, container.VolumeMounts)
+		for _, env := range container.Env {
+			assert.NotEqual(t, "DAPR_COMPONENT_CACHE_DIR", env.Name)
+		}
+	})
+}
+
+func TestReadOnlyRootFilesystem(t *testing.T) {
+	t.Run("read only root filesystem with writable tmp", func(t *testing.T) {
+		annotations := map[string]string{daprReadOnlyRootFilesystemKey: "true"}
+
+		assert.Equal(t, []corev1.Volume{
+			{
+				Name: tmpVolumeName,
+				VolumeSource: corev1.VolumeSource{
+					EmptyDir: &corev1.EmptyDirVolumeSource{},
+				},
+			},
+		}, getSidecarVolumes(annotations))
+
+		container, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.True(t, *container.SecurityContext.ReadOnlyRootFilesystem)
+		assert.False(t, *container.SecurityContext.AllowPrivilegeEscalation)
+		assert.Equal(t, []corev1.VolumeMount{
+			{Name: tmpVolumeName, MountPath: "/tmp"},
+		}, container.VolumeMounts)
+	})
+
+	t.Run("disabled when false", func(t *testing.T) {
+		annotations := map[string]string{daprReadOnlyRootFilesystemKey: "false"}
+		assert.Empty(t, getSidecarVolumes(annotations))
+
+		container, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Nil(t, container.SecurityContext.ReadOnlyRootFilesystem)
+		assert.Empty(t, container.VolumeMounts)
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Nil(t, container.SecurityContext.ReadOnlyRootFilesystem)
+	})
+}
+
+func TestSidecarRunAsNonRoot(t *testing.T) {
+	t.Run("run as non-root with a UID", func(t *testing.T) {
+		annotations := map[string]string{
+			daprRunAsNonRootKey: "true",
+			daprRunAsUserKey:    "65532",
+		}
+		container, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.True(t, *container.SecurityContext.RunAsNonRoot)
+		assert.Equal(t, int64(65532), *container.SecurityContext.RunAsUser)
+	})
+
+	t.Run("UID without non-root", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{daprRunAsUserKey: "0"}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Nil(t, container.SecurityContext.RunAsNonRoot)
+		assert.Equal(t, int64(0), *container.SecurityContext.RunAsUser)
+	})
+
+	t.Run("unset by default", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Nil(t, container.SecurityContext.RunAsNonRoot)
+		assert.Nil(t, container.SecurityContext.RunAsUser)
+	})
+
+	t.Run("invalid UID", func(t *testing.T) {
+		for _, uid := range []string{"abc", "-1", "1.5", "99999999999999999999"} {
+			_, err := getSidecarContainer(map[string]string{daprRunAsUserKey: uid}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+			assert.Error(t, err, uid)
+		}
+	})
+
+	t.Run("root UID with non-root", func(t *testing.T) {
+		annotations := map[string]string{
+			daprRunAsNonRootKey: "true",
+			daprRunAsUserKey:    "0",
+		}
+		_, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Error(t, err)
+	})
+}
+
+func TestSidecarCapabilities(t *testing.T) {
+	t.Run("drop all", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{daprDropCapabilitiesKey: "ALL"}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}}, container.SecurityContext.Capabilities)
+	})
+
+	t.Run("drop all and add back", func(t *testing.T) {
+		annotations := map[string]string{
+			daprDropCapabilitiesKey: "all",
+			daprAddCapabilitiesKey:  "net_bind_service, NET_RAW",
+		}
+		container, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+			Add:  []corev1.Capability{"NET_BIND_SERVICE", "NET_RAW"},
+		}, container.SecurityContext.Capabilities)
+	})
+
+	t.Run("drop a list", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{daprDropCapabilitiesKey: "NET_RAW,,CHOWN"}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, []corev1.Capability{"NET_RAW", "CHOWN"}, container.SecurityContext.Capabilities.Drop)
+		assert.Nil(t, container.SecurityContext.Capabilities.Add)
+	})
+
+	t.Run("unset by default", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Nil(t, container.SecurityContext.Capabilities)
+	})
+
+	t.Run("invalid capabilities", func(t *testing.T) {
+		for _, annotations := range []map[string]string{
+			{daprDropCapabilitiesKey: "NET RAW"},
+			{daprDropCapabilitiesKey: "_NET_RAW"},
+			{daprAddCapabilitiesKey: "CAP-SYS"},
+			{daprAddCapabilitiesKey: "ALL"},
+		} {
+			_, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+			assert.Error(t, err, annotations)
+		}
+	})
+}
+
+func TestSidecarSeccompProfile(t *testing.T) {
+	t.Run("runtime default", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{daprSeccompProfileTypeKey: "RuntimeDefault"}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}, container.SecurityContext.SeccompProfile)
+	})
+
+	t.Run("unconfined", func(t *testing.T) {
+		profile, err := getSeccompProfile(map[string]string{daprSeccompProfileTypeKey: "Unconfined"})
+		assert.NoError(t, err)
+		assert.Equal(t, &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeUnconfined}, profile)
+	})
+
+	t.Run("localhost", func(t *testing.T) {
+		annotations := map[string]string{
+			daprSeccompProfileTypeKey:      "Localhost",
+			daprSeccompLocalhostProfileKey: "profiles/daprd.json",
+		}
+		container, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, corev1.SeccompProfileTypeLocalhost, container.SecurityContext.SeccompProfile.Type)
+		assert.Equal(t, "profiles/daprd.json", *container.SecurityContext.SeccompProfile.LocalhostProfile)
+	})
+
+	t.Run("unset by default", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Nil(t, container.SecurityContext.SeccompProfile)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, annotations := range []map[string]string{
+			{daprSeccompProfileTypeKey: "Default"},
+			{daprSeccompProfileTypeKey: "Localhost"},
+			{daprSeccompProfileTypeKey: "Localhost", daprSeccompLocalhostProfileKey: "/var/lib/kubelet/seccomp/daprd.json"},
+			{daprSeccompProfileTypeKey: "Localhost", daprSeccompLocalhostProfileKey: "../daprd.json"},
+			{daprSeccompProfileTypeKey: "RuntimeDefault", daprSeccompLocalhostProfileKey: "daprd.json"},
+			{daprSeccompLocalhostProfileKey: "daprd.json"},
+		} {
+			_, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+			assert.Error(t, err, annotations)
+		}
+	})
+}
+
+func TestMemoryUnitWarnings(t *testing.T) {
+	t.Run("decimal units", func(t *testing.T) {
+		warnings := getMemoryUnitWarnings(map[string]string{
+			daprMemoryLimitKey:   "500M",
+			daprMemoryRequestKey: "1G",
+		})
+		assert.Equal(t, []string{
+			"annotation dapr.io/sidecar-memory-limit uses the decimal unit 500M, which is 500000000 bytes or 476.84Mi, use binary units such as Mi or Gi to avoid confusion",
+			"annotation dapr.io/sidecar-memory-request uses the decimal unit 1G, which is 1000000000 bytes or 953.67Mi, use binary units such as Mi or Gi to avoid confusion",
+		}, warnings)
+	})
+
+	t.Run("binary units", func(t *testing.T) {
+		assert.Empty(t, getMemoryUnitWarnings(map[string]string{
+			daprMemoryLimitKey:   "500Mi",
+			daprMemoryRequestKey: "1Gi",
+		}))
+	})
+
+	t.Run("plain bytes and invalid values", func(t *testing.T) {
+		assert.Empty(t, getMemoryUnitWarnings(map[string]string{
+			daprMemoryLimitKey:   "524288000",
+			daprMemoryRequestKey: "abc",
+		}))
+	})
+
+	t.Run("decimal units still apply", func(t *testing.T) {
+		r, err := getResourceRequirements(map[string]string{daprMemoryLimitKey: "500M"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(500000000), r.Limits.Memory().Value())
+	})
+
+	t.Run("returned as admission warnings", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					daprEnabledKey:     "true",
+					appIDKey:           "app",
+					daprMemoryLimitKey: "500M",
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+		}
+		i := &injector{}
+		_, warnings, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.Contains(t, warnings, getMemoryUnitWarnings(pod.Annotations)[0])
+	})
+}
+
+func TestPlacementHostAlias(t *testing.T) {
+	placementSvc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "dapr-placement-server",
+			Namespace: "dapr-system",
+		},
+		Spec: corev1.ServiceSpec{ClusterIP: "10.0.0.10"},
+	}
+
+	t.Run("host alias added", func(t *testing.T) {
+		patchOps, warnings := getPlacementHostAliasPatchOperations(nil, "dapr-system", "", fake.NewSimpleClientset(placementSvc))
+		assert.Empty(t, warnings)
+		assert.Equal(t, []PatchOperation{
+			{
+				Op:   "add",
+				Path: "/spec/hostAliases",
+				Value: []corev1.HostAlias{
+					{IP: "10.0.0.10", Hostnames: []string{"dapr-placement-server.dapr-system.svc.cluster.local"}},
+				},
+			},
+		}, patchOps)
+	})
+
+	t.Run("host alias appended", func(t *testing.T) {
+		existing := []corev1.HostAlias{{IP: "10.0.0.1", Hostnames: []string{"foo"}}}
+		patchOps, warnings := getPlacementHostAliasPatchOperations(existing, "dapr-system", "", fake.NewSimpleClientset(placementSvc))
+		assert.Empty(t, warnings)
+		assert.Equal(t, []PatchOperation{
+			{
+				Op:    "add",
+				Path:  "/spec/hostAliases/-",
+				Value: corev1.HostAlias{IP: "10.0.0.10", Hostnames: []string{"dapr-placement-server.dapr-system.svc.cluster.local"}},
+			},
+		}, patchOps)
+	})
+
+	t.Run("missing service", func(t *testing.T) {
+		patchOps, warnings := getPlacementHostAliasPatchOperations(nil, "dapr-system", "", fake.NewSimpleClientset())
+		assert.Empty(t, patchOps)
+		assert.Len(t, warnings, 1)
+	})
+
+	t.Run("headless service", func(t *testing.T) {
+		headless := placementSvc.DeepCopy()
+		headless.Spec.ClusterIP = corev1.ClusterIPNone
+		patchOps, warnings := getPlacementHostAliasPatchOperations(nil, "dapr-system", "", fake.NewSimpleClientset(headless))
+		assert.Empty(t, patchOps)
+		assert.Len(t, warnings, 1)
+	})
+
+	getPatchOps := func(t *testing.T, annotations map[string]string) []PatchOperation {
+		annotations[daprEnabledKey] = "true"
+		annotations[appIDKey] = "app"
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", Annotations: annotations},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+		}
+
+		i := &injector{}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(placementSvc), getTestDaprClient(false))
+		assert.NoError(t, err)
+		return patchOps
+	}
+
+	t.Run("pod patched with the annotation", func(t *testing.T) {
+		patchOps := getPatchOps(t, map[string]string{daprPlacementHostAliasKey: "true"})
+		assert.Contains(t, patchOps, PatchOperation{
+			Op:   "add",
+			Path: "/spec/hostAliases",
+			Value: []corev1.HostAlias{
+				{IP: "10.0.0.10", Hostnames: []string{"dapr-placement-server.dapr-system.svc.cluster.local"}},
+			},
+		})
+	})
+
+	t.Run("pod not patched without the annotation", func(t *testing.T) {
+		for _, op := range getPatchOps(t, map[string]string{}) {
+			assert.NotContains(t, op.Path, "/spec/hostAliases")
+		}
+	})
+}
+
+func TestSidecarImageAllowlist(t *testing.T) {
+	allowlist := []string{"docker.io/daprio/daprd:1.0.0", "registry.example.com/dapr/*"}
+
+	t.Run("exact match", func(t *testing.T) {
+		assert.NoError(t, validateSidecarImage("docker.io/daprio/daprd:1.0.0", allowlist))
+	})
+
+	t.Run("prefix match", func(t *testing.T) {
+		assert.NoError(t, validateSidecarImage("registry.example.com/dapr/daprd:edge", allowlist))
+	})
+
+	t.Run("not allowed", func(t *testing.T) {
+		assert.Error(t, validateSidecarImage("docker.io/daprio/daprd:1.0.1", allowlist))
+		assert.Error(t, validateSidecarImage("registry.example.com/other/daprd:edge", allowlist))
+	})
+
+	t.Run("empty allowlist", func(t *testing.T) {
+		assert.NoError(t, validateSidecarImage("anything", nil))
+	})
+
+	getPod := func(annotations map[string]string) corev1.Pod {
+		annotations[daprEnabledKey] = "true"
+		annotations[appIDKey] = "app"
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", Annotations: annotations},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+		}
+	}
+	i := &injector{config: Config{SidecarImageAllowlist: allowlist}}
+
+	t.Run("default image allowed", func(t *testing.T) {
+		_, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, getPod(map[string]string{})), "dapr-system", "docker.io/daprio/daprd:1.0.0", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+	})
+
+	t.Run("pod override allowed", func(t *testing.T) {
+		pod := getPod(map[string]string{daprSidecarImageKey: "registry.example.com/dapr/daprd:edge"})
+		_, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "docker.io/daprio/daprd:1.0.0", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+	})
+
+	t.Run("pod override rejected", func(t *testing.T) {
+		pod := getPod(map[string]string{daprSidecarImageKey: "evil.example.com/daprd:latest"})
+		_, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "docker.io/daprio/daprd:1.0.0", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.EqualError(t, err, "sidecar image evil.example.com/daprd:latest is not allowed")
+	})
+}
+
+func TestSidecarStartupProbe(t *testing.T) {
+	t.Run("no startup probe without annotations", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Nil(t, container.StartupProbe)
+	})
+
+	t.Run("all annotations", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{
+			daprStartupProbeDelayKey:     "1",
+			daprStartupProbeTimeoutKey:   "2",
+			daprStartupProbePeriodKey:    "5",
+			daprStartupProbeThresholdKey: "30",
+		}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.NotNil(t, container.StartupProbe)
+		assert.Equal(t, int32(1), container.StartupProbe.InitialDelaySeconds)
+		assert.Equal(t, int32(2), container.StartupProbe.TimeoutSeconds)
+		assert.Equal(t, int32(5), container.StartupProbe.PeriodSeconds)
+		assert.Equal(t, int32(30), container.StartupProbe.FailureThreshold)
+		assert.Equal(t, container.LivenessProbe.Handler, container.StartupProbe.Handler)
+	})
+
+	t.Run("defaults for missing annotations", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{
+			daprStartupProbeThresholdKey: "30",
+		}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, int32(defaultHealthzProbeDelaySeconds), container.StartupProbe.InitialDelaySeconds)
+		assert.Equal(t, int32(defaultHealthzProbeTimeoutSeconds), container.StartupProbe.TimeoutSeconds)
+		assert.Equal(t, int32(defaultHealthzProbePeriodSeconds), container.StartupProbe.PeriodSeconds)
+		assert.Equal(t, int32(30), container.StartupProbe.FailureThreshold)
+	})
+}
+
+func TestMetricsListenAddress(t *testing.T) {
+	t.Run("flag emitted", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{
+			daprMetricsListenAddressKey: "127.0.0.1",
+		}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Contains(t, strings.Join(container.Args, " "), "--metrics-listen-address 127.0.0.1")
+	})
+
+	t.Run("localhost and IPv6 accepted", func(t *testing.T) {
+		for _, address := range []string{"localhost", "::1"} {
+			address, err := getMetricsListenAddress(map[string]string{daprMetricsListenAddressKey: address})
+			assert.NoError(t, err)
+			assert.NotEmpty(t, address)
+		}
+	})
+
+	t.Run("invalid address", func(t *testing.T) {
+		_, err := getSidecarContainer(map[string]string{
+			daprMetricsListenAddressKey: "127.0.0.1:9090",
+		}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("no flag without the annotation", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.NotContains(t, container.Args, "--metrics-listen-address")
+	})
+}
+
+func TestSidecarProbeType(t *testing.T) {
+	t.Run("http by default", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.NotNil(t, container.LivenessProbe.HTTPGet)
+		assert.NotNil(t, container.ReadinessProbe.HTTPGet)
+		assert.Nil(t, container.LivenessProbe.TCPSocket)
+	})
+
+	t.Run("tcp", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{
+			daprProbeTypeKey:             "tcp",
+			sidecarHTTPPortKey:           "3600",
+			daprStartupProbeThresholdKey: "30",
+		}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		expected := corev1.Handler{
+			TCPSocket: &corev1.TCPSocketAction{Port: intstr.IntOrString{IntVal: 3600}},
+		}
+		assert.Equal(t, expected, container.LivenessProbe.Handler)
+		assert.Equal(t, expected, container.ReadinessProbe.Handler)
+		assert.Equal(t, expected, container.StartupProbe.Handler)
+	})
+
+	t.Run("tcp with a probe port", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{
+			daprProbeTypeKey:             "tcp",
+			daprProbePortKey:             "8080",
+			daprStartupProbeThresholdKey: "30",
+		}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		expected := corev1.Handler{
+			TCPSocket: &corev1.TCPSocketAction{Port: intstr.IntOrString{IntVal: 8080}},
+		}
+		assert.Equal(t, expected, container.LivenessProbe.Handler)
+		assert.Equal(t, expected, container.ReadinessProbe.Handler)
+		assert.Equal(t, expected, container.StartupProbe.Handler)
+	})
+
+	t.Run("grpc not supported", func(t *testing.T) {
+		_, err := getSidecarContainer(map[string]string{daprProbeTypeKey: "grpc"}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid type", func(t *testing.T) {
+		_, err := getSidecarContainer(map[string]string{daprProbeTypeKey: "exec"}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Error(t, err)
+	})
+}
+
+func TestHostNameEnv(t *testing.T) {
+	getHostNameEnv := func(t *testing.T, hostname string) corev1.EnvVar {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod-0",
+				Annotations: map[string]string{
+					daprEnabledKey: "true",
+					appIDKey:       "app",
+				},
+			},
+			Spec: corev1.PodSpec{
+				Hostname:   hostname,
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+		}
+
+		i := &injector{}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		for _, env := range patchOps[0].Value.(*corev1.Container).Env {
+			if env.Name == "DAPR_HOST_NAME" {
+				return env
+			}
+		}
+		t.Fatal("DAPR_HOST_NAME env var not found")
+		return corev1.EnvVar{}
+	}
+
+	t.Run("sourced from the pod name", func(t *testing.T) {
+		env := getHostNameEnv(t, "")
+		assert.Equal(t, "metadata.name", env.ValueFrom.FieldRef.FieldPath)
+		assert.Empty(t, env.Value)
+	})
+
+	t.Run("explicit hostname", func(t *testing.T) {
+		env := getHostNameEnv(t, "stable-host")
+		assert.Equal(t, "stable-host", env.Value)
+		assert.Nil(t, env.ValueFrom)
+	})
+}
+
+func TestDisableLivenessProbe(t *testing.T) {
+	t.Run("liveness probe disabled", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{daprDisableLivenessProbeKey: "true"}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Nil(t, container.LivenessProbe)
+		assert.NotNil(t, container.ReadinessProbe)
+	})
+
+	t.Run("liveness probe kept by default", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.NotNil(t, container.LivenessProbe)
+		assert.NotNil(t, container.ReadinessProbe)
+	})
+
+	t.Run("liveness probe kept when false", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{daprDisableLivenessProbeKey: "false"}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.NotNil(t, container.LivenessProbe)
+	})
+}
+
+func TestSidecarPreStopHook(t *testing.T) {
+	t.Run("preStop hook drains daprd", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{daprGracefulShutdownSecondsKey: "15"}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.NotNil(t, container.Lifecycle)
+		assert.Nil(t, container.Lifecycle.PreStop.HTTPGet)
+		assert.Equal(t, []string{"/daprd", "drain", "--dapr-http-port", "3500", "--seconds", "15"}, container.Lifecycle.PreStop.Exec.Command)
+	})
+
+	t.Run("preStop hook uses the sidecar http port", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{daprGracefulShutdownSecondsKey: "15", sidecarHTTPPortKey: "3600"}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"/daprd", "drain", "--dapr-http-port", "3600", "--seconds", "15"}, container.Lifecycle.PreStop.Exec.Command)
+	})
+
+	t.Run("preStop hook kept with a base container", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{
+			daprGracefulShutdownSecondsKey: "15",
+			daprSidecarBaseContainerKey:    `{"workingDir": "/work"}`,
+		}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, "/work", container.WorkingDir)
+		assert.Equal(t, []string{"/daprd", "drain", "--dapr-http-port", "3500", "--seconds", "15"}, container.Lifecycle.PreStop.Exec.Command)
+	})
+
+	t.Run("no preStop hook by default", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Nil(t, container.Lifecycle)
+	})
+
+	t.Run("no preStop hook for a zero window", func(t *testing.T) {
+		container, err := getSidecarContainer(map[string]string{daprGracefulShutdownSecondsKey: "0"}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Nil(t, container.Lifecycle)
+	})
+}
+
+func TestAlignedPreStopSeconds(t *testing.T) {
+	int64Ptr := func(i int64) *int64 { return &i }
+
+	t.Run("sleep until only the drain window is left", func(t *testing.T) {
+		assert.Equal(t, int32(55), getAlignedPreStopSeconds(int64Ptr(60), 5))
+		assert.Equal(t, int32(100), getAlignedPreStopSeconds(int64Ptr(120), 20))
+	})
+
+	t.Run("default grace period", func(t *testing.T) {
+		assert.Equal(t, int32(25), getAlignedPreStopSeconds(nil, defaultGracefulShutdownSeconds))
+	})
+
+	t.Run("no sleep when the drain window covers the grace period", func(t *testing.T) {
+		assert.Equal(t, int32(0), getAlignedPreStopSeconds(int64Ptr(10), 10))
+		assert.Equal(t, int32(0), getAlignedPreStopSeconds(int64Ptr(0), 5))
+	})
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "pod",
+			Annotations: map[string]string{
+				daprEnabledKey:               "true",
+				appIDKey:                     "app",
+				daprAlignTerminationGraceKey: "true",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers:                    []corev1.Container{{Name: "app"}},
+			TerminationGracePeriodSeconds: int64Ptr(90),
+		},
+	}
+
+	getPreStopSeconds := func(t *testing.T, pod corev1.Pod) string {
+		i := &injector{}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		c := patchOps[0].Value.(*corev1.Container)
+		if c.Lifecycle == nil {
+			return ""
+		}
+		command := c.Lifecycle.PreStop.Exec.Command
+		return command[len(command)-1]
+	}
+
+	t.Run("preStop hook aligned with the pod grace period", func(t *testing.T) {
+		assert.Equal(t, "85", getPreStopSeconds(t, pod))
+	})
+
+	t.Run("preStop hook uses the annotated drain window", func(t *testing.T) {
+		p := *pod.DeepCopy()
+		p.Annotations[daprGracefulShutdownSecondsKey] = "30"
+		assert.Equal(t, "60", getPreStopSeconds(t, p))
+	})
+
+	t.Run("no preStop hook when alignment is disabled", func(t *testing.T) {
+		p := *pod.DeepCopy()
+		delete(p.Annotations, daprAlignTerminationGraceKey)
+		assert.Empty(t, getPreStopSeconds(t, p))
+	})
+
+	t.Run("postStart hook of the base container is kept", func(t *testing.T) {
+		p := *pod.DeepCopy()
+		p.Annotations[daprSidecarBaseContainerKey] = `{"lifecycle": {"postStart": {"exec": {"command": ["/bin/true"]}}}}`
+		assert.Equal(t, "85", getPreStopSeconds(t, p))
+
+		i := &injector{}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, p), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"/bin/true"}, patchOps[0].Value.(*corev1.Container).Lifecycle.PostStart.Exec.Command)
+	})
+
+	t.Run("preStop hook of the base container is rejected", func(t *testing.T) {
+		p := *pod.DeepCopy()
+		p.Annotations[daprSidecarBaseContainerKey] = `{"lifecycle": {"preStop": {"exec": {"command": ["/bin/sleep", "5"]}}}}`
+		i := &injector{}
+		_, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, p), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.Error(t, err)
+	})
+}
+
+func TestEnvFromAnnotations(t *testing.T) {
+	t.Run("listed annotations are mapped to env vars", func(t *testing.T) {
+		annotations := map[string]string{
+			daprEnvFromAnnotationsKey: "team, example.com/cost-center,owner-email",
+			"team":                    "payments",
+			"example.com/cost-center": "1234",
+			"owner-email":             "payments@example.com",
+			"not-listed":              "value",
+		}
+		envs, err := getEnvFromAnnotations(annotations)
+		assert.NoError(t, err)
+		assert.Equal(t, []corev1.EnvVar{
+			{Name: "TEAM", Value: "payments"},
+			{Name: "EXAMPLE_COM_COST_CENTER", Value: "1234"},
+			{Name: "OWNER_EMAIL", Value: "payments@example.com"},
+		}, envs)
+	})
+
+	t.Run("missing annotations are skipped", func(t *testing.T) {
+		envs, err := getEnvFromAnnotations(map[string]string{daprEnvFromAnnotationsKey: "team,,missing"})
+		assert.NoError(t, err)
+		assert.Empty(t, envs)
+	})
+
+	t.Run("no env vars by default", func(t *testing.T) {
+		envs, err := getEnvFromAnnotations(map[string]string{"team": "payments"})
+		assert.NoError(t, err)
+		assert.Empty(t, envs)
+	})
+
+	t.Run("invalid env var name", func(t *testing.T) {
+		_, err := getEnvFromAnnotations(map[string]string{daprEnvFromAnnotationsKey: "1team", "1team": "payments"})
+		assert.Error(t, err)
+	})
+
+	t.Run("injected env vars can't be overridden", func(t *testing.T) {
+		for _, key := range []string{"sentry-local-identity", "sentry.local.identity", "namespace", "dapr-api-token"} {
+			_, err := getEnvFromAnnotations(map[string]string{daprEnvFromAnnotationsKey: key, key: "spoofed"})
+			assert.Error(t, err, key)
+		}
+	})
+
+	t.Run("sentry local identity can't be overridden on the sidecar", func(t *testing.T) {
+		annotations := map[string]string{
+			daprEnvFromAnnotationsKey: "sentry-local-identity",
+			"sentry-local-identity":   "other-ns:other-sa",
+		}
+		container, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "anchors", "chain", "key", "", true, "ns:sa")
+		assert.Error(t, err)
+		assert.Nil(t, container)
+	})
+
+	t.Run("env vars are added to the sidecar", func(t *testing.T) {
+		annotations := map[string]string{
+			daprEnvFromAnnotationsKey: "team",
+			"team":                    "payments",
+		}
+		container, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Contains(t, container.Env, corev1.EnvVar{Name: "TEAM", Value: "payments"})
+	})
+}
+
+func TestMTLSLookupFailurePolicy(t *testing.T) {
+	getFailingDaprClient := func() *daprfake.Clientset {
+		daprClient := daprfake.NewSimpleClientset()
+		daprClient.PrependReactor("list", "configurations", func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("api server unreachable")
+		})
+		return daprClient
+	}
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "pod",
+			Annotations: map[string]string{
+				daprEnabledKey: "true",
+				appIDKey:       "app",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}},
+		},
+	}
+
+	assertNoCredentials := func(t *testing.T, env []corev1.EnvVar) {
+		for _, e := range env {
+			assert.NotEqual(t, certs.TrustAnchorsEnvVar, e.Name)
+			assert.NotEqual(t, certs.CertChainEnvVar, e.Name)
+			assert.NotEqual(t, certs.CertKeyEnvVar, e.Name)
+		}
+	}
+
+	t.Run("fail open", func(t *testing.T) {
+		i := &injector{}
+		patchOps, warnings, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getFailingDaprClient())
+		assert.NoError(t, err)
+		assert.NotEmpty(t, patchOps)
+		env := getTestEnvPatchValues(patchOps)
+		assert.Contains(t, env, corev1.EnvVar{Name: userContainerDaprMTLSEnabled, Value: "false"})
+		assertNoCredentials(t, env)
+		assert.Contains(t, strings.Join(warnings, "\n"), "api server unreachable")
+	})
+
+	t.Run("fail closed", func(t *testing.T) {
+		i := &injector{config: Config{FailClosed: true}}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getFailingDaprClient())
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "api server unreachable")
+		assert.Nil(t, patchOps)
+	})
+
+	t.Run("fail closed without a lookup error", func(t *testing.T) {
+		for _, mtlsEnabled := range []bool{true, false} {
+			i := &injector{config: Config{FailClosed: true}}
+			patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(mtlsEnabled))
+			assert.NoError(t, err)
+			env := getTestEnvPatchValues(patchOps)
+			assert.Contains(t, env, corev1.EnvVar{Name: userContainerDaprMTLSEnabled, Value: strconv.FormatBool(mtlsEnabled)})
+			if !mtlsEnabled {
+				assertNoCredentials(t, env)
+			}
+		}
+	})
+}
+
+func TestTrustAnchorsVolume(t *testing.T) {
+	t.Run("size based switch", func(t *testing.T) {
+		assert.False(t, mountTrustAnchorsEnabled("1234", "", 2))
+		assert.False(t, mountTrustAnchorsEnabled("12", "trust-anchors", 2))
+		assert.False(t, mountTrustAnchorsEnabled("", "trust-anchors", 0))
+		assert.True(t, mountTrustAnchorsEnabled("123", "trust-anchors", 2))
+		assert.True(t, mountTrustAnchorsEnabled("1", "trust-anchors", 0))
+	})
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "pod",
+			Annotations: map[string]string{
+				daprEnabledKey: "true",
+				appIDKey:       "app",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}},
+		},
+	}
+	getKubeClient := func(trustAnchors string) *fake.Clientset {
+		return fake.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: certs.KubeScrtName, Namespace: "dapr-system"},
+			Data: map[string][]byte{
+				credentials.RootCertFilename:   []byte(trustAnchors),
+				credentials.IssuerCertFilename: []byte("cert"),
+				credentials.IssuerKeyFilename:  []byte("key"),
+			},
+		})
+	}
+	getSidecar := func(t *testing.T, patchOps []PatchOperation) *corev1.Container {
+		for _, p := range patchOps {
+			if c, ok := p.Value.(*corev1.Container); ok && c.Name == sidecarContainerName {
+				return c
+			}
+		}
+		t.Fatal("sidecar container not found")
+		return nil
+	}
+	getEnv := func(c *corev1.Container, name string) (string, bool) {
+		for _, e := range c.Env {
+			if e.Name == name {
+				return e.Value, true
+			}
+		}
+		return "", false
+	}
+
+	getKubeClientWithConfigMap := func(trustAnchors string, data map[string]string) *fake.Clientset {
+		kubeClient := getKubeClient(trustAnchors)
+		_, err := kubeClient.CoreV1().ConfigMaps("ns").Create(context.TODO(), &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "dapr-trust-anchors", Namespace: "ns"},
+			Data:       data,
+		}, metav1.CreateOptions{})
+		assert.NoError(t, err)
+		return kubeClient
+	}
+
+	t.Run("large trust anchors mounted from a volume", func(t *testing.T) {
+		i := &injector{config: Config{TrustAnchorsConfigMap: "dapr-trust-anchors", TrustAnchorsEnvMaxBytes: 8}}
+		kubeClient := getKubeClientWithConfigMap("large trust anchors", map[string]string{credentials.RootCertFilename: "large trust anchors"})
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", kubeClient, getTestDaprClient(true))
+		assert.NoError(t, err)
+
+		c := getSidecar(t, patchOps)
+		_, ok := getEnv(c, certs.TrustAnchorsEnvVar)
+		assert.False(t, ok)
+		assert.Contains(t, strings.Join(c.Args, " "), "--trust-anchors-file /var/run/secrets/dapr.io/trust-anchors/ca.crt")
+		assert.Contains(t, c.VolumeMounts, corev1.VolumeMount{Name: trustAnchorsVolumeName, MountPath: trustAnchorsMountPath, ReadOnly: true})
+		assert.Contains(t, patchOps, PatchOperation{
+			Op:    "add",
+			Path:  volumesPath,
+			Value: []corev1.Volume{getTrustAnchorsVolume("dapr-trust-anchors")},
+		})
+	})
+
+	t.Run("small trust anchors passed as an env var", func(t *testing.T) {
+		i := &injector{config: Config{TrustAnchorsConfigMap: "dapr-trust-anchors", TrustAnchorsEnvMaxBytes: 1024}}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", getKubeClient("small"), getTestDaprClient(true))
+		assert.NoError(t, err)
+
+		c := getSidecar(t, patchOps)
+		value, ok := getEnv(c, certs.TrustAnchorsEnvVar)
+		assert.True(t, ok)
+		assert.Equal(t, "small", value)
+		assert.NotContains(t, c.Args, "--trust-anchors-file")
+		assert.Empty(t, c.VolumeMounts)
+	})
+
+	t.Run("large trust anchors without the ConfigMap in the pod namespace", func(t *testing.T) {
+		i := &injector{config: Config{TrustAnchorsConfigMap: "dapr-trust-anchors", TrustAnchorsEnvMaxBytes: 8}}
+		patchOps, warnings, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", getKubeClient("large trust anchors"), getTestDaprClient(true))
+		assert.NoError(t, err)
+
+		c := getSidecar(t, patchOps)
+		value, ok := getEnv(c, certs.TrustAnchorsEnvVar)
+		assert.True(t, ok)
+		assert.Equal(t, "large trust anchors", value)
+		assert.NotContains(t, strings.Join(c.Args, " "), "--trust-anchors-file")
+		assert.Empty(t, c.VolumeMounts)
+		assert.Contains(t, strings.Join(warnings, "\n"), "ns/dapr-trust-anchors could not be found")
+	})
+
+	t.Run("large trust anchors with a ConfigMap missing the ca.crt key", func(t *testing.T) {
+		i := &injector{config: Config{TrustAnchorsConfigMap: "dapr-trust-anchors", TrustAnchorsEnvMaxBytes: 8}}
+		kubeClient := getKubeClientWithConfigMap("large trust anchors", map[string]string{"other": "value"})
+		patchOps, warnings, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", kubeClient, getTestDaprClient(true))
+		assert.NoError(t, err)
+
+		c := getSidecar(t, patchOps)
+		_, ok := getEnv(c, certs.TrustAnchorsEnvVar)
+		assert.True(t, ok)
+		assert.Contains(t, strings.Join(warnings, "\n"), "has no ca.crt key")
+	})
+
+	t.Run("large trust anchors without a ConfigMap", func(t *testing.T) {
+		i := &injector{config: Config{TrustAnchorsEnvMaxBytes: 8}}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", getKubeClient("large trust anchors"), getTestDaprClient(true))
+		assert.NoError(t, err)
+
+		c := getSidecar(t, patchOps)
+		_, ok := getEnv(c, certs.TrustAnchorsEnvVar)
+		assert.True(t, ok)
+		assert.NotContains(t, c.Args, "--trust-anchors-file")
+	})
+}
+
+func TestNativeSidecar(t *testing.T) {
+	getPod := func(annotations map[string]string, initContainers []corev1.Container) corev1.Pod {
+		annotations[daprEnabledKey] = "true"
+		annotations[appIDKey] = "app"
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", Annotations: annotations},
+			Spec: corev1.PodSpec{
+				InitContainers: initContainers,
+				Containers:     []corev1.Container{{Name: "app"}},
+			},
+		}
+	}
+	i := &injector{}
+
+	t.Run("sidecar added to the init containers", func(t *testing.T) {
+		pod := getPod(map[string]string{daprSidecarNativeKey: "true"}, nil)
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+
+		assert.Equal(t, "/spec/initContainers", patchOps[0].Path)
+		containers := patchOps[0].Value.([]interface{})
+		assert.Len(t, containers, 1)
+		sidecar := containers[0].(map[string]interface{})
+		assert.Equal(t, sidecarContainerName, sidecar["name"])
+		assert.Equal(t, "Always", sidecar["restartPolicy"])
+
+		for _, op := range patchOps {
+			assert.NotEqual(t, "/spec/containers/-", op.Path)
+		}
+		assert.Equal(t, "/spec/containers/0/env", patchOps[1].Path)
+	})
+
+	t.Run("sidecar appended to existing init containers", func(t *testing.T) {
+		pod := getPod(map[string]string{daprSidecarNativeKey: "true"}, []corev1.Container{{Name: "init"}})
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+
+		assert.Equal(t, "/spec/initContainers/-", patchOps[0].Path)
+		assert.Equal(t, "Always", patchOps[0].Value.(map[string]interface{})["restartPolicy"])
+	})
+
+	t.Run("regular container without the annotation", func(t *testing.T) {
+		pod := getPod(map[string]string{}, nil)
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+
+		assert.Equal(t, "/spec/containers/-", patchOps[0].Path)
+		assert.Equal(t, sidecarContainerName, patchOps[0].Value.(*corev1.Container).Name)
+		for _, op := range patchOps {
+			assert.NotContains(t, op.Path, "/spec/initContainers")
+		}
+	})
+
+	t.Run("init container startup probe", func(t *testing.T) {
+		annotations := map[string]string{daprSidecarNativeKey: "true"}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		if assert.NotNil(t, c.StartupProbe) {
+			assert.Equal(t, int32(defaultNativeStartupProbePeriod), c.StartupProbe.PeriodSeconds)
+			assert.Equal(t, int32(defaultNativeStartupProbeThreshold), c.StartupProbe.FailureThreshold)
+			assert.Equal(t, "/v1.0/healthz/liveness", c.StartupProbe.HTTPGet.Path)
+		}
+
+		native, err := getNativeSidecarContainer(c)
+		assert.NoError(t, err)
+		startupProbe := native["startupProbe"].(map[string]interface{})
+		assert.Equal(t, float64(defaultNativeStartupProbePeriod), startupProbe["periodSeconds"])
+	})
+
+	t.Run("init container startup probe period", func(t *testing.T) {
+		annotations := map[string]string{
+			daprSidecarNativeKey:      "true",
+			daprStartupProbePeriodKey: "5",
+		}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, int32(5), c.StartupProbe.PeriodSeconds)
+		assert.Equal(t, int32(defaultNativeStartupProbeThreshold), c.StartupProbe.FailureThreshold)
+
+		pod := getPod(annotations, nil)
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		sidecar := patchOps[0].Value.([]interface{})[0].(map[string]interface{})
+		startupProbe := sidecar["startupProbe"].(map[string]interface{})
+		assert.Equal(t, float64(5), startupProbe["periodSeconds"])
+	})
+
+	t.Run("regular container keeps the healthz startup probe", func(t *testing.T) {
+		annotations := map[string]string{daprStartupProbePeriodKey: "5"}
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Equal(t, int32(5), c.StartupProbe.PeriodSeconds)
+		assert.Equal(t, "/v1.0/healthz", c.StartupProbe.HTTPGet.Path)
+
+		c, err = getSidecarContainer(map[string]string{}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Nil(t, c.StartupProbe)
+	})
+
+	t.Run("metrics proxy added to a pod without containers", func(t *testing.T) {
+		pod := getPod(map[string]string{
+			daprSidecarNativeKey:      "true",
+			daprInjectMetricsProxyKey: "true",
+		}, nil)
+		pod.Spec.Containers = nil
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+
+		var containersOps []PatchOperation
+		for _, op := range patchOps {
+			assert.NotEqual(t, "/spec/containers/-", op.Path)
+			if op.Path == "/spec/containers" {
+				containersOps = append(containersOps, op)
+			}
+		}
+		if assert.Len(t, containersOps, 1) {
+			containers := containersOps[0].Value.([]corev1.Container)
+			assert.Len(t, containers, 1)
+			assert.Equal(t, metricsProxyContainerName, containers[0].Name)
+		}
+	})
+
+	t.Run("metrics proxy appended to the app containers", func(t *testing.T) {
+		pod := getPod(map[string]string{
+			daprSidecarNativeKey:      "true",
+			daprInjectMetricsProxyKey: "true",
+		}, nil)
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+
+		var appended []string
+		for _, op := range patchOps {
+			assert.NotEqual(t, "/spec/containers", op.Path)
+			if op.Path == "/spec/containers/-" {
+				appended = append(appended, op.Value.(corev1.Container).Name)
+			}
+		}
+		assert.Equal(t, []string{metricsProxyContainerName}, appended)
+	})
+
+	t.Run("pod with a native sidecar is not injected again", func(t *testing.T) {
+		pod := getPod(map[string]string{daprSidecarNativeKey: "true"}, []corev1.Container{{Name: sidecarContainerName}})
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.Empty(t, patchOps)
+	})
+}
+
+func TestDefaultRequests(t *testing.T) {
+	t.Run("defaults parsed from the config", func(t *testing.T) {
+		requests := getDefaultRequests(Config{SidecarDefaultCPURequest: "100m", SidecarDefaultMemoryRequest: "invalid"})
+		assert.Equal(t, corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")}, requests)
+		assert.Empty(t, getDefaultRequests(Config{}))
+	})
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "pod",
+			Annotations: map[string]string{
+				daprEnabledKey: "true",
+				appIDKey:       "app",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}},
+		},
+	}
+	i := &injector{
+		defaultRequests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("100m"),
+			corev1.ResourceMemory: resource.MustParse("64Mi"),
+		},
+	}
+	getResources := func(t *testing.T, i *injector, pod corev1.Pod) corev1.ResourceRequirements {
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		return patchOps[0].Value.(*corev1.Container).Resources
+	}
+
+	t.Run("defaults applied without annotations", func(t *testing.T) {
+		resources := getResources(t, i, pod)
+		assert.Equal(t, "100m", resources.Requests.Cpu().String())
+		assert.Equal(t, "64Mi", resources.Requests.Memory().String())
+		assert.Empty(t, resources.Limits)
+	})
+
+	t.Run("annotations override the defaults", func(t *testing.T) {
+		p := *pod.DeepCopy()
+		p.Annotations[daprCPURequestKey] = "250m"
+		p.Annotations[daprMemoryLimitKey] = "32Mi"
+		resources := getResources(t, i, p)
+		assert.Equal(t, "250m", resources.Requests.Cpu().String())
+		_, ok := resources.Requests[corev1.ResourceMemory]
+		assert.False(t, ok)
+		assert.Equal(t, "32Mi", resources.Limits.Memory().String())
+	})
+
+	t.Run("no defaults when disabled", func(t *testing.T) {
+		resources := getResources(t, &injector{}, pod)
+		assert.Empty(t, resources.Requests)
+	})
+}
+
+func TestJobPodInjection(t *testing.T) {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "job-pod",
+			Annotations: map[string]string{
+				daprEnabledKey: "true",
+				appIDKey:       "app",
+			},
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "Job", Name: "job"}},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}},
+		},
+	}
+
+	t.Run("job pod skipped by default", func(t *testing.T) {
+		i := &injector{}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.Empty(t, patchOps)
+	})
+
+	t.Run("job pod injected with the annotation", func(t *testing.T) {
+		p := *pod.DeepCopy()
+		p.Annotations[daprEnableJobInjectionKey] = "true"
+		i := &injector{}
+		patchOps, warnings, err := i.getPodPatchOperations(getTestAdmissionReview(t, p), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.NotEmpty(t, patchOps)
+
+		// The process namespace is only shared with the app when opted in.
+		assert.NotContains(t, patchOps[0].Value.(*corev1.Container).Args, "--shutdown-on-app-exit")
+		for _, op := range patchOps {
+			assert.NotEqual(t, shareProcessNamespacePath, op.Path)
+		}
+		assert.Contains(t, strings.Join(warnings, "\n"), daprShutdownOnAppExitKey)
+	})
+
+	t.Run("job pod shutting down on app exit", func(t *testing.T) {
+		p := *pod.DeepCopy()
+		p.Annotations[daprEnableJobInjectionKey] = "true"
+		p.Annotations[daprShutdownOnAppExitKey] = "true"
+		i := &injector{}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, p), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+
+		// daprd shuts down once the app exits so that the Job completes.
+		args := patchOps[0].Value.(*corev1.Container).Args
+		assert.Contains(t, args, "--shutdown-on-app-exit")
+		assert.NotContains(t, args, "--app-exit-ignored-processes")
+		assert.Contains(t, patchOps, PatchOperation{Op: "add", Path: shareProcessNamespacePath, Value: true})
+	})
+
+	t.Run("job pod ignoring the processes of other sidecars", func(t *testing.T) {
+		p := *pod.DeepCopy()
+		p.Annotations[daprEnableJobInjectionKey] = "true"
+		p.Annotations[daprShutdownOnAppExitKey] = "true"
+		p.Annotations[daprAppExitIgnoredProcessesKey] = "pilot-agent, envoy"
+		p.Annotations[daprInjectMetricsProxyKey] = "true"
+		i := &injector{}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, p), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+
+		assert.Contains(t, strings.Join(patchOps[0].Value.(*corev1.Container).Args, " "), "--app-exit-ignored-processes pilot-agent,envoy,socat")
+	})
+
+	t.Run("job pod with a native sidecar", func(t *testing.T) {
+		p := *pod.DeepCopy()
+		p.Annotations[daprEnableJobInjectionKey] = "true"
+		p.Annotations[daprSidecarNativeKey] = "true"
+		p.Annotations[daprShutdownOnAppExitKey] = "true"
+		i := &injector{}
+		patchOps, warnings, err := i.getPodPatchOperations(getTestAdmissionReview(t, p), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+
+		// Kubernetes stops the native sidecar once the app containers complete.
+		sidecar := patchOps[0].Value.([]interface{})[0].(map[string]interface{})
+		assert.NotContains(t, sidecar["args"], "--shutdown-on-app-exit")
+		for _, op := range patchOps {
+			assert.NotEqual(t, shareProcessNamespacePath, op.Path)
+		}
+		assert.NotContains(t, strings.Join(warnings, "\n"), daprShutdownOnAppExitKey)
+	})
+
+	t.Run("pods owned by other resources are injected", func(t *testing.T) {
+		p := *pod.DeepCopy()
+		p.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "rs"}}
+		assert.False(t, isJobPod(&p))
+		assert.True(t, isJobPod(&pod))
+	})
+
+	t.Run("no shutdown on app exit for other pods", func(t *testing.T) {
+		p := *pod.DeepCopy()
+		p.OwnerReferences = nil
+		i := &injector{}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, p), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.NotContains(t, patchOps[0].Value.(*corev1.Container).Args, "--shutdown-on-app-exit")
+		for _, op := range patchOps {
+			assert.NotEqual(t, shareProcessNamespacePath, op.Path)
+		}
+	})
+}
+
+func TestGetTrustAnchorsAndCertChainRetries(t *testing.T) {
+	getKubeClient := func(failures int) (*fake.Clientset, *int) {
+		kubeClient := fake.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: certs.KubeScrtName, Namespace: "dapr-system"},
+			Data: map[string][]byte{
+				credentials.RootCertFilename:   []byte("ca"),
+				credentials.IssuerCertFilename: []byte("cert"),
+				credentials.IssuerKeyFilename:  []byte("key"),
+			},
+		})
+		calls := 0
+		kubeClient.PrependReactor("get", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+			calls++
+			if calls <= failures {
+				return true, nil, errors.New("transient failure")
+			}
+			return false, nil, nil
+		})
+		return kubeClient, &calls
+	}
+
+	t.Run("transient failure then success", func(t *testing.T) {
+		kubeClient, calls := getKubeClient(2)
+		trustAnchors, certChain, certKey := getTrustAnchorsAndCertChain(context.TODO(), kubeClient, "dapr-system", 3, time.Millisecond)
+		assert.Equal(t, "ca", trustAnchors)
+		assert.Equal(t, "cert", certChain)
+		assert.Equal(t, "key", certKey)
+		assert.Equal(t, 3, *calls)
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		kubeClient, calls := getKubeClient(5)
+		trustAnchors, _, _ := getTrustAnchorsAndCertChain(context.TODO(), kubeClient, "dapr-system", 2, time.Millisecond)
+		assert.Empty(t, trustAnchors)
+		assert.Equal(t, 3, *calls)
+	})
+
+	t.Run("retries end with the context", func(t *testing.T) {
+		kubeClient, calls := getKubeClient(5)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		trustAnchors, _, _ := getTrustAnchorsAndCertChain(ctx, kubeClient, "dapr-system", 4, time.Second)
+		assert.Empty(t, trustAnchors)
+		assert.Equal(t, 1, *calls)
+		assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	})
+
+	t.Run("no retries", func(t *testing.T) {
+		kubeClient, calls := getKubeClient(1)
+		trustAnchors, _, _ := getTrustAnchorsAndCertChain(context.TODO(), kubeClient, "dapr-system", 0, time.Millisecond)
+		assert.Empty(t, trustAnchors)
+		assert.Equal(t, 1, *calls)
+	})
+}
+
+func TestClusterDomain(t *testing.T) {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "pod",
+			Annotations: map[string]string{
+				daprEnabledKey: "true",
+				appIDKey:       "app",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}},
+		},
+	}
+
+	i := &injector{config: Config{ClusterDomain: "cluster.internal"}}
+	patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+	assert.NoError(t, err)
+
+	args := strings.Join(patchOps[0].Value.(*corev1.Container).Args, " ")
+	assert.Contains(t, args, "--control-plane-address dapr-api.dapr-system.svc.cluster.internal:80")
+	assert.Contains(t, args, "--sentry-address dapr-sentry.dapr-system.svc.cluster.internal:80")
+	assert.Contains(t, args, "--placement-host-address dapr-placement-server.dapr-system.svc.cluster.internal:50005")
+}
+
+func TestMTLSEnabledEnvVar(t *testing.T) {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "pod",
+			Annotations: map[string]string{
+				daprEnabledKey: "true",
+				appIDKey:       "app",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}},
+		},
+	}
+	i := &injector{}
+
+	t.Run("mTLS enabled", func(t *testing.T) {
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(true))
+		assert.NoError(t, err)
+		assert.Contains(t, getTestEnvPatchValues(patchOps), corev1.EnvVar{Name: userContainerDaprMTLSEnabled, Value: "true"})
+		assert.NotContains(t, getTestEnvPatchValues(patchOps), corev1.EnvVar{Name: userContainerDaprMTLSEnabled, Value: "false"})
+	})
+
+	t.Run("mTLS disabled", func(t *testing.T) {
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.Contains(t, getTestEnvPatchValues(patchOps), corev1.EnvVar{Name: userContainerDaprMTLSEnabled, Value: "false"})
+		assert.NotContains(t, getTestEnvPatchValues(patchOps), corev1.EnvVar{Name: userContainerDaprMTLSEnabled, Value: "true"})
+	})
+}
+
+func TestAppTLSClientCert(t *testing.T) {
+	annotations := map[string]string{
+		daprAppSSLKey:                 "true",
+		daprAppTLSClientCertSecretKey: "app-client-cert",
+	}
+
+	t.Run("volume", func(t *testing.T) {
+		volumes := getSidecarVolumes(annotations)
+		assert.Contains(t, volumes, corev1.Volume{
+			Name: appTLSClientCertVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: "app-client-cert",
+					Items: []corev1.KeyToPath{
+						{Key: "tls.crt", Path: "tls.crt"},
+						{Key: "tls.key", Path: "tls.key"},
+					},
+				},
+			},
+		})
+	})
+
+	t.Run("mount and flags", func(t *testing.T) {
+		c, err := getSidecarContainer(annotations, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.Contains(t, c.VolumeMounts, corev1.VolumeMount{Name: appTLSClientCertVolumeName, MountPath: appTLSClientCertMountPath, ReadOnly: true})
+		args := strings.Join(c.Args, " ")
+		assert.Contains(t, args, "--app-ssl")
+		assert.Contains(t, args, "--app-tls-client-cert-file /var/run/secrets/dapr.io/app-tls-client-cert/tls.crt")
+		assert.Contains(t, args, "--app-tls-client-key-file /var/run/secrets/dapr.io/app-tls-client-cert/tls.key")
+	})
+
+	t.Run("requires app ssl", func(t *testing.T) {
+		_, err := getSidecarContainer(map[string]string{daprAppTLSClientCertSecretKey: "app-client-cert"}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("no client cert by default", func(t *testing.T) {
+		c, err := getSidecarContainer(map[string]string{daprAppSSLKey: "true"}, "app", "image", "Always", "ns", "a", "b", nil, "", "", "", "", false, "")
+		assert.NoError(t, err)
+		assert.NotContains(t, c.Args, "--app-tls-client-cert-file")
+		assert.Empty(t, getSidecarVolumes(map[string]string{daprAppSSLKey: "true"}))
+	})
+}
+
+func TestDNSNdots(t *testing.T) {
+	ndots := func(s string) *string {
+		return &s
+	}
+
+	t.Run("annotation", func(t *testing.T) {
+		value, err := getDNSNdots(map[string]string{daprDNSNdotsKey: "2"})
+		assert.NoError(t, err)
+		assert.Equal(t, "2", value)
+
+		value, err = getDNSNdots(map[string]string{})
+		assert.NoError(t, err)
+		assert.Empty(t, value)
+
+		for _, invalid := range []string{"-1", "16", "two"} {
+			_, err = getDNSNdots(map[string]string{daprDNSNdotsKey: invalid})
+			assert.Error(t, err, invalid)
+		}
+	})
+
+	t.Run("pod without dns config", func(t *testing.T) {
+		patchOps := getDNSNdotsPatchOperations(nil, "2")
+		assert.Equal(t, []PatchOperation{{
+			Op:    "add",
+			Path:  dnsConfigPath,
+			Value: corev1.PodDNSConfig{Options: []corev1.PodDNSConfigOption{{Name: "ndots", Value: ndots("2")}}},
+		}}, patchOps)
+	})
+
+	t.Run("dns config without options", func(t *testing.T) {
+		patchOps := getDNSNdotsPatchOperations(&corev1.PodDNSConfig{Nameservers: []string{"1.1.1.1"}}, "2")
+		assert.Equal(t, []PatchOperation{{
+			Op:    "add",
+			Path:  "/spec/dnsConfig/options",
+			Value: []corev1.PodDNSConfigOption{{Name: "ndots", Value: ndots("2")}},
+		}}, patchOps)
+	})
+
+	t.Run("dns config with other options", func(t *testing.T) {
+		patchOps := getDNSNdotsPatchOperations(&corev1.PodDNSConfig{Options: []corev1.PodDNSConfigOption{{Name: "edns0"}}}, "2")
+		assert.Equal(t, []PatchOperation{{
+			Op:    "add",
+			Path:  "/spec/dnsConfig/options/-",
+			Value: corev1.PodDNSConfigOption{Name: "ndots", Value: ndots("2")},
+		}}, patchOps)
+	})
+
+	t.Run("dns config with ndots", func(t *testing.T) {
+		patchOps := getDNSNdotsPatchOperations(&corev1.PodDNSConfig{Options: []corev1.PodDNSConfigOption{{Name: "edns0"}, {Name: "ndots", Value: ndots("5")}}}, "2")
+		assert.Equal(t, []PatchOperation{{
+			Op:    "replace",
+			Path:  "/spec/dnsConfig/options/1",
+			Value: corev1.PodDNSConfigOption{Name: "ndots", Value: ndots("2")},
+		}}, patchOps)
+	})
+
+	t.Run("pod patch", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					daprEnabledKey:  "true",
+					appIDKey:        "app",
+					daprDNSNdotsKey: "1",
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+		}
+		i := &injector{}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.Contains(t, patchOps, PatchOperation{
+			Op:    "add",
+			Path:  dnsConfigPath,
+			Value: corev1.PodDNSConfig{Options: []corev1.PodDNSConfigOption{{Name: "ndots", Value: ndots("1")}}},
+		})
+
+		pod.Annotations[daprDNSNdotsKey] = "20"
+		_, _, err = i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.Error(t, err)
+	})
+}
+
+func TestSidecarVersionAnnotation(t *testing.T) {
+	testCases := []struct {
+		image   string
+		version string
+	}{
+		{"daprio/daprd:1.0.0", "1.0.0"},
+		{"docker.io/daprio/daprd:1.1.0-rc.1", "1.1.0-rc.1"},
+		{"localhost:5000/daprd:edge", "edge"},
+		{"localhost:5000/daprd", "latest"},
+		{"daprd", "latest"},
+		{"daprio/daprd:1.0.0@sha256:abcdef", "1.0.0"},
+		{"daprio/daprd@sha256:abcdef", ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.image, func(t *testing.T) {
+			assert.Equal(t, tc.version, getSidecarVersion(tc.image))
+		})
+	}
+
+	t.Run("pod patch", func(t *testing.T) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					daprEnabledKey: "true",
+					appIDKey:       "app",
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+		}
+		i := &injector{}
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprio/daprd:1.2.3", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.Contains(t, patchOps, PatchOperation{Op: "add", Path: "/metadata/annotations/dapr.io~1sidecar-version", Value: "1.2.3"})
+
+		pod.Annotations[daprSidecarImageKey] = "daprio/daprd:1.3.0"
+		patchOps, _, err = i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprio/daprd:1.2.3", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		assert.Contains(t, patchOps, PatchOperation{Op: "add", Path: "/metadata/annotations/dapr.io~1sidecar-version", Value: "1.3.0"})
+	})
+}
+
+func TestNamespacedAppID(t *testing.T) {
+	getPod := func(appID string) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					daprEnabledKey:          "true",
+					appIDKey:                appID,
+					daprAppIDNamespacingKey: "suffix",
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+		}
+	}
+	i := &injector{}
+
+	t.Run("sidecar uses the namespaced app id", func(t *testing.T) {
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, getPod("app")), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		args := patchOps[0].Value.(*corev1.Container).Args
+		for i, arg := range args {
+			if arg == "--app-id" {
+				assert.Equal(t, "app-ns", args[i+1])
+			}
+		}
+		assert.Contains(t, args, "app-ns")
+	})
+
+	t.Run("namespaced app id is validated", func(t *testing.T) {
+		_, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, getPod(strings.Repeat("a", 62))), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.Error(t, err)
+	})
+
+	t.Run("operator creates the service of the namespaced app id", func(t *testing.T) {
+		pod := getPod("app")
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "ns"},
+			Spec: appsv1.DeploymentSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "app"}},
+				Template: corev1.PodTemplateSpec{ObjectMeta: pod.ObjectMeta, Spec: pod.Spec},
+			},
+		}
+		h := &handlers.DaprHandler{
+			Client: ctrlfake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(deployment).Build(),
+			Scheme: clientgoscheme.Scheme,
+		}
+		_, err := h.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "app"}})
+		assert.NoError(t, err)
+
+		patchOps, _, err := i.getPodPatchOperations(getTestAdmissionReview(t, pod), "dapr-system", "daprd", "Always", fake.NewSimpleClientset(), getTestDaprClient(false))
+		assert.NoError(t, err)
+		args := patchOps[0].Value.(*corev1.Container).Args
+		appID := ""
+		for i, arg := range args {
+			if arg == "--app-id" {
+				appID = args[i+1]
+			}
+		}
+
+		// Name resolution looks up the <app-id>-dapr Service of the app ID daprd runs with.
+		var svc corev1.Service
+		assert.NoError(t, h.Get(context.TODO(), types.NamespacedName{Namespace: "ns", Name: appID + "-dapr"}, &svc))
+		assert.Equal(t, appID, svc.Annotations[appIDKey])
+	})
+}
@@ -0,0 +1,270 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation and Dapr Contributors.
+// Licensed under the MIT License.
+// ------------------------------------------------------------
+
+package injector
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SidecarOptions represents the sidecar settings resolved from the annotations of a pod.
+type SidecarOptions struct {
+	// Image and ImagePullPolicy are resolved by the injector rather than from the annotations
+	// alone, and are only set in the effective config.
+	Image                    string                          `json:"image,omitempty"`
+	ImagePullPolicy          corev1.PullPolicy               `json:"imagePullPolicy,omitempty"`
+	AppPort                  int32                           `json:"appPort"`
+	AppProtocol              string                          `json:"appProtocol"`
+	AppSSL                   bool                            `json:"appSSL"`
+	AppTLSClientCertSecret   string                          `json:"appTLSClientCertSecret,omitempty"`
+	AppMaxConcurrency        int32                           `json:"appMaxConcurrency"`
+	Config                   string                          `json:"config"`
+	LogLevel                 string                          `json:"logLevel"`
+	LogAsJSON                bool                            `json:"logAsJSON"`
+	ProfilingEnabled         bool                            `json:"profilingEnabled"`
+	MaxRequestBodySize       int32                           `json:"maxRequestBodySize"`
+	HTTPPort                 int32                           `json:"httpPort"`
+	APIGRPCPort              int32                           `json:"apiGRPCPort"`
+	InternalGRPCPort         int32                           `json:"internalGRPCPort"`
+	MetricsPort              int32                           `json:"metricsPort"`
+	MetricsListenAddress     string                          `json:"metricsListenAddress,omitempty"`
+	APITokenSecret           string                          `json:"apiTokenSecret,omitempty"`
+	AppTokenSecret           string                          `json:"appTokenSecret,omitempty"`
+	AppTokenEnvName          string                          `json:"appTokenEnvName"`
+	AppTokenMount            bool                            `json:"appTokenMount"`
+	OtelEndpoint             string                          `json:"otelEndpoint,omitempty"`
+	OtelProtocol             string                          `json:"otelProtocol,omitempty"`
+	TerminationMessagePolicy corev1.TerminationMessagePolicy `json:"terminationMessagePolicy"`
+	AllowPrivilegeEscalation bool                            `json:"allowPrivilegeEscalation"`
+	ReadOnlyRootFilesystem   bool                            `json:"readOnlyRootFilesystem"`
+	RunAsNonRoot             bool                            `json:"runAsNonRoot"`
+	RunAsUser                *int64                          `json:"runAsUser,omitempty"`
+	DropCapabilities         []corev1.Capability             `json:"dropCapabilities,omitempty"`
+	AddCapabilities          []corev1.Capability             `json:"addCapabilities,omitempty"`
+	SeccompProfile           *corev1.SeccompProfile          `json:"seccompProfile,omitempty"`
+	HealthzIncludeAppID      bool                            `json:"healthzIncludeAppID"`
+	LivenessProbe            ProbeOptions                    `json:"livenessProbe"`
+	ReadinessProbe           ProbeOptions                    `json:"readinessProbe"`
+	StartupProbe             *ProbeOptions                   `json:"startupProbe,omitempty"`
+	Native                   bool                            `json:"native"`
+	DisableLivenessProbe     bool                            `json:"disableLivenessProbe"`
+	Resources                *corev1.ResourceRequirements    `json:"resources,omitempty"`
+	BaseContainer            *corev1.Container               `json:"baseContainer,omitempty"`
+	InjectMetricsProxy       bool                            `json:"injectMetricsProxy"`
+	GracefulShutdownSeconds  int32                           `json:"gracefulShutdownSeconds"`
+	CABundleConfigMap        string                          `json:"caBundleConfigMap,omitempty"`
+	CABundleMountPath        string                          `json:"caBundleMountPath"`
+	CABundleKey              string                          `json:"caBundleKey"`
+	AppHealthCheckPath       string                          `json:"appHealthCheckPath,omitempty"`
+	ExtraArgs                []string                        `json:"extraArgs,omitempty"`
+	HealthzPathPrefix        string                          `json:"healthzPathPrefix,omitempty"`
+	HealthzPath              string                          `json:"healthzPath,omitempty"`
+	LivenessOnlyHealthz      bool                            `json:"livenessOnlyHealthz"`
+	ReadinessComponents      bool                            `json:"readinessComponents"`
+	ProbePort                int32                           `json:"probePort"`
+	ProbeType                string                          `json:"probeType"`
+	ComponentCache           bool                            `json:"componentCache"`
+	ComponentCachePath       string                          `json:"componentCachePath"`
+	EnvFromAnnotations       []corev1.EnvVar                 `json:"envFromAnnotations,omitempty"`
+}
+
+// ProbeOptions represents the settings of a sidecar probe.
+type ProbeOptions struct {
+	Scheme              corev1.URIScheme `json:"scheme,omitempty"`
+	InitialDelaySeconds int32            `json:"initialDelaySeconds"`
+	TimeoutSeconds      int32            `json:"timeoutSeconds"`
+	PeriodSeconds       int32            `json:"periodSeconds"`
+	FailureThreshold    int32            `json:"failureThreshold"`
+}
+
+// ParseSidecarOptions resolves the sidecar settings from the given pod annotations,
+// applying defaults for the settings that aren't annotated.
+func ParseSidecarOptions(annotations map[string]string) (SidecarOptions, error) {
+	for _, key := range probeTimingAnnotations {
+		if err := validateProbeTiming(annotations, key); err != nil {
+			return SidecarOptions{}, err
+		}
+	}
+
+	var err error
+	opts := SidecarOptions{
+		AppSSL:              appSSLEnabled(annotations),
+		Config:              getConfig(annotations),
+		LogLevel:            getLogLevel(annotations),
+		LogAsJSON:           logAsJSONEnabled(annotations),
+		ProfilingEnabled:    profilingEnabled(annotations),
+		HTTPPort:            getSideCarHTTPPort(annotations),
+		APIGRPCPort:         getSideCarAPIGRPCPort(annotations),
+		InternalGRPCPort:    getSideCarInternalGRPCPort(annotations),
+		MetricsPort:         int32(getMetricsPort(annotations)),
+		APITokenSecret:      getAPITokenSecret(annotations),
+		AppTokenSecret:      GetAppTokenSecret(annotations),
+		AppTokenEnvName:     getAppTokenEnvName(annotations),
+		AppTokenMount:       appTokenMountEnabled(annotations),
+		HealthzIncludeAppID: getBoolAnnotationOrDefault(annotations, daprHealthzIncludeAppIDKey, false),
+		InjectMetricsProxy:  metricsProxyEnabled(annotations),
+		CABundleConfigMap:   getCABundleConfigMap(annotations),
+		CABundleKey:         getCABundleKey(annotations),
+		AppHealthCheckPath:  getAppHealthCheckPath(annotations),
+		HealthzPathPrefix:   getHealthzPathPrefix(annotations),
+		ComponentCache:      componentCacheEnabled(annotations),
+		LivenessProbe: ProbeOptions{
+			InitialDelaySeconds: getInt32AnnotationOrDefault(annotations, daprLivenessProbeDelayKey, defaultHealthzProbeDelaySeconds),
+			TimeoutSeconds:      getInt32AnnotationOrDefault(annotations, daprLivenessProbeTimeoutKey, defaultHealthzProbeTimeoutSeconds),
+			PeriodSeconds:       getInt32AnnotationOrDefault(annotations, daprLivenessProbePeriodKey, defaultHealthzProbePeriodSeconds),
+			FailureThreshold:    getInt32AnnotationOrDefault(annotations, daprLivenessProbeThresholdKey, defaultHealthzProbeThreshold),
+		},
+		ReadinessProbe: ProbeOptions{
+			InitialDelaySeconds: getInt32AnnotationOrDefault(annotations, daprReadinessProbeDelayKey, defaultHealthzProbeDelaySeconds),
+			TimeoutSeconds:      getInt32AnnotationOrDefault(annotations, daprReadinessProbeTimeoutKey, defaultHealthzProbeTimeoutSeconds),
+			PeriodSeconds:       getInt32AnnotationOrDefault(annotations, daprReadinessProbePeriodKey, defaultHealthzProbePeriodSeconds),
+			FailureThreshold:    getInt32AnnotationOrDefault(annotations, daprReadinessProbeThresholdKey, defaultHealthzProbeThreshold),
+		},
+		StartupProbe:             getStartupProbeOptions(annotations),
+		Native:                   sidecarNativeEnabled(annotations),
+		DisableLivenessProbe:     getBoolAnnotationOrDefault(annotations, daprDisableLivenessProbeKey, false),
+		AllowPrivilegeEscalation: getBoolAnnotationOrDefault(annotations, daprAllowPrivilegeEscalationKey, false),
+		ReadOnlyRootFilesystem:   readOnlyRootFilesystemEnabled(annotations),
+		RunAsNonRoot:             runAsNonRootEnabled(annotations),
+	}
+
+	if opts.Native {
+		opts.StartupProbe = getNativeStartupProbeOptions(annotations)
+	}
+
+	opts.AppPort, err = getAppPort(annotations)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.AppProtocol, err = getAppProtocol(annotations, opts.AppPort)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.AppMaxConcurrency, err = getMaxConcurrency(annotations)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.ExtraArgs, err = getSidecarExtraArgs(annotations)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.MaxRequestBodySize, err = getMaxRequestBodySize(annotations)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.OtelEndpoint, err = getOtelEndpoint(annotations)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.OtelProtocol, err = getOtelProtocol(annotations)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.TerminationMessagePolicy, err = getTerminationMessagePolicy(annotations)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.LivenessProbe.Scheme, err = getProbeScheme(annotations, daprLivenessProbeSchemeKey)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.ReadinessProbe.Scheme, err = getProbeScheme(annotations, daprReadinessProbeSchemeKey)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.LivenessProbe.FailureThreshold, err = getLivenessFailureThreshold(annotations, opts.LivenessProbe)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.Resources, err = getResourceRequirements(annotations)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.ProbePort, err = getProbePort(annotations, opts.HTTPPort)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.HealthzPath, err = getHealthzPath(annotations)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+	opts.LivenessOnlyHealthz = getBoolAnnotationOrDefault(annotations, daprLivenessOnlyHealthzKey, false)
+	opts.ReadinessComponents = getBoolAnnotationOrDefault(annotations, daprReadinessComponentsKey, false)
+
+	opts.ProbeType, err = getProbeType(annotations)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.MetricsListenAddress, err = getMetricsListenAddress(annotations)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.GracefulShutdownSeconds, err = getGracefulShutdownSeconds(annotations)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.CABundleMountPath, err = getCABundleMountPath(annotations)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.AppTLSClientCertSecret, err = getAppTLSClientCertSecret(annotations)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.ComponentCachePath, err = getComponentCachePath(annotations)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.RunAsUser, err = getRunAsUser(annotations)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.DropCapabilities, err = getCapabilities(annotations, daprDropCapabilitiesKey)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.AddCapabilities, err = getCapabilities(annotations, daprAddCapabilitiesKey)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.SeccompProfile, err = getSeccompProfile(annotations)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.EnvFromAnnotations, err = getEnvFromAnnotations(annotations)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	opts.BaseContainer, err = getSidecarBaseContainer(annotations)
+	if err != nil {
+		return SidecarOptions{}, err
+	}
+
+	return opts, nil
+}
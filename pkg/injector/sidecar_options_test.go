@@ -0,0 +1,140 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation and Dapr Contributors.
+// Licensed under the MIT License.
+// ------------------------------------------------------------
+
+package injector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestParseSidecarOptions(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		opts, err := ParseSidecarOptions(map[string]string{})
+		assert.NoError(t, err)
+		assert.Equal(t, int32(-1), opts.AppPort)
+		assert.Equal(t, "http", opts.AppProtocol)
+		assert.Equal(t, defaultLogLevel, opts.LogLevel)
+		assert.Equal(t, int32(defaultSidecarHTTPPort), opts.HTTPPort)
+		assert.Equal(t, int32(defaultSidecarAPIGRPCPort), opts.APIGRPCPort)
+		assert.Equal(t, int32(defaultSidecarInternalGRPCPortKey), opts.InternalGRPCPort)
+		assert.Equal(t, int32(defaultMetricsPort), opts.MetricsPort)
+		assert.Equal(t, "APP_API_TOKEN", opts.AppTokenEnvName)
+		assert.Equal(t, corev1.TerminationMessageFallbackToLogsOnError, opts.TerminationMessagePolicy)
+		assert.Equal(t, "http", opts.ProbeType)
+		assert.Equal(t, ProbeOptions{
+			InitialDelaySeconds: defaultHealthzProbeDelaySeconds,
+			TimeoutSeconds:      defaultHealthzProbeTimeoutSeconds,
+			PeriodSeconds:       defaultHealthzProbePeriodSeconds,
+			FailureThreshold:    defaultHealthzProbeThreshold,
+		}, opts.LivenessProbe)
+		assert.Nil(t, opts.Resources)
+		assert.Nil(t, opts.BaseContainer)
+	})
+
+	t.Run("fully annotated pod", func(t *testing.T) {
+		annotations := map[string]string{
+			daprAppPortKey:                  "5000",
+			daprAppProtocolKey:              "grpc",
+			daprAppSSLKey:                   "true",
+			daprAppMaxConcurrencyKey:        "10",
+			daprConfigKey:                   "config",
+			daprLogLevel:                    "debug",
+			daprLogAsJSON:                   "true",
+			daprEnableProfilingKey:          "true",
+			daprMaxRequestBodySize:          "8",
+			sidecarHTTPPortKey:              "3600",
+			sidecarAPIGRPCPortKey:           "50011",
+			sidecarInternalGRPCPortKey:      "50012",
+			daprMetricsPortKey:              "9095",
+			daprAPITokenSecret:              "secret",
+			daprAppTokenSecret:              "appsecret",
+			daprAppTokenEnvNameKey:          "MY_APP_TOKEN",
+			daprOtelEndpointKey:             "http://otel:4317",
+			daprOtelProtocolKey:             "grpc",
+			daprTerminationMessagePolicyKey: "File",
+			daprAllowPrivilegeEscalationKey: "true",
+			daprHealthzIncludeAppIDKey:      "true",
+			daprInjectMetricsProxyKey:       "true",
+			daprLivenessProbeDelayKey:       "10",
+			daprLivenessProbeTimeoutKey:     "11",
+			daprLivenessProbePeriodKey:      "12",
+			daprLivenessProbeThresholdKey:   "13",
+			daprLivenessProbeSchemeKey:      "https",
+			daprReadinessProbeDelayKey:      "20",
+			daprReadinessProbeTimeoutKey:    "21",
+			daprReadinessProbePeriodKey:     "22",
+			daprReadinessProbeThresholdKey:  "23",
+			daprCPULimitKey:                 "100m",
+			daprMemoryRequestKey:            "64Mi",
+			daprSidecarBaseContainerKey:     `{"workingDir": "/work"}`,
+		}
+
+		opts, err := ParseSidecarOptions(annotations)
+		assert.NoError(t, err)
+		assert.Equal(t, int32(5000), opts.AppPort)
+		assert.Equal(t, "grpc", opts.AppProtocol)
+		assert.True(t, opts.AppSSL)
+		assert.Equal(t, int32(10), opts.AppMaxConcurrency)
+		assert.Equal(t, "config", opts.Config)
+		assert.Equal(t, "debug", opts.LogLevel)
+		assert.True(t, opts.LogAsJSON)
+		assert.True(t, opts.ProfilingEnabled)
+		assert.Equal(t, int32(8), opts.MaxRequestBodySize)
+		assert.Equal(t, int32(3600), opts.HTTPPort)
+		assert.Equal(t, int32(50011), opts.APIGRPCPort)
+		assert.Equal(t, int32(50012), opts.InternalGRPCPort)
+		assert.Equal(t, int32(9095), opts.MetricsPort)
+		assert.Equal(t, "secret", opts.APITokenSecret)
+		assert.Equal(t, "appsecret", opts.AppTokenSecret)
+		assert.Equal(t, "MY_APP_TOKEN", opts.AppTokenEnvName)
+		assert.Equal(t, "http://otel:4317", opts.OtelEndpoint)
+		assert.Equal(t, "grpc", opts.OtelProtocol)
+		assert.Equal(t, corev1.TerminationMessageReadFile, opts.TerminationMessagePolicy)
+		assert.True(t, opts.AllowPrivilegeEscalation)
+		assert.True(t, opts.HealthzIncludeAppID)
+		assert.True(t, opts.InjectMetricsProxy)
+		assert.Equal(t, ProbeOptions{
+			Scheme:              corev1.URISchemeHTTPS,
+			InitialDelaySeconds: 10,
+			TimeoutSeconds:      11,
+			PeriodSeconds:       12,
+			FailureThreshold:    13,
+		}, opts.LivenessProbe)
+		assert.Equal(t, ProbeOptions{
+			InitialDelaySeconds: 20,
+			TimeoutSeconds:      21,
+			PeriodSeconds:       22,
+			FailureThreshold:    23,
+		}, opts.ReadinessProbe)
+		assert.Equal(t, "100m", opts.Resources.Limits.Cpu().String())
+		assert.Equal(t, "64Mi", opts.Resources.Requests.Memory().String())
+		assert.Equal(t, "/work", opts.BaseContainer.WorkingDir)
+	})
+
+	t.Run("invalid annotation", func(t *testing.T) {
+		_, err := ParseSidecarOptions(map[string]string{daprAppPortKey: "abc"})
+		assert.Error(t, err)
+	})
+
+	t.Run("negative probe timing", func(t *testing.T) {
+		for _, key := range []string{daprLivenessProbeDelayKey, daprReadinessProbePeriodKey, daprStartupProbeThresholdKey} {
+			_, err := ParseSidecarOptions(map[string]string{key: "-1"})
+			assert.Error(t, err, key)
+		}
+	})
+
+	t.Run("invalid max concurrency", func(t *testing.T) {
+		_, err := ParseSidecarOptions(map[string]string{daprAppMaxConcurrencyKey: "invalid"})
+		assert.Error(t, err)
+	})
+
+	t.Run("oversized max request size", func(t *testing.T) {
+		_, err := ParseSidecarOptions(map[string]string{daprMaxRequestBodySize: "3000000000"})
+		assert.Error(t, err)
+	})
+}
@@ -63,5 +63,11 @@ const (
 	ErrMetadataGet = "failed deserializing metadata: %s"
 
 	// Healthz
-	ErrHealthNotReady = "dapr is not ready"
+	ErrHealthNotReady           = "dapr is not ready"
+	ErrHealthComponentsNotReady = "dapr components are not loaded"
+	ErrHealthDrainSeconds       = "invalid drain seconds: %s"
+	ErrHealthDraining           = "dapr is draining"
+
+	// Drain
+	ErrDrainForbidden = "drain is only allowed from the dapr container"
 )
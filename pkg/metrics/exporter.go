@@ -1,8 +1,9 @@
 package metrics
 
 import (
-	"fmt"
+	"net"
 	"net/http"
+	"strconv"
 
 	ocprom "contrib.go.opencensus.io/exporter/prometheus"
 	"github.com/dapr/dapr/pkg/logger"
@@ -91,7 +92,7 @@ func (m *promMetricsExporter) startMetricServer() error {
 		return nil
 	}
 
-	addr := fmt.Sprintf(":%d", m.options.MetricsPort())
+	addr := net.JoinHostPort(m.options.MetricsListenAddress(), strconv.FormatUint(m.options.MetricsPort(), 10))
 
 	if m.ocExporter == nil {
 		return errors.New("exporter was not initialized")
@@ -19,7 +19,8 @@ type Options struct {
 	// OutputLevel is the level of logging
 	MetricsEnabled bool
 
-	metricsPort string
+	metricsPort          string
+	metricsListenAddress string
 }
 
 func defaultMetricOptions() *Options {
@@ -40,6 +41,12 @@ func (o *Options) MetricsPort() uint64 {
 	return port
 }
 
+// MetricsListenAddress gets the address the metrics server binds to. An empty address binds
+// to all interfaces. It is only set through the flags attached by AttachCmdFlag.
+func (o *Options) MetricsListenAddress() string {
+	return o.metricsListenAddress
+}
+
 // AttachCmdFlags attaches metrics options to command flags
 func (o *Options) AttachCmdFlags(
 	stringVar func(p *string, name string, value string, usage string),
@@ -56,7 +63,7 @@ func (o *Options) AttachCmdFlags(
 		"Enable prometheus metric")
 }
 
-// AttachCmdFlag attaches single metrics option to command flags
+// AttachCmdFlag attaches the metrics port and listen address options of daprd to command flags
 func (o *Options) AttachCmdFlag(
 	stringVar func(p *string, name string, value string, usage string)) {
 	stringVar(
@@ -64,4 +71,9 @@ func (o *Options) AttachCmdFlag(
 		"metrics-port",
 		defaultMetricsPort,
 		"The port for the metrics server")
+	stringVar(
+		&o.metricsListenAddress,
+		"metrics-listen-address",
+		"",
+		"The address for the metrics server to listen on. Listens on all interfaces if empty")
 }
@@ -43,6 +43,22 @@ func TestOptions(t *testing.T) {
 		assert.True(t, metricsEnabledAsserted)
 	})
 
+	t.Run("metrics listen address cmd flag is only attached for daprd", func(t *testing.T) {
+		o := defaultMetricOptions()
+
+		listenAddressAttached := false
+		testStringVarFn := func(p *string, name string, value string, usage string) {
+			if name == "metrics-listen-address" {
+				listenAddressAttached = true
+			}
+		}
+
+		o.AttachCmdFlags(testStringVarFn, func(p *bool, name string, value bool, usage string) {})
+
+		// assert
+		assert.False(t, listenAddressAttached)
+	})
+
 	t.Run("parse valid port", func(t *testing.T) {
 		o := Options{
 			metricsPort:    "1010",
@@ -78,4 +94,22 @@ func TestOptions(t *testing.T) {
 		// assert
 		assert.True(t, metricsPortAsserted)
 	})
+
+	t.Run("attaching metrics listen address cmd flag", func(t *testing.T) {
+		o := defaultMetricOptions()
+
+		listenAddressAsserted := false
+		testStringVarFn := func(p *string, name string, value string, usage string) {
+			if name == "metrics-listen-address" && value == "" {
+				listenAddressAsserted = true
+				*p = "127.0.0.1"
+			}
+		}
+
+		o.AttachCmdFlag(testStringVarFn)
+
+		// assert
+		assert.True(t, listenAddressAsserted)
+		assert.Equal(t, "127.0.0.1", o.MetricsListenAddress())
+	})
 }
@@ -10,6 +10,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"time"
 
 	componentsapi "github.com/dapr/dapr/pkg/apis/components/v1alpha1"
 	configurationapi "github.com/dapr/dapr/pkg/apis/configuration/v1alpha1"
@@ -19,6 +20,7 @@ import (
 	operatorv1pb "github.com/dapr/dapr/pkg/proto/operator/v1"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -26,6 +28,10 @@ import (
 
 const serverPort = 6500
 
+// keepaliveMinTime is the shortest interval at which clients may send keepalive pings, below the
+// interval used by the operator clients. Clients pinging more often are disconnected.
+const keepaliveMinTime = 5 * time.Second
+
 var log = logger.NewLogger("dapr.operator.api")
 
 // Server runs the Dapr API server for components and configurations
@@ -58,6 +64,10 @@ func (a *apiServer) Run(certChain *dapr_credentials.CertChain) {
 	if err != nil {
 		log.Fatal("error creating gRPC options: %s", err)
 	}
+	opts = append(opts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+		MinTime:             keepaliveMinTime,
+		PermitWithoutStream: true,
+	}))
 	s := grpc.NewServer(opts...)
 	operatorv1pb.RegisterOperatorServer(s, a)
 
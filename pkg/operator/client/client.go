@@ -1,7 +1,12 @@
 package client
 
 import (
+	"context"
 	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
 	"time"
 
 	dapr_credentials "github.com/dapr/dapr/pkg/credentials"
@@ -11,22 +16,415 @@ import (
 	grpc_retry "github.com/grpc-ecosystem/go-grpc-middleware/retry"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
-// GetOperatorClient returns a new k8s operator client and the underlying connection.
+// supportedDialSchemes are the gRPC resolver schemes accepted in an operator address.
+var supportedDialSchemes = map[string]bool{
+	"dns":         true,
+	"passthrough": true,
+	"unix":        true,
+}
+
+// minPerRetryTimeout is the shortest timeout given to a single attempt of a call to the
+// operator. Calls whose deadline is closer than this are not retried.
+const minPerRetryTimeout = 100 * time.Millisecond
+
+// defaultDialTimeout is how long GetOperatorClient blocks dialing the operator before giving up.
+const defaultDialTimeout = 30 * time.Second
+
+// defaultMaxRecvMsgSize is the largest message received from the operator, the gRPC default.
+const defaultMaxRecvMsgSize = 4 * 1024 * 1024
+
+// defaultRetryCodes are the gRPC status codes on which calls to the operator are retried.
+var defaultRetryCodes = []codes.Code{codes.Unavailable, codes.ResourceExhausted}
+
+// defaultKeepaliveParams keep idle connections to the operator alive across NAT and load balancer
+// idle timeouts.
+var defaultKeepaliveParams = keepalive.ClientParameters{
+	Time:                10 * time.Second,
+	Timeout:             5 * time.Second,
+	PermitWithoutStream: true,
+}
+
+// defaultRetryBackoff is the wait between retries of calls to the operator, matching the default
+// of the retry interceptor.
+var defaultRetryBackoff = grpc_retry.BackoffLinearWithJitter(50*time.Millisecond, 0.10)
+
+var (
+	// ErrTLSHandshake classifies a failure to dial the operator caused by the TLS handshake.
+	ErrTLSHandshake = errors.New("tls handshake failed")
+	// ErrResolution classifies a failure to dial the operator caused by resolving its address.
+	ErrResolution = errors.New("address resolution failed")
+	// ErrDialTimeout classifies a failure to dial the operator within the dial timeout.
+	ErrDialTimeout = errors.New("dial timed out")
+)
+
+// DialError is returned when the operator can't be dialed. Its class, one of ErrTLSHandshake,
+// ErrResolution or ErrDialTimeout, can be checked with errors.Is. LastErr is the last connection
+// error seen while dialing.
+type DialError struct {
+	Target  string
+	Class   error
+	LastErr error
+}
+
+func (e *DialError) Error() string {
+	if e.Class == nil {
+		return fmt.Sprintf("failed to dial the operator at %s: %v", e.Target, e.LastErr)
+	}
+	return fmt.Sprintf("failed to dial the operator at %s: %v: %v", e.Target, e.Class, e.LastErr)
+}
+
+// Unwrap returns the last connection error.
+func (e *DialError) Unwrap() error {
+	return e.LastErr
+}
+
+// Is reports whether the dial failure is of the given class.
+func (e *DialError) Is(target error) bool {
+	return e.Class != nil && e.Class == target
+}
+
+// Option configures an operator client.
+type Option func(*clientOptions)
+
+type clientOptions struct {
+	retryCodes      []codes.Code
+	maxRetries      uint
+	perRetryTimeout time.Duration
+	backoff         grpc_retry.BackoffFunc
+	customBackoff   bool
+	dialTimeout     time.Duration
+	monitorAttempts bool
+	keepalive       keepalive.ClientParameters
+	maxRecvMsgSize  int
+	tlsMinVersion   uint16
+}
+
+// WithRetryCodes sets the gRPC status codes on which calls to the operator are retried.
+func WithRetryCodes(retryCodes ...codes.Code) Option {
+	return func(o *clientOptions) {
+		o.retryCodes = retryCodes
+	}
+}
+
+// WithMaxRetries sets the number of times a failed call to the operator is retried.
+func WithMaxRetries(maxRetries uint) Option {
+	return func(o *clientOptions) {
+		o.maxRetries = maxRetries
+	}
+}
+
+// WithPerRetryTimeout sets a fixed timeout for every attempt of a call to the operator. By default,
+// the time left until the deadline of a call is split between its attempts instead.
+func WithPerRetryTimeout(perRetryTimeout time.Duration) Option {
+	return func(o *clientOptions) {
+		o.perRetryTimeout = perRetryTimeout
+	}
+}
+
+// WithBackoff sets the wait between the attempts of a call to the operator.
+func WithBackoff(backoff grpc_retry.BackoffFunc) Option {
+	return func(o *clientOptions) {
+		o.backoff = backoff
+		o.customBackoff = true
+	}
+}
+
+// WithDialTimeout sets how long GetOperatorClient blocks dialing the operator before giving up.
+// It is ignored by GetOperatorClientWithContext, which dials until its context is done. Shared
+// connections are always dialed within the dial timeout.
+func WithDialTimeout(dialTimeout time.Duration) Option {
+	return func(o *clientOptions) {
+		o.dialTimeout = dialTimeout
+	}
+}
+
+// WithKeepaliveParams sets how often the connection to the operator is pinged, how long to wait
+// for a ping to be acknowledged before closing the connection, and whether to ping connections
+// without active calls. The operator doesn't accept pings more often than every 5 seconds.
+func WithKeepaliveParams(params keepalive.ClientParameters) Option {
+	return func(o *clientOptions) {
+		o.keepalive = params
+	}
+}
+
+// WithMaxRecvMsgSize sets the size in bytes of the largest message received from the operator,
+// to be raised when listing or watching many or large components fails with ResourceExhausted.
+func WithMaxRecvMsgSize(maxRecvMsgSize int) Option {
+	return func(o *clientOptions) {
+		o.maxRecvMsgSize = maxRecvMsgSize
+	}
+}
+
+// WithTLSMinVersion sets the minimum TLS version accepted when connecting to the operator with
+// a cert chain, e.g. tls.VersionTLS13 for compliance. By default the Go TLS defaults apply.
+func WithTLSMinVersion(minVersion uint16) Option {
+	return func(o *clientOptions) {
+		o.tlsMinVersion = minVersion
+	}
+}
+
+// WithAttemptMonitoring records gRPC client metrics for every attempt of a call to the operator,
+// including retries, instead of once per call.
+func WithAttemptMonitoring() Option {
+	return func(o *clientOptions) {
+		o.monitorAttempts = true
+	}
+}
+
+func getClientOptions(opts ...Option) *clientOptions {
+	o := &clientOptions{
+		retryCodes:     defaultRetryCodes,
+		backoff:        defaultRetryBackoff,
+		dialTimeout:    defaultDialTimeout,
+		keepalive:      defaultKeepaliveParams,
+		maxRecvMsgSize: defaultMaxRecvMsgSize,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// deadlineAwareRetryInterceptor splits the time left until the deadline of the call
+// context evenly between the attempts, so that retries respect the overall deadline.
+// Calls without a deadline are left untouched and calls whose deadline is near are not
+// retried at all. Call options given by the caller take precedence.
+func deadlineAwareRetryInterceptor(maxRetries uint) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if retryOpt := getDeadlineRetryCallOption(ctx, maxRetries); retryOpt != nil {
+			opts = append([]grpc.CallOption{retryOpt}, opts...)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// getUnaryClientInterceptor chains the retry interceptors with the given monitoring interceptor,
+// if any. Monitoring wraps the retries, so that a retried call is counted once, unless attempt
+// monitoring is enabled.
+func getUnaryClientInterceptor(o *clientOptions, monitoring grpc.UnaryClientInterceptor) grpc.UnaryClientInterceptor {
+	retries := grpc_retry.UnaryClientInterceptor(getRetryCallOptions(o)...)
+	if o.perRetryTimeout == 0 {
+		retries = grpc_middleware.ChainUnaryClient(deadlineAwareRetryInterceptor(o.maxRetries), retries)
+	}
+	if monitoring == nil {
+		return retries
+	}
+	if o.monitorAttempts {
+		return grpc_middleware.ChainUnaryClient(retries, monitoring)
+	}
+	return grpc_middleware.ChainUnaryClient(monitoring, retries)
+}
+
+// getStreamClientInterceptor chains the retry interceptor with the given monitoring interceptor,
+// if any, in the same order as getUnaryClientInterceptor. Only the establishment of a stream is
+// retried, and without the per retry timeout, which would otherwise end long lived watch streams.
+func getStreamClientInterceptor(o *clientOptions, monitoring grpc.StreamClientInterceptor) grpc.StreamClientInterceptor {
+	streamOpts := *o
+	streamOpts.perRetryTimeout = 0
+	retries := grpc_retry.StreamClientInterceptor(getRetryCallOptions(&streamOpts)...)
+	if monitoring == nil {
+		return retries
+	}
+	if o.monitorAttempts {
+		return grpc_middleware.ChainStreamClient(retries, monitoring)
+	}
+	return grpc_middleware.ChainStreamClient(monitoring, retries)
+}
+
+// getRetryCallOptions returns the default call options of the retry interceptor. The retry
+// interceptor counts the first attempt against its maximum, so a call makes up to maxRetries+1
+// attempts.
+func getRetryCallOptions(o *clientOptions) []grpc_retry.CallOption {
+	opts := []grpc_retry.CallOption{
+		grpc_retry.WithCodes(o.retryCodes...),
+		grpc_retry.WithMax(o.maxRetries + 1),
+		grpc_retry.WithBackoff(o.backoff),
+	}
+	if o.perRetryTimeout > 0 {
+		opts = append(opts, grpc_retry.WithPerRetryTimeout(o.perRetryTimeout))
+	}
+	return opts
+}
+
+func getDeadlineRetryCallOption(ctx context.Context, maxRetries uint) grpc.CallOption {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+
+	remaining := time.Until(deadline)
+	if remaining < minPerRetryTimeout {
+		return grpc_retry.Disable()
+	}
+
+	perRetryTimeout := remaining / time.Duration(maxRetries+1)
+	if perRetryTimeout < minPerRetryTimeout {
+		perRetryTimeout = minPerRetryTimeout
+	}
+	return grpc_retry.WithPerRetryTimeout(perRetryTimeout)
+}
+
+// handshakeErrorRecorder keeps the last error of the TLS handshakes made by the wrapped
+// transport credentials, to classify dial failures.
+type handshakeErrorRecorder struct {
+	credentials.TransportCredentials
+
+	lock    sync.Mutex
+	lastErr error
+}
+
+func (r *handshakeErrorRecorder) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, authInfo, err := r.TransportCredentials.ClientHandshake(ctx, authority, rawConn)
+	if err != nil {
+		r.lock.Lock()
+		r.lastErr = err
+		r.lock.Unlock()
+	}
+	return conn, authInfo, err
+}
+
+func (r *handshakeErrorRecorder) getLastErr() error {
+	if r == nil {
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.lastErr
+}
+
+// connErrorRecorder dials the connections of the client, keeping the last connection error to
+// classify dial failures. Connections are dialed with the context given by gRPC, which is done
+// once the context of the caller is.
+type connErrorRecorder struct {
+	lock    sync.Mutex
+	lastErr error
+}
+
+func (r *connErrorRecorder) dial(ctx context.Context, addr string) (net.Conn, error) {
+	network := "tcp"
+	if strings.HasPrefix(addr, "unix:") {
+		network = "unix"
+		addr = strings.TrimPrefix(strings.TrimPrefix(addr, "unix:"), "//")
+	}
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+	if err != nil {
+		r.lock.Lock()
+		r.lastErr = err
+		r.lock.Unlock()
+	}
+	return conn, err
+}
+
+func (r *connErrorRecorder) getLastErr() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.lastErr
+}
+
+// getDialError classifies a failure to dial the given target from the last connection and TLS
+// handshake errors. TLS handshake failures take precedence, followed by hosts that don't exist,
+// then timeouts.
+func getDialError(target string, dialErr, connErr, handshakeErr error) *DialError {
+	if handshakeErr != nil && !isTimeout(handshakeErr) {
+		return &DialError{Target: target, Class: ErrTLSHandshake, LastErr: handshakeErr}
+	}
+	var dnsErr *net.DNSError
+	if errors.As(connErr, &dnsErr) && dnsErr.IsNotFound {
+		return &DialError{Target: target, Class: ErrResolution, LastErr: dnsErr}
+	}
+	if isTimeout(dialErr) || isTimeout(handshakeErr) {
+		lastErr := dialErr
+		if handshakeErr != nil {
+			lastErr = handshakeErr
+		}
+		return &DialError{Target: target, Class: ErrDialTimeout, LastErr: lastErr}
+	}
+	return &DialError{Target: target, LastErr: dialErr}
+}
+
+func isTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// getDialTarget validates the given operator address and returns the gRPC dial target.
+// Addresses without a scheme, such as host:port, are dialed as is. Addresses with a
+// scheme, such as dns:///host:port or passthrough:///host:port, must use a supported scheme.
+func getDialTarget(address string) (string, error) {
+	if address == "" {
+		return "", errors.New("operator address is empty")
+	}
+
+	idx := strings.Index(address, "://")
+	if idx == -1 {
+		return address, nil
+	}
+
+	scheme := address[:idx]
+	if !supportedDialSchemes[scheme] {
+		return "", errors.Errorf("unsupported scheme %q in operator address %s", scheme, address)
+	}
+	if strings.TrimLeft(address[idx+len("://"):], "/") == "" {
+		return "", errors.Errorf("missing endpoint in operator address %s", address)
+	}
+	return address, nil
+}
+
+// GetOperatorClient returns a new k8s operator client and the underlying connection,
+// blocking until the operator is dialed or the dial timeout has passed.
+// New code should use GetOperatorClientWithContext, which can be cancelled.
+func GetOperatorClient(address, serverName string, certChain *dapr_credentials.CertChain, clientOpts ...Option) (operatorv1pb.OperatorClient, *grpc.ClientConn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), getClientOptions(clientOpts...).dialTimeout)
+	defer cancel()
+	return GetOperatorClientWithContext(ctx, address, serverName, certChain, clientOpts...)
+}
+
+// GetOperatorClientWithContext returns a new k8s operator client and the underlying connection,
+// blocking until the operator is dialed or the given context is done.
 // If a cert chain is given, a TLS connection will be established.
-func GetOperatorClient(address, serverName string, certChain *dapr_credentials.CertChain) (operatorv1pb.OperatorClient, *grpc.ClientConn, error) {
-	unaryClientInterceptor := grpc_retry.UnaryClientInterceptor()
+// The address may be prefixed with a resolver scheme, e.g. dns:///dapr-api:80 to use
+// DNS based load balancing, or passthrough:///dapr-api:80 to dial the address as is.
+// By default, calls are retried on Unavailable and ResourceExhausted only, and the
+// time left until the deadline of a call is split between its attempts.
+// When the operator can't be dialed, the returned error is a *DialError classifying the failure.
+func GetOperatorClientWithContext(ctx context.Context, address, serverName string, certChain *dapr_credentials.CertChain, clientOpts ...Option) (operatorv1pb.OperatorClient, *grpc.ClientConn, error) {
+	target, err := getDialTarget(address)
+	if err != nil {
+		return nil, nil, err
+	}
 
+	o := getClientOptions(clientOpts...)
+	var monitoring grpc.UnaryClientInterceptor
+	var streamMonitoring grpc.StreamClientInterceptor
 	if diag.DefaultGRPCMonitoring.IsEnabled() {
-		unaryClientInterceptor = grpc_middleware.ChainUnaryClient(
-			unaryClientInterceptor,
-			diag.DefaultGRPCMonitoring.UnaryClientInterceptor(),
-		)
+		monitoring = diag.DefaultGRPCMonitoring.UnaryClientInterceptor()
+		streamMonitoring = diag.DefaultGRPCMonitoring.StreamClientInterceptor()
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithUnaryInterceptor(getUnaryClientInterceptor(o, monitoring)),
+		grpc.WithStreamInterceptor(getStreamClientInterceptor(o, streamMonitoring)),
+		grpc.WithKeepaliveParams(o.keepalive),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(o.maxRecvMsgSize)),
 	}
 
-	opts := []grpc.DialOption{grpc.WithUnaryInterceptor(unaryClientInterceptor)}
+	connRecorder := &connErrorRecorder{}
+	opts = append(opts, grpc.WithContextDialer(connRecorder.dial))
+
+	var handshakeRecorder *handshakeErrorRecorder
 
 	if certChain != nil {
 		cp := x509.NewCertPool()
@@ -39,17 +437,51 @@ func GetOperatorClient(address, serverName string, certChain *dapr_credentials.C
 		if err != nil {
 			return nil, nil, errors.Wrap(err, "failed to create tls config from cert and key")
 		}
-		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+		if o.tlsMinVersion != 0 {
+			config.MinVersion = o.tlsMinVersion
+		}
+		handshakeRecorder = &handshakeErrorRecorder{TransportCredentials: credentials.NewTLS(config)}
+		opts = append(opts, grpc.WithTransportCredentials(handshakeRecorder))
 	} else {
 		opts = append(opts, grpc.WithInsecure())
 	}
 
 	// block for connection
-	opts = append(opts, grpc.WithBlock(), grpc.WithTimeout(30*time.Second))
+	opts = append(opts, grpc.WithBlock())
 
-	conn, err := grpc.Dial(address, opts...)
+	conn, err := grpc.DialContext(ctx, target, opts...)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, getDialError(target, err, connRecorder.getLastErr(), handshakeRecorder.getLastErr())
 	}
 	return operatorv1pb.NewOperatorClient(conn), conn, nil
 }
+
+// GetOperatorClientFromSecret returns a new k8s operator client and the underlying connection,
+// using the root cert, cert chain and key stored in the given Kubernetes secret to establish
+// a TLS connection.
+func GetOperatorClientFromSecret(kubeClient kubernetes.Interface, namespace, secretName, address, serverName string, clientOpts ...Option) (operatorv1pb.OperatorClient, *grpc.ClientConn, error) {
+	certChain, err := getCertChainFromSecret(kubeClient, namespace, secretName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return GetOperatorClient(address, serverName, certChain, clientOpts...)
+}
+
+func getCertChainFromSecret(kubeClient kubernetes.Interface, namespace, secretName string) (*dapr_credentials.CertChain, error) {
+	secret, err := kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), secretName, meta_v1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get secret %s/%s", namespace, secretName)
+	}
+
+	for _, key := range []string{dapr_credentials.RootCertFilename, dapr_credentials.IssuerCertFilename, dapr_credentials.IssuerKeyFilename} {
+		if len(secret.Data[key]) == 0 {
+			return nil, errors.Errorf("secret %s/%s is missing key %s", namespace, secretName, key)
+		}
+	}
+
+	return &dapr_credentials.CertChain{
+		RootCA: secret.Data[dapr_credentials.RootCertFilename],
+		Cert:   secret.Data[dapr_credentials.IssuerCertFilename],
+		Key:    secret.Data[dapr_credentials.IssuerKeyFilename],
+	}, nil
+}
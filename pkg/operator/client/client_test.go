@@ -0,0 +1,549 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dapr_credentials "github.com/dapr/dapr/pkg/credentials"
+	operatorv1pb "github.com/dapr/dapr/pkg/proto/operator/v1"
+	grpc_retry "github.com/grpc-ecosystem/go-grpc-middleware/retry"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type failingOperatorServer struct {
+	operatorv1pb.UnimplementedOperatorServer
+
+	code  codes.Code
+	block bool
+	calls int32
+	// configuration is returned instead of failing when set.
+	configuration []byte
+}
+
+func (s *failingOperatorServer) ComponentUpdate(_ *emptypb.Empty, _ operatorv1pb.Operator_ComponentUpdateServer) error {
+	atomic.AddInt32(&s.calls, 1)
+	return status.Error(s.code, "failed")
+}
+
+func (s *failingOperatorServer) GetConfiguration(ctx context.Context, _ *operatorv1pb.GetConfigurationRequest) (*operatorv1pb.GetConfigurationResponse, error) {
+	atomic.AddInt32(&s.calls, 1)
+	if s.block {
+		<-ctx.Done()
+	}
+	if s.configuration != nil {
+		return &operatorv1pb.GetConfigurationResponse{Configuration: s.configuration}, nil
+	}
+	return nil, status.Error(s.code, "failed")
+}
+
+func startFailingOperatorServer(t *testing.T, code codes.Code) (string, *failingOperatorServer, func()) {
+	return startOperatorServer(t, &failingOperatorServer{code: code})
+}
+
+func startOperatorServer(t *testing.T, srv *failingOperatorServer) (string, *failingOperatorServer, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	server := grpc.NewServer()
+	operatorv1pb.RegisterOperatorServer(server, srv)
+	go server.Serve(lis)
+	return lis.Addr().String(), srv, server.Stop
+}
+
+func TestGetDialTarget(t *testing.T) {
+	t.Run("address without scheme", func(t *testing.T) {
+		target, err := getDialTarget("dapr-api.dapr-system.svc.cluster.local:80")
+		assert.NoError(t, err)
+		assert.Equal(t, "dapr-api.dapr-system.svc.cluster.local:80", target)
+	})
+
+	t.Run("supported schemes", func(t *testing.T) {
+		for _, address := range []string{"dns:///dapr-api:80", "passthrough:///dapr-api:80", "unix:///tmp/operator.sock"} {
+			target, err := getDialTarget(address)
+			assert.NoError(t, err)
+			assert.Equal(t, address, target)
+		}
+	})
+
+	t.Run("unsupported scheme", func(t *testing.T) {
+		_, err := getDialTarget("xds:///dapr-api:80")
+		assert.Error(t, err)
+	})
+
+	t.Run("missing endpoint", func(t *testing.T) {
+		_, err := getDialTarget("dns:///")
+		assert.Error(t, err)
+	})
+
+	t.Run("empty address", func(t *testing.T) {
+		_, err := getDialTarget("")
+		assert.Error(t, err)
+	})
+}
+
+func TestGetOperatorClientPassthrough(t *testing.T) {
+	address, stop := startTestServer(t)
+	defer stop()
+
+	client, conn, err := GetOperatorClient("passthrough:///"+address, "", nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, client)
+	assert.NoError(t, conn.Close())
+}
+
+func TestGetClientOptions(t *testing.T) {
+	t.Run("default retry codes", func(t *testing.T) {
+		o := getClientOptions()
+		assert.Equal(t, []codes.Code{codes.Unavailable, codes.ResourceExhausted}, o.retryCodes)
+	})
+
+	t.Run("custom retry codes", func(t *testing.T) {
+		o := getClientOptions(WithRetryCodes(codes.Aborted))
+		assert.Equal(t, []codes.Code{codes.Aborted}, o.retryCodes)
+	})
+
+	t.Run("max retries", func(t *testing.T) {
+		assert.Equal(t, uint(0), getClientOptions().maxRetries)
+		assert.Equal(t, uint(3), getClientOptions(WithMaxRetries(3)).maxRetries)
+	})
+
+	t.Run("per retry timeout", func(t *testing.T) {
+		assert.Equal(t, time.Duration(0), getClientOptions().perRetryTimeout)
+		assert.Equal(t, time.Second, getClientOptions(WithPerRetryTimeout(time.Second)).perRetryTimeout)
+	})
+
+	t.Run("backoff", func(t *testing.T) {
+		assert.NotNil(t, getClientOptions().backoff)
+		o := getClientOptions(WithBackoff(grpc_retry.BackoffLinear(time.Second)))
+		assert.Equal(t, time.Second, o.backoff(1))
+	})
+
+	t.Run("keepalive", func(t *testing.T) {
+		assert.Equal(t, keepalive.ClientParameters{Time: 10 * time.Second, Timeout: 5 * time.Second, PermitWithoutStream: true}, getClientOptions().keepalive)
+
+		params := keepalive.ClientParameters{Time: time.Minute, Timeout: 20 * time.Second}
+		assert.Equal(t, params, getClientOptions(WithKeepaliveParams(params)).keepalive)
+	})
+
+	t.Run("max recv msg size", func(t *testing.T) {
+		assert.Equal(t, 4*1024*1024, getClientOptions().maxRecvMsgSize)
+		assert.Equal(t, 16*1024*1024, getClientOptions(WithMaxRecvMsgSize(16*1024*1024)).maxRecvMsgSize)
+	})
+
+	t.Run("retry call options", func(t *testing.T) {
+		assert.Len(t, getRetryCallOptions(getClientOptions()), 3)
+		assert.Len(t, getRetryCallOptions(getClientOptions(WithPerRetryTimeout(time.Second))), 4)
+	})
+}
+
+func TestGetDeadlineRetryCallOption(t *testing.T) {
+	t.Run("no deadline", func(t *testing.T) {
+		assert.Nil(t, getDeadlineRetryCallOption(context.Background(), 3))
+	})
+
+	t.Run("deadline is near", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), minPerRetryTimeout/2)
+		defer cancel()
+		assert.NotNil(t, getDeadlineRetryCallOption(ctx, 3))
+	})
+
+	t.Run("deadline is far", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		assert.NotNil(t, getDeadlineRetryCallOption(ctx, 3))
+	})
+}
+
+func TestGetOperatorClientDeadlineAwareRetries(t *testing.T) {
+	t.Run("retries within the deadline", func(t *testing.T) {
+		address, srv, stop := startFailingOperatorServer(t, codes.Unavailable)
+		defer stop()
+
+		client, conn, err := GetOperatorClient(address, "", nil, WithMaxRetries(3))
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, err = client.GetConfiguration(ctx, &operatorv1pb.GetConfigurationRequest{})
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		assert.Equal(t, int32(4), atomic.LoadInt32(&srv.calls))
+	})
+
+	t.Run("no retries when the deadline is near", func(t *testing.T) {
+		address, srv, stop := startFailingOperatorServer(t, codes.Unavailable)
+		defer stop()
+
+		client, conn, err := GetOperatorClient(address, "", nil, WithMaxRetries(3))
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), minPerRetryTimeout/2)
+		defer cancel()
+		_, err = client.GetConfiguration(ctx, &operatorv1pb.GetConfigurationRequest{})
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&srv.calls))
+	})
+
+	t.Run("slow attempts are retried before the deadline", func(t *testing.T) {
+		address, srv, stop := startOperatorServer(t, &failingOperatorServer{code: codes.Unavailable, block: true})
+		defer stop()
+
+		client, conn, err := GetOperatorClient(address, "", nil, WithMaxRetries(1))
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		start := time.Now()
+		_, err = client.GetConfiguration(ctx, &operatorv1pb.GetConfigurationRequest{})
+		assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+		assert.Equal(t, int32(2), atomic.LoadInt32(&srv.calls))
+		assert.Less(t, int64(time.Since(start)), int64(3*time.Second))
+	})
+}
+
+func TestGetOperatorClientRetryConfiguration(t *testing.T) {
+	t.Run("backoff between attempts", func(t *testing.T) {
+		address, srv, stop := startFailingOperatorServer(t, codes.Unavailable)
+		defer stop()
+
+		client, conn, err := GetOperatorClient(address, "", nil, WithMaxRetries(2), WithBackoff(grpc_retry.BackoffLinear(200*time.Millisecond)))
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		start := time.Now()
+		_, err = client.GetConfiguration(context.Background(), &operatorv1pb.GetConfigurationRequest{})
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		assert.Equal(t, int32(3), atomic.LoadInt32(&srv.calls))
+		assert.GreaterOrEqual(t, int64(time.Since(start)), int64(400*time.Millisecond))
+	})
+
+	t.Run("fixed per retry timeout", func(t *testing.T) {
+		address, srv, stop := startOperatorServer(t, &failingOperatorServer{code: codes.Unavailable, block: true})
+		defer stop()
+
+		client, conn, err := GetOperatorClient(address, "", nil, WithMaxRetries(2), WithPerRetryTimeout(200*time.Millisecond))
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		start := time.Now()
+		_, err = client.GetConfiguration(ctx, &operatorv1pb.GetConfigurationRequest{})
+		assert.Error(t, err)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&srv.calls))
+		assert.Less(t, int64(time.Since(start)), int64(2*time.Second))
+	})
+}
+
+func TestGetOperatorClientRetryCodes(t *testing.T) {
+	testCases := []struct {
+		name          string
+		code          codes.Code
+		opts          []Option
+		expectedCalls int32
+	}{
+		{name: "unavailable is retried by default", code: codes.Unavailable, expectedCalls: 3},
+		{name: "resource exhausted is retried by default", code: codes.ResourceExhausted, expectedCalls: 3},
+		{name: "internal is not retried by default", code: codes.Internal, expectedCalls: 1},
+		{name: "custom retry codes", code: codes.Internal, opts: []Option{WithRetryCodes(codes.Internal)}, expectedCalls: 3},
+		{name: "custom retry codes replace the defaults", code: codes.Unavailable, opts: []Option{WithRetryCodes(codes.Internal)}, expectedCalls: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			address, srv, stop := startFailingOperatorServer(t, tc.code)
+			defer stop()
+
+			client, conn, err := GetOperatorClient(address, "", nil, tc.opts...)
+			assert.NoError(t, err)
+			defer conn.Close()
+
+			_, err = client.GetConfiguration(context.Background(), &operatorv1pb.GetConfigurationRequest{}, grpc_retry.WithMax(3))
+			assert.Equal(t, tc.code, status.Code(err))
+			assert.Equal(t, tc.expectedCalls, atomic.LoadInt32(&srv.calls))
+		})
+	}
+}
+
+func TestGetUnaryClientInterceptorMonitoring(t *testing.T) {
+	testCases := []struct {
+		name          string
+		opts          []Option
+		expectedCalls int32
+	}{
+		{name: "retried call is monitored once", expectedCalls: 1},
+		{name: "attempts are monitored", opts: []Option{WithAttemptMonitoring()}, expectedCalls: 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			address, srv, stop := startFailingOperatorServer(t, codes.Unavailable)
+			defer stop()
+
+			var monitored int32
+			monitoring := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+				atomic.AddInt32(&monitored, 1)
+				return invoker(ctx, method, req, reply, cc, opts...)
+			}
+			interceptor := getUnaryClientInterceptor(getClientOptions(tc.opts...), monitoring)
+			conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithBlock(), grpc.WithUnaryInterceptor(interceptor))
+			assert.NoError(t, err)
+			defer conn.Close()
+
+			client := operatorv1pb.NewOperatorClient(conn)
+			_, err = client.GetConfiguration(context.Background(), &operatorv1pb.GetConfigurationRequest{}, grpc_retry.WithMax(3))
+			assert.Equal(t, codes.Unavailable, status.Code(err))
+			assert.Equal(t, int32(3), atomic.LoadInt32(&srv.calls))
+			assert.Equal(t, tc.expectedCalls, atomic.LoadInt32(&monitored))
+		})
+	}
+}
+
+func TestGetStreamClientInterceptorMonitoring(t *testing.T) {
+	testCases := []struct {
+		name          string
+		opts          []Option
+		expectedCalls int32
+	}{
+		{name: "retried stream is monitored once", expectedCalls: 1},
+		{name: "attempts are monitored", opts: []Option{WithAttemptMonitoring()}, expectedCalls: 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			address, srv, stop := startFailingOperatorServer(t, codes.Unavailable)
+			defer stop()
+
+			var monitored int32
+			monitoring := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+				atomic.AddInt32(&monitored, 1)
+				return streamer(ctx, desc, cc, method, opts...)
+			}
+			interceptor := getStreamClientInterceptor(getClientOptions(tc.opts...), monitoring)
+			conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithBlock(), grpc.WithStreamInterceptor(interceptor))
+			assert.NoError(t, err)
+			defer conn.Close()
+
+			client := operatorv1pb.NewOperatorClient(conn)
+			stream, err := client.ComponentUpdate(context.Background(), &emptypb.Empty{}, grpc_retry.WithMax(3))
+			if err == nil {
+				_, err = stream.Recv()
+			}
+			assert.Equal(t, codes.Unavailable, status.Code(err))
+			assert.Equal(t, int32(3), atomic.LoadInt32(&srv.calls))
+			assert.Equal(t, tc.expectedCalls, atomic.LoadInt32(&monitored))
+		})
+	}
+}
+
+func TestGetOperatorClientMaxRecvMsgSize(t *testing.T) {
+	address, _, stop := startOperatorServer(t, &failingOperatorServer{configuration: make([]byte, 5*1024*1024)})
+	defer stop()
+
+	t.Run("default limit", func(t *testing.T) {
+		client, conn, err := GetOperatorClient(address, "", nil)
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		_, err = client.GetConfiguration(context.Background(), &operatorv1pb.GetConfigurationRequest{})
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	})
+
+	t.Run("raised limit", func(t *testing.T) {
+		client, conn, err := GetOperatorClient(address, "", nil, WithMaxRecvMsgSize(8*1024*1024))
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		resp, err := client.GetConfiguration(context.Background(), &operatorv1pb.GetConfigurationRequest{})
+		assert.NoError(t, err)
+		assert.Len(t, resp.Configuration, 5*1024*1024)
+	})
+}
+
+func TestGetOperatorClientDialErrors(t *testing.T) {
+	t.Run("tls handshake", func(t *testing.T) {
+		address, stop := startTestServer(t)
+		defer stop()
+
+		cert, key := generateTestCert(t)
+		certChain := &dapr_credentials.CertChain{RootCA: cert, Cert: cert, Key: key}
+		_, _, err := GetOperatorClient(address, "localhost", certChain, WithDialTimeout(time.Second))
+		assert.True(t, errors.Is(err, ErrTLSHandshake), err)
+		assert.False(t, errors.Is(err, ErrDialTimeout))
+
+		var dialErr *DialError
+		assert.True(t, errors.As(err, &dialErr))
+		assert.Equal(t, address, dialErr.Target)
+		assert.NotNil(t, dialErr.LastErr)
+	})
+
+	t.Run("resolution", func(t *testing.T) {
+		_, _, err := GetOperatorClient("dapr-operator.invalid:80", "", nil, WithDialTimeout(time.Second))
+		assert.True(t, errors.Is(err, ErrResolution), err)
+
+		var dnsErr *net.DNSError
+		assert.True(t, errors.As(err, &dnsErr))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		// The listener accepts connections but never completes the HTTP/2 handshake.
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer lis.Close()
+		go func() {
+			for {
+				conn, err := lis.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+			}
+		}()
+
+		_, _, err = GetOperatorClient(lis.Addr().String(), "", nil, WithDialTimeout(time.Second))
+		assert.True(t, errors.Is(err, ErrDialTimeout), err)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+}
+
+func TestGetOperatorClientWithContext(t *testing.T) {
+	// The listener accepts connections but never completes the HTTP/2 handshake.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer lis.Close()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	t.Run("dial succeeds", func(t *testing.T) {
+		address, stop := startTestServer(t)
+		defer stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		client, conn, err := GetOperatorClientWithContext(ctx, address, "", nil)
+		assert.NoError(t, err)
+		assert.NotNil(t, client)
+		conn.Close()
+	})
+
+	t.Run("context deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, _, err := GetOperatorClientWithContext(ctx, lis.Addr().String(), "", nil)
+		assert.True(t, errors.Is(err, ErrDialTimeout), err)
+		assert.Less(t, int64(time.Since(start)), int64(5*time.Second))
+	})
+
+	t.Run("context cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+		}()
+		_, _, err := GetOperatorClientWithContext(ctx, lis.Addr().String(), "", nil, WithDialTimeout(time.Minute))
+		assert.True(t, errors.Is(err, context.Canceled), err)
+	})
+}
+
+func TestGetDialError(t *testing.T) {
+	t.Run("tls handshake takes precedence", func(t *testing.T) {
+		err := getDialError("dapr-operator.invalid:80", context.DeadlineExceeded, nil, errors.New("bad certificate"))
+		assert.Equal(t, ErrTLSHandshake, err.Class)
+		assert.EqualError(t, err, "failed to dial the operator at dapr-operator.invalid:80: tls handshake failed: bad certificate")
+	})
+
+	t.Run("handshake timeout", func(t *testing.T) {
+		err := getDialError("127.0.0.1:80", context.DeadlineExceeded, nil, context.DeadlineExceeded)
+		assert.Equal(t, ErrDialTimeout, err.Class)
+	})
+
+	t.Run("unclassified", func(t *testing.T) {
+		err := getDialError("unix:///tmp/operator.sock", errors.New("failed"), nil, nil)
+		assert.Nil(t, err.Class)
+		assert.False(t, errors.Is(err, ErrDialTimeout))
+		assert.EqualError(t, err, "failed to dial the operator at unix:///tmp/operator.sock: failed")
+	})
+
+	t.Run("host not found", func(t *testing.T) {
+		connErr := &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "dapr-operator.invalid", IsNotFound: true}}
+		err := getDialError("dapr-operator.invalid:80", context.DeadlineExceeded, connErr, nil)
+		assert.Equal(t, ErrResolution, err.Class)
+
+		var dnsErr *net.DNSError
+		assert.True(t, errors.As(err, &dnsErr))
+	})
+
+	t.Run("temporary resolution failure", func(t *testing.T) {
+		connErr := &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "server misbehaving", Name: "dapr-operator", IsTemporary: true}}
+		err := getDialError("dapr-operator:80", context.DeadlineExceeded, connErr, nil)
+		assert.Equal(t, ErrDialTimeout, err.Class)
+		assert.False(t, errors.Is(err, ErrResolution))
+	})
+}
+
+func TestConnErrorRecorder(t *testing.T) {
+	t.Run("records connection errors", func(t *testing.T) {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		address := lis.Addr().String()
+		lis.Close()
+
+		r := &connErrorRecorder{}
+		_, err = r.dial(context.Background(), address)
+		assert.Error(t, err)
+		assert.Equal(t, err, r.getLastErr())
+	})
+
+	t.Run("dials unix sockets", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "operator")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+		socket := filepath.Join(dir, "operator.sock")
+		lis, err := net.Listen("unix", socket)
+		assert.NoError(t, err)
+		defer lis.Close()
+
+		r := &connErrorRecorder{}
+		for _, addr := range []string{"unix://" + socket, "unix:" + socket} {
+			conn, err := r.dial(context.Background(), addr)
+			if assert.NoError(t, err, addr) {
+				conn.Close()
+			}
+		}
+		assert.NoError(t, r.getLastErr())
+	})
+
+	t.Run("cancelled with the context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		r := &connErrorRecorder{}
+		start := time.Now()
+		_, err := r.dial(ctx, "dapr-operator.invalid:80")
+		assert.Error(t, err)
+		assert.Less(t, int64(time.Since(start)), int64(time.Second))
+		assert.False(t, errors.Is(getDialError("dapr-operator.invalid:80", context.Canceled, r.getLastErr(), nil), ErrResolution))
+	})
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	dapr_credentials "github.com/dapr/dapr/pkg/credentials"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	corev1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// generateTestCert returns a self-signed certificate and key valid for localhost.
+func generateTestCert(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return certPem, keyPem
+}
+
+func TestGetOperatorClientTLSMinVersion(t *testing.T) {
+	certPem, keyPem := generateTestCert(t)
+	serverCert, err := tls.X509KeyPair(certPem, keyPem)
+	assert.NoError(t, err)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		MaxVersion:   tls.VersionTLS12,
+	})))
+	go server.Serve(lis)
+	defer server.Stop()
+
+	certChain := &dapr_credentials.CertChain{RootCA: certPem, Cert: certPem, Key: keyPem}
+
+	t.Run("default min version", func(t *testing.T) {
+		_, conn, err := GetOperatorClient(lis.Addr().String(), "localhost", certChain)
+		assert.NoError(t, err)
+		assert.NoError(t, conn.Close())
+	})
+
+	t.Run("server below the min version", func(t *testing.T) {
+		_, _, err := GetOperatorClient(lis.Addr().String(), "localhost", certChain, WithTLSMinVersion(tls.VersionTLS13), WithDialTimeout(time.Second))
+		assert.True(t, errors.Is(err, ErrTLSHandshake), err)
+	})
+}
+
+func getTestSecret(data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "operator-client-certs",
+			Namespace: "dapr-system",
+		},
+		Data: data,
+	}
+}
+
+func TestGetOperatorClientFromSecret(t *testing.T) {
+	certPem, keyPem := generateTestCert(t)
+
+	t.Run("secret not found", func(t *testing.T) {
+		kubeClient := fake.NewSimpleClientset()
+		_, _, err := GetOperatorClientFromSecret(kubeClient, "dapr-system", "operator-client-certs", "localhost:6500", "localhost")
+		assert.Error(t, err)
+	})
+
+	t.Run("secret missing the key", func(t *testing.T) {
+		kubeClient := fake.NewSimpleClientset(getTestSecret(map[string][]byte{
+			dapr_credentials.RootCertFilename:   certPem,
+			dapr_credentials.IssuerCertFilename: certPem,
+		}))
+		_, _, err := GetOperatorClientFromSecret(kubeClient, "dapr-system", "operator-client-certs", "localhost:6500", "localhost")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), dapr_credentials.IssuerKeyFilename)
+	})
+
+	t.Run("secret with invalid cert material", func(t *testing.T) {
+		kubeClient := fake.NewSimpleClientset(getTestSecret(map[string][]byte{
+			dapr_credentials.RootCertFilename:   certPem,
+			dapr_credentials.IssuerCertFilename: []byte("invalid"),
+			dapr_credentials.IssuerKeyFilename:  []byte("invalid"),
+		}))
+		_, _, err := GetOperatorClientFromSecret(kubeClient, "dapr-system", "operator-client-certs", "localhost:6500", "localhost")
+		assert.Error(t, err)
+	})
+
+	t.Run("connects with the cert material from the secret", func(t *testing.T) {
+		serverCert, err := tls.X509KeyPair(certPem, keyPem)
+		assert.NoError(t, err)
+
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		server := grpc.NewServer(grpc.Creds(credentials.NewServerTLSFromCert(&serverCert)))
+		go server.Serve(lis)
+		defer server.Stop()
+
+		kubeClient := fake.NewSimpleClientset(getTestSecret(map[string][]byte{
+			dapr_credentials.RootCertFilename:   certPem,
+			dapr_credentials.IssuerCertFilename: certPem,
+			dapr_credentials.IssuerKeyFilename:  keyPem,
+		}))
+		client, conn, err := GetOperatorClientFromSecret(kubeClient, "dapr-system", "operator-client-certs", lis.Addr().String(), "localhost")
+		assert.NoError(t, err)
+		assert.NotNil(t, client)
+		assert.NoError(t, conn.Close())
+	})
+}
@@ -0,0 +1,177 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	dapr_credentials "github.com/dapr/dapr/pkg/credentials"
+	operatorv1pb "github.com/dapr/dapr/pkg/proto/operator/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// sharedConnKey identifies a shared connection by the address dialed, the TLS identity used and
+// the client options the connection is dialed with, so that callers with different settings don't
+// share a connection.
+type sharedConnKey struct {
+	address    string
+	serverName string
+	certChain  [sha256.Size]byte
+	options    sharedConnOptions
+}
+
+// sharedConnOptions holds the client options the connection is dialed with. The dial timeout only
+// bounds the dial and isn't part of it.
+type sharedConnOptions struct {
+	retryCodes      string
+	maxRetries      uint
+	perRetryTimeout time.Duration
+	monitorAttempts bool
+	keepalive       keepalive.ClientParameters
+	maxRecvMsgSize  int
+	tlsMinVersion   uint16
+	// customBackoff is unique to every caller with a custom backoff, since funcs can't be
+	// compared. These callers get a connection of their own.
+	customBackoff uint64
+}
+
+type sharedConn struct {
+	// dialed is closed once the connection is dialed, after conn and err are set.
+	dialed chan struct{}
+	conn   *grpc.ClientConn
+	err    error
+	refs   int
+}
+
+var (
+	sharedConnsLock sync.Mutex
+	sharedConns     = map[sharedConnKey]*sharedConn{}
+
+	customBackoffs uint64
+)
+
+func getSharedConnKey(address, serverName string, certChain *dapr_credentials.CertChain, o *clientOptions) sharedConnKey {
+	key := sharedConnKey{
+		address:    address,
+		serverName: serverName,
+		options: sharedConnOptions{
+			retryCodes:      fmt.Sprint(o.retryCodes),
+			maxRetries:      o.maxRetries,
+			perRetryTimeout: o.perRetryTimeout,
+			monitorAttempts: o.monitorAttempts,
+			keepalive:       o.keepalive,
+			maxRecvMsgSize:  o.maxRecvMsgSize,
+			tlsMinVersion:   o.tlsMinVersion,
+		},
+	}
+	if o.customBackoff {
+		key.options.customBackoff = atomic.AddUint64(&customBackoffs, 1)
+	}
+	if certChain != nil {
+		h := sha256.New()
+		for _, b := range [][]byte{certChain.RootCA, certChain.Cert, certChain.Key} {
+			h.Write(b)
+			// Separates the fields so that moving bytes between them changes the hash.
+			h.Write([]byte{0})
+		}
+		copy(key.certChain[:], h.Sum(nil))
+	}
+	return key
+}
+
+// GetSharedOperatorClient returns a k8s operator client backed by a connection that is shared
+// by all callers using the same address, TLS settings and client options, blocking until the
+// connection is dialed or its dial timeout has passed.
+// New code should use GetSharedOperatorClientWithContext, which can be cancelled.
+func GetSharedOperatorClient(address, serverName string, certChain *dapr_credentials.CertChain, clientOpts ...Option) (operatorv1pb.OperatorClient, *grpc.ClientConn, func() error, error) {
+	return GetSharedOperatorClientWithContext(context.Background(), address, serverName, certChain, clientOpts...)
+}
+
+// GetSharedOperatorClientWithContext returns a k8s operator client backed by a connection that is
+// shared by all callers using the same address, TLS settings and client options, blocking until
+// the connection is dialed or the given context is done. The returned release func must be called
+// once the client is no longer needed; the connection is closed when the last reference is released.
+// The connection is dialed once, outside of the lock and within the dial timeout of the caller
+// that first asks for it, so that a slow dial only blocks the callers of the same connection.
+// Callers with a custom backoff get a connection of their own.
+func GetSharedOperatorClientWithContext(ctx context.Context, address, serverName string, certChain *dapr_credentials.CertChain, clientOpts ...Option) (operatorv1pb.OperatorClient, *grpc.ClientConn, func() error, error) {
+	key := getSharedConnKey(address, serverName, certChain, getClientOptions(clientOpts...))
+
+	sharedConnsLock.Lock()
+	shared, ok := sharedConns[key]
+	if !ok {
+		shared = &sharedConn{dialed: make(chan struct{})}
+		sharedConns[key] = shared
+		// The dial doesn't end with the context of the caller, whose connection may be
+		// shared with callers that are still waiting for it.
+		go dialSharedConn(key, shared, address, serverName, certChain, clientOpts)
+	}
+	shared.refs++
+	sharedConnsLock.Unlock()
+
+	select {
+	case <-shared.dialed:
+	case <-ctx.Done():
+		releaseSharedConn(key, shared)
+		return nil, nil, nil, ctx.Err()
+	}
+	if shared.err != nil {
+		return nil, nil, nil, shared.err
+	}
+
+	var once sync.Once
+	release := func() error {
+		var err error
+		once.Do(func() {
+			err = releaseSharedConn(key, shared)
+		})
+		return err
+	}
+	return operatorv1pb.NewOperatorClient(shared.conn), shared.conn, release, nil
+}
+
+func dialSharedConn(key sharedConnKey, shared *sharedConn, address, serverName string, certChain *dapr_credentials.CertChain, clientOpts []Option) {
+	_, conn, err := GetOperatorClient(address, serverName, certChain, clientOpts...)
+
+	sharedConnsLock.Lock()
+	defer sharedConnsLock.Unlock()
+
+	shared.conn, shared.err = conn, err
+	switch {
+	case err != nil:
+		// The failed dial isn't shared with later callers, which dial again.
+		if sharedConns[key] == shared {
+			delete(sharedConns, key)
+		}
+	case shared.refs == 0:
+		// Every caller gave up waiting for the connection.
+		conn.Close()
+	}
+	close(shared.dialed)
+}
+
+func releaseSharedConn(key sharedConnKey, shared *sharedConn) error {
+	sharedConnsLock.Lock()
+	defer sharedConnsLock.Unlock()
+
+	shared.refs--
+	if shared.refs > 0 {
+		return nil
+	}
+	if sharedConns[key] == shared {
+		delete(sharedConns, key)
+	}
+	select {
+	case <-shared.dialed:
+		if shared.conn != nil {
+			return shared.conn.Close()
+		}
+	default:
+		// The connection is closed once dialed.
+	}
+	return nil
+}
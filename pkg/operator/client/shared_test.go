@@ -0,0 +1,232 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	dapr_credentials "github.com/dapr/dapr/pkg/credentials"
+	grpc_retry "github.com/grpc-ecosystem/go-grpc-middleware/retry"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/keepalive"
+)
+
+func startTestServer(t *testing.T) (string, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	server := grpc.NewServer()
+	go server.Serve(lis)
+	return lis.Addr().String(), server.Stop
+}
+
+func TestGetSharedOperatorClient(t *testing.T) {
+	t.Run("same address shares the connection", func(t *testing.T) {
+		address, stop := startTestServer(t)
+		defer stop()
+
+		_, conn1, release1, err := GetSharedOperatorClient(address, "", nil)
+		assert.NoError(t, err)
+		_, conn2, release2, err := GetSharedOperatorClient(address, "", nil)
+		assert.NoError(t, err)
+		assert.Same(t, conn1, conn2)
+
+		assert.NoError(t, release1())
+		assert.NotEqual(t, connectivity.Shutdown, conn1.GetState())
+
+		assert.NoError(t, release2())
+		assert.Equal(t, connectivity.Shutdown, conn1.GetState())
+	})
+
+	t.Run("different addresses use different connections", func(t *testing.T) {
+		address1, stop1 := startTestServer(t)
+		defer stop1()
+		address2, stop2 := startTestServer(t)
+		defer stop2()
+
+		_, conn1, release1, err := GetSharedOperatorClient(address1, "", nil)
+		assert.NoError(t, err)
+		defer release1()
+		_, conn2, release2, err := GetSharedOperatorClient(address2, "", nil)
+		assert.NoError(t, err)
+		defer release2()
+		assert.NotSame(t, conn1, conn2)
+	})
+
+	t.Run("different TLS settings use different connections", func(t *testing.T) {
+		address, stop := startTestServer(t)
+		defer stop()
+
+		_, conn1, release1, err := GetSharedOperatorClient(address, "", nil)
+		assert.NoError(t, err)
+		defer release1()
+		_, conn2, release2, err := GetSharedOperatorClient(address, "other", nil)
+		assert.NoError(t, err)
+		defer release2()
+		assert.NotSame(t, conn1, conn2)
+	})
+
+	t.Run("different cert chains get different keys", func(t *testing.T) {
+		chain1 := &dapr_credentials.CertChain{RootCA: []byte("ca"), Cert: []byte("cert1"), Key: []byte("key")}
+		chain2 := &dapr_credentials.CertChain{RootCA: []byte("ca"), Cert: []byte("cert2"), Key: []byte("key")}
+		moved := &dapr_credentials.CertChain{RootCA: []byte("cac"), Cert: []byte("ert1"), Key: []byte("key")}
+		o := getClientOptions()
+		assert.NotEqual(t, getSharedConnKey("a", "s", chain1, o), getSharedConnKey("a", "s", chain2, o))
+		assert.NotEqual(t, getSharedConnKey("a", "s", chain1, o), getSharedConnKey("a", "s", moved, o))
+		assert.NotEqual(t, getSharedConnKey("a", "s", nil, o), getSharedConnKey("a", "s", chain1, o))
+		assert.Equal(t, getSharedConnKey("a", "s", chain1, o), getSharedConnKey("a", "s", chain1, o))
+	})
+
+	t.Run("client options are part of the key", func(t *testing.T) {
+		getKey := func(opts ...Option) sharedConnKey {
+			return getSharedConnKey("a", "s", nil, getClientOptions(opts...))
+		}
+		assert.Equal(t, getKey(), getKey())
+		assert.Equal(t, getKey(WithMaxRetries(3)), getKey(WithMaxRetries(3)))
+		// the dial timeout doesn't change the dialed connection
+		assert.Equal(t, getKey(), getKey(WithDialTimeout(time.Second)))
+		assert.NotEqual(t, getKey(), getKey(WithMaxRetries(3)))
+		assert.NotEqual(t, getKey(), getKey(WithRetryCodes(codes.Unavailable)))
+		assert.NotEqual(t, getKey(), getKey(WithPerRetryTimeout(time.Second)))
+		assert.NotEqual(t, getKey(), getKey(WithAttemptMonitoring()))
+		assert.NotEqual(t, getKey(), getKey(WithKeepaliveParams(keepalive.ClientParameters{Time: time.Minute})))
+		assert.NotEqual(t, getKey(), getKey(WithMaxRecvMsgSize(1024)))
+		assert.NotEqual(t, getKey(), getKey(WithTLSMinVersion(tls.VersionTLS13)))
+		backoff := WithBackoff(grpc_retry.BackoffLinear(time.Second))
+		assert.NotEqual(t, getKey(backoff), getKey(backoff))
+	})
+
+	t.Run("different client options use different connections", func(t *testing.T) {
+		address, stop := startTestServer(t)
+		defer stop()
+
+		_, conn1, release1, err := GetSharedOperatorClient(address, "", nil, WithMaxRetries(3))
+		assert.NoError(t, err)
+		defer release1()
+		_, conn2, release2, err := GetSharedOperatorClient(address, "", nil, WithMaxRetries(3))
+		assert.NoError(t, err)
+		defer release2()
+		_, conn3, release3, err := GetSharedOperatorClient(address, "", nil, WithMaxRecvMsgSize(1024))
+		assert.NoError(t, err)
+		defer release3()
+		assert.Same(t, conn1, conn2)
+		assert.NotSame(t, conn1, conn3)
+	})
+
+	t.Run("waiting for the dial ends with the context", func(t *testing.T) {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		unreachable := lis.Addr().String()
+		lis.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, conn, release, err := GetSharedOperatorClientWithContext(ctx, unreachable, "", nil, WithDialTimeout(time.Second))
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.Nil(t, conn)
+		assert.Nil(t, release)
+		assert.Less(t, int64(time.Since(start)), int64(time.Second))
+
+		// the dial keeps going in the background until its dial timeout and isn't kept once it fails
+		assert.Eventually(t, func() bool {
+			sharedConnsLock.Lock()
+			defer sharedConnsLock.Unlock()
+			for key := range sharedConns {
+				if key.address == unreachable {
+					return false
+				}
+			}
+			return true
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("concurrent callers share one connection", func(t *testing.T) {
+		address, stop := startTestServer(t)
+		defer stop()
+
+		const callers = 5
+		conns := make([]*grpc.ClientConn, callers)
+		releases := make([]func() error, callers)
+		var wg sync.WaitGroup
+		for i := 0; i < callers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				var err error
+				_, conns[i], releases[i], err = GetSharedOperatorClient(address, "", nil)
+				assert.NoError(t, err)
+			}(i)
+		}
+		wg.Wait()
+		for i := 1; i < callers; i++ {
+			assert.Same(t, conns[0], conns[i])
+		}
+		for _, release := range releases {
+			assert.NoError(t, release())
+		}
+		assert.Equal(t, connectivity.Shutdown, conns[0].GetState())
+	})
+
+	t.Run("a pending dial doesn't block other addresses", func(t *testing.T) {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		unreachable := lis.Addr().String()
+		lis.Close()
+		// Dials until the dial timeout, the test doesn't wait for it.
+		go GetSharedOperatorClient(unreachable, "", nil)
+		time.Sleep(100 * time.Millisecond)
+
+		address, stop := startTestServer(t)
+		defer stop()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _, release, err := GetSharedOperatorClient(address, "", nil)
+			if assert.NoError(t, err) {
+				release()
+			}
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, "the dial of another address was blocked")
+		}
+	})
+
+	t.Run("release is idempotent", func(t *testing.T) {
+		address, stop := startTestServer(t)
+		defer stop()
+
+		_, conn1, release1, err := GetSharedOperatorClient(address, "", nil)
+		assert.NoError(t, err)
+		_, _, release2, err := GetSharedOperatorClient(address, "", nil)
+		assert.NoError(t, err)
+
+		assert.NoError(t, release1())
+		assert.NoError(t, release1())
+		assert.NotEqual(t, connectivity.Shutdown, conn1.GetState())
+		assert.NoError(t, release2())
+		assert.Equal(t, connectivity.Shutdown, conn1.GetState())
+	})
+
+	t.Run("a new connection is dialed after the last release", func(t *testing.T) {
+		address, stop := startTestServer(t)
+		defer stop()
+
+		_, conn1, release1, err := GetSharedOperatorClient(address, "", nil)
+		assert.NoError(t, err)
+		assert.NoError(t, release1())
+
+		_, conn2, release2, err := GetSharedOperatorClient(address, "", nil)
+		assert.NoError(t, err)
+		defer release2()
+		assert.NotSame(t, conn1, conn2)
+	})
+}
@@ -23,6 +23,7 @@ import (
 const (
 	daprEnabledAnnotationKey        = "dapr.io/enabled"
 	appIDAnnotationKey              = "dapr.io/app-id"
+	appIDNamespacingAnnotationKey   = "dapr.io/app-id-namespacing"
 	daprMetricsPortKey              = "dapr.io/metrics-port"
 	daprSidecarHTTPPortName         = "dapr-http"
 	daprSidecarAPIGRPCPortName      = "dapr-grpc"
@@ -33,6 +34,7 @@ const (
 	daprSidecarInternalGRPCPort     = 50002
 	defaultMetricsPort              = 9090
 	clusterIPNone                   = "None"
+	defaultAnnotationPrefix         = "dapr.io"
 	daprServiceOwnerField           = ".metadata.controller"
 )
 
@@ -41,15 +43,19 @@ var log = logger.NewLogger("dapr.operator.handlers")
 // DaprHandler handles the lifetime for Dapr CRDs
 type DaprHandler struct {
 	mgr ctrl.Manager
+	// annotationPrefix is the domain of the deployment annotations, matching the sidecar injector.
+	annotationPrefix string
 
 	client.Client
 	Scheme *runtime.Scheme
 }
 
-// NewDaprHandler returns a new Dapr handler
-func NewDaprHandler(mgr ctrl.Manager) *DaprHandler {
+// NewDaprHandler returns a new Dapr handler reading the deployment annotations with the given
+// prefix, dapr.io when empty.
+func NewDaprHandler(mgr ctrl.Manager, annotationPrefix string) *DaprHandler {
 	return &DaprHandler{
-		mgr: mgr,
+		mgr:              mgr,
+		annotationPrefix: annotationPrefix,
 
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
@@ -113,8 +119,9 @@ func (h *DaprHandler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Res
 }
 
 func (h *DaprHandler) ensureDaprServicePresent(ctx context.Context, namespace string, deployment *appsv1.Deployment) error {
-	appID := h.getAppID(deployment)
-	err := validation.ValidateKubernetesAppID(appID)
+	// The sidecar is injected with the same app ID, which name resolution looks up as the
+	// <app-id>-dapr Service.
+	appID, err := validation.GetKubernetesAppID(h.getAppID(deployment), h.getAppIDNamespacing(deployment), h.getAnnotationKey(appIDNamespacingAnnotationKey), namespace)
 	if err != nil {
 		return err
 	}
@@ -127,7 +134,7 @@ func (h *DaprHandler) ensureDaprServicePresent(ctx context.Context, namespace st
 	if err := h.Get(ctx, mayDaprService, &daprSvc); err != nil {
 		if apierrors.IsNotFound(err) {
 			log.Debugf("no service for deployment found, deployment: %s/%s", namespace, deployment.Name)
-			return h.createDaprService(ctx, mayDaprService, deployment)
+			return h.createDaprService(ctx, mayDaprService, appID, deployment)
 		}
 		log.Errorf("unable to get service, %s, err: %s", mayDaprService, err)
 		return err
@@ -135,8 +142,7 @@ func (h *DaprHandler) ensureDaprServicePresent(ctx context.Context, namespace st
 	return nil
 }
 
-func (h *DaprHandler) createDaprService(ctx context.Context, expectedService types.NamespacedName, deployment *appsv1.Deployment) error {
-	appID := h.getAppID(deployment)
+func (h *DaprHandler) createDaprService(ctx context.Context, expectedService types.NamespacedName, appID string, deployment *appsv1.Deployment) error {
 	metricsPort := h.getMetricsPort(deployment)
 
 	service := &corev1.Service{
@@ -215,17 +221,40 @@ func (h *DaprHandler) ensureDaprServiceAbsent(ctx context.Context, deploymentKey
 	return nil
 }
 
-func (h *DaprHandler) getAppID(deployment *appsv1.Deployment) string {
-	annotations := deployment.Spec.Template.ObjectMeta.Annotations
-	if val, ok := annotations[appIDAnnotationKey]; ok && val != "" {
-		return val
+// getAnnotationKey returns the given annotation key, declared with the default dapr.io prefix,
+// with the prefix of the handler instead.
+func (h *DaprHandler) getAnnotationKey(key string) string {
+	return getPrefixedKey(key, h.annotationPrefix)
+}
+
+// getPrefixedKey returns the given key, declared with the default dapr.io prefix, with the given
+// prefix instead.
+func getPrefixedKey(key, prefix string) string {
+	if prefix != "" && prefix != defaultAnnotationPrefix {
+		return prefix + strings.TrimPrefix(key, defaultAnnotationPrefix)
 	}
-	return ""
+	return key
+}
+
+// getAnnotation returns the pod template annotation of the deployment for the given key, declared
+// with the default dapr.io prefix and looked up with the prefix of the handler.
+func (h *DaprHandler) getAnnotation(deployment *appsv1.Deployment, key string) (string, bool) {
+	val, ok := deployment.Spec.Template.ObjectMeta.Annotations[h.getAnnotationKey(key)]
+	return val, ok
+}
+
+func (h *DaprHandler) getAppID(deployment *appsv1.Deployment) string {
+	val, _ := h.getAnnotation(deployment, appIDAnnotationKey)
+	return val
+}
+
+func (h *DaprHandler) getAppIDNamespacing(deployment *appsv1.Deployment) string {
+	val, _ := h.getAnnotation(deployment, appIDNamespacingAnnotationKey)
+	return val
 }
 
 func (h *DaprHandler) isAnnotatedForDapr(deployment *appsv1.Deployment) bool {
-	annotations := deployment.Spec.Template.ObjectMeta.Annotations
-	enabled, ok := annotations[daprEnabledAnnotationKey]
+	enabled, ok := h.getAnnotation(deployment, daprEnabledAnnotationKey)
 	if !ok {
 		return false
 	}
@@ -238,9 +267,8 @@ func (h *DaprHandler) isAnnotatedForDapr(deployment *appsv1.Deployment) bool {
 }
 
 func (h *DaprHandler) getMetricsPort(deployment *appsv1.Deployment) int {
-	annotations := deployment.Spec.Template.ObjectMeta.Annotations
 	metricsPort := defaultMetricsPort
-	if val, ok := annotations[daprMetricsPortKey]; ok {
+	if val, ok := h.getAnnotation(deployment, daprMetricsPortKey); ok {
 		if v, err := strconv.Atoi(val); err == nil {
 			metricsPort = v
 		}
@@ -8,6 +8,10 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestNewDaprHandler(t *testing.T) {
@@ -95,6 +99,68 @@ func TestDaprService(t *testing.T) {
 	})
 }
 
+func TestDaprServiceNamespacedAppID(t *testing.T) {
+	d := getDeployment("app", "true")
+	d.Namespace = "ns"
+	d.Spec.Selector = &meta_v1.LabelSelector{MatchLabels: d.Spec.Template.Labels}
+	d.Spec.Template.Annotations[appIDNamespacingAnnotationKey] = "suffix"
+	h := &DaprHandler{
+		Client: fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(d).Build(),
+		Scheme: clientgoscheme.Scheme,
+	}
+
+	_, err := h.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "app"}})
+	assert.NoError(t, err)
+
+	var svc corev1.Service
+	assert.NoError(t, h.Get(context.TODO(), types.NamespacedName{Namespace: "ns", Name: "app-ns-dapr"}, &svc))
+	assert.Equal(t, "app-ns", svc.Annotations[appIDAnnotationKey])
+
+	t.Run("invalid namespacing", func(t *testing.T) {
+		d := getDeployment("app", "true")
+		d.Spec.Template.Annotations[appIDNamespacingAnnotationKey] = "infix"
+		err := getTestDaprHandler().ensureDaprServicePresent(context.TODO(), "ns", d)
+		assert.Error(t, err)
+	})
+}
+
+func TestAnnotationPrefix(t *testing.T) {
+	d := getDeployment("app", "true")
+	d.Spec.Template.Annotations = map[string]string{
+		"dapr.example.com/enabled":      "true",
+		"dapr.example.com/app-id":       "custom",
+		"dapr.example.com/metrics-port": "5050",
+	}
+
+	t.Run("custom prefix", func(t *testing.T) {
+		h := &DaprHandler{annotationPrefix: "dapr.example.com"}
+		assert.True(t, h.isAnnotatedForDapr(d))
+		assert.Equal(t, "custom", h.getAppID(d))
+		assert.Equal(t, 5050, h.getMetricsPort(d))
+	})
+
+	t.Run("default prefix ignores custom annotations", func(t *testing.T) {
+		h := getTestDaprHandler()
+		assert.False(t, h.isAnnotatedForDapr(d))
+		assert.Equal(t, "", h.getAppID(d))
+	})
+
+	t.Run("errors name the custom prefix", func(t *testing.T) {
+		d := getDeployment("app", "true")
+		d.Spec.Template.Annotations = map[string]string{"dapr.example.com/app-id-namespacing": "infix"}
+		h := &DaprHandler{annotationPrefix: "dapr.example.com"}
+		err := h.ensureDaprServicePresent(context.TODO(), "ns", d)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "dapr.example.com/app-id-namespacing")
+		}
+	})
+
+	t.Run("custom prefix ignores dapr.io annotations", func(t *testing.T) {
+		h := &DaprHandler{annotationPrefix: "dapr.example.com"}
+		assert.False(t, h.isAnnotatedForDapr(getDeployment("app", "true")))
+	})
+}
+
 func TestGetMetricsPort(t *testing.T) {
 	testDaprHandler := getTestDaprHandler()
 	t.Run("metrics port override", func(t *testing.T) {
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// sidecarReadyConditionType is the pod readiness gate added by the sidecar injector, named with
+	// the annotation prefix of the handler instead of dapr.io when one is configured.
+	sidecarReadyConditionType = corev1.PodConditionType("dapr.io/sidecar-ready")
+	sidecarContainerName      = "daprd"
+	sidecarReadyReason        = "SidecarReady"
+	sidecarNotReadyReason     = "SidecarNotReady"
+)
+
+// SidecarReadyHandler reports the sidecar ready condition of the pods with the sidecar
+// readiness gate, from the readiness of the sidecar container.
+type SidecarReadyHandler struct {
+	mgr           ctrl.Manager
+	conditionType corev1.PodConditionType
+
+	client.Client
+}
+
+// NewSidecarReadyHandler returns a new sidecar ready condition handler for the readiness gate
+// named with the given annotation prefix, the same one the sidecar injector is configured with.
+func NewSidecarReadyHandler(mgr ctrl.Manager, annotationPrefix string) *SidecarReadyHandler {
+	return &SidecarReadyHandler{
+		mgr:           mgr,
+		conditionType: corev1.PodConditionType(getPrefixedKey(string(sidecarReadyConditionType), annotationPrefix)),
+
+		Client: mgr.GetClient(),
+	}
+}
+
+// Init watches the pods with the sidecar readiness gate.
+func (h *SidecarReadyHandler) Init() error {
+	return ctrl.NewControllerManagedBy(h.mgr).
+		For(&corev1.Pod{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			pod, ok := obj.(*corev1.Pod)
+			return ok && h.hasSidecarReadinessGate(pod)
+		}))).
+		Complete(h)
+}
+
+// Reconcile sets the sidecar ready condition of the pod to the readiness of the sidecar container,
+// which passes its readiness probe once daprd has loaded its components.
+func (h *SidecarReadyHandler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	var pod corev1.Pod
+	if err := h.Get(ctx, req.NamespacedName, &pod); err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Debugf("pod has be deleted, %s", req.NamespacedName)
+			return ctrl.Result{}, nil
+		}
+		log.Errorf("unable to get pod, %s, err: %s", req.NamespacedName, err)
+		return ctrl.Result{}, err
+	}
+	if pod.DeletionTimestamp != nil || !h.hasSidecarReadinessGate(&pod) {
+		return ctrl.Result{}, nil
+	}
+
+	status, reason := corev1.ConditionFalse, sidecarNotReadyReason
+	if isSidecarReady(&pod) {
+		status, reason = corev1.ConditionTrue, sidecarReadyReason
+	}
+	if !h.setPodCondition(&pod, status, reason) {
+		return ctrl.Result{}, nil
+	}
+	if err := h.Status().Update(ctx, &pod); err != nil {
+		log.Errorf("unable to update the sidecar ready condition of pod %s, err: %s", req.NamespacedName, err)
+		return ctrl.Result{Requeue: true}, err
+	}
+	log.Debugf("set the sidecar ready condition of pod %s to %s", req.NamespacedName, status)
+	return ctrl.Result{}, nil
+}
+
+func (h *SidecarReadyHandler) hasSidecarReadinessGate(pod *corev1.Pod) bool {
+	for _, g := range pod.Spec.ReadinessGates {
+		if g.ConditionType == h.conditionType {
+			return true
+		}
+	}
+	return false
+}
+
+// isSidecarReady returns whether the sidecar container is ready, looked up in the init container
+// statuses as well for sidecars injected as native sidecars.
+func isSidecarReady(pod *corev1.Pod) bool {
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.ContainerStatuses, pod.Status.InitContainerStatuses} {
+		for _, s := range statuses {
+			if s.Name == sidecarContainerName {
+				return s.Ready
+			}
+		}
+	}
+	return false
+}
+
+// setPodCondition sets the sidecar ready condition of the pod, and returns whether it changed.
+func (h *SidecarReadyHandler) setPodCondition(pod *corev1.Pod, status corev1.ConditionStatus, reason string) bool {
+	condition := corev1.PodCondition{
+		Type:               h.conditionType,
+		Status:             status,
+		Reason:             reason,
+		LastTransitionTime: meta_v1.Now(),
+	}
+	for i, c := range pod.Status.Conditions {
+		if c.Type != h.conditionType {
+			continue
+		}
+		if c.Status == status {
+			return false
+		}
+		pod.Status.Conditions[i] = condition
+		return true
+	}
+	pod.Status.Conditions = append(pod.Status.Conditions, condition)
+	return true
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSidecarReadyCondition(t *testing.T) {
+	getCondition := func(t *testing.T, h *SidecarReadyHandler) *corev1.PodCondition {
+		var pod corev1.Pod
+		assert.NoError(t, h.Get(context.TODO(), types.NamespacedName{Namespace: "ns", Name: "app"}, &pod))
+		for _, c := range pod.Status.Conditions {
+			if c.Type == h.conditionType {
+				return &c
+			}
+		}
+		return nil
+	}
+	reconcile := func(t *testing.T, pod *corev1.Pod) *SidecarReadyHandler {
+		h := &SidecarReadyHandler{
+			conditionType: sidecarReadyConditionType,
+			Client:        fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(pod).Build(),
+		}
+		_, err := h.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "app"}})
+		assert.NoError(t, err)
+		return h
+	}
+
+	t.Run("ready sidecar", func(t *testing.T) {
+		h := reconcile(t, getSidecarReadyTestPod(true, true))
+		c := getCondition(t, h)
+		assert.NotNil(t, c)
+		assert.Equal(t, corev1.ConditionTrue, c.Status)
+	})
+
+	t.Run("not ready sidecar", func(t *testing.T) {
+		h := reconcile(t, getSidecarReadyTestPod(true, false))
+		c := getCondition(t, h)
+		assert.NotNil(t, c)
+		assert.Equal(t, corev1.ConditionFalse, c.Status)
+	})
+
+	t.Run("ready native sidecar", func(t *testing.T) {
+		pod := getSidecarReadyTestPod(true, false)
+		pod.Status.ContainerStatuses = nil
+		pod.Status.InitContainerStatuses = []corev1.ContainerStatus{{Name: sidecarContainerName, Ready: true}}
+		h := reconcile(t, pod)
+		c := getCondition(t, h)
+		assert.NotNil(t, c)
+		assert.Equal(t, corev1.ConditionTrue, c.Status)
+	})
+
+	t.Run("condition updated when the sidecar becomes ready", func(t *testing.T) {
+		pod := getSidecarReadyTestPod(true, true)
+		pod.Status.Conditions = []corev1.PodCondition{{Type: sidecarReadyConditionType, Status: corev1.ConditionFalse}}
+		h := reconcile(t, pod)
+		c := getCondition(t, h)
+		assert.NotNil(t, c)
+		assert.Equal(t, corev1.ConditionTrue, c.Status)
+		assert.Equal(t, sidecarReadyReason, c.Reason)
+	})
+
+	t.Run("no readiness gate", func(t *testing.T) {
+		h := reconcile(t, getSidecarReadyTestPod(false, true))
+		assert.Nil(t, getCondition(t, h))
+	})
+
+	t.Run("readiness gate with a custom prefix", func(t *testing.T) {
+		pod := getSidecarReadyTestPod(false, true)
+		pod.Spec.ReadinessGates = []corev1.PodReadinessGate{{ConditionType: "dapr.example.com/sidecar-ready"}}
+		h := &SidecarReadyHandler{
+			conditionType: "dapr.example.com/sidecar-ready",
+			Client:        fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(pod).Build(),
+		}
+		_, err := h.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "app"}})
+		assert.NoError(t, err)
+		c := getCondition(t, h)
+		assert.NotNil(t, c)
+		assert.Equal(t, corev1.ConditionTrue, c.Status)
+	})
+
+	t.Run("dapr.io readiness gate ignored with a custom prefix", func(t *testing.T) {
+		pod := getSidecarReadyTestPod(true, true)
+		h := &SidecarReadyHandler{
+			conditionType: "dapr.example.com/sidecar-ready",
+			Client:        fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(pod).Build(),
+		}
+		_, err := h.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "app"}})
+		assert.NoError(t, err)
+		var updated corev1.Pod
+		assert.NoError(t, h.Get(context.TODO(), types.NamespacedName{Namespace: "ns", Name: "app"}, &updated))
+		assert.Empty(t, updated.Status.Conditions)
+	})
+
+	t.Run("deleted pod", func(t *testing.T) {
+		h := &SidecarReadyHandler{
+			conditionType: sidecarReadyConditionType,
+			Client:        fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build(),
+		}
+		_, err := h.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "app"}})
+		assert.NoError(t, err)
+	})
+}
+
+func getSidecarReadyTestPod(readinessGate, sidecarReady bool) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "app",
+			Namespace: "ns",
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}, {Name: sidecarContainerName}},
+		},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", Ready: true},
+				{Name: sidecarContainerName, Ready: sidecarReady},
+			},
+		},
+	}
+	if readinessGate {
+		pod.Spec.ReadinessGates = []corev1.PodReadinessGate{{ConditionType: sidecarReadyConditionType}}
+	}
+	return pod
+}
+
+func TestSidecarReadyConditionType(t *testing.T) {
+	assert.Equal(t, sidecarReadyConditionType, corev1.PodConditionType(getPrefixedKey(string(sidecarReadyConditionType), "")))
+	assert.Equal(t, sidecarReadyConditionType, corev1.PodConditionType(getPrefixedKey(string(sidecarReadyConditionType), defaultAnnotationPrefix)))
+	assert.Equal(t, corev1.PodConditionType("dapr.example.com/sidecar-ready"), corev1.PodConditionType(getPrefixedKey(string(sidecarReadyConditionType), "dapr.example.com")))
+}
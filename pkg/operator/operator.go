@@ -61,8 +61,8 @@ func init() {
 	_ = subscriptionsapi.AddToScheme(scheme)
 }
 
-// NewOperator returns a new Dapr Operator
-func NewOperator(config, certChainPath string, enableLeaderElection bool) Operator {
+// NewOperator returns a new Dapr Operator reading the deployment annotations with the given prefix.
+func NewOperator(config, certChainPath string, enableLeaderElection bool, annotationPrefix string) Operator {
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:             scheme,
 		MetricsBindAddress: "0",
@@ -72,10 +72,14 @@ func NewOperator(config, certChainPath string, enableLeaderElection bool) Operat
 	if err != nil {
 		log.Fatal("unable to start manager")
 	}
-	daprHandler := handlers.NewDaprHandler(mgr)
+	daprHandler := handlers.NewDaprHandler(mgr, annotationPrefix)
 	if err := daprHandler.Init(); err != nil {
 		log.Fatalf("unable to initialize handler, err: %s", err)
 	}
+	sidecarReadyHandler := handlers.NewSidecarReadyHandler(mgr, annotationPrefix)
+	if err := sidecarReadyHandler.Init(); err != nil {
+		log.Fatalf("unable to initialize sidecar ready handler, err: %s", err)
+	}
 
 	o := &operator{
 		daprHandler:   daprHandler,
@@ -0,0 +1,104 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation and Dapr Contributors.
+// Licensed under the MIT License.
+// ------------------------------------------------------------
+
+package runtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	procDir             = "/proc"
+	appExitPollInterval = time.Second
+	// sandboxPID is the pid of the pod sandbox process in a shared process namespace.
+	sandboxPID = 1
+)
+
+// AppExited returns a channel that is closed once the app processes have exited. It returns
+// a nil channel, which never fires, when shutdown on app exit isn't enabled.
+func (a *DaprRuntime) AppExited() <-chan struct{} {
+	if !a.runtimeConfig.ShutdownOnAppExit {
+		return nil
+	}
+	exited := make(chan struct{})
+	go watchAppProcesses(procDir, os.Getpid(), a.runtimeConfig.AppExitIgnoredProcesses, appExitPollInterval, exited)
+	return exited
+}
+
+// watchAppProcesses closes exited once none of the app processes are left. The app containers
+// are started before the sidecar, so the app has already exited when no app process is found
+// on the first check.
+func watchAppProcesses(procDir string, daprPID int, ignoredProcesses []string, interval time.Duration, exited chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		count, err := countAppProcesses(procDir, daprPID, ignoredProcesses)
+		if err != nil {
+			log.Warnf("failed to list the app processes: %s", err)
+		} else if count == 0 {
+			log.Info("app processes exited")
+			close(exited)
+			return
+		}
+		<-ticker.C
+	}
+}
+
+// countAppProcesses counts the processes other than the pod sandbox, the processes in the
+// container of Dapr, found through its cgroup, and the processes with an ignored name, such
+// as the processes of other sidecars.
+func countAppProcesses(procDir string, daprPID int, ignoredProcesses []string) (int, error) {
+	entries, err := ioutil.ReadDir(procDir)
+	if err != nil {
+		return 0, err
+	}
+	daprCgroup, err := readProcFile(procDir, daprPID, "cgroup")
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid == sandboxPID || pid == daprPID {
+			continue
+		}
+		// Processes that exit while being listed are skipped.
+		cgroup, err := readProcFile(procDir, pid, "cgroup")
+		if err != nil || cgroup == daprCgroup {
+			continue
+		}
+		if name, err := readProcFile(procDir, pid, "comm"); err == nil && isIgnoredProcess(name, ignoredProcesses) {
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+func readProcFile(procDir string, pid int, name string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(procDir, strconv.Itoa(pid), name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func isIgnoredProcess(name string, ignoredProcesses []string) bool {
+	for _, ignored := range ignoredProcesses {
+		if name == ignored {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation and Dapr Contributors.
+// Licensed under the MIT License.
+// ------------------------------------------------------------
+
+package runtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	daprTestCgroup = "0::/kubepods/pod1/daprd"
+	appTestCgroup  = "0::/kubepods/pod1/app"
+)
+
+func addTestProcess(t *testing.T, dir, pid, cgroup, comm string) {
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, pid), 0700))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, pid, "cgroup"), []byte(cgroup+"\n"), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, pid, "comm"), []byte(comm+"\n"), 0600))
+}
+
+func TestCountAppProcesses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	addTestProcess(t, dir, "1", "0::/kubepods/pod1/pause", "pause")
+	addTestProcess(t, dir, "7", daprTestCgroup, "daprd")
+	addTestProcess(t, dir, "8", daprTestCgroup, "sh")
+	addTestProcess(t, dir, "42", appTestCgroup, "app")
+	addTestProcess(t, dir, "43", "0::/kubepods/pod1/proxy", "socat")
+	for _, name := range []string{"self", "sys"} {
+		assert.NoError(t, os.Mkdir(filepath.Join(dir, name), 0700))
+	}
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "99"), nil, 0600))
+	// a process that exited while listing
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "50"), 0700))
+
+	t.Run("processes of other containers", func(t *testing.T) {
+		count, err := countAppProcesses(dir, 7, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("ignored processes", func(t *testing.T) {
+		count, err := countAppProcesses(dir, 7, []string{"socat"})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+}
+
+func TestWatchAppProcesses(t *testing.T) {
+	t.Run("exit once the app processes are gone", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "proc")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		addTestProcess(t, dir, "1", "0::/kubepods/pod1/pause", "pause")
+		addTestProcess(t, dir, "7", daprTestCgroup, "daprd")
+		addTestProcess(t, dir, "42", appTestCgroup, "app")
+
+		exited := make(chan struct{})
+		go watchAppProcesses(dir, 7, nil, 10*time.Millisecond, exited)
+
+		select {
+		case <-exited:
+			t.Fatal("exited while the app is running")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		assert.NoError(t, os.RemoveAll(filepath.Join(dir, "42")))
+		select {
+		case <-exited:
+		case <-time.After(time.Second):
+			t.Fatal("app exit wasn't detected")
+		}
+	})
+
+	t.Run("exit when the app exited before the first check", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "proc")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		addTestProcess(t, dir, "7", daprTestCgroup, "daprd")
+
+		exited := make(chan struct{})
+		go watchAppProcesses(dir, 7, nil, time.Hour, exited)
+
+		select {
+		case <-exited:
+		case <-time.After(time.Second):
+			t.Fatal("app exit wasn't detected")
+		}
+	})
+
+	t.Run("ignored processes don't keep Dapr running", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "proc")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		addTestProcess(t, dir, "7", daprTestCgroup, "daprd")
+		addTestProcess(t, dir, "43", "0::/kubepods/pod1/istio-proxy", "envoy")
+
+		exited := make(chan struct{})
+		go watchAppProcesses(dir, 7, []string{"envoy"}, 10*time.Millisecond, exited)
+
+		select {
+		case <-exited:
+		case <-time.After(time.Second):
+			t.Fatal("app exit wasn't detected")
+		}
+	})
+}
+
+func TestAppExitedDisabled(t *testing.T) {
+	rt := NewDaprRuntime(&Config{}, nil, nil)
+	assert.Nil(t, rt.AppExited())
+}
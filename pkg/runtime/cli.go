@@ -11,6 +11,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	global_config "github.com/dapr/dapr/pkg/config"
 	"github.com/dapr/dapr/pkg/cors"
@@ -46,6 +47,13 @@ func FromFlags() (*DaprRuntime, error) {
 	enableMTLS := flag.Bool("enable-mtls", false, "Enables automatic mTLS for daprd to daprd communication channels")
 	appSSL := flag.Bool("app-ssl", false, "Sets the URI scheme of the app to https and attempts an SSL connection")
 	daprHTTPMaxRequestSize := flag.Int("dapr-http-max-request-size", -1, "Increasing max size of request body in MB to handle uploading of big files. By default 4 MB.")
+	appHealthCheckPath := flag.String("app-health-check-path", "", "HTTP path on the app polled on startup until it returns a success status. Applies to http apps only")
+	appTLSClientCertFile := flag.String("app-tls-client-cert-file", "", "Path to the client certificate presented to the app when app-ssl is enabled")
+	appTLSClientKeyFile := flag.String("app-tls-client-key-file", "", "Path to the private key of the client certificate presented to the app")
+	trustAnchorsFile := flag.String("trust-anchors-file", "", "Path to a file holding the trust anchors, read instead of the DAPR_TRUST_ANCHORS environment variable")
+	shutdownOnAppExit := flag.Bool("shutdown-on-app-exit", false, "Shuts Dapr down once the app processes exit. Requires a process namespace shared with the app, which exposes the Dapr process, including its environment, to the app")
+	appExitIgnoredProcesses := flag.String("app-exit-ignored-processes", "", "Comma separated names of the processes, such as the processes of other sidecars, that aren't waited for with shutdown-on-app-exit")
+	daprGracefulShutdownSeconds := flag.Int("dapr-graceful-shutdown-seconds", -1, "Time in seconds to wait for outstanding operations to finish on shutdown. By default 5 seconds.")
 
 	loggerOptions := logger.DefaultOptions()
 	loggerOptions.AttachCmdFlags(flag.StringVar, flag.BoolVar)
@@ -141,11 +149,30 @@ func FromFlags() (*DaprRuntime, error) {
 	runtimeConfig := NewRuntimeConfig(*appID, placementAddresses, *controlPlaneAddress, *allowedOrigins, *config, *componentsPath,
 		appPrtcl, *mode, daprHTTP, daprInternalGRPC, daprAPIGRPC, applicationPort, profPort, *enableProfiling, concurrency, *enableMTLS, *sentryAddress, *appSSL, maxRequestBodySize)
 
+	if *daprGracefulShutdownSeconds != -1 {
+		if *daprGracefulShutdownSeconds < 0 {
+			return nil, errors.New("dapr-graceful-shutdown-seconds cannot be negative")
+		}
+		runtimeConfig.GracefulShutdownDuration = time.Duration(*daprGracefulShutdownSeconds) * time.Second
+	}
+
+	runtimeConfig.AppHealthCheckPath = *appHealthCheckPath
+	runtimeConfig.ShutdownOnAppExit = *shutdownOnAppExit
+	if *appExitIgnoredProcesses != "" {
+		runtimeConfig.AppExitIgnoredProcesses = strings.Split(*appExitIgnoredProcesses, ",")
+	}
+
+	if (*appTLSClientCertFile == "") != (*appTLSClientKeyFile == "") {
+		return nil, errors.New("app-tls-client-cert-file and app-tls-client-key-file must be set together")
+	}
+	runtimeConfig.AppTLSClientCertFile = *appTLSClientCertFile
+	runtimeConfig.AppTLSClientKeyFile = *appTLSClientKeyFile
+
 	var globalConfig *global_config.Configuration
 	var configErr error
 
 	if *enableMTLS {
-		runtimeConfig.CertChain, err = security.GetCertChain()
+		runtimeConfig.CertChain, err = security.GetCertChainWithTrustAnchorsFile(*trustAnchorsFile)
 		if err != nil {
 			return nil, err
 		}
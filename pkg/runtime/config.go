@@ -6,6 +6,8 @@
 package runtime
 
 import (
+	"time"
+
 	config "github.com/dapr/dapr/pkg/config/modes"
 	"github.com/dapr/dapr/pkg/credentials"
 	"github.com/dapr/dapr/pkg/modes"
@@ -29,6 +31,8 @@ const (
 	DefaultMetricsPort = 9090
 	// DefaultMaxRequestBodySize is the default option for the maximum body size in MB for Dapr HTTP servers
 	DefaultMaxRequestBodySize = 4
+	// DefaultGracefulShutdownDuration is the default time Dapr waits for outstanding operations to finish on shutdown
+	DefaultGracefulShutdownDuration = 5 * time.Second
 )
 
 // Config holds the Dapr Runtime configuration
@@ -53,6 +57,19 @@ type Config struct {
 	CertChain            *credentials.CertChain
 	AppSSL               bool
 	MaxRequestBodySize   int
+	// GracefulShutdownDuration is the time Dapr waits for outstanding operations to finish on shutdown
+	GracefulShutdownDuration time.Duration
+	// AppHealthCheckPath is the HTTP path polled on startup until the app reports healthy
+	AppHealthCheckPath string
+	// AppTLSClientCertFile and AppTLSClientKeyFile hold the client certificate presented to the app
+	// when it is reached over TLS
+	AppTLSClientCertFile string
+	AppTLSClientKeyFile  string
+	// ShutdownOnAppExit shuts Dapr down once the app processes sharing its process namespace exit
+	ShutdownOnAppExit bool
+	// AppExitIgnoredProcesses are the names of the processes, such as the processes of other
+	// sidecars, that aren't waited for when shutting down on app exit
+	AppExitIgnoredProcesses []string
 }
 
 // NewRuntimeConfig returns a new runtime config
@@ -85,5 +102,7 @@ func NewRuntimeConfig(
 		SentryServiceAddress: sentryAddress,
 		AppSSL:               appSSL,
 		MaxRequestBodySize:   maxRequestBodySize,
+
+		GracefulShutdownDuration: DefaultGracefulShutdownDuration,
 	}
 }
@@ -34,4 +34,5 @@ func TestNewConfig(t *testing.T) {
 	assert.Equal(t, "localhost:5052", c.SentryServiceAddress)
 	assert.Equal(t, true, c.AppSSL)
 	assert.Equal(t, 4, c.MaxRequestBodySize)
+	assert.Equal(t, DefaultGracefulShutdownDuration, c.GracefulShutdownDuration)
 }
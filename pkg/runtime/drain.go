@@ -0,0 +1,55 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation and Dapr Contributors.
+// Licensed under the MIT License.
+// ------------------------------------------------------------
+
+package runtime
+
+import (
+	"flag"
+	"fmt"
+	nethttp "net/http"
+	"time"
+
+	"github.com/dapr/dapr/pkg/runtime/security"
+	"github.com/pkg/errors"
+)
+
+// DrainCommand is the daprd subcommand run by the preStop hook of the sidecar.
+const DrainCommand = "drain"
+
+// Drain asks the Dapr instance listening on the local HTTP port to stop reporting ready, then
+// waits until the given number of seconds has passed. Dapr holds the request for at most its
+// graceful shutdown duration, the rest of the wait happens here.
+func Drain(args []string) error {
+	flags := flag.NewFlagSet(DrainCommand, flag.ContinueOnError)
+	daprHTTPPort := flags.Int("dapr-http-port", DefaultDaprHTTPPort, "HTTP port of the Dapr API to drain")
+	seconds := flags.Int("seconds", 0, "Time in seconds to wait before returning")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *seconds < 0 {
+		return errors.Errorf("invalid value for seconds: %d", *seconds)
+	}
+
+	deadline := time.Now().Add(time.Duration(*seconds) * time.Second)
+	url := fmt.Sprintf("http://127.0.0.1:%d/v1.0/drain?seconds=%d", *daprHTTPPort, *seconds)
+	req, err := nethttp.NewRequest(nethttp.MethodPost, url, nil)
+	if err != nil {
+		return err
+	}
+	if token := security.GetAPIToken(); token != "" {
+		req.Header.Set(security.APITokenHeader, token)
+	}
+	resp, err := nethttp.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to drain dapr")
+	}
+	resp.Body.Close()
+	if resp.StatusCode != nethttp.StatusNoContent {
+		return errors.Errorf("failed to drain dapr: unexpected status code %d", resp.StatusCode)
+	}
+
+	time.Sleep(time.Until(deadline))
+	return nil
+}
@@ -0,0 +1,53 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation and Dapr Contributors.
+// Licensed under the MIT License.
+// ------------------------------------------------------------
+
+package runtime
+
+import (
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/dapr/dapr/pkg/runtime/security"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrain(t *testing.T) {
+	var req *nethttp.Request
+	status := nethttp.StatusNoContent
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		req = r
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	assert.NoError(t, err)
+
+	os.Setenv(security.APITokenEnvVar, "1234")
+	defer os.Unsetenv(security.APITokenEnvVar)
+
+	t.Run("drain the local dapr", func(t *testing.T) {
+		err := Drain([]string{"--dapr-http-port", u.Port(), "--seconds", "0"})
+		assert.NoError(t, err)
+		assert.Equal(t, nethttp.MethodPost, req.Method)
+		assert.Equal(t, "/v1.0/drain", req.URL.Path)
+		assert.Equal(t, "0", req.URL.Query().Get("seconds"))
+		assert.Equal(t, "1234", req.Header.Get(security.APITokenHeader))
+	})
+
+	t.Run("rejected drain", func(t *testing.T) {
+		status = nethttp.StatusForbidden
+		defer func() { status = nethttp.StatusNoContent }()
+		err := Drain([]string{"--dapr-http-port", u.Port(), "--seconds", "0"})
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid seconds", func(t *testing.T) {
+		err := Drain([]string{"--dapr-http-port", u.Port(), "--seconds", "-1"})
+		assert.Error(t, err)
+	})
+}
@@ -7,6 +7,7 @@ package runtime
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -76,6 +77,10 @@ const (
 	bindingsConcurrencyParallel   = "parallel"
 	bindingsConcurrencySequential = "sequential"
 	pubsubName                    = "pubsubName"
+
+	// appHealthCheckLogInterval is how often the result of the app health check is logged while
+	// waiting on the app to report healthy.
+	appHealthCheckLogInterval = 10 * time.Second
 )
 
 type ComponentCategory string
@@ -208,6 +213,9 @@ func (a *DaprRuntime) Run(opts ...Option) error {
 	if a.daprHTTPAPI != nil {
 		// gRPC server start failure is logged as Fatal in initRuntime method. Setting the status only when runtime is initialized.
 		a.daprHTTPAPI.MarkStatusAsReady()
+		// The components are only reported ready once the app channel, direct messaging and
+		// actors that serve requests through them are initialized as well.
+		a.daprHTTPAPI.MarkComponentsAsReady()
 	}
 
 	return nil
@@ -693,7 +701,7 @@ func (a *DaprRuntime) readFromBinding(name string, binding bindings.InputBinding
 
 func (a *DaprRuntime) startHTTPServer(port, profilePort int, allowedOrigins string, pipeline http_middleware.Pipeline) {
 	a.daprHTTPAPI = http.NewAPI(a.runtimeConfig.ID, a.appChannel, a.directMessaging, a.components, a.stateStores, a.secretStores,
-		a.secretsConfiguration, a.getPublishAdapter(), a.actor, a.sendToOutputBinding, a.globalConfig.Spec.TracingSpec)
+		a.secretsConfiguration, a.getPublishAdapter(), a.actor, a.sendToOutputBinding, a.globalConfig.Spec.TracingSpec, a.runtimeConfig.GracefulShutdownDuration)
 	serverConf := http.NewServerConfig(a.runtimeConfig.ID, a.hostAddress, port, profilePort, allowedOrigins, a.runtimeConfig.EnableProfiling, a.runtimeConfig.MaxRequestBodySize)
 
 	server := http.NewServer(a.daprHTTPAPI, serverConf, a.globalConfig.Spec.TracingSpec, a.globalConfig.Spec.MetricSpec, pipeline)
@@ -1451,6 +1459,11 @@ func (a *DaprRuntime) Stop() {
 	}
 }
 
+// GracefulShutdownDuration returns the time to wait for outstanding operations to finish on shutdown.
+func (a *DaprRuntime) GracefulShutdownDuration() time.Duration {
+	return a.runtimeConfig.GracefulShutdownDuration
+}
+
 func (a *DaprRuntime) processComponentSecrets(component components_v1alpha1.Component) (components_v1alpha1.Component, string) {
 	cache := map[string]secretstores.GetSecretResponse{}
 
@@ -1536,6 +1549,56 @@ func (a *DaprRuntime) blockUntilAppIsReady() {
 	}
 
 	log.Infof("application discovered on port %v", a.runtimeConfig.ApplicationPort)
+
+	a.blockUntilAppIsHealthy()
+}
+
+// blockUntilAppIsHealthy polls the app health check path, if configured, until it returns a success status.
+// The app is called with the TLS settings of the app channel, and the last result is logged periodically
+// so that a misconfigured health check path doesn't block silently.
+func (a *DaprRuntime) blockUntilAppIsHealthy() {
+	if a.runtimeConfig.AppHealthCheckPath == "" || a.runtimeConfig.ApplicationProtocol != HTTPProtocol {
+		return
+	}
+
+	scheme := "http"
+	client := &nethttp.Client{Timeout: time.Second}
+	if a.runtimeConfig.AppSSL {
+		scheme = "https"
+		clientCerts, err := a.getAppTLSClientCerts()
+		if err != nil {
+			log.Warnf("calling the application health check without a client certificate: %s", err)
+		}
+		// The app serves on the loopback interface, and is verified the same way as by the app channel.
+		// nolint:gosec
+		client.Transport = &nethttp.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true, Certificates: clientCerts}}
+	}
+	url := fmt.Sprintf("%s://127.0.0.1:%v/%s", scheme, a.runtimeConfig.ApplicationPort, strings.TrimPrefix(a.runtimeConfig.AppHealthCheckPath, "/"))
+
+	log.Infof("waiting on the application health check at %s. This will block until the app reports healthy.", url)
+	start := time.Now()
+	lastLog := start
+	for {
+		var result string
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				break
+			}
+			result = fmt.Sprintf("status code %d", resp.StatusCode)
+		} else {
+			result = err.Error()
+		}
+
+		if time.Since(lastLog) >= appHealthCheckLogInterval {
+			log.Warnf("still waiting on the application health check at %s after %s, last result: %s", url, time.Since(start).Round(time.Second), result)
+			lastLog = time.Now()
+		}
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	log.Info("application reported healthy")
 }
 
 func (a *DaprRuntime) loadAppConfiguration() {
@@ -1603,7 +1666,7 @@ func (a *DaprRuntime) getConfigurationGRPC() (*config.ApplicationConfig, error)
 
 func (a *DaprRuntime) createAppChannel() error {
 	if a.runtimeConfig.ApplicationPort > 0 {
-		var channelCreatorFn func(port, maxConcurrency int, spec config.TracingSpec, sslEnabled bool) (channel.AppChannel, error)
+		var channelCreatorFn func(port, maxConcurrency int, spec config.TracingSpec, sslEnabled bool, clientCerts ...tls.Certificate) (channel.AppChannel, error)
 
 		switch a.runtimeConfig.ApplicationProtocol {
 		case GRPCProtocol:
@@ -1614,7 +1677,12 @@ func (a *DaprRuntime) createAppChannel() error {
 			return errors.Errorf("cannot create app channel for protocol %s", string(a.runtimeConfig.ApplicationProtocol))
 		}
 
-		ch, err := channelCreatorFn(a.runtimeConfig.ApplicationPort, a.runtimeConfig.MaxConcurrency, a.globalConfig.Spec.TracingSpec, a.runtimeConfig.AppSSL)
+		clientCerts, err := a.getAppTLSClientCerts()
+		if err != nil {
+			return err
+		}
+
+		ch, err := channelCreatorFn(a.runtimeConfig.ApplicationPort, a.runtimeConfig.MaxConcurrency, a.globalConfig.Spec.TracingSpec, a.runtimeConfig.AppSSL, clientCerts...)
 		if err != nil {
 			return err
 		}
@@ -1627,6 +1695,18 @@ func (a *DaprRuntime) createAppChannel() error {
 	return nil
 }
 
+// getAppTLSClientCerts returns the client certificates presented to the app when SSL is enabled.
+func (a *DaprRuntime) getAppTLSClientCerts() ([]tls.Certificate, error) {
+	if a.runtimeConfig.AppTLSClientCertFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(a.runtimeConfig.AppTLSClientCertFile, a.runtimeConfig.AppTLSClientKeyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load the app TLS client certificate")
+	}
+	return []tls.Certificate{cert}, nil
+}
+
 func (a *DaprRuntime) appendBuiltinSecretStore() {
 	for _, comp := range a.builtinSecretStore() {
 		a.pendingComponents <- comp
@@ -11,10 +11,12 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -2427,3 +2429,146 @@ func TestInitBindings(t *testing.T) {
 		assert.NoError(t, err)
 	})
 }
+
+func TestBlockUntilAppIsHealthy(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/healthz", r.URL.Path)
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	port, err := strconv.Atoi(strings.Split(server.Listener.Addr().String(), ":")[1])
+	assert.NoError(t, err)
+
+	rt := NewTestDaprRuntimeWithProtocol(modes.StandaloneMode, string(HTTPProtocol), port)
+	rt.runtimeConfig.AppHealthCheckPath = "/healthz"
+
+	done := make(chan struct{})
+	go func() {
+		rt.blockUntilAppIsReady()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	case <-time.After(10 * time.Second):
+		assert.Fail(t, "timed out waiting for the app to report healthy")
+	}
+}
+
+func TestBlockUntilAppIsHealthyWithSSL(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	port, err := strconv.Atoi(strings.Split(server.Listener.Addr().String(), ":")[1])
+	assert.NoError(t, err)
+
+	rt := NewTestDaprRuntimeWithProtocol(modes.StandaloneMode, string(HTTPProtocol), port)
+	rt.runtimeConfig.AppHealthCheckPath = "/healthz"
+	rt.runtimeConfig.AppSSL = true
+
+	done := make(chan struct{})
+	go func() {
+		rt.blockUntilAppIsHealthy()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		assert.Fail(t, "timed out waiting for the app to report healthy")
+	}
+}
+
+func TestGetAppTLSClientCerts(t *testing.T) {
+	rt := NewTestDaprRuntime(modes.StandaloneMode)
+
+	t.Run("no client certificate", func(t *testing.T) {
+		certs, err := rt.getAppTLSClientCerts()
+		assert.NoError(t, err)
+		assert.Empty(t, certs)
+	})
+
+	t.Run("missing client certificate", func(t *testing.T) {
+		rt.runtimeConfig.AppTLSClientCertFile = "/missing/tls.crt"
+		rt.runtimeConfig.AppTLSClientKeyFile = "/missing/tls.key"
+		defer func() {
+			rt.runtimeConfig.AppTLSClientCertFile = ""
+			rt.runtimeConfig.AppTLSClientKeyFile = ""
+		}()
+		_, err := rt.getAppTLSClientCerts()
+		assert.Error(t, err)
+	})
+}
+
+func TestComponentsReadiness(t *testing.T) {
+	ports := make([]int, 4)
+	for i := range ports {
+		port, err := freeport.GetFreePort()
+		assert.NoError(t, err)
+		ports[i] = port
+	}
+	httpPort, apiGRPCPort, internalGRPCPort, appPort := ports[0], ports[1], ports[2], ports[3]
+
+	rt := NewTestDaprRuntimeWithProtocol(modes.StandaloneMode, string(HTTPProtocol), appPort)
+	rt.runtimeConfig.HTTPPort = httpPort
+	rt.runtimeConfig.APIGRPCPort = apiGRPCPort
+	rt.runtimeConfig.InternalGRPCPort = internalGRPCPort
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- rt.Run()
+	}()
+
+	client := &http.Client{Timeout: time.Second}
+	componentsURL := fmt.Sprintf("http://127.0.0.1:%d/v1.0/healthz/components", httpPort)
+	getStatusCode := func() int {
+		resp, err := client.Get(componentsURL)
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// The HTTP server is started while daprd still waits for the app to listen on its port, before
+	// the app channel is created.
+	assert.Eventually(t, func() bool {
+		return getStatusCode() != 0
+	}, 10*time.Second, 10*time.Millisecond)
+	select {
+	case err := <-runErr:
+		assert.Fail(t, "daprd finished initializing without the app", "error: %v", err)
+	default:
+	}
+	assert.Equal(t, http.StatusInternalServerError, getStatusCode())
+
+	lis, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", appPort))
+	assert.NoError(t, err)
+	app := &httptest.Server{
+		Listener: lis,
+		Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		})},
+	}
+	app.Start()
+	defer app.Close()
+
+	select {
+	case err := <-runErr:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		assert.Fail(t, "timed out waiting for daprd to initialize")
+		return
+	}
+	assert.NotNil(t, rt.appChannel)
+	assert.Equal(t, http.StatusNoContent, getStatusCode())
+}
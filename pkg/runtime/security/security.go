@@ -5,6 +5,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"io/ioutil"
 	"os"
 
 	"github.com/dapr/dapr/pkg/credentials"
@@ -34,6 +35,27 @@ func GetCertChain() (*credentials.CertChain, error) {
 	if trustAnchors == "" {
 		return nil, errors.Errorf("couldn't find trust anchors in environment variable %s", certs.TrustAnchorsEnvVar)
 	}
+	return getCertChainFromEnv([]byte(trustAnchors))
+}
+
+// GetCertChainWithTrustAnchorsFile returns the cert chain with the trust anchors read from the
+// given file instead of the environment, for trust bundles too large to be passed as an
+// environment variable. The trust anchors are read from the environment when the path is empty.
+func GetCertChainWithTrustAnchorsFile(trustAnchorsFile string) (*credentials.CertChain, error) {
+	if trustAnchorsFile == "" {
+		return GetCertChain()
+	}
+	trustAnchors, err := ioutil.ReadFile(trustAnchorsFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't read trust anchors from file %s", trustAnchorsFile)
+	}
+	if len(trustAnchors) == 0 {
+		return nil, errors.Errorf("trust anchors file %s is empty", trustAnchorsFile)
+	}
+	return getCertChainFromEnv(trustAnchors)
+}
+
+func getCertChainFromEnv(trustAnchors []byte) (*credentials.CertChain, error) {
 	cert := os.Getenv(certs.CertChainEnvVar)
 	if cert == "" {
 		return nil, errors.Errorf("couldn't find cert chain in environment variable %s", certs.CertChainEnvVar)
@@ -43,7 +65,7 @@ func GetCertChain() (*credentials.CertChain, error) {
 		return nil, errors.Errorf("couldn't find cert key in environment variable %s", certs.CertKeyEnvVar)
 	}
 	return &credentials.CertChain{
-		RootCA: []byte(trustAnchors),
+		RootCA: trustAnchors,
 		Cert:   []byte(cert),
 		Key:    []byte(key),
 	}, nil
@@ -1,7 +1,9 @@
 package security
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"runtime"
 	"testing"
 
@@ -48,6 +50,46 @@ func TestGetTrustAnchors(t *testing.T) {
 	})
 }
 
+func TestGetCertChainWithTrustAnchorsFile(t *testing.T) {
+	t.Run("trust anchors read from file", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "trust-anchors")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+		trustAnchorsFile := filepath.Join(dir, "ca.crt")
+		assert.NoError(t, ioutil.WriteFile(trustAnchorsFile, []byte(testRootCert), 0600))
+
+		os.Setenv(certs.TrustAnchorsEnvVar, "111")
+		os.Setenv(certs.CertChainEnvVar, "111")
+		os.Setenv(certs.CertKeyEnvVar, "111")
+		defer os.Clearenv()
+
+		certChain, err := GetCertChainWithTrustAnchorsFile(trustAnchorsFile)
+		assert.NoError(t, err)
+		assert.Equal(t, testRootCert, string(certChain.RootCA))
+		assert.Equal(t, "111", string(certChain.Cert))
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		os.Setenv(certs.CertChainEnvVar, "111")
+		os.Setenv(certs.CertKeyEnvVar, "111")
+		defer os.Clearenv()
+
+		_, err := GetCertChainWithTrustAnchorsFile(filepath.Join(os.TempDir(), "missing-trust-anchors.crt"))
+		assert.Error(t, err)
+	})
+
+	t.Run("trust anchors read from env without a file", func(t *testing.T) {
+		os.Setenv(certs.TrustAnchorsEnvVar, testRootCert)
+		os.Setenv(certs.CertChainEnvVar, "111")
+		os.Setenv(certs.CertKeyEnvVar, "111")
+		defer os.Clearenv()
+
+		certChain, err := GetCertChainWithTrustAnchorsFile("")
+		assert.NoError(t, err)
+		assert.Equal(t, testRootCert, string(certChain.RootCA))
+	})
+}
+
 func TestGenerateSidecarCSR(t *testing.T) {
 	// can't run this on Windows build agents, GH actions fails with "CryptAcquireContext: Provider DLL failed to initialize correctly."
 	if runtime.GOOS == "windows" {
@@ -1,6 +1,7 @@
 package security
 
 import (
+	"io/ioutil"
 	"os"
 	"strings"
 )
@@ -10,6 +11,8 @@ const (
 	// APITokenEnvVar is the environment variable for the api token
 	APITokenEnvVar    = "DAPR_API_TOKEN"
 	AppAPITokenEnvVar = "APP_API_TOKEN"
+	// AppAPITokenFileEnvVar is the environment variable for the path of a file holding the app api token
+	AppAPITokenFileEnvVar = "APP_API_TOKEN_FILE"
 	// APITokenHeader is header name for http/gRPC calls to hold the token
 	APITokenHeader = "dapr-api-token"
 )
@@ -21,9 +24,19 @@ func GetAPIToken() string {
 	return os.Getenv(APITokenEnvVar)
 }
 
-// GetAppToken returns the value of the app api token from an environment variable
+// GetAppToken returns the value of the app api token from an environment variable,
+// falling back to the file referenced by AppAPITokenFileEnvVar
 func GetAppToken() string {
-	return os.Getenv(AppAPITokenEnvVar)
+	if token := os.Getenv(AppAPITokenEnvVar); token != "" {
+		return token
+	}
+	if path := os.Getenv(AppAPITokenFileEnvVar); path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err == nil {
+			return strings.TrimSpace(string(b))
+		}
+	}
+	return ""
 }
 
 // ExcludedRoute returns whether a given route should be excluded from a token check
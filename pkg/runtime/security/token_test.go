@@ -1,6 +1,7 @@
 package security
 
 import (
+	"io/ioutil"
 	"os"
 	"testing"
 
@@ -39,6 +40,21 @@ func TestAppToken(t *testing.T) {
 		token := GetAppToken()
 		assert.Equal(t, "", token)
 	})
+
+	t.Run("token file", func(t *testing.T) {
+		f, err := ioutil.TempFile("", "app-token")
+		assert.NoError(t, err)
+		defer os.Remove(f.Name())
+		_, err = f.WriteString("file-token\n")
+		assert.NoError(t, err)
+		f.Close()
+
+		os.Setenv(AppAPITokenFileEnvVar, f.Name())
+		defer os.Clearenv()
+
+		apitoken := GetAppToken()
+		assert.Equal(t, "file-token", apitoken)
+	})
 }
 
 func TestExcludedRoute(t *testing.T) {
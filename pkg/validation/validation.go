@@ -20,8 +20,34 @@ const (
 	dns1123LabelMaxLength int    = 63
 )
 
+const (
+	// AppIDNamespacingPrefix prefixes the app ID with the namespace.
+	AppIDNamespacingPrefix = "prefix"
+	// AppIDNamespacingSuffix suffixes the app ID with the namespace.
+	AppIDNamespacingSuffix = "suffix"
+)
+
 var dns1123LabelRegexp = regexp.MustCompile("^" + dns1123LabelFmt + "$")
 
+// GetKubernetesAppID returns the app ID of a Dapr app on Kubernetes, prefixed or suffixed with its
+// namespace according to the namespacing mode read from the namespacingKey annotation. The sidecar,
+// its Service and name resolution all rely on this ID, so it's validated as a DNS label.
+func GetKubernetesAppID(appID, namespacing, namespacingKey, namespace string) (string, error) {
+	switch namespacing {
+	case "":
+	case AppIDNamespacingPrefix:
+		appID = namespace + "-" + appID
+	case AppIDNamespacingSuffix:
+		appID = appID + "-" + namespace
+	default:
+		return "", errors.Errorf("invalid value for %s: %s, must be %s or %s", namespacingKey, namespacing, AppIDNamespacingPrefix, AppIDNamespacingSuffix)
+	}
+	if err := ValidateKubernetesAppID(appID); err != nil {
+		return "", err
+	}
+	return appID, nil
+}
+
 // ValidateKubernetesAppID returns a bool that indicates whether a dapr app id is valid for the Kubernetes platform.
 func ValidateKubernetesAppID(appID string) error {
 	if appID == "" {
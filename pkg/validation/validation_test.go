@@ -6,6 +6,7 @@
 package validation
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -45,3 +46,33 @@ func TestValidationForKubernetes(t *testing.T) {
 		assert.Regexp(t, "value for the dapr.io/app-id annotation is empty", err.Error())
 	})
 }
+
+func TestGetKubernetesAppID(t *testing.T) {
+	t.Run("no namespacing", func(t *testing.T) {
+		id, err := GetKubernetesAppID("app", "", "dapr.io/app-id-namespacing", "ns")
+		assert.NoError(t, err)
+		assert.Equal(t, "app", id)
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		id, err := GetKubernetesAppID("app", AppIDNamespacingPrefix, "dapr.io/app-id-namespacing", "ns")
+		assert.NoError(t, err)
+		assert.Equal(t, "ns-app", id)
+	})
+
+	t.Run("suffix", func(t *testing.T) {
+		id, err := GetKubernetesAppID("app", AppIDNamespacingSuffix, "dapr.io/app-id-namespacing", "ns")
+		assert.NoError(t, err)
+		assert.Equal(t, "app-ns", id)
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		_, err := GetKubernetesAppID("app", "infix", "dapr.io/app-id-namespacing", "ns")
+		assert.Error(t, err)
+	})
+
+	t.Run("namespaced id too long", func(t *testing.T) {
+		_, err := GetKubernetesAppID(strings.Repeat("a", 62), AppIDNamespacingSuffix, "dapr.io/app-id-namespacing", "ns")
+		assert.Error(t, err)
+	})
+}